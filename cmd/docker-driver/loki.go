@@ -70,6 +70,8 @@ func (l *loki) Name() string {
 
 // Log implements `logger.Logger`
 func (l *loki) Close() error {
+	// the entries held by the pipeline are sent before the client stops.
+	api.StopEntryHandler(l.handler)
 	l.client.Stop()
 	return nil
 }
@@ -0,0 +1,199 @@
+package chunkenc
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/cortexproject/cortex/pkg/chunk/encoding"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/loki/pkg/logql"
+)
+
+const (
+	// bloomMagicNumber starts the bloom filters section written after the chunk header.
+	// Readers not knowing about the section ignore it as blocks are located using their offsets.
+	bloomMagicNumber = uint32(0xB1003F17)
+	// bloomFiltersMagicNumber starts the bloom filters of a chunk stored next to it.
+	bloomFiltersMagicNumber = uint32(0xB1003F18)
+
+	// bloomTokenLength is the length of the n-grams added to the bloom filters.
+	bloomTokenLength = 4
+	// bloomBitsPerToken and bloomHashes give a false positive rate of about 2% per n-gram.
+	bloomBitsPerToken = 8
+	bloomHashes       = 5
+	bloomMinBits      = 64
+)
+
+// tokenBloom is a bloom filter of the n-grams of the lines of a block.
+type tokenBloom []byte
+
+// newTokenBloom returns the bloom filter of the n-grams of the given entries.
+func newTokenBloom(entries []entry) tokenBloom {
+	tokens := map[uint32]struct{}{}
+	for _, e := range entries {
+		for i := 0; i+bloomTokenLength <= len(e.s); i++ {
+			tokens[token(e.s[i], e.s[i+1], e.s[i+2], e.s[i+3])] = struct{}{}
+		}
+	}
+
+	bits := len(tokens) * bloomBitsPerToken
+	if bits < bloomMinBits {
+		bits = bloomMinBits
+	}
+	b := make(tokenBloom, (bits+7)/8)
+	for t := range tokens {
+		b.add(t)
+	}
+	return b
+}
+
+func token(b0, b1, b2, b3 byte) uint32 {
+	return uint32(b0) | uint32(b1)<<8 | uint32(b2)<<16 | uint32(b3)<<24
+}
+
+// positions calls f with the bit positions of the token, using double hashing.
+func (b tokenBloom) positions(t uint32, f func(pos uint32) bool) {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], t)
+	h := xxhash.Sum64(buf[:])
+	h1, h2 := uint32(h), uint32(h>>32)|1
+	m := uint32(len(b) * 8)
+	for i := uint32(0); i < bloomHashes; i++ {
+		if !f((h1 + i*h2) % m) {
+			return
+		}
+	}
+}
+
+func (b tokenBloom) add(t uint32) {
+	b.positions(t, func(pos uint32) bool {
+		b[pos/8] |= 1 << (pos % 8)
+		return true
+	})
+}
+
+func (b tokenBloom) test(t uint32) bool {
+	found := true
+	b.positions(t, func(pos uint32) bool {
+		found = b[pos/8]&(1<<(pos%8)) != 0
+		return found
+	})
+	return found
+}
+
+// mayContain returns false if none of the lines of the block contains the literal.
+func (b tokenBloom) mayContain(literal []byte) bool {
+	for i := 0; i+bloomTokenLength <= len(literal); i++ {
+		if !b.test(token(literal[i], literal[i+1], literal[i+2], literal[i+3])) {
+			return false
+		}
+	}
+	return true
+}
+
+// MayMatch returns false if the bloom filters and metadata of the blocks of the chunk tell the filter can't match
+// any of its lines between from and through.
+// It is a helper function to hide the type assertion kludge when wanting to skip chunks of the Cortex interface encoding.Chunk.
+func MayMatch(c encoding.Chunk, fromT, throughT time.Time, filter logql.LineFilter) bool {
+	f := NewBloomFilters(c)
+	return f == nil || f.MayMatch(fromT, throughT, filter)
+}
+
+// BloomFilters are the bloom filters and metadata of the blocks of a chunk. They are stored next to the chunk,
+// so that queries can tell whether their line filters can match the chunk without fetching it.
+type BloomFilters struct {
+	blocks []block
+}
+
+// NewBloomFilters returns the bloom filters of the blocks of the chunk, nil if it has none or if it
+// still has a head block.
+func NewBloomFilters(c encoding.Chunk) *BloomFilters {
+	f, ok := c.(*Facade)
+	if !ok {
+		return nil
+	}
+	mc, ok := f.c.(*MemChunk)
+	if !ok || !mc.head.isEmpty() || !mc.hasBloomFilters() {
+		return nil
+	}
+	blocks := make([]block, 0, len(mc.blocks))
+	for _, b := range mc.blocks {
+		blocks = append(blocks, block{
+			mint:      b.mint,
+			maxt:      b.maxt,
+			bloom:     b.bloom,
+			blockMeta: blockMeta{maxLineLength: b.maxLineLength},
+		})
+	}
+	return &BloomFilters{blocks: blocks}
+}
+
+// MayMatch returns false if the filter can't match any line of the chunk between from and through.
+func (f *BloomFilters) MayMatch(fromT, throughT time.Time, filter logql.LineFilter) bool {
+	if filter == nil {
+		return true
+	}
+	from, through := fromT.UnixNano(), throughT.UnixNano()
+	for _, b := range f.blocks {
+		if through < b.mint || b.maxt < from {
+			continue
+		}
+		if b.mayMatch(filter) {
+			return true
+		}
+	}
+	return false
+}
+
+// Bytes encodes the bloom filters, they are decoded by DecodeBloomFilters.
+func (f *BloomFilters) Bytes() []byte {
+	eb := encbuf{b: make([]byte, 0, 64)}
+	eb.putBE32(bloomFiltersMagicNumber)
+	eb.putUvarint(len(f.blocks))
+	for _, b := range f.blocks {
+		eb.putVarint64(b.mint)
+		eb.putVarint64(b.maxt)
+		eb.putUvarint(b.maxLineLength)
+		eb.putUvarint(len(b.bloom))
+		eb.putBytes(b.bloom)
+	}
+	crc32Hash := newCRC32()
+	_, _ = crc32Hash.Write(eb.get())
+	eb.putHash(crc32Hash)
+	return eb.get()
+}
+
+// DecodeBloomFilters decodes the bloom filters encoded by BloomFilters.Bytes.
+func DecodeBloomFilters(b []byte) (*BloomFilters, error) {
+	if len(b) < 4 {
+		return nil, ErrInvalidSize
+	}
+	data := b[:len(b)-4]
+	if binary.BigEndian.Uint32(b[len(b)-4:]) != crc32.Checksum(data, castagnoliTable) {
+		return nil, ErrInvalidChecksum
+	}
+	db := decbuf{b: data}
+	if m := db.be32(); m != bloomFiltersMagicNumber {
+		return nil, errors.Errorf("invalid bloom filters magic number %x", m)
+	}
+	num := db.uvarint()
+	if db.err() != nil || num > len(data) {
+		return nil, ErrInvalidSize
+	}
+	f := &BloomFilters{blocks: make([]block, num)}
+	for i := range f.blocks {
+		f.blocks[i].mint = db.varint64()
+		f.blocks[i].maxt = db.varint64()
+		f.blocks[i].maxLineLength = db.uvarint()
+		if l := db.uvarint(); l > 0 {
+			f.blocks[i].bloom = db.bytes(l)
+		}
+	}
+	if db.err() != nil {
+		return nil, errors.Wrap(db.err(), "decoding bloom filters")
+	}
+	return f, nil
+}
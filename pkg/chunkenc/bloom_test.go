@@ -0,0 +1,116 @@
+package chunkenc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/grafana/loki/pkg/logql"
+)
+
+func TestTokenBloom(t *testing.T) {
+	b := newTokenBloom([]entry{{0, "level=info traceID=2107b6b551458908"}, {1, "msg=hi"}})
+
+	require.True(t, b.mayContain([]byte("traceID=2107b6b551458908")))
+	require.True(t, b.mayContain([]byte("info")))
+	// literals shorter than the n-grams may always be contained.
+	require.True(t, b.mayContain([]byte("hi")))
+	require.False(t, b.mayContain([]byte("traceID=e0cc9e1a8c39e8b1")))
+	require.False(t, b.mayContain([]byte("level=error")))
+}
+
+func lineFilter(t *testing.T, filter string) logql.LineFilter {
+	expr, err := logql.ParseLogSelector(`{app="foo"} ` + filter)
+	require.NoError(t, err)
+	f, err := expr.Filter()
+	require.NoError(t, err)
+	return f
+}
+
+func TestMemChunk_BloomFilters(t *testing.T) {
+	for _, enc := range testEncoding {
+		t.Run(enc.String(), func(t *testing.T) {
+			chk := NewMemChunk(enc, testBlockSize, testTargetSize)
+			chk.EnableBloomFilters()
+			for i := 0; i < 1000; i++ {
+				if i == 500 {
+					require.NoError(t, chk.cut())
+				}
+				require.NoError(t, chk.Append(logprotoEntry(int64(i), fmt.Sprintf("block=%d line=%d", i/500, i))))
+			}
+
+			b, err := chk.Bytes()
+			require.NoError(t, err)
+			bc, err := NewByteChunk(b, testBlockSize, testTargetSize)
+			require.NoError(t, err)
+			require.Equal(t, 2, bc.BlockCount())
+
+			count := func(filter logql.LineFilter) int {
+				it, err := bc.Iterator(context.Background(), time.Unix(0, 0), time.Unix(0, math.MaxInt64), logproto.FORWARD, filter)
+				require.NoError(t, err)
+				n := 0
+				for it.Next() {
+					n++
+				}
+				require.NoError(t, it.Close())
+				return n
+			}
+			require.Equal(t, 1000, count(nil))
+			require.Equal(t, 1, count(lineFilter(t, `|= "line=742"`)))
+			require.Equal(t, 0, count(lineFilter(t, `|= "missing"`)))
+
+			facade := NewFacade(bc, testBlockSize, testTargetSize)
+			require.True(t, MayMatch(facade, time.Unix(0, 0), time.Unix(0, math.MaxInt64), lineFilter(t, `|= "line=742"`)))
+			require.True(t, MayMatch(facade, time.Unix(0, 0), time.Unix(0, math.MaxInt64), lineFilter(t, `!= "line=742"`)))
+			require.False(t, MayMatch(facade, time.Unix(0, 0), time.Unix(0, math.MaxInt64), lineFilter(t, `|= "missing"`)))
+			// the line is in the second block.
+			require.False(t, MayMatch(facade, time.Unix(0, 0), time.Unix(0, 499), lineFilter(t, `|= "line=742"`)))
+
+			// the bloom filters stored next to the chunk tell the same.
+			filters := NewBloomFilters(facade)
+			require.NotNil(t, filters)
+			encoded := filters.Bytes()
+			decoded, err := DecodeBloomFilters(encoded)
+			require.NoError(t, err)
+			require.True(t, decoded.MayMatch(time.Unix(0, 0), time.Unix(0, math.MaxInt64), lineFilter(t, `|= "line=742"`)))
+			require.False(t, decoded.MayMatch(time.Unix(0, 0), time.Unix(0, math.MaxInt64), lineFilter(t, `|= "missing"`)))
+			require.False(t, decoded.MayMatch(time.Unix(0, 0), time.Unix(0, 499), lineFilter(t, `|= "line=742"`)))
+			encoded[len(encoded)/2]++
+			_, err = DecodeBloomFilters(encoded)
+			require.Error(t, err)
+
+			// the bloom filters are kept when checkpointing.
+			cb, head, err := chk.CheckpointBytes()
+			require.NoError(t, err)
+			restored, err := NewMemChunkFromCheckpoint(cb, head, false, testBlockSize, testTargetSize)
+			require.NoError(t, err)
+			require.True(t, restored.bloomFilters)
+			require.NotNil(t, restored.blocks[0].bloom)
+		})
+	}
+}
+
+func TestMemChunk_InvalidBloomFilters(t *testing.T) {
+	chk := NewMemChunk(EncGZIP, testBlockSize, testTargetSize)
+	chk.EnableBloomFilters()
+	require.NoError(t, chk.Append(logprotoEntry(1, "foo bar")))
+
+	b, err := chk.Bytes()
+	require.NoError(t, err)
+	// corrupt the bloom filters section, the chunk is still readable without it.
+	b[10]++
+	bc, err := NewByteChunk(b, testBlockSize, testTargetSize)
+	require.NoError(t, err)
+	require.Equal(t, 1, bc.BlockCount())
+	require.Nil(t, bc.blocks[0].bloom)
+
+	it, err := bc.Iterator(context.Background(), time.Unix(0, 0), time.Unix(0, math.MaxInt64), logproto.FORWARD, lineFilter(t, `|= "missing"`))
+	require.NoError(t, err)
+	require.False(t, it.Next())
+	require.NoError(t, it.Close())
+}
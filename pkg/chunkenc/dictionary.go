@@ -0,0 +1,266 @@
+package chunkenc
+
+import (
+	"encoding/binary"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// dictionarySegmentSize is the length of the segments of the samples a dictionary is made of.
+	dictionarySegmentSize = 64
+	// dictionaryDmerSize is the length of the substrings whose frequency gives the score of a segment.
+	dictionaryDmerSize = 8
+	// dictionaryFrequencyBits is the log2 of the size of the table counting the substrings, collisions are ignored.
+	dictionaryFrequencyBits = 20
+
+	// DictionarySamplesRatio is the number of bytes of samples used to train a dictionary, relative to its size.
+	DictionarySamplesRatio = 100
+	// DictionarySampleInterval is the number of lines added to a trainer for each line it samples.
+	DictionarySampleInterval = 16
+)
+
+// TrainDictionary returns a raw content dictionary of at most size bytes made of the segments of the samples
+// which have the most frequent substrings, following the COVER algorithm used by Zstandard.
+// The best segments are put at the end of the dictionary where they are the cheapest to reference.
+func TrainDictionary(samples [][]byte, size int) []byte {
+	var data []byte
+	for _, s := range samples {
+		data = append(data, s...)
+	}
+	if size <= 0 || len(data) < dictionarySegmentSize {
+		return nil
+	}
+	if len(data) <= size {
+		return data
+	}
+
+	freqs := make([]uint32, 1<<dictionaryFrequencyBits)
+	for i := 0; i+dictionaryDmerSize <= len(data); i++ {
+		freqs[dmerHash(data[i:])]++
+	}
+
+	type segment struct {
+		start int
+		score uint64
+	}
+	var (
+		segments []segment
+		// the dmers of the current window, so that the ones repeated within a segment are only scored once.
+		active = map[uint32]int{}
+		// the data is split in as many epochs as segments fit in the dictionary, the best segment of each is kept.
+		epochs    = (size + dictionarySegmentSize - 1) / dictionarySegmentSize
+		epochSize = len(data) / epochs
+		dmers     = dictionarySegmentSize - dictionaryDmerSize + 1
+	)
+	if epochSize < dictionarySegmentSize {
+		epochSize = dictionarySegmentSize
+	}
+	for start := 0; start+dictionarySegmentSize <= len(data); start += epochSize {
+		end := start + epochSize
+		if end > len(data) {
+			end = len(data)
+		}
+		for k := range active {
+			delete(active, k)
+		}
+
+		best, score := segment{start: -1}, uint64(0)
+		for i := start; i+dictionaryDmerSize <= end; i++ {
+			h := dmerHash(data[i:])
+			if active[h] == 0 {
+				score += uint64(freqs[h])
+			}
+			active[h]++
+			// remove the dmer leaving the window.
+			if i-start >= dmers {
+				old := dmerHash(data[i-dmers:])
+				active[old]--
+				if active[old] == 0 {
+					delete(active, old)
+					score -= uint64(freqs[old])
+				}
+			}
+			if i-start >= dmers-1 && score > best.score {
+				best = segment{start: i - dmers + 1, score: score}
+			}
+		}
+		if best.start < 0 {
+			continue
+		}
+		segments = append(segments, best)
+		// the dmers of the segment are now in the dictionary, they don't make the other segments any better.
+		for i := best.start; i < best.start+dmers; i++ {
+			freqs[dmerHash(data[i:])] = 0
+		}
+	}
+
+	sort.SliceStable(segments, func(i, j int) bool { return segments[i].score < segments[j].score })
+	if len(segments) > epochs {
+		segments = segments[len(segments)-epochs:]
+	}
+	dictionary := make([]byte, 0, len(segments)*dictionarySegmentSize)
+	for _, s := range segments {
+		dictionary = append(dictionary, data[s.start:s.start+dictionarySegmentSize]...)
+	}
+	return dictionary
+}
+
+func dmerHash(b []byte) uint32 {
+	return uint32((binary.LittleEndian.Uint64(b) * 0x9E3779B185EBCA87) >> (64 - dictionaryFrequencyBits))
+}
+
+// DictionaryTrainer trains a dictionary from the lines it samples, and retrains it periodically from the most recent ones.
+// It is safe for concurrent use.
+type DictionaryTrainer struct {
+	lines  uint64 // accessed atomically, first for 64-bit alignment.
+	size   int
+	period time.Duration
+
+	mtx        sync.Mutex
+	samples    [][]byte
+	sampled    int
+	training   bool
+	trained    time.Time
+	dictionary []byte
+}
+
+// NewDictionaryTrainer returns a trainer of dictionaries of at most size bytes, retrained at most every period.
+func NewDictionaryTrainer(size int, period time.Duration) *DictionaryTrainer {
+	return &DictionaryTrainer{
+		size:   size,
+		period: period,
+	}
+}
+
+// Add samples one in DictionarySampleInterval lines, a dictionary is trained in the background once enough
+// lines have been sampled. Lines which aren't sampled are neither copied nor wait for the lock of the trainer.
+func (t *DictionaryTrainer) Add(line string) {
+	if atomic.AddUint64(&t.lines, 1)%DictionarySampleInterval != 0 {
+		return
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.training || time.Since(t.trained) < t.period {
+		return
+	}
+	t.samples = append(t.samples, []byte(line))
+	t.sampled += len(line)
+	if t.sampled < t.size*DictionarySamplesRatio {
+		return
+	}
+
+	samples := t.samples
+	t.samples, t.sampled, t.training = nil, 0, true
+	go func() {
+		dictionary := TrainDictionary(samples, t.size)
+
+		t.mtx.Lock()
+		defer t.mtx.Unlock()
+		t.dictionary = dictionary
+		t.training = false
+		t.trained = time.Now()
+	}()
+}
+
+// Dictionary returns the last dictionary trained, nil until enough lines have been sampled.
+func (t *DictionaryTrainer) Dictionary() []byte {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.dictionary
+}
+
+// zstdDictionaryMinContentSize is the minimum size of the content of a Zstandard dictionary,
+// its initial repeat offsets must be within the content.
+const zstdDictionaryMinContentSize = 8
+
+// The predefined distributions of the literals lengths, match lengths and offsets codes of the Zstandard format.
+var (
+	zstdLiteralsLengthsDistribution = []int16{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1, -1, -1, -1, -1,
+	}
+	zstdMatchLengthsDistribution = []int16{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1, -1, -1,
+	}
+	zstdOffsetsDistribution = []int16{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	}
+)
+
+// zstdDictionary returns the Zstandard dictionary of the raw content, which must be at least
+// zstdDictionaryMinContentSize bytes long.
+//
+// Raw content dictionaries can't be loaded by the vendored Zstandard library, which requires entropy tables.
+// They are written with fixed tables, so that the dictionary only depends on its content: the encoder only uses
+// the literals table when it is cheaper than a new one, and the decoder only uses the tables the frames refer to.
+func zstdDictionary(id uint32, content []byte) []byte {
+	var b []byte
+	b = append(b, 0x37, 0xA4, 0x30, 0xEC) // magic number
+	b = append(b, byte(id), byte(id>>8), byte(id>>16), byte(id>>24))
+
+	// Huffman table of the literals with the weights of the first 128 symbols written directly:
+	// the first 127 weigh 1 and the weight of the last one is implied, they are all coded with 7 bits.
+	b = append(b, 127+127)
+	for i := 0; i < 63; i++ {
+		b = append(b, 0x11)
+	}
+	b = append(b, 0x10)
+
+	b = appendNormalizedCounts(b, zstdOffsetsDistribution, 5)
+	b = appendNormalizedCounts(b, zstdMatchLengthsDistribution, 6)
+	b = appendNormalizedCounts(b, zstdLiteralsLengthsDistribution, 6)
+
+	// initial repeat offsets
+	for _, offset := range []uint32{1, 4, 8} {
+		b = append(b, byte(offset), byte(offset>>8), byte(offset>>16), byte(offset>>24))
+	}
+	return append(b, content...)
+}
+
+// appendNormalizedCounts appends the header of a FSE table of the distribution, as described in
+// https://tools.ietf.org/html/rfc8878#section-4.1.1. The distribution must not have any 0 probability.
+func appendNormalizedCounts(b []byte, distribution []int16, accuracyLog uint) []byte {
+	var (
+		bitStream = uint32(accuracyLog - 5)
+		bitCount  = uint(4)
+		remaining = int16(1<<accuracyLog) + 1
+		threshold = int16(1 << accuracyLog)
+		nbBits    = accuracyLog + 1
+	)
+	for _, count := range distribution {
+		max := (2*threshold - 1) - remaining
+		if count < 0 {
+			remaining += count
+		} else {
+			remaining -= count
+		}
+		count++
+		if count >= threshold {
+			count += max
+		}
+		bitStream += uint32(count) << bitCount
+		bitCount += nbBits
+		if count < max {
+			bitCount--
+		}
+		for remaining < threshold {
+			nbBits--
+			threshold >>= 1
+		}
+		if bitCount > 16 {
+			b = append(b, byte(bitStream), byte(bitStream>>8))
+			bitStream >>= 16
+			bitCount -= 16
+		}
+	}
+	for n := (bitCount + 7) / 8; n > 0; n-- {
+		b = append(b, byte(bitStream))
+		bitStream >>= 8
+	}
+	return b
+}
@@ -0,0 +1,159 @@
+package chunkenc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/pkg/chunkenc/testdata"
+	"github.com/grafana/loki/pkg/logproto"
+)
+
+func TestTrainDictionary(t *testing.T) {
+	require.Nil(t, TrainDictionary(nil, 1024))
+	require.Nil(t, TrainDictionary(testdata.LogsBytes, 0))
+
+	dictionary := TrainDictionary(testdata.LogsBytes, 4096)
+	require.NotEmpty(t, dictionary)
+	require.True(t, len(dictionary) <= 4096)
+	require.Equal(t, 0, len(dictionary)%dictionarySegmentSize)
+	// the dictionary is made of the content of the samples.
+	require.True(t, bytes.Contains(bytes.Join(testdata.LogsBytes, nil), dictionary[len(dictionary)-dictionarySegmentSize:]))
+}
+
+func TestMemChunk_Dictionary(t *testing.T) {
+	dictionary := TrainDictionary(testdata.LogsBytes[:500], 16*1024)
+
+	for _, enc := range testEncoding {
+		t.Run(enc.String(), func(t *testing.T) {
+			chk := NewMemChunk(enc, testBlockSize, testTargetSize)
+			chk.SetDictionary(dictionary)
+			for i := int64(0); i < 5000; i++ {
+				if i == 2500 {
+					require.NoError(t, chk.cut())
+				}
+				require.NoError(t, chk.Append(logprotoEntry(i, testdata.LogString(i))))
+			}
+
+			// the checkpointed chunk keeps compressing its blocks with the dictionary.
+			cb, head, err := chk.CheckpointBytes()
+			require.NoError(t, err)
+			restored, err := NewMemChunkFromCheckpoint(cb, head, false, testBlockSize, testTargetSize)
+			require.NoError(t, err)
+
+			for _, c := range []*MemChunk{chk, restored} {
+				b, err := c.Bytes()
+				require.NoError(t, err)
+				bc, err := NewByteChunk(b, testBlockSize, testTargetSize)
+				require.NoError(t, err)
+				require.Equal(t, c.BlockCount(), bc.BlockCount())
+				for _, blk := range bc.blocks {
+					if enc.SupportsDictionary() {
+						require.Equal(t, dictionary, blk.dictionary)
+					} else {
+						require.Nil(t, blk.dictionary)
+					}
+				}
+
+				it, err := bc.Iterator(context.Background(), time.Unix(0, 0), time.Unix(0, math.MaxInt64), logproto.FORWARD, nil)
+				require.NoError(t, err)
+				i := int64(0)
+				for ; it.Next(); i++ {
+					require.Equal(t, time.Unix(0, i), it.Entry().Timestamp)
+					require.Equal(t, testdata.LogString(i), it.Entry().Line)
+				}
+				require.NoError(t, it.Close())
+				require.Equal(t, int64(5000), i)
+			}
+		})
+	}
+}
+
+func TestDictionaryTrainer(t *testing.T) {
+	trainer := NewDictionaryTrainer(1024, time.Hour)
+	require.Nil(t, trainer.Dictionary())
+
+	// only one in DictionarySampleInterval lines is sampled.
+	for i := int64(0); i < DictionarySampleInterval; i++ {
+		trainer.Add(testdata.LogString(i))
+	}
+	trainer.mtx.Lock()
+	require.Len(t, trainer.samples, 1)
+	require.Equal(t, len(testdata.LogString(DictionarySampleInterval-1)), trainer.sampled)
+	trainer.mtx.Unlock()
+
+	for i := int64(0); !trainer.started(); i++ {
+		trainer.Add(testdata.LogString(i))
+	}
+	require.Eventually(t, func() bool { return trainer.Dictionary() != nil }, 5*time.Second, 10*time.Millisecond)
+	require.True(t, len(trainer.Dictionary()) <= 1024)
+
+	// the dictionary isn't retrained before the period has elapsed.
+	for i := int64(0); i < DictionarySampleInterval; i++ {
+		trainer.Add(testdata.LogString(i))
+	}
+	trainer.mtx.Lock()
+	defer trainer.mtx.Unlock()
+	require.Equal(t, 0, trainer.sampled)
+}
+
+// started returns whether the trainer has started training a dictionary.
+func (t *DictionaryTrainer) started() bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.training || t.dictionary != nil
+}
+
+func TestDictionaryPools_LRU(t *testing.T) {
+	dictionary := func(i int) []byte {
+		return []byte(fmt.Sprintf("dictionary %d", i))
+	}
+	recent := getDictionaryPool(EncZstd, dictionary(0))
+	old := getDictionaryPool(EncZstd, dictionary(1))
+	for i := 2; i < maxZstdDictionaryPools+2; i++ {
+		// the recently used pool is kept, the least recently used one is evicted.
+		require.True(t, recent == getDictionaryPool(EncZstd, dictionary(0)))
+		getDictionaryPool(EncZstd, dictionary(i))
+	}
+	require.True(t, recent == getDictionaryPool(EncZstd, dictionary(0)))
+	require.False(t, old == getDictionaryPool(EncZstd, dictionary(1)))
+}
+
+var compressedSize int
+
+func BenchmarkDictionary(b *testing.B) {
+	dictionary := TrainDictionary(testdata.LogsBytes[:len(testdata.LogsBytes)/2], 64*1024)
+
+	for _, enc := range []Encoding{EncZstdFastest, EncZstd} {
+		for _, withDictionary := range []bool{false, true} {
+			name := enc.String()
+			if withDictionary {
+				name += "-dictionary"
+			}
+			b.Run(name, func(b *testing.B) {
+				b.ReportAllocs()
+				var size, uncompressed int
+				for n := 0; n < b.N; n++ {
+					// small blocks benefit the most from dictionaries.
+					c := NewMemChunk(enc, 16*1024, testTargetSize)
+					if withDictionary {
+						c.SetDictionary(dictionary)
+					}
+					uncompressed = int(fillChunk(c))
+					_ = c.Close()
+					size = c.CompressedSize()
+					if withDictionary {
+						size += len(dictionary)
+					}
+				}
+				compressedSize = size
+				b.ReportMetric(float64(uncompressed)/float64(size), "ratio")
+			})
+		}
+	}
+}
@@ -32,11 +32,14 @@ const (
 	EncDumb
 	EncLZ4_64k
 	EncSnappy
-
-	// Added for testing.
 	EncLZ4_256k
 	EncLZ4_1M
 	EncLZ4_4M
+	EncZstd
+	EncZstdFastest
+	EncZstdBetter
+	EncZstdBest
+	EncLZ4HC
 )
 
 var supportedEncoding = []Encoding{
@@ -44,6 +47,14 @@ var supportedEncoding = []Encoding{
 	EncGZIP,
 	EncLZ4_64k,
 	EncSnappy,
+	EncLZ4_256k,
+	EncLZ4_1M,
+	EncLZ4_4M,
+	EncZstd,
+	EncZstdFastest,
+	EncZstdBetter,
+	EncZstdBest,
+	EncLZ4HC,
 }
 
 func (e Encoding) String() string {
@@ -62,13 +73,33 @@ func (e Encoding) String() string {
 		return "lz4-1M"
 	case EncLZ4_4M:
 		return "lz4-4M"
+	case EncLZ4HC:
+		return "lz4-hc"
 	case EncSnappy:
 		return "snappy"
+	case EncZstd:
+		return "zstd"
+	case EncZstdFastest:
+		return "zstd-fastest"
+	case EncZstdBetter:
+		return "zstd-better"
+	case EncZstdBest:
+		return "zstd-best"
 	default:
 		return "unknown"
 	}
 }
 
+// SupportsDictionary returns whether the blocks can be compressed with a dictionary.
+func (e Encoding) SupportsDictionary() bool {
+	switch e {
+	case EncZstd, EncZstdFastest, EncZstdBetter, EncZstdBest:
+		return true
+	default:
+		return false
+	}
+}
+
 // ParseEncoding parses an chunk encoding (compression algorithm) by its name.
 func ParseEncoding(enc string) (Encoding, error) {
 	for _, e := range supportedEncoding {
@@ -120,8 +151,9 @@ type Block interface {
 	Offset() int
 	// Entries is the amount of entries in the block.
 	Entries() int
-	// Iterator returns an entry iterator for the block.
-	Iterator(context.Context, logql.LineFilter) iter.EntryIterator
-	// SampleIterator returns a sample iterator for the block.
-	SampleIterator(context.Context, logql.LineFilter, logql.SampleExtractor) iter.SampleIterator
+	// Iterator returns an entry iterator for the block, the entries before from are skipped using the index of the
+	// block and its decompression stops after through.
+	Iterator(ctx context.Context, from, through time.Time, filter logql.LineFilter) iter.EntryIterator
+	// SampleIterator returns a sample iterator for the block, bounded like Iterator.
+	SampleIterator(ctx context.Context, from, through time.Time, filter logql.LineFilter, extractor logql.SampleExtractor) iter.SampleIterator
 }
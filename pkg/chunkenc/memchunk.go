@@ -9,6 +9,7 @@ import (
 	"hash"
 	"hash/crc32"
 	"io"
+	"sort"
 	"time"
 
 	"github.com/cespare/xxhash/v2"
@@ -25,6 +26,9 @@ import (
 const (
 	blocksPerChunk = 10
 	maxLineLength  = 1024 * 1024 * 1024
+
+	// blockIndexInterval is the number of uncompressed bytes between the points of the time index of a block.
+	blockIndexInterval = 16 * 1024
 )
 
 var (
@@ -32,6 +36,7 @@ var (
 
 	chunkFormatV1 = byte(1)
 	chunkFormatV2 = byte(2)
+	chunkFormatV3 = byte(3)
 )
 
 // The table gets initialized with sync.Once but may still cause a race
@@ -64,10 +69,15 @@ type MemChunk struct {
 	// Current in-mem block being appended to.
 	head *headBlock
 
-	// the chunk format default to v2
+	// the chunk format default to v3
 	format   byte
 	encoding Encoding
 
+	// Whether a bloom filter of the n-grams of the lines is written for the blocks cut.
+	bloomFilters bool
+	// The dictionary the blocks cut are compressed with, if any.
+	dictionary []byte
+
 	readers ReaderPool
 	writers WriterPool
 }
@@ -82,9 +92,39 @@ type block struct {
 	offset           int // The offset of the block in the chunk.
 	uncompressedSize int // Total uncompressed size in bytes when the chunk is cut.
 
+	bloom tokenBloom // nil when the block has no bloom filter.
+
+	// The metadata of blocks read from chunks older than v3 is unknown.
+	blockMeta
+
 	readers ReaderPool
 }
 
+// blockMeta is the metadata of a block computed when it is cut, it is stored since chunk format v3.
+type blockMeta struct {
+	minLineLength, maxLineLength int
+	// index holds a point every blockIndexInterval uncompressed bytes, allowing to seek within the block.
+	index []blockIndexPoint
+	// dictionary is the compression dictionary of the block, if any.
+	dictionary []byte
+}
+
+// blockIndexPoint is the timestamp of an entry of a block and its offset in the uncompressed block.
+type blockIndexPoint struct {
+	ts     int64
+	offset int
+}
+
+// seek returns the uncompressed offset from which to read the block to get the entries at or after ts.
+func (m blockMeta) seek(ts int64) int {
+	// the entries of a block are ordered, those before the last point earlier than ts can be skipped.
+	i := sort.Search(len(m.index), func(i int) bool { return m.index[i].ts >= ts })
+	if i == 0 {
+		return 0
+	}
+	return m.index[i-1].offset
+}
+
 // This block holds the un-compressed entries. Once it has enough data, this is
 // emptied into a block with only compressed entries.
 type headBlock struct {
@@ -93,6 +133,9 @@ type headBlock struct {
 	size    int // size of uncompressed bytes.
 
 	mint, maxt int64
+
+	// Whether entries can be appended in any order, they are sorted when the block is cut or read.
+	unordered bool
 }
 
 func (hb *headBlock) isEmpty() bool {
@@ -100,21 +143,35 @@ func (hb *headBlock) isEmpty() bool {
 }
 
 func (hb *headBlock) append(ts int64, line string) error {
-	if !hb.isEmpty() && hb.maxt > ts {
+	if !hb.unordered && !hb.isEmpty() && hb.maxt > ts {
 		return ErrOutOfOrder
 	}
 
+	if hb.isEmpty() || hb.maxt < ts {
+		hb.maxt = ts
+	}
 	hb.entries = append(hb.entries, entry{ts, line})
 	if hb.mint == 0 || hb.mint > ts {
 		hb.mint = ts
 	}
-	hb.maxt = ts
 	hb.size += len(line)
 
 	return nil
 }
 
-func (hb *headBlock) serialise(pool WriterPool) ([]byte, error) {
+// sortedEntries returns the entries of the head block ordered by timestamp, entries with the same
+// timestamp are kept in the order they were appended. The entries are not copied if already ordered.
+func (hb *headBlock) sortedEntries() []entry {
+	if !hb.unordered || sort.SliceIsSorted(hb.entries, func(i, j int) bool { return hb.entries[i].t < hb.entries[j].t }) {
+		return hb.entries
+	}
+	entries := make([]entry, len(hb.entries))
+	copy(entries, hb.entries)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].t < entries[j].t })
+	return entries
+}
+
+func (hb *headBlock) serialise(pool WriterPool) ([]byte, blockMeta, error) {
 	inBuf := serializeBytesBufferPool.Get().(*bytes.Buffer)
 	defer func() {
 		inBuf.Reset()
@@ -122,10 +179,21 @@ func (hb *headBlock) serialise(pool WriterPool) ([]byte, error) {
 	}()
 	outBuf := &bytes.Buffer{}
 
+	var meta blockMeta
 	encBuf := make([]byte, binary.MaxVarintLen64)
 	compressedWriter := pool.GetWriter(outBuf)
 	defer pool.PutWriter(compressedWriter)
-	for _, logEntry := range hb.entries {
+	for i, logEntry := range hb.sortedEntries() {
+		if i == 0 || len(logEntry.s) < meta.minLineLength {
+			meta.minLineLength = len(logEntry.s)
+		}
+		if len(logEntry.s) > meta.maxLineLength {
+			meta.maxLineLength = len(logEntry.s)
+		}
+		if len(meta.index) == 0 || inBuf.Len()-meta.index[len(meta.index)-1].offset >= blockIndexInterval {
+			meta.index = append(meta.index, blockIndexPoint{ts: logEntry.t, offset: inBuf.Len()})
+		}
+
 		n := binary.PutVarint(encBuf, logEntry.t)
 		inBuf.Write(encBuf[:n])
 
@@ -136,13 +204,42 @@ func (hb *headBlock) serialise(pool WriterPool) ([]byte, error) {
 	}
 
 	if _, err := compressedWriter.Write(inBuf.Bytes()); err != nil {
-		return nil, errors.Wrap(err, "appending entry")
+		return nil, meta, errors.Wrap(err, "appending entry")
 	}
 	if err := compressedWriter.Close(); err != nil {
-		return nil, errors.Wrap(err, "flushing pending compress buffer")
+		return nil, meta, errors.Wrap(err, "flushing pending compress buffer")
 	}
 
-	return outBuf.Bytes(), nil
+	return outBuf.Bytes(), meta, nil
+}
+
+// checkpointBytes returns the uncompressed entries of the head block, ordered by timestamp.
+func (hb *headBlock) checkpointBytes() []byte {
+	eb := encbuf{b: make([]byte, 0, hb.size+len(hb.entries)*2*binary.MaxVarintLen64+binary.MaxVarintLen64)}
+	eb.putUvarint(len(hb.entries))
+	for _, e := range hb.sortedEntries() {
+		eb.putVarint64(e.t)
+		eb.putUvarint(len(e.s))
+		eb.putBytes([]byte(e.s))
+	}
+	return eb.get()
+}
+
+// loadCheckpoint appends the entries serialised by checkpointBytes to the head block.
+func (hb *headBlock) loadCheckpoint(b []byte) error {
+	db := decbuf{b: b}
+	num := db.uvarint()
+	for i := 0; i < num && db.err() == nil; i++ {
+		ts := db.varint64()
+		line := db.bytes(db.uvarint())
+		if db.err() != nil {
+			break
+		}
+		if err := hb.append(ts, string(line)); err != nil {
+			return err
+		}
+	}
+	return db.err()
 }
 
 type entry struct {
@@ -158,7 +255,7 @@ func NewMemChunk(enc Encoding, blockSize, targetSize int) *MemChunk {
 		blocks:     []block{},
 
 		head:   &headBlock{},
-		format: chunkFormatV2,
+		format: chunkFormatV3,
 
 		encoding: enc,
 		writers:  getWriterPool(enc),
@@ -168,6 +265,31 @@ func NewMemChunk(enc Encoding, blockSize, targetSize int) *MemChunk {
 	return c
 }
 
+// NewUnorderedMemChunk returns a new in-mem chunk accepting entries in any order.
+// Its blocks may overlap, they are merged when iterating over the chunk.
+func NewUnorderedMemChunk(enc Encoding, blockSize, targetSize int) *MemChunk {
+	c := NewMemChunk(enc, blockSize, targetSize)
+	c.head.unordered = true
+	return c
+}
+
+// EnableBloomFilters makes the chunk write a bloom filter of the n-grams of the lines for the blocks cut from now on.
+// They let queries skip blocks and chunks which can't match their line filters.
+func (c *MemChunk) EnableBloomFilters() {
+	c.bloomFilters = true
+}
+
+// SetDictionary makes the chunk compress the blocks cut from now on with the dictionary, which is embedded in the chunk.
+// It is a no-op when the encoding of the chunk doesn't support dictionaries.
+func (c *MemChunk) SetDictionary(dictionary []byte) {
+	if !c.encoding.SupportsDictionary() || c.format < chunkFormatV3 {
+		return
+	}
+	c.dictionary = dictionary
+	pool := getDictionaryPool(c.encoding, dictionary)
+	c.readers, c.writers = pool, pool.(WriterPool)
+}
+
 // NewByteChunk returns a MemChunk on the passed bytes.
 func NewByteChunk(b []byte, blockSize, targetSize int) (*MemChunk, error) {
 	bc := &MemChunk{
@@ -189,8 +311,8 @@ func NewByteChunk(b []byte, blockSize, targetSize int) (*MemChunk, error) {
 	switch version {
 	case chunkFormatV1:
 		bc.readers, bc.writers = &Gzip, &Gzip
-	case chunkFormatV2:
-		// format v2 has a byte for block encoding.
+	case chunkFormatV2, chunkFormatV3:
+		// formats v2 and v3 have a byte for block encoding.
 		enc := Encoding(db.byte())
 		if db.err() != nil {
 			return nil, errors.Wrap(db.err(), "verifying encoding")
@@ -201,6 +323,10 @@ func NewByteChunk(b []byte, blockSize, targetSize int) (*MemChunk, error) {
 		return nil, errors.Errorf("invalid version %d", version)
 	}
 
+	// The bloom filters section is optional, chunks with an invalid one are read without it.
+	blooms, ok := readBloomFilters(db.b)
+	bc.bloomFilters = ok
+
 	metasOffset := binary.BigEndian.Uint64(b[len(b)-8:])
 	mb := b[metasOffset : len(b)-(8+4)] // storing the metasOffset + checksum of meta
 	db = decbuf{b: mb}
@@ -212,12 +338,23 @@ func NewByteChunk(b []byte, blockSize, targetSize int) (*MemChunk, error) {
 
 	// Read the number of blocks.
 	num := db.uvarint()
+	if db.err() != nil || num > len(b) {
+		return nil, errors.Wrap(ErrInvalidSize, "decoding number of blocks")
+	}
 	bc.blocks = make([]block, 0, num)
+	// the dictionary of each block, as a 1-based index in the dictionaries written after the blocks metadata.
+	blockDictionaries := make([]int, 0, num)
+	if len(blooms) != num {
+		blooms = nil
+	}
 
 	for i := 0; i < num; i++ {
 		blk := block{
 			readers: bc.readers,
 		}
+		if i < len(blooms) {
+			blk.bloom = blooms[i]
+		}
 		// Read #entries.
 		blk.numEntries = db.uvarint()
 
@@ -228,8 +365,17 @@ func NewByteChunk(b []byte, blockSize, targetSize int) (*MemChunk, error) {
 		// Read offset and length.
 		blk.offset = db.uvarint()
 		l := db.uvarint()
+		if db.err() != nil || blk.offset+l+4 > len(b) {
+			return nil, errors.Wrap(ErrInvalidSize, "decoding block meta")
+		}
 		blk.b = b[blk.offset : blk.offset+l]
 
+		var dictionary int
+		if version >= chunkFormatV3 {
+			blk.uncompressedSize = db.uvarint()
+			blk.blockMeta, dictionary = readBlockMeta(&db, blk.mint)
+		}
+
 		// Verify checksums.
 		expCRC := binary.BigEndian.Uint32(b[blk.offset+l:])
 		if expCRC != crc32.Checksum(blk.b, castagnoliTable) {
@@ -238,6 +384,7 @@ func NewByteChunk(b []byte, blockSize, targetSize int) (*MemChunk, error) {
 		}
 
 		bc.blocks = append(bc.blocks, blk)
+		blockDictionaries = append(blockDictionaries, dictionary)
 
 		// Update the counter used to track the size of cut blocks.
 		bc.cutBlockSize += len(blk.b)
@@ -247,6 +394,26 @@ func NewByteChunk(b []byte, blockSize, targetSize int) (*MemChunk, error) {
 		}
 	}
 
+	if version >= chunkFormatV3 {
+		// Read the dictionaries of the blocks.
+		dictionaries := make([][]byte, db.uvarint())
+		for i := range dictionaries {
+			dictionaries[i] = db.bytes(db.uvarint())
+		}
+		if db.err() != nil {
+			return nil, errors.Wrap(db.err(), "decoding dictionaries")
+		}
+		for i, d := range blockDictionaries {
+			if d > len(dictionaries) {
+				return nil, errors.Wrap(ErrInvalidSize, "decoding block dictionary")
+			}
+			if d > 0 {
+				bc.blocks[i].dictionary = dictionaries[d-1]
+				bc.blocks[i].readers = getDictionaryPool(bc.encoding, dictionaries[d-1])
+			}
+		}
+	}
+
 	return bc, nil
 }
 
@@ -258,6 +425,40 @@ func (c *MemChunk) Bytes() ([]byte, error) {
 			return nil, err
 		}
 	}
+	return c.bytes(true)
+}
+
+// CheckpointBytes returns the serialised chunk without its head block, and the entries of the head block.
+// Unlike Bytes, the head block is not cut and the chunk is left untouched,
+// which allows to checkpoint chunks that are still appended to.
+func (c *MemChunk) CheckpointBytes() (chunk, head []byte, err error) {
+	chunk, err = c.bytes(false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return chunk, c.head.checkpointBytes(), nil
+}
+
+// NewMemChunkFromCheckpoint returns a MemChunk restored from the output of CheckpointBytes.
+// When unordered is set, the restored chunk accepts entries in any order.
+func NewMemChunkFromCheckpoint(chunk, head []byte, unordered bool, blockSize, targetSize int) (*MemChunk, error) {
+	c, err := NewByteChunk(chunk, blockSize, targetSize)
+	if err != nil {
+		return nil, err
+	}
+	c.head.unordered = unordered
+	// keep compressing the blocks with the dictionary of the chunk.
+	if len(c.blocks) > 0 {
+		c.SetDictionary(c.blocks[len(c.blocks)-1].dictionary)
+	}
+	if err := c.head.loadCheckpoint(head); err != nil {
+		return nil, errors.Wrap(err, "decoding head block")
+	}
+	return c, nil
+}
+
+// bytes serialises the blocks of the chunk, the offsets of the blocks are only recorded when updateOffsets is set.
+func (c *MemChunk) bytes(updateOffsets bool) ([]byte, error) {
 	crc32Hash := newCRC32()
 
 	buf := bytes.NewBuffer(nil)
@@ -268,8 +469,8 @@ func (c *MemChunk) Bytes() ([]byte, error) {
 	// Write the header (magicNum + version).
 	eb.putBE32(magicNumber)
 	eb.putByte(c.format)
-	if c.format == chunkFormatV2 {
-		// chunk format v2 has a byte for encoding.
+	if c.format >= chunkFormatV2 {
+		// chunk formats v2 and v3 have a byte for encoding.
 		eb.putByte(byte(c.encoding))
 	}
 
@@ -279,9 +480,31 @@ func (c *MemChunk) Bytes() ([]byte, error) {
 	}
 	offset += n
 
+	// Write the bloom filters of the blocks, if any.
+	if c.hasBloomFilters() {
+		eb.reset()
+		eb.putBE32(bloomMagicNumber)
+		eb.putUvarint(len(c.blocks))
+		for _, b := range c.blocks {
+			eb.putUvarint(len(b.bloom))
+			eb.putBytes(b.bloom)
+		}
+		eb.putHash(crc32Hash)
+
+		n, err := buf.Write(eb.get())
+		if err != nil {
+			return buf.Bytes(), errors.Wrap(err, "write bloom filters")
+		}
+		offset += n
+	}
+
 	// Write Blocks.
+	offsets := make([]int, len(c.blocks))
 	for i, b := range c.blocks {
-		c.blocks[i].offset = offset
+		offsets[i] = offset
+		if updateOffsets {
+			c.blocks[i].offset = offset
+		}
 
 		eb.reset()
 		eb.putBytes(b.b)
@@ -300,12 +523,25 @@ func (c *MemChunk) Bytes() ([]byte, error) {
 	eb.putUvarint(len(c.blocks))
 
 	// Write BlockMetas.
-	for _, b := range c.blocks {
+	var dictionaries [][]byte
+	for i, b := range c.blocks {
 		eb.putUvarint(b.numEntries)
 		eb.putVarint64(b.mint)
 		eb.putVarint64(b.maxt)
-		eb.putUvarint(b.offset)
+		eb.putUvarint(offsets[i])
 		eb.putUvarint(len(b.b))
+		if c.format >= chunkFormatV3 {
+			eb.putUvarint(b.uncompressedSize)
+			dictionaries = writeBlockMeta(&eb, b.mint, b.blockMeta, dictionaries)
+		}
+	}
+	if c.format >= chunkFormatV3 {
+		// Write the dictionaries of the blocks, shared between the blocks using the same one.
+		eb.putUvarint(len(dictionaries))
+		for _, d := range dictionaries {
+			eb.putUvarint(len(d))
+			eb.putBytes(d)
+		}
 	}
 	eb.putHash(crc32Hash)
 
@@ -325,6 +561,98 @@ func (c *MemChunk) Bytes() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// writeBlockMeta writes the v3 metadata of a block, its dictionary is written as a 1-based index in dictionaries
+// to which it is added if not yet present.
+func writeBlockMeta(eb *encbuf, mint int64, m blockMeta, dictionaries [][]byte) [][]byte {
+	eb.putUvarint(m.minLineLength)
+	eb.putUvarint(m.maxLineLength)
+
+	dictionary := 0
+	if len(m.dictionary) > 0 {
+		for i, d := range dictionaries {
+			if bytes.Equal(d, m.dictionary) {
+				dictionary = i + 1
+				break
+			}
+		}
+		if dictionary == 0 {
+			dictionaries = append(dictionaries, m.dictionary)
+			dictionary = len(dictionaries)
+		}
+	}
+	eb.putUvarint(dictionary)
+
+	// the index points are delta encoded.
+	eb.putUvarint(len(m.index))
+	prev := blockIndexPoint{ts: mint}
+	for _, p := range m.index {
+		eb.putVarint64(p.ts - prev.ts)
+		eb.putUvarint(p.offset - prev.offset)
+		prev = p
+	}
+	return dictionaries
+}
+
+// readBlockMeta reads the metadata written by writeBlockMeta.
+func readBlockMeta(db *decbuf, mint int64) (blockMeta, int) {
+	var m blockMeta
+	m.minLineLength = db.uvarint()
+	m.maxLineLength = db.uvarint()
+	dictionary := db.uvarint()
+
+	num := db.uvarint()
+	if db.err() != nil || num > len(db.b) {
+		db.e = ErrInvalidSize
+		return m, 0
+	}
+	m.index = make([]blockIndexPoint, 0, num)
+	prev := blockIndexPoint{ts: mint}
+	for i := 0; i < num; i++ {
+		p := blockIndexPoint{
+			ts:     prev.ts + db.varint64(),
+			offset: prev.offset + db.uvarint(),
+		}
+		m.index = append(m.index, p)
+		prev = p
+	}
+	return m, dictionary
+}
+
+func (c *MemChunk) hasBloomFilters() bool {
+	for _, b := range c.blocks {
+		if b.bloom != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// readBloomFilters reads the bloom filters of the blocks written after the chunk header, if any.
+func readBloomFilters(b []byte) ([]tokenBloom, bool) {
+	db := decbuf{b: b}
+	if db.be32() != bloomMagicNumber {
+		return nil, false
+	}
+	num := db.uvarint()
+	if db.err() != nil || num > len(b) {
+		return nil, false
+	}
+	blooms := make([]tokenBloom, num)
+	for i := range blooms {
+		if l := db.uvarint(); l > 0 {
+			blooms[i] = db.bytes(l)
+		}
+	}
+	if db.err() != nil || len(db.b) < 4 {
+		return nil, false
+	}
+	sectionLen := len(b) - len(db.b)
+	if binary.BigEndian.Uint32(db.b) != crc32.Checksum(b[:sectionLen], castagnoliTable) {
+		return nil, false
+	}
+	return blooms, true
+}
+
 // Encoding implements Chunk.
 func (c *MemChunk) Encoding() Encoding {
 	return c.encoding
@@ -403,7 +731,7 @@ func (c *MemChunk) Append(entry *logproto.Entry) error {
 
 	// If the head block is empty but there are cut blocks, we have to make
 	// sure the new entry is not out of order compared to the previous block
-	if c.head.isEmpty() && len(c.blocks) > 0 && c.blocks[len(c.blocks)-1].maxt > entryTimestamp {
+	if !c.head.unordered && c.head.isEmpty() && len(c.blocks) > 0 && c.blocks[len(c.blocks)-1].maxt > entryTimestamp {
 		return ErrOutOfOrder
 	}
 
@@ -430,10 +758,16 @@ func (c *MemChunk) cut() error {
 		return nil
 	}
 
-	b, err := c.head.serialise(c.writers)
+	b, meta, err := c.head.serialise(c.writers)
 	if err != nil {
 		return err
 	}
+	meta.dictionary = c.dictionary
+
+	var bloom tokenBloom
+	if c.bloomFilters {
+		bloom = newTokenBloom(c.head.entries)
+	}
 
 	c.blocks = append(c.blocks, block{
 		readers:          c.readers,
@@ -442,12 +776,15 @@ func (c *MemChunk) cut() error {
 		mint:             c.head.mint,
 		maxt:             c.head.maxt,
 		uncompressedSize: c.head.size,
+		bloom:            bloom,
+		blockMeta:        meta,
 	})
 
 	c.cutBlockSize += len(b)
 
 	c.head.entries = c.head.entries[:0]
 	c.head.mint = 0 // Will be set on first append.
+	c.head.maxt = 0
 	c.head.size = 0
 
 	return nil
@@ -456,9 +793,14 @@ func (c *MemChunk) cut() error {
 // Bounds implements Chunk.
 func (c *MemChunk) Bounds() (fromT, toT time.Time) {
 	var from, to int64
-	if len(c.blocks) > 0 {
-		from = c.blocks[0].mint
-		to = c.blocks[len(c.blocks)-1].maxt
+	// Blocks are usually ordered, but they overlap when entries were appended out of order.
+	for i, b := range c.blocks {
+		if i == 0 || b.mint < from {
+			from = b.mint
+		}
+		if b.maxt > to {
+			to = b.maxt
+		}
 	}
 
 	if !c.head.isEmpty() {
@@ -483,15 +825,21 @@ func (c *MemChunk) Iterator(ctx context.Context, mintT, maxtT time.Time, directi
 		if maxt < b.mint || b.maxt < mint {
 			continue
 		}
-		its = append(its, b.Iterator(ctx, filter))
+		its = append(its, b.iterator(ctx, mint, maxt, filter))
 	}
 
 	if !c.head.isEmpty() {
 		its = append(its, c.head.iterator(ctx, mint, maxt, filter))
 	}
 
+	var it iter.EntryIterator
+	if c.overlapping(mint, maxt) {
+		it = iter.NewHeapIterator(ctx, its, logproto.FORWARD)
+	} else {
+		it = iter.NewNonOverlappingIterator(its, "")
+	}
 	iterForward := iter.NewTimeRangedIterator(
-		iter.NewNonOverlappingIterator(its, ""),
+		it,
 		time.Unix(0, mint),
 		time.Unix(0, maxt),
 	)
@@ -512,18 +860,44 @@ func (c *MemChunk) SampleIterator(ctx context.Context, mintT, maxtT time.Time, f
 		if maxt < b.mint || b.maxt < mint {
 			continue
 		}
-		its = append(its, b.SampleIterator(ctx, filter, extractor))
+		its = append(its, b.sampleIterator(ctx, mint, maxt, filter, extractor))
 	}
 
 	if !c.head.isEmpty() {
 		its = append(its, c.head.sampleIterator(ctx, mint, maxt, filter, extractor))
 	}
 
-	return iter.NewTimeRangedSampleIterator(
-		iter.NewNonOverlappingSampleIterator(its, ""),
-		mint,
-		maxt,
-	)
+	var it iter.SampleIterator
+	if c.overlapping(mint, maxt) {
+		it = iter.NewHeapSampleIterator(ctx, its)
+	} else {
+		it = iter.NewNonOverlappingSampleIterator(its, "")
+	}
+	return iter.NewTimeRangedSampleIterator(it, mint, maxt)
+}
+
+// overlapping returns whether the blocks and the head block within [mint, maxt] overlap,
+// which happens when entries were appended out of order.
+func (c *MemChunk) overlapping(mint, maxt int64) bool {
+	var prevMaxt int64
+	first := true
+	check := func(bmint, bmaxt int64) bool {
+		if maxt < bmint || bmaxt < mint {
+			return false
+		}
+		if !first && bmint < prevMaxt {
+			return true
+		}
+		first = false
+		prevMaxt = bmaxt
+		return false
+	}
+	for _, b := range c.blocks {
+		if check(b.mint, b.maxt) {
+			return true
+		}
+	}
+	return !c.head.isEmpty() && check(c.head.mint, c.head.maxt)
 }
 
 // Blocks implements Chunk
@@ -539,18 +913,43 @@ func (c *MemChunk) Blocks(mintT, maxtT time.Time) []Block {
 	return blocks
 }
 
-func (b block) Iterator(ctx context.Context, filter logql.LineFilter) iter.EntryIterator {
-	if len(b.b) == 0 {
+func (b block) Iterator(ctx context.Context, from, through time.Time, filter logql.LineFilter) iter.EntryIterator {
+	return b.iterator(ctx, from.UnixNano(), through.UnixNano(), filter)
+}
+
+// iterator returns an iterator over the entries of the block within [mint, maxt]. The block is decompressed from its
+// start until maxt, the entries before the closest point of its index before mint are skipped without being copied.
+func (b block) iterator(ctx context.Context, mint, maxt int64, filter logql.LineFilter) iter.EntryIterator {
+	if len(b.b) == 0 || !b.mayMatch(filter) {
 		return emptyIterator
 	}
-	return newEntryIterator(ctx, b.readers, b.b, filter)
+	return newEntryIterator(ctx, b, mint, maxt, filter)
+}
+
+func (b block) SampleIterator(ctx context.Context, from, through time.Time, filter logql.LineFilter, extractor logql.SampleExtractor) iter.SampleIterator {
+	return b.sampleIterator(ctx, from.UnixNano(), through.UnixNano(), filter, extractor)
 }
 
-func (b block) SampleIterator(ctx context.Context, filter logql.LineFilter, extractor logql.SampleExtractor) iter.SampleIterator {
-	if len(b.b) == 0 {
+// sampleIterator returns an iterator over the samples of the block within [mint, maxt], see iterator.
+func (b block) sampleIterator(ctx context.Context, mint, maxt int64, filter logql.LineFilter, extractor logql.SampleExtractor) iter.SampleIterator {
+	if len(b.b) == 0 || !b.mayMatch(filter) {
 		return iter.NoopIterator
 	}
-	return newSampleIterator(ctx, b.readers, b.b, filter, extractor)
+	return newSampleIterator(ctx, b, mint, maxt, filter, extractor)
+}
+
+// mayMatch returns false if the filter can't match any line of the block according to its bloom filter and metadata.
+func (b block) mayMatch(filter logql.LineFilter) bool {
+	if filter == nil || (b.bloom == nil && b.maxLineLength == 0) {
+		return true
+	}
+	return logql.FilterMayMatch(filter, func(literal []byte) bool {
+		// the line length is unknown for blocks older than v3.
+		if b.maxLineLength > 0 && len(literal) > b.maxLineLength {
+			return false
+		}
+		return b.bloom == nil || b.bloom.mayContain(literal)
+	})
 }
 
 func (b block) Offset() int {
@@ -580,7 +979,7 @@ func (hb *headBlock) iterator(ctx context.Context, mint, maxt int64, filter logq
 	// cutting of blocks.
 	chunkStats.HeadChunkLines += int64(len(hb.entries))
 	entries := make([]entry, 0, len(hb.entries))
-	for _, e := range hb.entries {
+	for _, e := range hb.sortedEntries() {
 		chunkStats.HeadChunkBytes += int64(len(e.s))
 		if filter == nil || filter.Filter([]byte(e.s)) {
 			entries = append(entries, e)
@@ -604,7 +1003,7 @@ func (hb *headBlock) sampleIterator(ctx context.Context, mint, maxt int64, filte
 	chunkStats := stats.GetChunkData(ctx)
 	chunkStats.HeadChunkLines += int64(len(hb.entries))
 	samples := make([]logproto.Sample, 0, len(hb.entries))
-	for _, e := range hb.entries {
+	for _, e := range hb.sortedEntries() {
 		chunkStats.HeadChunkBytes += int64(len(e.s))
 		if filter == nil || filter.Filter([]byte(e.s)) {
 			if value, ok := extractor.Extract([]byte(e.s)); ok {
@@ -673,18 +1072,25 @@ type bufferedIterator struct {
 
 	closed bool
 
+	// The entries are read within [mint, maxt], starting at the uncompressed offset skip.
+	mint, maxt int64
+	skip       int
+
 	filter logql.LineFilter
 }
 
-func newBufferedIterator(ctx context.Context, pool ReaderPool, b []byte, filter logql.LineFilter) *bufferedIterator {
+func newBufferedIterator(ctx context.Context, b block, mint, maxt int64, filter logql.LineFilter) *bufferedIterator {
 	chunkStats := stats.GetChunkData(ctx)
-	chunkStats.CompressedBytes += int64(len(b))
+	chunkStats.CompressedBytes += int64(len(b.b))
 	return &bufferedIterator{
 		stats:     chunkStats,
-		origBytes: b,
+		origBytes: b.b,
 		reader:    nil, // will be initialized later
 		bufReader: nil, // will be initialized later
-		pool:      pool,
+		pool:      b.readers,
+		mint:      mint,
+		maxt:      maxt,
+		skip:      b.seek(mint),
 		filter:    filter,
 		decBuf:    make([]byte, binary.MaxVarintLen64),
 		consumed:  true,
@@ -696,17 +1102,29 @@ func (si *bufferedIterator) Next() bool {
 		// initialize reader now, hopefully reusing one of the previous readers
 		si.reader = si.pool.GetReader(bytes.NewBuffer(si.origBytes))
 		si.bufReader = BufReaderPool.Get(si.reader)
+		if si.skip > 0 {
+			if err := si.skipEntries(); err != nil {
+				si.err = err
+				si.Close()
+				return false
+			}
+		}
 	}
 
 	for {
 		ts, line, ok := si.moveNext()
-		if !ok {
+		// the entries of a block are ordered, none of the next ones are within the range.
+		// Entries at maxt are left to the time ranged iterators which include them when mint equals maxt.
+		if !ok || ts > si.maxt {
 			si.Close()
 			return false
 		}
 		// we decode always the line length and ts as varint
 		si.stats.DecompressedBytes += int64(len(line)) + 2*binary.MaxVarintLen64
 		si.stats.DecompressedLines++
+		if ts < si.mint {
+			continue
+		}
 		if si.filter != nil && !si.filter.Filter(line) {
 			continue
 		}
@@ -717,6 +1135,29 @@ func (si *bufferedIterator) Next() bool {
 	}
 }
 
+// skipEntries skips the entries before the uncompressed offset skip without copying their lines.
+// They are still decompressed, so they are counted in the stats.
+func (si *bufferedIterator) skipEntries() error {
+	for offset := 0; offset < si.skip; {
+		ts, err := binary.ReadVarint(si.bufReader)
+		if err != nil {
+			return err
+		}
+		l, err := binary.ReadUvarint(si.bufReader)
+		if err != nil {
+			return err
+		}
+		if _, err := si.bufReader.Discard(int(l)); err != nil {
+			return err
+		}
+		offset += binary.PutVarint(si.decBuf, ts) + binary.PutUvarint(si.decBuf, l) + int(l)
+		// we decode always the line length and ts as varint
+		si.stats.DecompressedBytes += int64(l) + 2*binary.MaxVarintLen64
+		si.stats.DecompressedLines++
+	}
+	return nil
+}
+
 // moveNext moves the buffer to the next entry
 func (si *bufferedIterator) moveNext() (int64, []byte, bool) {
 	ts, err := binary.ReadVarint(si.bufReader)
@@ -799,9 +1240,9 @@ func (si *bufferedIterator) close() {
 
 func (si *bufferedIterator) Labels() string { return "" }
 
-func newEntryIterator(ctx context.Context, pool ReaderPool, b []byte, filter logql.LineFilter) iter.EntryIterator {
+func newEntryIterator(ctx context.Context, b block, mint, maxt int64, filter logql.LineFilter) iter.EntryIterator {
 	return &entryBufferedIterator{
-		bufferedIterator: newBufferedIterator(ctx, pool, b, filter),
+		bufferedIterator: newBufferedIterator(ctx, b, mint, maxt, filter),
 	}
 }
 
@@ -819,9 +1260,9 @@ func (e *entryBufferedIterator) Entry() logproto.Entry {
 	return e.cur
 }
 
-func newSampleIterator(ctx context.Context, pool ReaderPool, b []byte, filter logql.LineFilter, extractor logql.SampleExtractor) iter.SampleIterator {
+func newSampleIterator(ctx context.Context, b block, mint, maxt int64, filter logql.LineFilter, extractor logql.SampleExtractor) iter.SampleIterator {
 	it := &sampleBufferedIterator{
-		bufferedIterator: newBufferedIterator(ctx, pool, b, filter),
+		bufferedIterator: newBufferedIterator(ctx, b, mint, maxt, filter),
 		extractor:        extractor,
 	}
 	return it
@@ -30,6 +30,11 @@ var testEncoding = []Encoding{
 	EncLZ4_1M,
 	EncLZ4_4M,
 	EncSnappy,
+	EncZstd,
+	EncZstdFastest,
+	EncZstdBetter,
+	EncZstdBest,
+	EncLZ4HC,
 }
 
 var (
@@ -177,6 +182,118 @@ func TestReadFormatV1(t *testing.T) {
 	}
 }
 
+func TestReadFormatV2(t *testing.T) {
+	c := NewMemChunk(EncSnappy, testBlockSize, testTargetSize)
+	fillChunk(c)
+	// overrides default v3 format
+	c.format = chunkFormatV2
+
+	b, err := c.Bytes()
+	require.NoError(t, err)
+
+	r, err := NewByteChunk(b, testBlockSize, testTargetSize)
+	require.NoError(t, err)
+	require.Equal(t, EncSnappy, r.Encoding())
+	// the blocks metadata is not stored in format v2.
+	require.Zero(t, r.blocks[0].maxLineLength)
+	require.Empty(t, r.blocks[0].index)
+
+	it, err := r.Iterator(context.Background(), time.Unix(0, 0), time.Unix(0, math.MaxInt64), logproto.FORWARD, nil)
+	require.NoError(t, err)
+
+	i := int64(0)
+	for it.Next() {
+		require.Equal(t, i, it.Entry().Timestamp.UnixNano())
+		require.Equal(t, testdata.LogString(i), it.Entry().Line)
+		i++
+	}
+	require.NoError(t, it.Error())
+	require.Equal(t, int64(c.Size()), i)
+}
+
+func TestBlockMetaV3(t *testing.T) {
+	c := NewMemChunk(EncGZIP, testBlockSize, testTargetSize)
+	fillChunk(c)
+	require.NoError(t, c.Close())
+	require.True(t, c.BlockCount() > 2)
+	// the blocks using the same dictionary share it.
+	c.blocks[0].dictionary = []byte("dictionary")
+	c.blocks[1].dictionary = []byte("dictionary")
+
+	b, err := c.Bytes()
+	require.NoError(t, err)
+	r, err := NewByteChunk(b, testBlockSize, testTargetSize)
+	require.NoError(t, err)
+	require.Equal(t, c.BlockCount(), r.BlockCount())
+
+	for i, blk := range r.blocks {
+		expected := c.blocks[i]
+		require.Equal(t, expected.uncompressedSize, blk.uncompressedSize)
+		require.Equal(t, expected.blockMeta, blk.blockMeta)
+		require.NotZero(t, blk.maxLineLength)
+		require.True(t, blk.minLineLength <= blk.maxLineLength)
+		require.True(t, len(blk.index) > 1)
+		require.Zero(t, blk.index[0].offset)
+		require.True(t, blk.index[1].offset >= blockIndexInterval)
+	}
+	require.Equal(t, []byte("dictionary"), r.blocks[1].dictionary)
+	require.Nil(t, r.blocks[2].dictionary)
+	require.Equal(t, 1, bytes.Count(b, []byte("dictionary")))
+}
+
+func TestMemChunk_IteratorSeek(t *testing.T) {
+	c := NewMemChunk(EncSnappy, 10*testBlockSize, 0)
+	const numEntries = 20000
+	for i := 0; i < numEntries; i++ {
+		require.NoError(t, c.Append(logprotoEntry(int64(i), fmt.Sprintf("line %d with some padding to fill the block", i))))
+	}
+	require.NoError(t, c.Close())
+	require.Equal(t, 1, c.BlockCount())
+
+	ctx := stats.NewContext(context.Background())
+	it, err := c.Iterator(ctx, time.Unix(0, 15000), time.Unix(0, 15010), logproto.FORWARD, nil)
+	require.NoError(t, err)
+	var lines []string
+	for it.Next() {
+		lines = append(lines, it.Entry().Line)
+	}
+	require.NoError(t, it.Close())
+	require.Len(t, lines, 10)
+	require.Equal(t, "line 15000 with some padding to fill the block", lines[0])
+	require.Equal(t, "line 15009 with some padding to fill the block", lines[9])
+
+	// the block is decompressed until maxt, the entries skipped thanks to the index included.
+	decoded := stats.GetChunkData(ctx).DecompressedLines
+	require.True(t, decoded >= 15000 && decoded <= 15011, decoded)
+
+	sampleIt := c.SampleIterator(ctx, time.Unix(0, 15000), time.Unix(0, 15010), nil, logql.ExtractCount)
+	samples := 0
+	for sampleIt.Next() {
+		samples++
+	}
+	require.NoError(t, sampleIt.Close())
+	require.Equal(t, 10, samples)
+
+	// the blocks returned by Blocks are entered at the closest point of their index before the start of the query.
+	blocks := c.Blocks(time.Unix(0, 15000), time.Unix(0, 15010))
+	require.Len(t, blocks, 1)
+	skip := c.blocks[0].seek(15000)
+	require.NotZero(t, skip)
+	blockIt := blocks[0].Iterator(ctx, time.Unix(0, 15000), time.Unix(0, 15010), nil)
+	require.Equal(t, skip, blockIt.(*entryBufferedIterator).skip)
+	require.NoError(t, blockIt.Close())
+	blockSampleIt := blocks[0].SampleIterator(ctx, time.Unix(0, 15000), time.Unix(0, 15010), nil, logql.ExtractCount)
+	require.Equal(t, skip, blockSampleIt.(*sampleBufferedIterator).skip)
+	require.NoError(t, blockSampleIt.Close())
+
+	// the block can't contain a literal longer than its longest line.
+	expr, err := logql.ParseLogSelector(fmt.Sprintf(`{app="foo"} |= "%s"`, strings.Repeat("a", 100)))
+	require.NoError(t, err)
+	filter, err := expr.Filter()
+	require.NoError(t, err)
+	require.False(t, c.blocks[0].mayMatch(filter))
+}
+
 // Test all encodings by populating a memchunk, serializing it,
 // re-loading with NewByteChunk, serializing it again, and re-loading into via NewByteChunk once more.
 // This tests the integrity of transfer between the following:
@@ -281,6 +398,51 @@ func TestSerialization(t *testing.T) {
 	}
 }
 
+func TestCheckpointSerialization(t *testing.T) {
+	for _, enc := range testEncoding {
+		t.Run(enc.String(), func(t *testing.T) {
+			chk := NewMemChunk(enc, testBlockSize, testTargetSize)
+
+			numSamples := 5000
+			for i := 0; i < numSamples; i++ {
+				if i == numSamples/2 {
+					require.NoError(t, chk.cut())
+				}
+				require.NoError(t, chk.Append(logprotoEntry(int64(i), fmt.Sprintf("line %d", i))))
+			}
+			// the chunk has cut blocks and entries in its head block.
+			require.NotZero(t, chk.BlockCount())
+			require.False(t, chk.head.isEmpty())
+			headEntries := len(chk.head.entries)
+
+			byt, head, err := chk.CheckpointBytes()
+			require.NoError(t, err)
+			// the head block is not cut.
+			require.Len(t, chk.head.entries, headEntries)
+
+			restored, err := NewMemChunkFromCheckpoint(byt, head, false, testBlockSize, testTargetSize)
+			require.NoError(t, err)
+			require.Equal(t, chk.BlockCount(), restored.BlockCount())
+			require.Len(t, restored.head.entries, headEntries)
+
+			// the restored chunk can still be appended to.
+			require.NoError(t, restored.Append(logprotoEntry(int64(numSamples), "last")))
+
+			it, err := restored.Iterator(context.Background(), time.Unix(0, 0), time.Unix(0, math.MaxInt64), logproto.FORWARD, nil)
+			require.NoError(t, err)
+			for i := 0; i < numSamples; i++ {
+				require.True(t, it.Next())
+				require.Equal(t, int64(i), it.Entry().Timestamp.UnixNano())
+				require.Equal(t, fmt.Sprintf("line %d", i), it.Entry().Line)
+			}
+			require.True(t, it.Next())
+			require.Equal(t, "last", it.Entry().Line)
+			require.False(t, it.Next())
+			require.NoError(t, it.Error())
+		})
+	}
+}
+
 func TestChunkFilling(t *testing.T) {
 	for _, enc := range testEncoding {
 		t.Run(enc.String(), func(t *testing.T) {
@@ -409,6 +571,80 @@ func TestMemChunk_AppendOutOfOrder(t *testing.T) {
 			tester(t, NewMemChunk(EncGZIP, testBlockSize, testTargetSize))
 		})
 	}
+
+	t.Run("unordered chunk", func(t *testing.T) {
+		chk := NewUnorderedMemChunk(EncGZIP, testBlockSize, testTargetSize)
+		assert.NoError(t, chk.Append(logprotoEntry(5, "test")))
+		assert.NoError(t, chk.cut())
+		assert.NoError(t, chk.Append(logprotoEntry(6, "test")))
+		assert.NoError(t, chk.Append(logprotoEntry(1, "test")))
+	})
+}
+
+func TestUnorderedMemChunk(t *testing.T) {
+	for _, enc := range testEncoding {
+		t.Run(enc.String(), func(t *testing.T) {
+			chk := NewUnorderedMemChunk(enc, testBlockSize, testTargetSize)
+
+			// entries are appended in reverse order within each block, and blocks overlap.
+			numSamples := 300
+			for i := 0; i < numSamples; i += 100 {
+				for j := 99; j >= 0; j-- {
+					ts := int64(i/2 + j + 1)
+					require.NoError(t, chk.Append(logprotoEntry(ts, fmt.Sprintf("%d-%d", i, j))))
+				}
+				if i < numSamples-100 {
+					require.NoError(t, chk.cut())
+				}
+			}
+			from, through := chk.Bounds()
+			require.Equal(t, int64(1), from.UnixNano())
+			require.Equal(t, int64(200), through.UnixNano())
+
+			check := func(c *MemChunk) {
+				for _, direction := range []logproto.Direction{logproto.FORWARD, logproto.BACKWARD} {
+					it, err := c.Iterator(context.Background(), time.Unix(0, 0), time.Unix(0, math.MaxInt64), direction, nil)
+					require.NoError(t, err)
+					var prev int64 = -1
+					if direction == logproto.BACKWARD {
+						prev = math.MaxInt64
+					}
+					count := 0
+					for it.Next() {
+						ts := it.Entry().Timestamp.UnixNano()
+						if direction == logproto.FORWARD {
+							require.GreaterOrEqual(t, ts, prev)
+						} else {
+							require.LessOrEqual(t, ts, prev)
+						}
+						prev = ts
+						count++
+					}
+					require.NoError(t, it.Close())
+					require.Equal(t, numSamples, count)
+				}
+
+				sampleIt := c.SampleIterator(context.Background(), time.Unix(0, 0), time.Unix(0, math.MaxInt64), nil, logql.ExtractCount)
+				var prev int64 = -1
+				count := 0
+				for sampleIt.Next() {
+					require.GreaterOrEqual(t, sampleIt.Sample().Timestamp, prev)
+					prev = sampleIt.Sample().Timestamp
+					count++
+				}
+				require.NoError(t, sampleIt.Close())
+				require.Equal(t, numSamples, count)
+			}
+			check(chk)
+
+			// the head block is sorted when cut, blocks still overlap once serialised.
+			b, err := chk.Bytes()
+			require.NoError(t, err)
+			bc, err := NewByteChunk(b, testBlockSize, testTargetSize)
+			require.NoError(t, err)
+			check(bc)
+		})
+	}
 }
 
 func TestChunkSize(t *testing.T) {
@@ -4,11 +4,16 @@ import (
 	"bufio"
 	"bytes"
 	"io"
+	"io/ioutil"
+	"runtime"
 	"sync"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/golang/snappy"
+	"github.com/hashicorp/golang-lru/simplelru"
 	"github.com/klauspost/compress/gzip"
-	"github.com/pierrec/lz4"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
 	"github.com/prometheus/prometheus/pkg/pool"
 )
 
@@ -32,6 +37,14 @@ var (
 	Lz4_256k = LZ4Pool{bufferSize: 1 << 18} // Lz4_256k uses 256k buffer
 	Lz4_1M   = LZ4Pool{bufferSize: 1 << 20} // Lz4_1M uses 1M buffer
 	Lz4_4M   = LZ4Pool{bufferSize: 1 << 22} // Lz4_4M uses 4M buffer
+	// Lz4HC is the LZ4 high compression pool, it compresses better and much slower, its decompression is as fast.
+	Lz4HC = LZ4Pool{bufferSize: 1 << 18, level: lz4.Level9}
+
+	// Zstd is the Zstandard compression pool, with the default level.
+	Zstd        = ZstdPool{level: zstd.SpeedDefault}
+	ZstdFastest = ZstdPool{level: zstd.SpeedFastest}           // ZstdFastest trades compression ratio for speed.
+	ZstdBetter  = ZstdPool{level: zstd.SpeedBetterCompression} // ZstdBetter compresses better at about twice the CPU cost.
+	ZstdBest    = ZstdPool{level: zstd.SpeedBestCompression}   // ZstdBest compresses best but is much slower to compress.
 
 	// Snappy is the snappy compression pool
 	Snappy SnappyPool
@@ -70,6 +83,16 @@ func getReaderPool(enc Encoding) ReaderPool {
 		return &Lz4_1M
 	case EncLZ4_4M:
 		return &Lz4_4M
+	case EncLZ4HC:
+		return &Lz4HC
+	case EncZstd:
+		return &Zstd
+	case EncZstdFastest:
+		return &ZstdFastest
+	case EncZstdBetter:
+		return &ZstdBetter
+	case EncZstdBest:
+		return &ZstdBest
 	case EncSnappy:
 		return &Snappy
 	case EncNone:
@@ -79,6 +102,16 @@ func getReaderPool(enc Encoding) ReaderPool {
 	}
 }
 
+// getDictionaryPool returns the pool of the encoding compressing with the dictionary.
+// The pool of the encoding is returned when it doesn't support dictionaries or the dictionary is empty.
+func getDictionaryPool(enc Encoding, dictionary []byte) ReaderPool {
+	pool := getReaderPool(enc)
+	if zstdPool, ok := pool.(*ZstdPool); ok && len(dictionary) > 0 {
+		return zstdPool.withDictionary(dictionary)
+	}
+	return pool
+}
+
 // GzipPool is a gun zip compression pool
 type GzipPool struct {
 	readers sync.Pool
@@ -135,73 +168,43 @@ func (pool *GzipPool) PutWriter(writer io.WriteCloser) {
 type LZ4Pool struct {
 	readers    sync.Pool
 	writers    sync.Pool
-	bufferSize int // available values: 1<<16 (64k), 1<<18 (256k), 1<<20 (1M), 1<<22 (4M). Defaults to 4MB, if not set.
-}
-
-// lz4Reader is simple wrapper around *lz4.Reader, which remembers max used block size,
-// as reported by this reader. It is used to determine whether we want to reuse it,
-// or throw away and garbage-collect.
-type lz4Reader struct {
-	r            *lz4.Reader
-	maxBlockSize int
-}
-
-func (l *lz4Reader) Read(p []byte) (n int, err error) {
-	return l.r.Read(p)
-}
-
-func (l *lz4Reader) Reset(src io.Reader) {
-	l.r.Reset(src)
-}
-
-func (l *lz4Reader) onBlockDone(_ int) {
-	// remember max block size used.
-	if l.r.BlockMaxSize > l.maxBlockSize {
-		l.maxBlockSize = l.r.BlockMaxSize
-	}
-}
-
-func newLz4Reader(src io.Reader) *lz4Reader {
-	lz4r := lz4.NewReader(src)
-	r := &lz4Reader{r: lz4r}
-	lz4r.OnBlockDone = r.onBlockDone
-	return r
+	bufferSize int                  // available values: 1<<16 (64k), 1<<18 (256k), 1<<20 (1M), 1<<22 (4M). Defaults to 4MB, if not set.
+	level      lz4.CompressionLevel // lz4.Fast, or the high compression level.
 }
 
 // GetReader gets or creates a new CompressionReader and reset it to read from src
 func (pool *LZ4Pool) GetReader(src io.Reader) io.Reader {
 	if r := pool.readers.Get(); r != nil {
-		reader := r.(*lz4Reader)
+		reader := r.(*lz4.Reader)
 		reader.Reset(src)
 		return reader
 	}
 	// no need to set buffer size here. Reader uses buffer size based on
-	// LZ4 header that it is reading.
-	return newLz4Reader(src)
+	// LZ4 header that it is reading, and releases it once the stream is read.
+	return lz4.NewReader(src)
 }
 
 // PutReader places back in the pool a CompressionReader
 func (pool *LZ4Pool) PutReader(reader io.Reader) {
-	r := reader.(*lz4Reader)
-	if r.maxBlockSize > pool.bufferSize {
-		// Readers base their buffer size based on headers from LZ4 stream.
-		// If this reader uses bigger buffer than what we use currently, don't pool it.
-		// Reading from a couple of chunks that used big buffer sizes could otherwise quickly lead
-		// to high pooled memory usage.
-		return
-	}
 	pool.readers.Put(reader)
 }
 
 // GetWriter gets or creates a new CompressionWriter and reset it to write to dst
 func (pool *LZ4Pool) GetWriter(dst io.Writer) io.WriteCloser {
 	if w := pool.writers.Get(); w != nil {
+		// Reset keeps the block size and level of the pool.
 		writer := w.(*lz4.Writer)
 		writer.Reset(dst)
 		return writer
 	}
 	w := lz4.NewWriter(dst)
-	w.BlockMaxSize = pool.bufferSize
+	opts := []lz4.Option{lz4.CompressionLevelOption(pool.level)}
+	if pool.bufferSize > 0 {
+		opts = append(opts, lz4.BlockSizeOption(lz4.BlockSize(pool.bufferSize)))
+	}
+	if err := w.Apply(opts...); err != nil {
+		panic(err) // never happens, error is only returned on wrong options.
+	}
 	return w
 }
 
@@ -210,6 +213,166 @@ func (pool *LZ4Pool) PutWriter(writer io.WriteCloser) {
 	pool.writers.Put(writer)
 }
 
+// maxZstdDictionaryPools is the maximum number of dictionary pools kept, chunks of every tenant embed their own.
+// The least recently used pools are evicted, chunks still referencing them keep using them.
+const maxZstdDictionaryPools = 256
+
+// maxZstdDictionaryDecoderConcurrency is the maximum number of blocks decoded concurrently with a dictionary.
+const maxZstdDictionaryDecoderConcurrency = 4
+
+// zstdDictionaryPools caches the pools of the dictionaries blocks are compressed with, keyed by level and hash of
+// their dictionary, so that their readers and writers are reused across chunks.
+var zstdDictionaryPools = struct {
+	sync.Mutex
+	pools *simplelru.LRU
+}{pools: newZstdDictionaryPools()}
+
+func newZstdDictionaryPools() *simplelru.LRU {
+	pools, err := simplelru.NewLRU(maxZstdDictionaryPools, nil)
+	if err != nil {
+		panic(err) // never happens, error is only returned on a non-positive size.
+	}
+	return pools
+}
+
+type zstdPoolKey struct {
+	level      zstd.EncoderLevel
+	dictionary uint64
+}
+
+// ZstdPool is a Zstandard compression pool, compressing with an optional raw content dictionary.
+type ZstdPool struct {
+	readers sync.Pool
+	writers sync.Pool
+	level   zstd.EncoderLevel
+
+	dictionary   []byte
+	dictionaryID uint32
+
+	// The decoder is shared by the readers of the pool, it decodes whole blocks at once.
+	decoderOnce sync.Once
+	decoder     *zstd.Decoder
+}
+
+// withDictionary returns the pool of the same level compressing with the dictionary.
+func (pool *ZstdPool) withDictionary(dictionary []byte) *ZstdPool {
+	h := xxhash.Sum64(dictionary)
+	key := zstdPoolKey{level: pool.level, dictionary: h}
+
+	zstdDictionaryPools.Lock()
+	defer zstdDictionaryPools.Unlock()
+	if p, ok := zstdDictionaryPools.pools.Get(key); ok && bytes.Equal(p.(*ZstdPool).dictionary, dictionary) {
+		return p.(*ZstdPool)
+	}
+	p := &ZstdPool{
+		level:      pool.level,
+		dictionary: dictionary,
+		// 0 means no dictionary in Zstandard frames.
+		dictionaryID: uint32(h) | 1,
+	}
+	// The goroutines of the decoder are stopped once the pool is no longer used by any chunk.
+	runtime.SetFinalizer(p, func(p *ZstdPool) {
+		if p.decoder != nil {
+			p.decoder.Close()
+		}
+	})
+	zstdDictionaryPools.pools.Add(key, p)
+	return p
+}
+
+// zstdDictionary returns the dictionary of the pool in the Zstandard format, nil if there is none.
+func (pool *ZstdPool) zstdDictionary() []byte {
+	if len(pool.dictionary) < zstdDictionaryMinContentSize {
+		return nil
+	}
+	return zstdDictionary(pool.dictionaryID, pool.dictionary)
+}
+
+func (pool *ZstdPool) getDecoder() *zstd.Decoder {
+	pool.decoderOnce.Do(func() {
+		// Decoders created without an input never start a stream goroutine, blocks are decoded with DecodeAll.
+		concurrency := runtime.GOMAXPROCS(0)
+		dictionary := pool.zstdDictionary()
+		if dictionary != nil && concurrency > maxZstdDictionaryDecoderConcurrency {
+			// each decoding slot runs a goroutine, and many dictionary pools may be cached.
+			concurrency = maxZstdDictionaryDecoderConcurrency
+		}
+		opts := []zstd.DOption{zstd.WithDecoderConcurrency(concurrency)}
+		if dictionary != nil {
+			opts = append(opts, zstd.WithDecoderDicts(dictionary))
+		}
+		decoder, err := zstd.NewReader(nil, opts...)
+		if err != nil {
+			panic(err) // never happens, error is only returned on wrong options.
+		}
+		pool.decoder = decoder
+	})
+	return pool.decoder
+}
+
+// zstdReader reads a block decoded at once.
+type zstdReader struct {
+	bytes.Reader
+	decoded []byte
+	err     error
+}
+
+func (r *zstdReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	return r.Reader.Read(p)
+}
+
+// GetReader gets or creates a new CompressionReader and reset it to read from src
+func (pool *ZstdPool) GetReader(src io.Reader) io.Reader {
+	reader, _ := pool.readers.Get().(*zstdReader)
+	if reader == nil {
+		reader = &zstdReader{}
+	}
+	var compressed []byte
+	if b, ok := src.(interface{ Bytes() []byte }); ok {
+		compressed = b.Bytes()
+	} else {
+		compressed, reader.err = ioutil.ReadAll(src)
+	}
+	if reader.err == nil {
+		reader.decoded, reader.err = pool.getDecoder().DecodeAll(compressed, reader.decoded[:0])
+	}
+	reader.Reader.Reset(reader.decoded)
+	return reader
+}
+
+// PutReader places back in the pool a CompressionReader
+func (pool *ZstdPool) PutReader(reader io.Reader) {
+	r := reader.(*zstdReader)
+	r.err = nil
+	pool.readers.Put(r)
+}
+
+// GetWriter gets or creates a new CompressionWriter and reset it to write to dst
+func (pool *ZstdPool) GetWriter(dst io.Writer) io.WriteCloser {
+	if w := pool.writers.Get(); w != nil {
+		writer := w.(*zstd.Encoder)
+		writer.Reset(dst)
+		return writer
+	}
+	opts := []zstd.EOption{zstd.WithEncoderLevel(pool.level), zstd.WithEncoderConcurrency(1)}
+	if dictionary := pool.zstdDictionary(); dictionary != nil {
+		opts = append(opts, zstd.WithEncoderDict(dictionary))
+	}
+	w, err := zstd.NewWriter(dst, opts...)
+	if err != nil {
+		panic(err) // never happens, error is only returned on wrong options.
+	}
+	return w
+}
+
+// PutWriter places back in the pool a CompressionWriter
+func (pool *ZstdPool) PutWriter(writer io.WriteCloser) {
+	pool.writers.Put(writer)
+}
+
 type SnappyPool struct {
 	readers sync.Pool
 	writers sync.Pool
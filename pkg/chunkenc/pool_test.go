@@ -0,0 +1,44 @@
+package chunkenc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLZ4Pools_LongLiterals(t *testing.T) {
+	// a long run of literals followed by a match, which the amd64 decoder of pierrec/lz4 v2 rejected.
+	literals := make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(literals)
+	data := append(append([]byte{}, literals...), literals...)
+
+	for _, enc := range []Encoding{EncLZ4_64k, EncLZ4_256k, EncLZ4_1M, EncLZ4_4M, EncLZ4HC} {
+		t.Run(enc.String(), func(t *testing.T) {
+			pool := getWriterPool(enc)
+			// twice, so that the pooled writer and reader are reused. The output must be deterministic, so that the
+			// chunks of the replicas of a stream are identical.
+			var compressed []byte
+			for i := 0; i < 2; i++ {
+				var buf bytes.Buffer
+				w := pool.GetWriter(&buf)
+				_, err := w.Write(data)
+				require.NoError(t, err)
+				require.NoError(t, w.Close())
+				pool.PutWriter(w)
+				if compressed == nil {
+					compressed = append(compressed, buf.Bytes()...)
+				}
+				require.Equal(t, compressed, buf.Bytes())
+
+				r := getReaderPool(enc).GetReader(&buf)
+				decoded, err := ioutil.ReadAll(r)
+				require.NoError(t, err)
+				require.Equal(t, data, decoded)
+				getReaderPool(enc).PutReader(r)
+			}
+		})
+	}
+}
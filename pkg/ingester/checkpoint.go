@@ -0,0 +1,66 @@
+package ingester
+
+import (
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/loki/pkg/chunkenc"
+)
+
+// checkpoint passes the state of every stream of the instance to fn.
+// The instance is only locked while a single stream is serialised, so pushes are not blocked for long.
+func (i *instance) checkpoint(fn func(*checkpointStream) error) error {
+	i.streamsMtx.RLock()
+	fps := make([]model.Fingerprint, 0, len(i.streams))
+	for fp := range i.streams {
+		fps = append(fps, fp)
+	}
+	i.streamsMtx.RUnlock()
+
+	for _, fp := range fps {
+		i.streamsMtx.RLock()
+		stream, ok := i.streams[fp]
+		if !ok {
+			i.streamsMtx.RUnlock()
+			continue
+		}
+		cs, err := stream.checkpoint(i.instanceID)
+		i.streamsMtx.RUnlock()
+		if err != nil {
+			return err
+		}
+		if err := fn(cs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkpoint returns the state of the stream and its chunks. Must hold the streamsMtx of the instance.
+func (s *stream) checkpoint(userID string) (*checkpointStream, error) {
+	cs := &checkpointStream{
+		userID:   userID,
+		ref:      uint64(s.fp),
+		labels:   s.labels,
+		lastLine: s.lastLine,
+		chunks:   make([]checkpointChunk, 0, len(s.chunks)),
+	}
+	for _, c := range s.chunks {
+		mc, ok := c.chunk.(*chunkenc.MemChunk)
+		if !ok {
+			continue
+		}
+		chk, head, err := mc.CheckpointBytes()
+		if err != nil {
+			return nil, err
+		}
+		cs.chunks = append(cs.chunks, checkpointChunk{
+			closed:      c.closed,
+			synced:      c.synced,
+			flushed:     c.flushed,
+			lastUpdated: c.lastUpdated,
+			chunk:       chk,
+			head:        head,
+		})
+	}
+	return cs, nil
+}
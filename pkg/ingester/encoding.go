@@ -0,0 +1,247 @@
+package ingester
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb/encoding"
+
+	"github.com/grafana/loki/pkg/logproto"
+)
+
+// walRecordType is the first byte of every record of the WAL and its checkpoints.
+type walRecordType byte
+
+const (
+	// walRecordSeries records the creation of streams.
+	walRecordSeries walRecordType = 1
+	// walRecordEntries records the entries pushed to streams.
+	walRecordEntries walRecordType = 2
+	// walRecordCheckpoint records a stream and its in-memory chunks.
+	walRecordCheckpoint walRecordType = 3
+)
+
+var errInvalidWALRecord = errors.New("invalid WAL record")
+
+// walRecord holds the stream creations and entries of a single push of a tenant.
+// Streams are referenced by their fingerprint.
+type walRecord struct {
+	userID  string
+	series  []walSeries
+	entries []walEntries
+}
+
+type walSeries struct {
+	ref    uint64
+	labels labels.Labels
+}
+
+type walEntries struct {
+	ref     uint64
+	entries []logproto.Entry
+}
+
+func (r *walRecord) isEmpty() bool {
+	return len(r.series) == 0 && len(r.entries) == 0
+}
+
+// encode returns the series record followed by the entries record, each one is only returned if not empty.
+func (r *walRecord) encode() [][]byte {
+	var recs [][]byte
+	if len(r.series) > 0 {
+		buf := encoding.Encbuf{}
+		buf.PutByte(byte(walRecordSeries))
+		buf.PutUvarintStr(r.userID)
+		buf.PutUvarint(len(r.series))
+		for _, s := range r.series {
+			buf.PutBE64(s.ref)
+			encodeLabels(&buf, s.labels)
+		}
+		recs = append(recs, buf.Get())
+	}
+
+	if len(r.entries) > 0 {
+		buf := encoding.Encbuf{}
+		buf.PutByte(byte(walRecordEntries))
+		buf.PutUvarintStr(r.userID)
+		buf.PutUvarint(len(r.entries))
+		for _, e := range r.entries {
+			buf.PutBE64(e.ref)
+			buf.PutUvarint(len(e.entries))
+			for _, entry := range e.entries {
+				buf.PutVarint64(entry.Timestamp.UnixNano())
+				buf.PutUvarintStr(entry.Line)
+			}
+		}
+		recs = append(recs, buf.Get())
+	}
+	return recs
+}
+
+// decodeWALRecord decodes a series or entries record into r, which is reset first.
+func decodeWALRecord(b []byte, r *walRecord) error {
+	r.userID, r.series, r.entries = "", r.series[:0], r.entries[:0]
+	if len(b) == 0 {
+		return errInvalidWALRecord
+	}
+
+	dec := encoding.Decbuf{B: b[1:]}
+	r.userID = dec.UvarintStr()
+	switch walRecordType(b[0]) {
+	case walRecordSeries:
+		n := dec.Uvarint()
+		for i := 0; i < n && dec.Err() == nil; i++ {
+			ref := dec.Be64()
+			r.series = append(r.series, walSeries{ref: ref, labels: decodeLabels(&dec)})
+		}
+	case walRecordEntries:
+		n := dec.Uvarint()
+		for i := 0; i < n && dec.Err() == nil; i++ {
+			e := walEntries{ref: dec.Be64()}
+			numEntries := dec.Uvarint()
+			if dec.Err() == nil {
+				e.entries = make([]logproto.Entry, 0, numEntries)
+			}
+			for j := 0; j < numEntries && dec.Err() == nil; j++ {
+				e.entries = append(e.entries, logproto.Entry{
+					Timestamp: time.Unix(0, dec.Varint64()),
+					Line:      dec.UvarintStr(),
+				})
+			}
+			r.entries = append(r.entries, e)
+		}
+	default:
+		return errors.Wrapf(errInvalidWALRecord, "unexpected record type %d", b[0])
+	}
+
+	if dec.Err() != nil {
+		return errors.Wrap(dec.Err(), "decoding WAL record")
+	}
+	if dec.Len() > 0 {
+		return errors.Wrapf(errInvalidWALRecord, "%d unused bytes", dec.Len())
+	}
+	return nil
+}
+
+// checkpointStream is the state of a stream written to checkpoints.
+type checkpointStream struct {
+	userID   string
+	ref      uint64
+	labels   labels.Labels
+	lastLine line
+	chunks   []checkpointChunk
+}
+
+type checkpointChunk struct {
+	closed      bool
+	synced      bool
+	flushed     time.Time
+	lastUpdated time.Time
+	// The serialised chunk without its head block, and the entries of its head block.
+	chunk, head []byte
+}
+
+func (s *checkpointStream) encode() []byte {
+	buf := encoding.Encbuf{}
+	buf.PutByte(byte(walRecordCheckpoint))
+	buf.PutUvarintStr(s.userID)
+	buf.PutBE64(s.ref)
+	encodeLabels(&buf, s.labels)
+	encodeTime(&buf, s.lastLine.ts)
+	buf.PutUvarintStr(s.lastLine.content)
+	buf.PutUvarint(len(s.chunks))
+	for _, c := range s.chunks {
+		var flags byte
+		if c.closed {
+			flags |= 1
+		}
+		if c.synced {
+			flags |= 1 << 1
+		}
+		buf.PutByte(flags)
+		encodeTime(&buf, c.flushed)
+		encodeTime(&buf, c.lastUpdated)
+		buf.PutUvarint(len(c.chunk))
+		buf.B = append(buf.B, c.chunk...)
+		buf.PutUvarint(len(c.head))
+		buf.B = append(buf.B, c.head...)
+	}
+	return buf.Get()
+}
+
+// decodeCheckpointStream decodes a checkpoint record, the chunks are copied
+// as the record buffer is reused by the WAL reader.
+func decodeCheckpointStream(b []byte) (*checkpointStream, error) {
+	if len(b) == 0 || walRecordType(b[0]) != walRecordCheckpoint {
+		return nil, errInvalidWALRecord
+	}
+
+	dec := encoding.Decbuf{B: b[1:]}
+	s := &checkpointStream{
+		userID: dec.UvarintStr(),
+		ref:    dec.Be64(),
+	}
+	s.labels = decodeLabels(&dec)
+	s.lastLine.ts = decodeTime(&dec)
+	s.lastLine.content = dec.UvarintStr()
+
+	n := dec.Uvarint()
+	for i := 0; i < n && dec.Err() == nil; i++ {
+		flags := dec.Byte()
+		c := checkpointChunk{
+			closed:      flags&1 != 0,
+			synced:      flags&(1<<1) != 0,
+			flushed:     decodeTime(&dec),
+			lastUpdated: decodeTime(&dec),
+		}
+		c.chunk = append([]byte(nil), dec.UvarintBytes()...)
+		c.head = append([]byte(nil), dec.UvarintBytes()...)
+		s.chunks = append(s.chunks, c)
+	}
+
+	if dec.Err() != nil {
+		return nil, errors.Wrap(dec.Err(), "decoding checkpoint record")
+	}
+	if dec.Len() > 0 {
+		return nil, errors.Wrapf(errInvalidWALRecord, "%d unused bytes", dec.Len())
+	}
+	return s, nil
+}
+
+func encodeLabels(buf *encoding.Encbuf, lbls labels.Labels) {
+	buf.PutUvarint(len(lbls))
+	for _, l := range lbls {
+		buf.PutUvarintStr(l.Name)
+		buf.PutUvarintStr(l.Value)
+	}
+}
+
+func decodeLabels(dec *encoding.Decbuf) labels.Labels {
+	n := dec.Uvarint()
+	if dec.Err() != nil {
+		return nil
+	}
+	lbls := make(labels.Labels, 0, n)
+	for i := 0; i < n && dec.Err() == nil; i++ {
+		lbls = append(lbls, labels.Label{Name: dec.UvarintStr(), Value: dec.UvarintStr()})
+	}
+	return lbls
+}
+
+// encodeTime encodes a time as nanoseconds, the zero time is encoded as 0.
+func encodeTime(buf *encoding.Encbuf, t time.Time) {
+	if t.IsZero() {
+		buf.PutVarint64(0)
+		return
+	}
+	buf.PutVarint64(t.UnixNano())
+}
+
+func decodeTime(dec *encoding.Decbuf) time.Time {
+	ns := dec.Varint64()
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
@@ -54,8 +54,13 @@ type Config struct {
 	BlockSize         int           `yaml:"chunk_block_size"`
 	TargetChunkSize   int           `yaml:"chunk_target_size"`
 	ChunkEncoding     string        `yaml:"chunk_encoding"`
+	ChunkBloomFilters bool          `yaml:"chunk_bloom_filters"`
 	MaxChunkAge       time.Duration `yaml:"max_chunk_age"`
 
+	// Per-tenant compression dictionaries, embedded in the chunks.
+	ChunkDictionarySize          int           `yaml:"chunk_dictionary_size"`
+	ChunkDictionaryRetrainPeriod time.Duration `yaml:"chunk_dictionary_retrain_period"`
+
 	// Synchronization settings. Used to make sure that ingesters cut their chunks at the same moments.
 	SyncPeriod         time.Duration `yaml:"sync_period"`
 	SyncMinUtilization float64       `yaml:"sync_min_utilization"`
@@ -67,11 +72,14 @@ type Config struct {
 
 	QueryStore                  bool          `yaml:"-"`
 	QueryStoreMaxLookBackPeriod time.Duration `yaml:"query_store_max_look_back_period"`
+
+	WAL WALConfig `yaml:"wal,omitempty"`
 }
 
 // RegisterFlags registers the flags.
 func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	cfg.LifecyclerConfig.RegisterFlags(f)
+	cfg.WAL.RegisterFlags(f)
 
 	f.IntVar(&cfg.MaxTransferRetries, "ingester.max-transfer-retries", 10, "Number of times to try and transfer chunks before falling back to flushing. If set to 0 or negative value, transfers are disabled.")
 	f.IntVar(&cfg.ConcurrentFlushes, "ingester.concurrent-flushed", 16, "")
@@ -82,6 +90,9 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&cfg.BlockSize, "ingester.chunks-block-size", 256*1024, "")
 	f.IntVar(&cfg.TargetChunkSize, "ingester.chunk-target-size", 0, "")
 	f.StringVar(&cfg.ChunkEncoding, "ingester.chunk-encoding", chunkenc.EncGZIP.String(), fmt.Sprintf("The algorithm to use for compressing chunk. (%s)", chunkenc.SupportedEncoding()))
+	f.BoolVar(&cfg.ChunkBloomFilters, "ingester.chunk-bloom-filters", false, "Write a bloom filter of the n-grams of the lines of each chunk block, letting queries skip the blocks and chunks their line filters can't match.")
+	f.IntVar(&cfg.ChunkDictionarySize, "ingester.chunk-dictionary-size", 0, "Size in bytes of the compression dictionary trained for each tenant from a sample of its recent lines and embedded in its chunks. 0 to disable, only supported by the zstd chunk encodings.")
+	f.DurationVar(&cfg.ChunkDictionaryRetrainPeriod, "ingester.chunk-dictionary-retrain-period", time.Hour, "How often the compression dictionary of a tenant is retrained.")
 	f.DurationVar(&cfg.SyncPeriod, "ingester.sync-period", 0, "How often to cut chunks to synchronize ingesters.")
 	f.Float64Var(&cfg.SyncMinUtilization, "ingester.sync-min-utilization", 0, "Minimum utilization of chunk when doing synchronization.")
 	f.IntVar(&cfg.MaxReturnedErrors, "ingester.max-ignored-stream-errors", 10, "Maximum number of ignored stream errors to return. 0 to return all errors.")
@@ -89,6 +100,26 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.DurationVar(&cfg.QueryStoreMaxLookBackPeriod, "ingester.query-store-max-look-back-period", 0, "How far back should an ingester be allowed to query the store for data, for use only with boltdb-shipper index and filesystem object store. -1 for infinite.")
 }
 
+// Validate validates the ingester config.
+func (cfg *Config) Validate() error {
+	if err := cfg.WAL.Validate(); err != nil {
+		return err
+	}
+	if cfg.WAL.Enabled && cfg.MaxTransferRetries > 0 {
+		return errors.New("the WAL cannot be enabled with chunk transfers, set -ingester.max-transfer-retries to 0")
+	}
+	if cfg.ChunkDictionarySize > 0 {
+		enc, err := chunkenc.ParseEncoding(cfg.ChunkEncoding)
+		if err != nil {
+			return err
+		}
+		if !enc.SupportsDictionary() {
+			return fmt.Errorf("the %s chunk encoding doesn't support compression dictionaries", enc)
+		}
+	}
+	return nil
+}
+
 // Ingester builds chunks for incoming log streams.
 type Ingester struct {
 	services.Service
@@ -116,7 +147,11 @@ type Ingester struct {
 	flushQueuesDone sync.WaitGroup
 
 	limiter *Limiter
-	factory func() chunkenc.Chunk
+	factory func(unordered bool) chunkenc.Chunk
+
+	// Pushed entries are logged to the WAL when enabled.
+	wal        WAL
+	registerer prometheus.Registerer
 }
 
 // ChunkStore is the interface we need to store chunks.
@@ -144,12 +179,25 @@ func New(cfg Config, clientConfig client.Config, store ChunkStore, limits *valid
 		loopQuit:     make(chan struct{}),
 		flushQueues:  make([]*util.PriorityQueue, cfg.ConcurrentFlushes),
 		tailersQuit:  make(chan struct{}),
-		factory: func() chunkenc.Chunk {
-			return chunkenc.NewMemChunk(enc, cfg.BlockSize, cfg.TargetChunkSize)
+		factory: func(unordered bool) chunkenc.Chunk {
+			var c *chunkenc.MemChunk
+			if unordered {
+				c = chunkenc.NewUnorderedMemChunk(enc, cfg.BlockSize, cfg.TargetChunkSize)
+			} else {
+				c = chunkenc.NewMemChunk(enc, cfg.BlockSize, cfg.TargetChunkSize)
+			}
+			if cfg.ChunkBloomFilters {
+				c.EnableBloomFilters()
+			}
+			return c
 		},
+		wal:        noopWAL{},
+		registerer: registerer,
 	}
 
-	i.lifecycler, err = ring.NewLifecycler(cfg.LifecyclerConfig, i, "ingester", ring.IngesterRingKey, true, registerer)
+	// With the WAL, chunks are only flushed on shutdown if asked, they are replayed on restart otherwise.
+	flushOnShutdown := !cfg.WAL.Enabled || cfg.WAL.FlushOnShutdown
+	i.lifecycler, err = ring.NewLifecycler(cfg.LifecyclerConfig, i, "ingester", ring.IngesterRingKey, flushOnShutdown, registerer)
 	if err != nil {
 		return nil, err
 	}
@@ -166,6 +214,12 @@ func New(cfg Config, clientConfig client.Config, store ChunkStore, limits *valid
 }
 
 func (i *Ingester) starting(ctx context.Context) error {
+	if i.cfg.WAL.Enabled {
+		if err := i.startWAL(); err != nil {
+			return err
+		}
+	}
+
 	i.flushQueuesDone.Add(i.cfg.ConcurrentFlushes)
 	for j := 0; j < i.cfg.ConcurrentFlushes; j++ {
 		i.flushQueues[j] = util.NewPriorityQueue(flushQueueLength)
@@ -224,6 +278,10 @@ func (i *Ingester) stopping(_ error) error {
 	}
 	i.flushQueuesDone.Wait()
 
+	// The last checkpoint is written once no more entries are pushed.
+	if walErr := i.wal.Stop(); err == nil {
+		err = walErr
+	}
 	return err
 }
 
@@ -268,7 +326,7 @@ func (i *Ingester) getOrCreateInstance(instanceID string) *instance {
 	defer i.instancesMtx.Unlock()
 	inst, ok = i.instances[instanceID]
 	if !ok {
-		inst = newInstance(&i.cfg, instanceID, i.factory, i.limiter, i.cfg.SyncPeriod, i.cfg.SyncMinUtilization)
+		inst = newInstance(&i.cfg, instanceID, i.factory, i.limiter, i.cfg.SyncPeriod, i.cfg.SyncMinUtilization, i.wal)
 		i.instances[instanceID] = inst
 	}
 	return inst
@@ -72,14 +72,18 @@ type instance struct {
 	tailerMtx sync.RWMutex
 
 	limiter *Limiter
-	factory func() chunkenc.Chunk
+	factory func(unordered bool) chunkenc.Chunk
+	wal     WAL
+
+	// dictionaries trains the compression dictionary of the chunks of the tenant, nil when disabled.
+	dictionaries *chunkenc.DictionaryTrainer
 
 	// sync
 	syncPeriod  time.Duration
 	syncMinUtil float64
 }
 
-func newInstance(cfg *Config, instanceID string, factory func() chunkenc.Chunk, limiter *Limiter, syncPeriod time.Duration, syncMinUtil float64) *instance {
+func newInstance(cfg *Config, instanceID string, factory func(unordered bool) chunkenc.Chunk, limiter *Limiter, syncPeriod time.Duration, syncMinUtil float64, wal WAL) *instance {
 	i := &instance{
 		cfg:        cfg,
 		streams:    map[model.Fingerprint]*stream{},
@@ -92,11 +96,23 @@ func newInstance(cfg *Config, instanceID string, factory func() chunkenc.Chunk,
 		factory: factory,
 		tailers: map[uint32]*tailer{},
 		limiter: limiter,
+		wal:     wal,
 
 		syncPeriod:  syncPeriod,
 		syncMinUtil: syncMinUtil,
 	}
 	i.mapper = newFPMapper(i.getLabelsFromFingerprint)
+
+	if cfg.ChunkDictionarySize > 0 {
+		i.dictionaries = chunkenc.NewDictionaryTrainer(cfg.ChunkDictionarySize, cfg.ChunkDictionaryRetrainPeriod)
+		i.factory = func(unordered bool) chunkenc.Chunk {
+			c := factory(unordered)
+			if mc, ok := c.(*chunkenc.MemChunk); ok {
+				mc.SetDictionary(i.dictionaries.Dictionary())
+			}
+			return c
+		}
+	}
 	return i
 }
 
@@ -132,19 +148,53 @@ func (i *instance) Push(ctx context.Context, req *logproto.PushRequest) error {
 	defer i.streamsMtx.Unlock()
 
 	var appendErr error
-	for _, s := range req.Streams {
-
+	streams := make([]*stream, len(req.Streams))
+	// The record is only built when the WAL is enabled.
+	var record *walRecord
+	if i.wal.Enabled() {
+		record = &walRecord{userID: i.instanceID}
+	}
+	for j, s := range req.Streams {
 		stream, err := i.getOrCreateStream(s)
 		if err != nil {
 			appendErr = err
 			continue
 		}
+		streams[j] = stream
+
+		if record == nil {
+			continue
+		}
+		if !stream.walSeriesLogged {
+			record.series = append(record.series, walSeries{ref: uint64(stream.fp), labels: stream.labels})
+		}
+		record.entries = append(record.entries, walEntries{ref: uint64(stream.fp), entries: s.Entries})
+	}
+
+	// Entries are only appended once logged, so they are not lost if the ingester crashes after acknowledging them.
+	if record != nil {
+		if err := i.wal.Log(record); err != nil {
+			return httpgrpc.Errorf(http.StatusInternalServerError, "unable to write to WAL: %s", err)
+		}
+	}
+
+	for j, s := range req.Streams {
+		stream := streams[j]
+		if stream == nil {
+			continue
+		}
+		stream.walSeriesLogged = true
 
 		prevNumChunks := len(stream.chunks)
-		if err := stream.Push(ctx, s.Entries, i.syncPeriod, i.syncMinUtil); err != nil {
+		if _, err := stream.Push(ctx, s.Entries, i.syncPeriod, i.syncMinUtil); err != nil {
 			appendErr = err
 			continue
 		}
+		if i.dictionaries != nil {
+			for _, e := range s.Entries {
+				i.dictionaries.Add(e.Line)
+			}
+		}
 
 		memoryChunks.Add(float64(len(stream.chunks) - prevNumChunks))
 	}
@@ -157,15 +207,7 @@ func (i *instance) getOrCreateStream(pushReqStream logproto.Stream) (*stream, er
 	if err != nil {
 		return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
 	}
-	rawFp := client.FastFingerprint(labels)
-	fp := i.mapper.mapFP(rawFp, labels)
-
-	stream, ok := i.streams[fp]
-	if ok {
-		return stream, nil
-	}
-
-	err = i.limiter.AssertMaxStreamsPerUser(i.instanceID, len(i.streams))
+	stream, err := i.getOrCreateStreamByLabels(labels)
 	if err != nil {
 		validation.DiscardedSamples.WithLabelValues(validation.StreamLimit, i.instanceID).Add(float64(len(pushReqStream.Entries)))
 		bytes := 0
@@ -175,9 +217,29 @@ func (i *instance) getOrCreateStream(pushReqStream logproto.Stream) (*stream, er
 		validation.DiscardedBytes.WithLabelValues(validation.StreamLimit, i.instanceID).Add(float64(bytes))
 		return nil, httpgrpc.Errorf(http.StatusTooManyRequests, validation.StreamLimitErrorMsg())
 	}
+	return stream, nil
+}
+
+// getOrCreateStreamByLabels returns the stream with the given labels, creating it if the stream limit allows it.
+// Must hold streamsMtx.
+func (i *instance) getOrCreateStreamByLabels(labels []client.LabelAdapter) (*stream, error) {
+	rawFp := client.FastFingerprint(labels)
+	fp := i.mapper.mapFP(rawFp, labels)
+
+	stream, ok := i.streams[fp]
+	if ok {
+		return stream, nil
+	}
+
+	if err := i.limiter.AssertMaxStreamsPerUser(i.instanceID, len(i.streams)); err != nil {
+		return nil, err
+	}
 
 	sortedLabels := i.index.Add(labels, fp)
 	stream = newStream(i.cfg, fp, sortedLabels, i.factory)
+	stream.outOfOrderWindowLimit = func() time.Duration {
+		return i.limiter.limits.OutOfOrderWindow(i.instanceID)
+	}
 	i.streams[fp] = stream
 	memoryStreams.WithLabelValues(i.instanceID).Inc()
 	i.streamsCreatedTotal.Inc()
@@ -204,6 +266,10 @@ func (i *instance) Query(ctx context.Context, req logql.SelectLogParams) ([]iter
 	if err != nil {
 		return nil, err
 	}
+	pipeline, err := expr.Pipeline()
+	if err != nil {
+		return nil, err
+	}
 
 	ingStats := stats.GetIngesterData(ctx)
 	var iters []iter.EntryIterator
@@ -215,7 +281,7 @@ func (i *instance) Query(ctx context.Context, req logql.SelectLogParams) ([]iter
 			if err != nil {
 				return err
 			}
-			iters = append(iters, iter)
+			iters = append(iters, logql.NewPipelineEntryIterator(iter, pipeline))
 			return nil
 		},
 	)
@@ -239,12 +305,25 @@ func (i *instance) QuerySample(ctx context.Context, req logql.SelectSampleParams
 	if err != nil {
 		return nil, err
 	}
+	pipeline, err := expr.Selector().Pipeline()
+	if err != nil {
+		return nil, err
+	}
 	ingStats := stats.GetIngesterData(ctx)
 	var iters []iter.SampleIterator
 	err = i.forMatchingStreams(
 		expr.Selector().Matchers(),
 		func(stream *stream) error {
 			ingStats.TotalChunksMatched += int64(len(stream.chunks))
+			// samples of a pipeline are extracted from processed entries as labels can change for each line.
+			if logql.NeedsPipeline(pipeline, extractor) {
+				it, err := stream.Iterator(ctx, req.Start, req.End, logproto.FORWARD, filter)
+				if err != nil {
+					return err
+				}
+				iters = append(iters, logql.NewPipelineSampleIterator(it, pipeline, extractor))
+				return nil
+			}
 			iter, err := stream.SampleIterator(ctx, req.Start, req.End, filter, extractor)
 			if err != nil {
 				return err
@@ -531,4 +610,4 @@ func shouldConsiderStream(stream *stream, req *logproto.SeriesRequest) bool {
 		return true
 	}
 	return false
-}
\ No newline at end of file
+}
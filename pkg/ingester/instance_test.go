@@ -1,6 +1,7 @@
 package ingester
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"math/rand"
@@ -19,7 +20,10 @@ import (
 	"github.com/grafana/loki/pkg/util/validation"
 )
 
-var defaultFactory = func() chunkenc.Chunk {
+var defaultFactory = func(unordered bool) chunkenc.Chunk {
+	if unordered {
+		return chunkenc.NewUnorderedMemChunk(chunkenc.EncGZIP, 512, 0)
+	}
 	return chunkenc.NewMemChunk(chunkenc.EncGZIP, 512, 0)
 }
 
@@ -28,7 +32,7 @@ func TestLabelsCollisions(t *testing.T) {
 	require.NoError(t, err)
 	limiter := NewLimiter(limits, &ringCountMock{count: 1}, 1)
 
-	i := newInstance(&Config{}, "test", defaultFactory, limiter, 0, 0)
+	i := newInstance(&Config{}, "test", defaultFactory, limiter, 0, 0, noopWAL{})
 
 	// avoid entries from the future.
 	tt := time.Now().Add(-5 * time.Minute)
@@ -55,7 +59,7 @@ func TestConcurrentPushes(t *testing.T) {
 	require.NoError(t, err)
 	limiter := NewLimiter(limits, &ringCountMock{count: 1}, 1)
 
-	inst := newInstance(&Config{}, "test", defaultFactory, limiter, 0, 0)
+	inst := newInstance(&Config{}, "test", defaultFactory, limiter, 0, 0, noopWAL{})
 
 	const (
 		concurrent          = 10
@@ -113,7 +117,7 @@ func TestSyncPeriod(t *testing.T) {
 		minUtil    = 0.20
 	)
 
-	inst := newInstance(&Config{}, "test", defaultFactory, limiter, syncPeriod, minUtil)
+	inst := newInstance(&Config{}, "test", defaultFactory, limiter, syncPeriod, minUtil, noopWAL{})
 	lbls := makeRandomLabels()
 
 	tt := time.Now()
@@ -152,7 +156,7 @@ func Test_SeriesQuery(t *testing.T) {
 	syncPeriod := 1 * time.Minute
 	minUtil := 0.20
 
-	instance := newInstance(&Config{}, "test", defaultFactory, limiter, syncPeriod, minUtil)
+	instance := newInstance(&Config{}, "test", defaultFactory, limiter, syncPeriod, minUtil, noopWAL{})
 
 	currentTime := time.Now()
 
@@ -164,7 +168,7 @@ func Test_SeriesQuery(t *testing.T) {
 	for _, testStream := range testStreams {
 		stream, err := instance.getOrCreateStream(testStream)
 		require.NoError(t, err)
-		chunk := defaultFactory()
+		chunk := defaultFactory(false)
 		for _, entry := range testStream.Entries {
 			err = chunk.Append(&entry)
 			require.NoError(t, err)
@@ -239,6 +243,39 @@ func Test_SeriesQuery(t *testing.T) {
 
 }
 
+func TestInstance_ChunkDictionary(t *testing.T) {
+	limits, err := validation.NewOverrides(validation.Limits{MaxLocalStreamsPerUser: 1000}, nil)
+	require.NoError(t, err)
+	limiter := NewLimiter(limits, &ringCountMock{count: 1}, 1)
+
+	cfg := &Config{ChunkDictionarySize: 128, ChunkDictionaryRetrainPeriod: time.Hour}
+	factory := func(unordered bool) chunkenc.Chunk {
+		return chunkenc.NewMemChunk(chunkenc.EncZstd, 512, 0)
+	}
+	inst := newInstance(cfg, "test", factory, limiter, 0, 0, noopWAL{})
+
+	tt := time.Now().Add(-5 * time.Minute)
+	for j := 0; inst.dictionaries.Dictionary() == nil; j++ {
+		require.NoError(t, inst.Push(context.Background(), &logproto.PushRequest{Streams: []logproto.Stream{
+			{Labels: `{app="foo"}`, Entries: entries(100, tt.Add(time.Duration(j)*time.Millisecond))},
+		}}))
+		if j > 1000 {
+			require.Fail(t, "no dictionary trained")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// chunks created once the dictionary is trained embed it.
+	require.NoError(t, inst.Push(context.Background(), &logproto.PushRequest{Streams: []logproto.Stream{
+		{Labels: `{app="bar"}`, Entries: entries(100, tt)},
+	}}))
+	s, err := inst.getOrCreateStream(logproto.Stream{Labels: `{app="bar"}`})
+	require.NoError(t, err)
+	b, err := s.chunks[0].chunk.Bytes()
+	require.NoError(t, err)
+	require.True(t, bytes.Contains(b, inst.dictionaries.Dictionary()))
+}
+
 func entries(n int, t time.Time) []logproto.Entry {
 	var result []logproto.Entry
 	for i := 0; i < n; i++ {
@@ -0,0 +1,309 @@
+package ingester
+
+import (
+	"context"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/tsdb/record"
+	"github.com/prometheus/prometheus/tsdb/wal"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/loki/pkg/chunkenc"
+)
+
+const (
+	replayDropReasonStreamLimit = "stream_limit"
+	replayDropReasonUnknown     = "unknown_stream"
+)
+
+var (
+	walReplayActive = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "loki",
+		Name:      "ingester_wal_replay_active",
+		Help:      "Whether the WAL is being replayed.",
+	})
+	walReplayDuration = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "loki",
+		Name:      "ingester_wal_replay_duration_seconds",
+		Help:      "Time taken to replay the checkpoint and the WAL.",
+	})
+	walReplaySegments = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "loki",
+		Name:      "ingester_wal_replay_segments",
+		Help:      "Number of WAL segments to replay, including the checkpoint.",
+	})
+	walReplaySegmentsDone = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "loki",
+		Name:      "ingester_wal_replay_segments_replayed",
+		Help:      "Number of WAL segments replayed so far, including the checkpoint.",
+	})
+	walRecoveredStreams = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "loki",
+		Name:      "ingester_wal_recovered_streams_total",
+		Help:      "Total number of streams recovered from the checkpoint and the WAL.",
+	})
+	walRecoveredChunks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "loki",
+		Name:      "ingester_wal_recovered_chunks_total",
+		Help:      "Total number of chunks recovered from the checkpoint.",
+	})
+	walRecoveredEntries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "loki",
+		Name:      "ingester_wal_recovered_entries_total",
+		Help:      "Total number of entries replayed from the WAL.",
+	})
+	walReplayDroppedEntries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "loki",
+		Name:      "ingester_wal_replay_dropped_entries_total",
+		Help:      "Total number of entries dropped during the WAL replay per reason.",
+	}, []string{"reason"})
+	walCorruptions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "loki",
+		Name:      "ingester_wal_corruptions_total",
+		Help:      "Total number of WAL corruptions encountered during replay.",
+	})
+)
+
+// recoverer rebuilds the in-memory streams of an ingester from the last checkpoint and the WAL segments following it.
+type recoverer struct {
+	ing *Ingester
+	// Streams of each tenant by the reference they have in the WAL.
+	streams map[string]map[uint64]*stream
+}
+
+// startWAL opens the WAL, replays it and starts checkpointing. Pushed entries are only logged once replayed.
+func (i *Ingester) startWAL() error {
+	w, err := newWAL(i.cfg.WAL, i.registerer, i.getInstances)
+	if err != nil {
+		return errors.Wrap(err, "unable to open WAL")
+	}
+
+	// The instances created during the replay keep the WAL of the ingester, it must be set beforehand.
+	i.wal = w
+	if err := i.recoverFromWAL(w.wal); err != nil {
+		// Only the segments can be repaired, not the checkpoint.
+		cerr, ok := errors.Cause(err).(*wal.CorruptionErr)
+		if !ok || cerr.Dir != w.wal.Dir() {
+			w.wal.Close()
+			i.wal = noopWAL{}
+			return errors.Wrap(err, "unable to recover from WAL")
+		}
+		walCorruptions.Inc()
+		level.Error(util.Logger).Log("msg", "WAL is corrupted, repairing it", "err", cerr)
+		if err := w.wal.Repair(cerr); err != nil {
+			w.wal.Close()
+			i.wal = noopWAL{}
+			return errors.Wrap(err, "unable to repair WAL")
+		}
+	}
+
+	w.start()
+	return nil
+}
+
+// recoverFromWAL replays the last checkpoint and the segments of w following it.
+// It must run before the ingester joins the ring. On corruption the records read so far are kept
+// and a *wal.CorruptionErr is returned.
+func (i *Ingester) recoverFromWAL(w *wal.WAL) error {
+	start := time.Now()
+	walReplayActive.Set(1)
+	defer func() {
+		walReplayActive.Set(0)
+		walReplayDuration.Set(time.Since(start).Seconds())
+	}()
+
+	r := &recoverer{
+		ing:     i,
+		streams: map[string]map[uint64]*stream{},
+	}
+
+	dir := w.Dir()
+	from := 0
+	checkpoint, index, err := wal.LastCheckpoint(dir)
+	if err != nil && err != record.ErrNotFound {
+		return errors.Wrap(err, "unable to find the last checkpoint")
+	}
+	hasCheckpoint := err == nil
+	if hasCheckpoint {
+		from = index + 1
+	}
+
+	first, last, err := w.Segments()
+	if err != nil {
+		return err
+	}
+	if first < from {
+		first = from
+	}
+	total := 0
+	if last >= first {
+		total = last - first + 1
+	}
+	if hasCheckpoint {
+		total++
+	}
+	walReplaySegments.Set(float64(total))
+	walReplaySegmentsDone.Set(0)
+
+	level.Info(util.Logger).Log("msg", "recovering from WAL", "dir", dir, "checkpoint", checkpoint, "first_segment", first, "last_segment", last)
+
+	if hasCheckpoint {
+		if err := r.replayCheckpoint(checkpoint); err != nil {
+			return errors.Wrapf(err, "unable to replay checkpoint %s", checkpoint)
+		}
+		walReplaySegmentsDone.Inc()
+	}
+
+	for s := first; s <= last; s++ {
+		if err := r.replaySegment(dir, s); err != nil {
+			return err
+		}
+		walReplaySegmentsDone.Inc()
+	}
+
+	level.Info(util.Logger).Log("msg", "WAL recovery done", "duration", time.Since(start))
+	return nil
+}
+
+func (r *recoverer) replaySegment(dir string, index int) error {
+	sr, err := wal.NewSegmentsRangeReader(wal.SegmentRange{Dir: dir, First: index, Last: index})
+	if err != nil {
+		return err
+	}
+	defer sr.Close()
+
+	reader := wal.NewReader(sr)
+	rec := &walRecord{}
+	for reader.Next() {
+		if err := decodeWALRecord(reader.Record(), rec); err != nil {
+			return &wal.CorruptionErr{Dir: dir, Segment: index, Offset: reader.Offset(), Err: err}
+		}
+		r.replayRecord(rec)
+	}
+	return reader.Err()
+}
+
+func (r *recoverer) replayCheckpoint(dir string) error {
+	sr, err := wal.NewSegmentsReader(dir)
+	if err != nil {
+		return err
+	}
+	defer sr.Close()
+
+	reader := wal.NewReader(sr)
+	for reader.Next() {
+		if err := r.replayCheckpointRecord(reader.Record()); err != nil {
+			return err
+		}
+	}
+	return reader.Err()
+}
+
+// getOrCreateStream returns the stream referenced by ref in the WAL of a tenant,
+// it is nil if the stream limit of the tenant was reached.
+func (r *recoverer) getOrCreateStream(userID string, ref uint64, lbls []client.LabelAdapter) (*stream, *instance) {
+	inst := r.ing.getOrCreateInstance(userID)
+	inst.streamsMtx.Lock()
+	defer inst.streamsMtx.Unlock()
+
+	if r.streams[userID] == nil {
+		r.streams[userID] = map[uint64]*stream{}
+	}
+
+	prevStreams := len(inst.streams)
+	s, err := inst.getOrCreateStreamByLabels(lbls)
+	if err != nil {
+		// Remember the stream was dropped so its entries are accounted for.
+		r.streams[userID][ref] = nil
+		return nil, inst
+	}
+	if len(inst.streams) > prevStreams {
+		walRecoveredStreams.Inc()
+	}
+	r.streams[userID][ref] = s
+	return s, inst
+}
+
+func (r *recoverer) replayCheckpointRecord(b []byte) error {
+	cs, err := decodeCheckpointStream(b)
+	if err != nil {
+		return err
+	}
+
+	s, inst := r.getOrCreateStream(cs.userID, cs.ref, client.FromLabelsToLabelAdapters(cs.labels))
+	if s == nil {
+		for _, c := range cs.chunks {
+			// The head block is not counted, there is no cheap way to know its number of entries.
+			if mc, err := chunkenc.NewByteChunk(c.chunk, 0, 0); err == nil {
+				walReplayDroppedEntries.WithLabelValues(replayDropReasonStreamLimit).Add(float64(mc.Size()))
+			}
+		}
+		return nil
+	}
+
+	inst.streamsMtx.Lock()
+	defer inst.streamsMtx.Unlock()
+	unordered := s.outOfOrderWindow() > 0
+	for _, c := range cs.chunks {
+		mc, err := chunkenc.NewMemChunkFromCheckpoint(c.chunk, c.head, unordered, r.ing.cfg.BlockSize, r.ing.cfg.TargetChunkSize)
+		if err != nil {
+			return err
+		}
+		if r.ing.cfg.ChunkBloomFilters {
+			mc.EnableBloomFilters()
+		}
+		if _, through := mc.Bounds(); through.After(s.newest) {
+			s.newest = through
+		}
+		s.chunks = append(s.chunks, chunkDesc{
+			chunk:       mc,
+			closed:      c.closed,
+			synced:      c.synced,
+			flushed:     c.flushed,
+			lastUpdated: c.lastUpdated,
+			unordered:   unordered,
+		})
+		memoryChunks.Inc()
+		walRecoveredChunks.Inc()
+	}
+	s.lastLine = cs.lastLine
+	return nil
+}
+
+func (r *recoverer) replayRecord(rec *walRecord) {
+	for _, series := range rec.series {
+		r.getOrCreateStream(rec.userID, series.ref, client.FromLabelsToLabelAdapters(series.labels))
+	}
+
+	if len(rec.entries) == 0 {
+		return
+	}
+	inst := r.ing.getOrCreateInstance(rec.userID)
+	ctx := user.InjectOrgID(context.Background(), rec.userID)
+
+	inst.streamsMtx.Lock()
+	defer inst.streamsMtx.Unlock()
+	for _, e := range rec.entries {
+		s, ok := r.streams[rec.userID][e.ref]
+		if !ok {
+			walReplayDroppedEntries.WithLabelValues(replayDropReasonUnknown).Add(float64(len(e.entries)))
+			continue
+		}
+		if s == nil {
+			walReplayDroppedEntries.WithLabelValues(replayDropReasonStreamLimit).Add(float64(len(e.entries)))
+			continue
+		}
+
+		prevNumChunks := len(s.chunks)
+		// Entries already in the checkpoint are rejected as out of order or duplicates, which is expected.
+		appended, _ := s.Push(ctx, e.entries, inst.syncPeriod, inst.syncMinUtil)
+		memoryChunks.Add(float64(len(s.chunks) - prevNumChunks))
+		walRecoveredEntries.Add(float64(appended))
+	}
+}
@@ -64,18 +64,27 @@ type stream struct {
 	fp           model.Fingerprint // possibly remapped fingerprint, used in the streams map
 	labels       labels.Labels
 	labelsString string
-	factory      func() chunkenc.Chunk
+	factory      func(unordered bool) chunkenc.Chunk
 	lastLine     line
 
+	// Entries older than the newest entry of the stream by at most the window it returns are accepted.
+	// It is read on every push, so a change of the limit applies to the existing streams.
+	outOfOrderWindowLimit func() time.Duration
+	newest                time.Time
+
+	// Whether the creation of the stream has been written to the WAL.
+	walSeriesLogged bool
+
 	tailers   map[uint32]*tailer
 	tailerMtx sync.RWMutex
 }
 
 type chunkDesc struct {
-	chunk   chunkenc.Chunk
-	closed  bool
-	synced  bool
-	flushed time.Time
+	chunk     chunkenc.Chunk
+	closed    bool
+	synced    bool
+	flushed   time.Time
+	unordered bool
 
 	lastUpdated time.Time
 }
@@ -85,7 +94,7 @@ type entryWithError struct {
 	e     error
 }
 
-func newStream(cfg *Config, fp model.Fingerprint, labels labels.Labels, factory func() chunkenc.Chunk) *stream {
+func newStream(cfg *Config, fp model.Fingerprint, labels labels.Labels, factory func(unordered bool) chunkenc.Chunk) *stream {
 	return &stream{
 		cfg:          cfg,
 		fp:           fp,
@@ -111,12 +120,13 @@ func (s *stream) consumeChunk(_ context.Context, chunk *logproto.Chunk) error {
 	return nil
 }
 
-func (s *stream) Push(ctx context.Context, entries []logproto.Entry, synchronizePeriod time.Duration, minUtilization float64) error {
+// Push appends the entries to the stream and returns the number of entries appended.
+func (s *stream) Push(ctx context.Context, entries []logproto.Entry, synchronizePeriod time.Duration, minUtilization float64) (int, error) {
 	var lastChunkTimestamp time.Time
+	window := s.outOfOrderWindow()
+	unordered := window > 0
 	if len(s.chunks) == 0 {
-		s.chunks = append(s.chunks, chunkDesc{
-			chunk: s.factory(),
-		})
+		s.chunks = append(s.chunks, s.newChunk(unordered))
 		chunksCreatedTotal.Inc()
 	} else {
 		_, lastChunkTimestamp = s.chunks[len(s.chunks)-1].chunk.Bounds()
@@ -140,8 +150,16 @@ func (s *stream) Push(ctx context.Context, entries []logproto.Entry, synchronize
 			continue
 		}
 
+		// Chunks accept entries in any order when the window is enabled, the window is enforced here
+		// as it also applies across chunks.
+		if unordered && entries[i].Timestamp.Before(s.newest.Add(-window)) {
+			failedEntriesWithError = append(failedEntriesWithError, entryWithError{&entries[i], chunkenc.ErrOutOfOrder})
+			continue
+		}
+
 		chunk := &s.chunks[len(s.chunks)-1]
-		if chunk.closed || !chunk.chunk.SpaceFor(&entries[i]) || s.cutChunkForSynchronization(entries[i].Timestamp, lastChunkTimestamp, chunk, synchronizePeriod, minUtilization) {
+		// The chunk is also cut when the window was enabled or disabled since it was created.
+		if chunk.closed || chunk.unordered != unordered || !chunk.chunk.SpaceFor(&entries[i]) || s.cutChunkForSynchronization(entries[i].Timestamp, lastChunkTimestamp, chunk, synchronizePeriod, minUtilization) {
 			// If the chunk has no more space call Close to make sure anything in the head block is cut and compressed
 			err := chunk.chunk.Close()
 			if err != nil {
@@ -155,9 +173,7 @@ func (s *stream) Push(ctx context.Context, entries []logproto.Entry, synchronize
 			blocksPerChunk.Observe(float64(chunk.chunk.BlockCount()))
 			chunksCreatedTotal.Inc()
 
-			s.chunks = append(s.chunks, chunkDesc{
-				chunk: s.factory(),
-			})
+			s.chunks = append(s.chunks, s.newChunk(unordered))
 			chunk = &s.chunks[len(s.chunks)-1]
 			lastChunkTimestamp = time.Time{}
 		}
@@ -166,8 +182,13 @@ func (s *stream) Push(ctx context.Context, entries []logproto.Entry, synchronize
 		} else {
 			// send only stored entries to tailers
 			storedEntries = append(storedEntries, entries[i])
-			lastChunkTimestamp = entries[i].Timestamp
-			s.lastLine = line{ts: lastChunkTimestamp, content: entries[i].Line}
+			if entries[i].Timestamp.After(lastChunkTimestamp) {
+				lastChunkTimestamp = entries[i].Timestamp
+			}
+			if entries[i].Timestamp.After(s.newest) {
+				s.newest = entries[i].Timestamp
+			}
+			s.lastLine = line{ts: entries[i].Timestamp, content: entries[i].Line}
 		}
 		chunk.lastUpdated = time.Now()
 	}
@@ -219,18 +240,19 @@ func (s *stream) Push(ctx context.Context, entries []logproto.Entry, synchronize
 
 			fmt.Fprintf(&buf, "total ignored: %d out of %d", len(failedEntriesWithError), len(entries))
 
-			return httpgrpc.Errorf(http.StatusBadRequest, buf.String())
+			return len(storedEntries), httpgrpc.Errorf(http.StatusBadRequest, buf.String())
 		}
-		return lastEntryWithErr.e
+		return len(storedEntries), lastEntryWithErr.e
 	}
 
-	return nil
+	return len(storedEntries), nil
 }
 
 // Returns true, if chunk should be cut before adding new entry. This is done to make ingesters
 // cut the chunk for this stream at the same moment, so that new chunk will contain exactly the same entries.
 func (s *stream) cutChunkForSynchronization(entryTimestamp, prevEntryTimestamp time.Time, c *chunkDesc, synchronizePeriod time.Duration, minUtilization float64) bool {
-	if synchronizePeriod <= 0 || prevEntryTimestamp.IsZero() {
+	// out of order entries do not roll over the synchronization period.
+	if synchronizePeriod <= 0 || prevEntryTimestamp.IsZero() || entryTimestamp.Before(prevEntryTimestamp) {
 		return false
 	}
 
@@ -268,6 +290,11 @@ func (s *stream) Iterator(ctx context.Context, from, through time.Time, directio
 		}
 	}
 
+	if s.chunksOverlapping() {
+		// The heap iterator does not know the labels of the stream, they are set by wrapping it.
+		return iter.NewNonOverlappingIterator([]iter.EntryIterator{iter.NewHeapIterator(ctx, iterators, direction)}, s.labelsString), nil
+	}
+
 	if direction != logproto.FORWARD {
 		for left, right := 0, len(iterators)-1; left < right; left, right = left+1, right-1 {
 			iterators[left], iterators[right] = iterators[right], iterators[left]
@@ -286,9 +313,41 @@ func (s *stream) SampleIterator(ctx context.Context, from, through time.Time, fi
 		}
 	}
 
+	if s.chunksOverlapping() {
+		return iter.NewNonOverlappingSampleIterator([]iter.SampleIterator{iter.NewHeapSampleIterator(ctx, iterators)}, s.labelsString), nil
+	}
+
 	return iter.NewNonOverlappingSampleIterator(iterators, s.labelsString), nil
 }
 
+// chunksOverlapping returns whether a chunk starts before the end of the previous one,
+// which happens when out of order entries are accepted.
+func (s *stream) chunksOverlapping() bool {
+	for i := 1; i < len(s.chunks); i++ {
+		from, _ := s.chunks[i].chunk.Bounds()
+		_, prevThrough := s.chunks[i-1].chunk.Bounds()
+		if from.Before(prevThrough) {
+			return true
+		}
+	}
+	return false
+}
+
+// outOfOrderWindow returns the current out of order window of the stream, 0 when out of order entries are rejected.
+func (s *stream) outOfOrderWindow() time.Duration {
+	if s.outOfOrderWindowLimit == nil {
+		return 0
+	}
+	return s.outOfOrderWindowLimit()
+}
+
+func (s *stream) newChunk(unordered bool) chunkDesc {
+	return chunkDesc{
+		chunk:     s.factory(unordered),
+		unordered: unordered,
+	}
+}
+
 func (s *stream) addTailer(t *tailer) {
 	s.tailerMtx.Lock()
 	defer s.tailerMtx.Unlock()
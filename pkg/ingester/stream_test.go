@@ -41,7 +41,7 @@ func TestMaxReturnedStreamsErrors(t *testing.T) {
 				defaultFactory,
 			)
 
-			err := s.Push(context.Background(), []logproto.Entry{
+			_, err := s.Push(context.Background(), []logproto.Entry{
 				{Timestamp: time.Unix(int64(numLogs), 0), Line: "log"},
 			}, 0, 0)
 			require.NoError(t, err)
@@ -62,7 +62,7 @@ func TestMaxReturnedStreamsErrors(t *testing.T) {
 			fmt.Fprintf(&expected, "total ignored: %d out of %d", numLogs, numLogs)
 			expectErr := httpgrpc.Errorf(http.StatusBadRequest, expected.String())
 
-			err = s.Push(context.Background(), newLines, 0, 0)
+			_, err = s.Push(context.Background(), newLines, 0, 0)
 			require.Error(t, err)
 			require.Equal(t, expectErr.Error(), err.Error())
 		})
@@ -79,12 +79,13 @@ func TestPushDeduplication(t *testing.T) {
 		defaultFactory,
 	)
 
-	err := s.Push(context.Background(), []logproto.Entry{
+	appended, err := s.Push(context.Background(), []logproto.Entry{
 		{Timestamp: time.Unix(1, 0), Line: "test"},
 		{Timestamp: time.Unix(1, 0), Line: "test"},
 		{Timestamp: time.Unix(1, 0), Line: "newer, better test"},
 	}, 0, 0)
 	require.NoError(t, err)
+	require.Equal(t, 2, appended)
 	require.Len(t, s.chunks, 1)
 	require.Equal(t, s.chunks[0].chunk.Size(), 2,
 		"expected exact duplicate to be dropped and newer content with same timestamp to be appended")
@@ -139,3 +140,65 @@ func TestStreamIterator(t *testing.T) {
 	}
 
 }
+
+func TestPushOutOfOrderWindow(t *testing.T) {
+	s := newStream(
+		&Config{},
+		model.Fingerprint(0),
+		labels.Labels{
+			{Name: "foo", Value: "bar"},
+		},
+		defaultFactory,
+	)
+	window := 10 * time.Second
+	s.outOfOrderWindowLimit = func() time.Duration { return window }
+
+	_, err := s.Push(context.Background(), []logproto.Entry{
+		{Timestamp: time.Unix(20, 0), Line: "20"},
+		{Timestamp: time.Unix(15, 0), Line: "15"},
+		{Timestamp: time.Unix(9, 0), Line: "9"},
+		{Timestamp: time.Unix(25, 0), Line: "25"},
+		{Timestamp: time.Unix(10, 0), Line: "10"},
+	}, 0, 0)
+	// only the entries older than the newest one by more than the window are rejected.
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "total ignored: 2 out of 5")
+
+	// close the chunk, the window also applies to the next one.
+	require.NoError(t, s.chunks[0].chunk.Close())
+	s.chunks[0].closed = true
+	_, err = s.Push(context.Background(), []logproto.Entry{
+		{Timestamp: time.Unix(18, 0), Line: "18"},
+		{Timestamp: time.Unix(14, 0), Line: "14"},
+	}, 0, 0)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "total ignored: 1 out of 2")
+	require.Len(t, s.chunks, 2)
+
+	for _, direction := range []logproto.Direction{logproto.FORWARD, logproto.BACKWARD} {
+		it, err := s.Iterator(context.Background(), time.Unix(0, 0), time.Unix(100, 0), direction, nil)
+		require.NoError(t, err)
+		var lines []string
+		for it.Next() {
+			require.Equal(t, s.labelsString, it.Labels())
+			lines = append(lines, it.Entry().Line)
+		}
+		require.NoError(t, it.Close())
+		expected := []string{"15", "18", "20", "25"}
+		if direction == logproto.BACKWARD {
+			expected = []string{"25", "20", "18", "15"}
+		}
+		require.Equal(t, expected, lines)
+	}
+
+	// the limit is read on every push, disabling the window cuts the chunk and rejects out of order entries.
+	window = 0
+	_, err = s.Push(context.Background(), []logproto.Entry{
+		{Timestamp: time.Unix(30, 0), Line: "30"},
+		{Timestamp: time.Unix(28, 0), Line: "28"},
+	}, 0, 0)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "total ignored: 1 out of 2")
+	require.Len(t, s.chunks, 3)
+	require.False(t, s.chunks[2].unordered)
+}
@@ -0,0 +1,243 @@
+package ingester
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/tsdb/fileutil"
+	"github.com/prometheus/prometheus/tsdb/wal"
+)
+
+var (
+	walRecordsLogged = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "loki",
+		Name:      "ingester_wal_records_logged_total",
+		Help:      "Total number of records written to the WAL.",
+	})
+	walLoggedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "loki",
+		Name:      "ingester_wal_logged_bytes_total",
+		Help:      "Total number of bytes written to the WAL.",
+	})
+	checkpointCreations = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "loki",
+		Name:      "ingester_checkpoint_creations_total",
+		Help:      "Total number of checkpoints attempted.",
+	})
+	checkpointFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "loki",
+		Name:      "ingester_checkpoint_creations_failed_total",
+		Help:      "Total number of checkpoints that failed.",
+	})
+	checkpointDuration = promauto.NewSummary(prometheus.SummaryOpts{
+		Namespace:  "loki",
+		Name:       "ingester_checkpoint_duration_seconds",
+		Help:       "Time taken to create a checkpoint.",
+		Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+	})
+)
+
+// WALConfig configures the write-ahead log of the ingester.
+type WALConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `yaml:"dir"`
+	// How frequently the in-memory chunks are checkpointed, which allows to truncate the WAL.
+	CheckpointDuration time.Duration `yaml:"checkpoint_duration"`
+	// Whether chunks are flushed on shutdown, they are kept in the WAL otherwise.
+	FlushOnShutdown bool `yaml:"flush_on_shutdown"`
+}
+
+// RegisterFlags registers the flags.
+func (cfg *WALConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "ingester.wal-enabled", false, "Enable writing pushed entries to a write-ahead log, which is replayed on startup.")
+	f.StringVar(&cfg.Dir, "ingester.wal-dir", "wal", "Directory to store the write-ahead log and its checkpoints in.")
+	f.DurationVar(&cfg.CheckpointDuration, "ingester.checkpoint-duration", 5*time.Minute, "Interval at which in-memory chunks are checkpointed and the write-ahead log is truncated.")
+	f.BoolVar(&cfg.FlushOnShutdown, "ingester.flush-on-shutdown", false, "When the write-ahead log is enabled, flush chunks on shutdown instead of only checkpointing them.")
+}
+
+// Validate validates the WAL config.
+func (cfg *WALConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.Dir == "" {
+		return errors.New("a WAL directory is required when the WAL is enabled")
+	}
+	if cfg.CheckpointDuration <= 0 {
+		return errors.New("checkpoint duration must be greater than zero")
+	}
+	return nil
+}
+
+// WAL persists pushed entries so they can be replayed after a restart.
+type WAL interface {
+	// Enabled returns whether the records are persisted, they don't need to be built otherwise.
+	Enabled() bool
+	// Log writes the record to the WAL.
+	Log(*walRecord) error
+	// Stop writes a last checkpoint and closes the WAL.
+	Stop() error
+}
+
+type noopWAL struct{}
+
+func (noopWAL) Enabled() bool        { return false }
+func (noopWAL) Log(*walRecord) error { return nil }
+func (noopWAL) Stop() error          { return nil }
+
+// walWrapper logs records to a segmented WAL and periodically checkpoints the in-memory chunks.
+// A checkpoint contains every stream of the ingester, once written all the segments before it are truncated.
+type walWrapper struct {
+	cfg       WALConfig
+	wal       *wal.WAL
+	instances func() []*instance
+
+	quit chan struct{}
+	wait sync.WaitGroup
+}
+
+// newWAL opens the WAL in cfg.Dir, a new segment is created after the existing ones.
+// Checkpoints are only taken once start is called.
+func newWAL(cfg WALConfig, registerer prometheus.Registerer, instances func() []*instance) (*walWrapper, error) {
+	w, err := wal.New(util.Logger, registerer, cfg.Dir, true)
+	if err != nil {
+		return nil, err
+	}
+	return &walWrapper{
+		cfg:       cfg,
+		wal:       w,
+		instances: instances,
+		quit:      make(chan struct{}),
+	}, nil
+}
+
+func (w *walWrapper) start() {
+	w.wait.Add(1)
+	go w.run()
+}
+
+// Enabled implements WAL.
+func (w *walWrapper) Enabled() bool {
+	return true
+}
+
+// Log implements WAL.
+func (w *walWrapper) Log(r *walRecord) error {
+	if r == nil || r.isEmpty() {
+		return nil
+	}
+	recs := r.encode()
+	if err := w.wal.Log(recs...); err != nil {
+		return err
+	}
+	walRecordsLogged.Add(float64(len(recs)))
+	for _, rec := range recs {
+		walLoggedBytes.Add(float64(len(rec)))
+	}
+	return nil
+}
+
+// Stop implements WAL.
+func (w *walWrapper) Stop() error {
+	close(w.quit)
+	w.wait.Wait()
+
+	if err := w.checkpoint(); err != nil {
+		level.Error(util.Logger).Log("msg", "failed to checkpoint on shutdown", "err", err)
+	}
+	return w.wal.Close()
+}
+
+func (w *walWrapper) run() {
+	defer w.wait.Done()
+
+	ticker := time.NewTicker(w.cfg.CheckpointDuration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.checkpoint(); err != nil {
+				level.Error(util.Logger).Log("msg", "failed to checkpoint in-memory chunks", "err", err)
+			}
+		case <-w.quit:
+			return
+		}
+	}
+}
+
+// checkpoint writes every stream in memory to a new checkpoint and truncates the segments it covers.
+//
+// A new segment is started first: pushes log their records and append their entries while holding
+// the lock of their instance, so every entry logged in the previous segments is in memory
+// once the lock is acquired to checkpoint the stream.
+func (w *walWrapper) checkpoint() (err error) {
+	checkpointCreations.Inc()
+	start := time.Now()
+	defer func() {
+		if err != nil {
+			checkpointFailures.Inc()
+			return
+		}
+		checkpointDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	if err := w.wal.NextSegment(); err != nil {
+		return errors.Wrap(err, "unable to start a new segment")
+	}
+	_, last, err := w.wal.Segments()
+	if err != nil {
+		return err
+	}
+	index := last - 1
+
+	dir := filepath.Join(w.wal.Dir(), fmt.Sprintf("checkpoint.%08d", index))
+	tmp := dir + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return errors.Wrap(err, "unable to remove previous temporary checkpoint")
+	}
+	cp, err := wal.New(nil, nil, tmp, true)
+	if err != nil {
+		return errors.Wrap(err, "unable to create checkpoint")
+	}
+	defer func() {
+		if err != nil {
+			cp.Close()
+			os.RemoveAll(tmp)
+		}
+	}()
+
+	for _, inst := range w.instances() {
+		if err := inst.checkpoint(func(s *checkpointStream) error {
+			return cp.Log(s.encode())
+		}); err != nil {
+			return errors.Wrapf(err, "unable to checkpoint tenant %s", inst.instanceID)
+		}
+	}
+	if err := cp.Close(); err != nil {
+		return errors.Wrap(err, "unable to close checkpoint")
+	}
+	if err := fileutil.Replace(tmp, dir); err != nil {
+		return errors.Wrap(err, "unable to rename checkpoint")
+	}
+
+	level.Info(util.Logger).Log("msg", "checkpoint done", "index", index, "duration", time.Since(start))
+
+	if err := w.wal.Truncate(last); err != nil {
+		return errors.Wrap(err, "unable to truncate WAL")
+	}
+	if err := wal.DeleteCheckpoints(w.wal.Dir(), index); err != nil {
+		// Older checkpoints are ignored during replay.
+		level.Warn(util.Logger).Log("msg", "unable to delete old checkpoints", "err", err)
+	}
+	return nil
+}
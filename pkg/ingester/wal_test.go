@@ -0,0 +1,163 @@
+package ingester
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/util/services"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+	"golang.org/x/net/context"
+
+	"github.com/grafana/loki/pkg/ingester/client"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/grafana/loki/pkg/util/validation"
+)
+
+func TestWALRecordEncoding(t *testing.T) {
+	rec := &walRecord{
+		userID: "tenant",
+		series: []walSeries{
+			{ref: 1, labels: labels.FromStrings("foo", "bar")},
+		},
+		entries: []walEntries{
+			{ref: 1, entries: []logproto.Entry{{Timestamp: time.Unix(0, 1), Line: "1"}, {Timestamp: time.Unix(0, 2), Line: "2"}}},
+			{ref: 2, entries: []logproto.Entry{{Timestamp: time.Unix(0, 3), Line: "3"}}},
+		},
+	}
+	recs := rec.encode()
+	require.Len(t, recs, 2)
+
+	var decoded walRecord
+	require.NoError(t, decodeWALRecord(recs[0], &decoded))
+	require.Equal(t, rec.userID, decoded.userID)
+	require.Equal(t, rec.series, decoded.series)
+	require.Empty(t, decoded.entries)
+
+	require.NoError(t, decodeWALRecord(recs[1], &decoded))
+	require.Equal(t, rec.userID, decoded.userID)
+	require.Empty(t, decoded.series)
+	require.Equal(t, rec.entries, decoded.entries)
+
+	require.Error(t, decodeWALRecord(recs[1][:len(recs[1])-1], &decoded))
+
+	cs := &checkpointStream{
+		userID:   "tenant",
+		ref:      1,
+		labels:   labels.FromStrings("foo", "bar"),
+		lastLine: line{ts: time.Unix(0, 2), content: "2"},
+		chunks: []checkpointChunk{
+			{closed: true, flushed: time.Unix(10, 0), lastUpdated: time.Unix(5, 0), chunk: []byte("chunk"), head: []byte("head")},
+			{synced: true, lastUpdated: time.Unix(6, 0), chunk: []byte("chunk2")},
+		},
+	}
+	decodedStream, err := decodeCheckpointStream(cs.encode())
+	require.NoError(t, err)
+	require.Equal(t, cs, decodedStream)
+}
+
+func TestIngesterWALReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := defaultIngesterTestConfig(t)
+	cfg.MaxTransferRetries = 0
+	cfg.WAL = WALConfig{Enabled: true, Dir: dir, CheckpointDuration: time.Hour}
+	require.NoError(t, cfg.Validate())
+
+	newIngester := func(maxStreams int) (*Ingester, *mockStore) {
+		limits := defaultLimitsTestConfig()
+		limits.MaxLocalStreamsPerUser = maxStreams
+		overrides, err := validation.NewOverrides(limits, nil)
+		require.NoError(t, err)
+
+		store := &mockStore{chunks: map[string][]chunk.Chunk{}}
+		i, err := New(cfg, client.Config{}, store, overrides, nil)
+		require.NoError(t, err)
+		require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+		return i, store
+	}
+
+	ctx := user.InjectOrgID(context.Background(), "test")
+	push := func(i *Ingester, from, to int) {
+		for _, lbs := range []string{`{foo="bar",bar="baz1"}`, `{foo="bar",bar="baz2"}`} {
+			req := &logproto.PushRequest{Streams: []logproto.Stream{{Labels: lbs}}}
+			for j := from; j < to; j++ {
+				req.Streams[0].Entries = append(req.Streams[0].Entries, logproto.Entry{
+					Timestamp: time.Unix(int64(j), 0),
+					Line:      fmt.Sprintf("line %d", j),
+				})
+			}
+			_, err := i.Push(ctx, req)
+			require.NoError(t, err)
+		}
+	}
+	countEntries := func(i *Ingester) map[string]int {
+		result := mockQuerierServer{ctx: ctx}
+		require.NoError(t, i.Query(&logproto.QueryRequest{
+			Selector: `{foo="bar"}`,
+			Limit:    1000,
+			Start:    time.Unix(0, 0),
+			End:      time.Unix(1000, 0),
+		}, &result))
+		counts := map[string]int{}
+		for _, resp := range result.resps {
+			for _, s := range resp.Streams {
+				counts[s.Labels] += len(s.Entries)
+			}
+		}
+		return counts
+	}
+
+	// crash stops the ingester without writing a checkpoint.
+	crash := func(i *Ingester, store *mockStore) {
+		w := i.wal.(*walWrapper)
+		close(w.quit)
+		require.NoError(t, w.wal.Close())
+		i.wal = noopWAL{}
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), i))
+		require.Empty(t, store.chunks)
+	}
+
+	// entries pushed before the checkpoint are recovered from it, the others from the segments.
+	i, store := newIngester(0)
+	push(i, 0, 10)
+	require.NoError(t, i.wal.(*walWrapper).checkpoint())
+	push(i, 10, 20)
+	crash(i, store)
+
+	i, store = newIngester(0)
+	require.Equal(t, map[string]int{
+		`{bar="baz1", foo="bar"}`: 20,
+		`{bar="baz2", foo="bar"}`: 20,
+	}, countEntries(i))
+
+	// the entries pushed to a tenant recovered from the WAL are logged too.
+	push(i, 20, 25)
+	crash(i, store)
+
+	i, _ = newIngester(0)
+	require.Equal(t, map[string]int{
+		`{bar="baz1", foo="bar"}`: 25,
+		`{bar="baz2", foo="bar"}`: 25,
+	}, countEntries(i))
+
+	// replayed and new entries are checkpointed on shutdown.
+	push(i, 25, 30)
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), i))
+
+	// streams above the limit are not recovered.
+	i, _ = newIngester(1)
+	defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+	counts := countEntries(i)
+	require.Len(t, counts, 1)
+	for _, c := range counts {
+		require.Equal(t, 30, c)
+	}
+}
@@ -0,0 +1,189 @@
+package stages
+
+import (
+	"reflect"
+	"regexp"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/loki/pkg/util/flagext"
+)
+
+// Config Errors
+const (
+	ErrDropStageEmptyConfig       = "drop stage config must contain at least one of `source`, `expression`, `older_than` or `longer_than`"
+	ErrDropStageEmptySource       = "drop stage `source` cannot be an empty string"
+	ErrDropStageInvalidDuration   = "drop stage invalid duration for `older_than`"
+	ErrDropStageInvalidByteSize   = "drop stage invalid byte size for `longer_than`"
+	ErrDropStageInvalidRegex      = "drop stage regex compilation error"
+	ErrDropStageEmptyDropReason   = "drop stage `drop_counter_reason` cannot be an empty string"
+	defaultDropStageCounterReason = "drop_stage"
+)
+
+// DropConfig contains the configuration for a dropStage
+type DropConfig struct {
+	DropReason *string `mapstructure:"drop_counter_reason"`
+	Source     *string `mapstructure:"source"`
+	Expression *string `mapstructure:"expression"`
+	OlderThan  *string `mapstructure:"older_than"`
+	LongerThan *string `mapstructure:"longer_than"`
+
+	regex      *regexp.Regexp
+	olderThan  time.Duration
+	longerThan flagext.ByteSize
+}
+
+// validateDropConfig validates the DropConfig for the dropStage
+func validateDropConfig(cfg *DropConfig) error {
+	if cfg == nil ||
+		(cfg.Source == nil && cfg.Expression == nil && cfg.OlderThan == nil && cfg.LongerThan == nil) {
+		return errors.New(ErrDropStageEmptyConfig)
+	}
+	if cfg.Source != nil && *cfg.Source == "" {
+		return errors.New(ErrDropStageEmptySource)
+	}
+	if cfg.DropReason != nil && *cfg.DropReason == "" {
+		return errors.New(ErrDropStageEmptyDropReason)
+	}
+	if cfg.Expression != nil {
+		expr, err := regexp.Compile(*cfg.Expression)
+		if err != nil {
+			return errors.Wrap(err, ErrDropStageInvalidRegex)
+		}
+		cfg.regex = expr
+	}
+	if cfg.OlderThan != nil {
+		dur, err := time.ParseDuration(*cfg.OlderThan)
+		if err != nil {
+			return errors.Wrap(err, ErrDropStageInvalidDuration)
+		}
+		cfg.olderThan = dur
+	}
+	if cfg.LongerThan != nil {
+		if err := cfg.longerThan.Set(*cfg.LongerThan); err != nil {
+			return errors.Wrap(err, ErrDropStageInvalidByteSize)
+		}
+	}
+	return nil
+}
+
+// newDropStage creates a dropStage from config
+func newDropStage(logger log.Logger, config interface{}, registerer prometheus.Registerer) (Stage, error) {
+	cfg := &DropConfig{}
+	// weakly typed so that `longer_than` can be given as a number of bytes.
+	err := mapstructure.WeakDecode(config, cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = validateDropConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	reason := defaultDropStageCounterReason
+	if cfg.DropReason != nil {
+		reason = *cfg.DropReason
+	}
+
+	return &dropStage{
+		logger:  log.With(logger, "component", "stage", "type", "drop"),
+		cfg:     cfg,
+		dropped: droppedLinesCounter(registerer).WithLabelValues(reason),
+	}, nil
+}
+
+// droppedLinesCounter returns the counter of the entries dropped by the drop stages, registering it if needed.
+func droppedLinesCounter(registerer prometheus.Registerer) *prometheus.CounterVec {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "logentry",
+		Name:      "dropped_lines_total",
+		Help:      "A count of all log lines dropped as a result of a pipeline stage",
+	}, []string{"reason"})
+	err := registerer.Register(counter)
+	if err != nil {
+		if existing, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			counter = existing.ExistingCollector.(*prometheus.CounterVec)
+		} else {
+			// Same behavior as MustRegister if the error is not for AlreadyRegistered
+			panic(err)
+		}
+	}
+	return counter
+}
+
+// dropStage drops the entries matching all of its conditions.
+type dropStage struct {
+	logger  log.Logger
+	cfg     *DropConfig
+	dropped prometheus.Counter
+}
+
+// Process implements Stage
+func (m *dropStage) Process(labels model.LabelSet, extracted map[string]interface{}, t *time.Time, entry *string) {
+	// There is no point in dropping an entry twice.
+	if _, ok := labels[dropLabel]; ok {
+		return
+	}
+	if !m.shouldDrop(extracted, *t, *entry) {
+		return
+	}
+	// Adds the drop label to not be sent by the api.EntryHandler
+	labels[dropLabel] = ""
+	m.dropped.Inc()
+}
+
+// shouldDrop returns whether the entry matches all the conditions of the stage.
+func (m *dropStage) shouldDrop(extracted map[string]interface{}, t time.Time, entry string) bool {
+	if m.cfg.LongerThan != nil && len(entry) <= m.cfg.longerThan.Val() {
+		if Debug {
+			level.Debug(m.logger).Log("msg", "line was not longer than the configured length", "length", len(entry), "longer_than", m.cfg.longerThan)
+		}
+		return false
+	}
+
+	if m.cfg.OlderThan != nil && !t.Before(time.Now().Add(-m.cfg.olderThan)) {
+		if Debug {
+			level.Debug(m.logger).Log("msg", "line timestamp was not older than the configured duration", "time", t, "older_than", m.cfg.olderThan)
+		}
+		return false
+	}
+
+	input := entry
+	if m.cfg.Source != nil {
+		v, ok := extracted[*m.cfg.Source]
+		if !ok {
+			if Debug {
+				level.Debug(m.logger).Log("msg", "source does not exist in the set of extracted values", "source", *m.cfg.Source)
+			}
+			return false
+		}
+		value, err := getString(v)
+		if err != nil {
+			if Debug {
+				level.Debug(m.logger).Log("msg", "failed to convert source value to string", "source", *m.cfg.Source, "err", err, "type", reflect.TypeOf(v))
+			}
+			return false
+		}
+		input = value
+	}
+
+	// Without expression, a source is dropped as soon as it is extracted.
+	if m.cfg.regex != nil && !m.cfg.regex.MatchString(input) {
+		if Debug {
+			level.Debug(m.logger).Log("msg", "regex did not match", "input", input, "regex", m.cfg.regex)
+		}
+		return false
+	}
+	return true
+}
+
+// Name implements Stage
+func (m *dropStage) Name() string {
+	return StageTypeDrop
+}
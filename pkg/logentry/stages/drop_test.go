@@ -0,0 +1,191 @@
+package stages
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testDropYaml = `
+pipeline_stages:
+- regex:
+    expression: "^(?P<method>\\S+) (?P<path>\\S+)"
+- drop:
+    source: path
+    expression: "^/health"
+    drop_counter_reason: health_check
+- drop:
+    longer_than: 32
+- drop:
+    older_than: 24h
+`
+
+func TestDropPipeline(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	pl, err := NewPipeline(util.Logger, loadConfig(testDropYaml), nil, registry)
+	require.NoError(t, err)
+	rec := &recordingHandler{}
+	handler := pl.Wrap(rec)
+
+	now := time.Now()
+	for _, e := range []struct {
+		line string
+		time time.Time
+	}{
+		{"GET /health 200", now},
+		{"GET /api/v1/push 200", now},
+		{"GET /api/v1/push 200 " + strings.Repeat("a", 32), now},
+		{"GET /api/v1/query 200", now.Add(-48 * time.Hour)},
+		{"GET /api/v1/query 200", now.Add(-time.Hour)},
+	} {
+		require.NoError(t, handler.Handle(model.LabelSet{}, e.time, e.line))
+	}
+	assert.Equal(t, []string{"GET /api/v1/push 200", "GET /api/v1/query 200"}, rec.lines())
+
+	expected := `
+		# HELP logentry_dropped_lines_total A count of all log lines dropped as a result of a pipeline stage
+		# TYPE logentry_dropped_lines_total counter
+		logentry_dropped_lines_total{reason="drop_stage"} 2
+		logentry_dropped_lines_total{reason="health_check"} 1
+	`
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "logentry_dropped_lines_total"))
+}
+
+func TestDropStage_Process(t *testing.T) {
+	source := "level"
+	debug := "debug"
+	notMatching := "^info$"
+	hour := "1h"
+	length := "1KB"
+
+	tests := map[string]struct {
+		config    *DropConfig
+		extracted map[string]interface{}
+		t         time.Time
+		entry     string
+		dropped   bool
+	}{
+		"line matching expression": {
+			config:  &DropConfig{Expression: &debug},
+			entry:   "some debug line",
+			dropped: true,
+		},
+		"line not matching expression": {
+			config: &DropConfig{Expression: &notMatching},
+			entry:  "some debug line",
+		},
+		"extracted value matching expression": {
+			config:    &DropConfig{Source: &source, Expression: &debug},
+			extracted: map[string]interface{}{"level": "debug"},
+			entry:     "line",
+			dropped:   true,
+		},
+		"missing extracted value": {
+			config: &DropConfig{Source: &source, Expression: &debug},
+			entry:  "some debug line",
+		},
+		"source only": {
+			config:    &DropConfig{Source: &source},
+			extracted: map[string]interface{}{"level": "info"},
+			entry:     "line",
+			dropped:   true,
+		},
+		"older than": {
+			config:  &DropConfig{OlderThan: &hour},
+			t:       time.Now().Add(-2 * time.Hour),
+			entry:   "line",
+			dropped: true,
+		},
+		"not older than": {
+			config: &DropConfig{OlderThan: &hour},
+			t:      time.Now().Add(-30 * time.Minute),
+			entry:  "line",
+		},
+		"longer than": {
+			config:  &DropConfig{LongerThan: &length},
+			entry:   strings.Repeat("a", 1025),
+			dropped: true,
+		},
+		"not longer than": {
+			config: &DropConfig{LongerThan: &length},
+			entry:  strings.Repeat("a", 1024),
+		},
+		"all conditions must match": {
+			config:  &DropConfig{Expression: &debug, OlderThan: &hour},
+			t:       time.Now(),
+			entry:   "some debug line",
+			dropped: false,
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			require.NoError(t, validateDropConfig(tt.config))
+			st := &dropStage{logger: util.Logger, cfg: tt.config, dropped: prometheus.NewCounter(prometheus.CounterOpts{Name: "test"})}
+
+			labels := model.LabelSet{}
+			extracted := tt.extracted
+			if extracted == nil {
+				extracted = map[string]interface{}{}
+			}
+			ts, entry := tt.t, tt.entry
+			st.Process(labels, extracted, &ts, &entry)
+			_, dropped := labels[dropLabel]
+			assert.Equal(t, tt.dropped, dropped)
+		})
+	}
+}
+
+func TestDropStage_Validation(t *testing.T) {
+	t.Parallel()
+
+	empty := ""
+	invalidRegex := "("
+	invalidDuration := "1parsec"
+	invalidSize := "big"
+
+	tests := map[string]struct {
+		config      *DropConfig
+		expectedErr error
+	}{
+		"empty config": {
+			config:      &DropConfig{},
+			expectedErr: errors.New(ErrDropStageEmptyConfig),
+		},
+		"empty source": {
+			config:      &DropConfig{Source: &empty},
+			expectedErr: errors.New(ErrDropStageEmptySource),
+		},
+		"invalid regex": {
+			config:      &DropConfig{Expression: &invalidRegex},
+			expectedErr: errors.Wrap(errors.New("error parsing regexp: missing closing ): `(`"), ErrDropStageInvalidRegex),
+		},
+		"invalid duration": {
+			config:      &DropConfig{OlderThan: &invalidDuration},
+			expectedErr: errors.Wrap(errors.New(`time: unknown unit "parsec" in duration "1parsec"`), ErrDropStageInvalidDuration),
+		},
+		"invalid size": {
+			config: &DropConfig{LongerThan: &invalidSize},
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			err := validateDropConfig(tt.config)
+			require.Error(t, err)
+			if tt.expectedErr != nil {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+			}
+		})
+	}
+}
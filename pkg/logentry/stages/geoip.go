@@ -0,0 +1,220 @@
+package stages
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/mitchellh/mapstructure"
+	"github.com/oschwald/geoip2-golang"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+)
+
+// Config Errors
+const (
+	ErrEmptyGeoIPStageConfig = "geoip stage config cannot be empty"
+	ErrEmptyGeoIPStageDB     = "geoip stage `db` is required"
+	ErrEmptyGeoIPStageSource = "geoip stage `source` is required"
+	ErrInvalidGeoIPDBType    = "geoip stage `db_type` should be 'city', 'country' or 'asn'"
+	ErrCouldNotOpenGeoIPDB   = "could not open the geoip database"
+)
+
+// Supported database types
+const (
+	GeoIPDBTypeCity    = "city"
+	GeoIPDBTypeCountry = "country"
+	GeoIPDBTypeASN     = "asn"
+)
+
+// Names of the extracted data set by the geoip stage
+const (
+	GeoIPCityName                     = "geoip_city_name"
+	GeoIPCountryName                  = "geoip_country_name"
+	GeoIPCountryCode                  = "geoip_country_code"
+	GeoIPContinentName                = "geoip_continent_name"
+	GeoIPContinentCode                = "geoip_continent_code"
+	GeoIPSubdivisionName              = "geoip_subdivision_name"
+	GeoIPSubdivisionCode              = "geoip_subdivision_code"
+	GeoIPPostalCode                   = "geoip_postal_code"
+	GeoIPTimezone                     = "geoip_timezone"
+	GeoIPLocationLatitude             = "geoip_location_latitude"
+	GeoIPLocationLongitude            = "geoip_location_longitude"
+	GeoIPAutonomousSystemNumber       = "geoip_autonomous_system_number"
+	GeoIPAutonomousSystemOrganization = "geoip_autonomous_system_organization"
+)
+
+// geoIPNamesLanguage is the language of the names of the locations.
+const geoIPNamesLanguage = "en"
+
+// GeoIPConfig represents a geoip Stage configuration
+type GeoIPConfig struct {
+	DB     string  `mapstructure:"db"`
+	Source *string `mapstructure:"source"`
+	DBType string  `mapstructure:"db_type"`
+}
+
+// validateGeoIPConfig validates the GeoIPConfig for the geoIPStage
+func validateGeoIPConfig(c *GeoIPConfig) error {
+	if c == nil {
+		return errors.New(ErrEmptyGeoIPStageConfig)
+	}
+	if c.DB == "" {
+		return errors.New(ErrEmptyGeoIPStageDB)
+	}
+	if c.Source == nil || *c.Source == "" {
+		return errors.New(ErrEmptyGeoIPStageSource)
+	}
+	switch c.DBType {
+	case GeoIPDBTypeCity, GeoIPDBTypeCountry, GeoIPDBTypeASN:
+	case "":
+		c.DBType = GeoIPDBTypeCity
+	default:
+		return errors.New(ErrInvalidGeoIPDBType)
+	}
+	return nil
+}
+
+// geoIPDB looks up the IP addresses in a MaxMind database, it is implemented by geoip2.Reader.
+type geoIPDB interface {
+	City(ipAddress net.IP) (*geoip2.City, error)
+	Country(ipAddress net.IP) (*geoip2.Country, error)
+	ASN(ipAddress net.IP) (*geoip2.ASN, error)
+	// Close unmaps the database file.
+	Close() error
+}
+
+// newGeoIPStage creates a new geoip pipeline stage from a config.
+func newGeoIPStage(logger log.Logger, config interface{}) (Stage, error) {
+	cfg := &GeoIPConfig{}
+	err := mapstructure.Decode(config, cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = validateGeoIPConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	db, err := geoip2.Open(cfg.DB)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrCouldNotOpenGeoIPDB)
+	}
+	return &geoIPStage{
+		cfg:    cfg,
+		db:     db,
+		logger: log.With(logger, "component", "stage", "type", "geoip"),
+	}, nil
+}
+
+// geoIPStage sets extracted data with the location or the autonomous system of an extracted IP address
+type geoIPStage struct {
+	cfg    *GeoIPConfig
+	logger log.Logger
+
+	// The database is unmapped when the stage is closed, entries still processed afterwards are not looked up.
+	mtx    sync.RWMutex
+	db     geoIPDB
+	closed bool
+}
+
+// Process implements Stage
+func (g *geoIPStage) Process(labels model.LabelSet, extracted map[string]interface{}, t *time.Time, entry *string) {
+	value, ok := extracted[*g.cfg.Source]
+	if !ok {
+		if Debug {
+			level.Debug(g.logger).Log("msg", "source does not exist in the set of extracted values", "source", *g.cfg.Source)
+		}
+		return
+	}
+	s, err := getString(value)
+	if err != nil {
+		if Debug {
+			level.Debug(g.logger).Log("msg", "failed to convert source value to string", "source", *g.cfg.Source, "err", err, "type", reflect.TypeOf(value))
+		}
+		return
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		if Debug {
+			level.Debug(g.logger).Log("msg", "source value is not an IP address", "source", *g.cfg.Source, "value", s)
+		}
+		return
+	}
+
+	g.mtx.RLock()
+	defer g.mtx.RUnlock()
+	if g.closed {
+		return
+	}
+
+	switch g.cfg.DBType {
+	case GeoIPDBTypeCity:
+		record, err := g.db.City(ip)
+		if err != nil {
+			level.Error(g.logger).Log("msg", "failed to look up the IP address", "ip", ip, "err", err)
+			return
+		}
+		setExtracted(extracted, GeoIPCityName, record.City.Names[geoIPNamesLanguage])
+		setExtracted(extracted, GeoIPCountryName, record.Country.Names[geoIPNamesLanguage])
+		setExtracted(extracted, GeoIPCountryCode, record.Country.IsoCode)
+		setExtracted(extracted, GeoIPContinentName, record.Continent.Names[geoIPNamesLanguage])
+		setExtracted(extracted, GeoIPContinentCode, record.Continent.Code)
+		if len(record.Subdivisions) > 0 {
+			// The subdivisions are ordered from the largest to the smallest.
+			setExtracted(extracted, GeoIPSubdivisionName, record.Subdivisions[0].Names[geoIPNamesLanguage])
+			setExtracted(extracted, GeoIPSubdivisionCode, record.Subdivisions[0].IsoCode)
+		}
+		setExtracted(extracted, GeoIPPostalCode, record.Postal.Code)
+		setExtracted(extracted, GeoIPTimezone, record.Location.TimeZone)
+		if record.Location.Latitude != 0 || record.Location.Longitude != 0 {
+			extracted[GeoIPLocationLatitude] = record.Location.Latitude
+			extracted[GeoIPLocationLongitude] = record.Location.Longitude
+		}
+	case GeoIPDBTypeCountry:
+		record, err := g.db.Country(ip)
+		if err != nil {
+			level.Error(g.logger).Log("msg", "failed to look up the IP address", "ip", ip, "err", err)
+			return
+		}
+		setExtracted(extracted, GeoIPCountryName, record.Country.Names[geoIPNamesLanguage])
+		setExtracted(extracted, GeoIPCountryCode, record.Country.IsoCode)
+		setExtracted(extracted, GeoIPContinentName, record.Continent.Names[geoIPNamesLanguage])
+		setExtracted(extracted, GeoIPContinentCode, record.Continent.Code)
+	case GeoIPDBTypeASN:
+		record, err := g.db.ASN(ip)
+		if err != nil {
+			level.Error(g.logger).Log("msg", "failed to look up the IP address", "ip", ip, "err", err)
+			return
+		}
+		if record.AutonomousSystemNumber != 0 {
+			extracted[GeoIPAutonomousSystemNumber] = record.AutonomousSystemNumber
+		}
+		setExtracted(extracted, GeoIPAutonomousSystemOrganization, record.AutonomousSystemOrganization)
+	}
+}
+
+// setExtracted sets the extracted value unless it is empty, i.e. unknown.
+func setExtracted(extracted map[string]interface{}, name, value string) {
+	if value != "" {
+		extracted[name] = value
+	}
+}
+
+// Close implements ClosableStage
+func (g *geoIPStage) Close() error {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if g.closed {
+		return nil
+	}
+	g.closed = true
+	return g.db.Close()
+}
+
+// Name implements Stage
+func (g *geoIPStage) Name() string {
+	return StageTypeGeoIP
+}
@@ -0,0 +1,258 @@
+package stages
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/oschwald/geoip2-golang"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/pkg/promtail/api"
+)
+
+// fakeGeoIPDB knows about a single IP address, and panics when it is used once closed like an unmapped database.
+type fakeGeoIPDB struct {
+	ip     net.IP
+	closed bool
+}
+
+var errGeoIPNotFound = errors.New("address not found")
+
+func (f *fakeGeoIPDB) City(ip net.IP) (*geoip2.City, error) {
+	f.checkOpen()
+	if !ip.Equal(f.ip) {
+		return nil, errGeoIPNotFound
+	}
+	record := &geoip2.City{}
+	record.City.Names = map[string]string{"en": "Paris", "fr": "Paris"}
+	record.Country.Names = map[string]string{"en": "France"}
+	record.Country.IsoCode = "FR"
+	record.Continent.Names = map[string]string{"en": "Europe"}
+	record.Continent.Code = "EU"
+	record.Subdivisions = append(record.Subdivisions, struct {
+		GeoNameID uint              `maxminddb:"geoname_id"`
+		IsoCode   string            `maxminddb:"iso_code"`
+		Names     map[string]string `maxminddb:"names"`
+	}{IsoCode: "IDF", Names: map[string]string{"en": "Île-de-France"}})
+	record.Postal.Code = "75001"
+	record.Location.TimeZone = "Europe/Paris"
+	record.Location.Latitude = 48.8582
+	record.Location.Longitude = 2.3387
+	return record, nil
+}
+
+func (f *fakeGeoIPDB) Country(ip net.IP) (*geoip2.Country, error) {
+	f.checkOpen()
+	if !ip.Equal(f.ip) {
+		return nil, errGeoIPNotFound
+	}
+	record := &geoip2.Country{}
+	record.Country.Names = map[string]string{"en": "France"}
+	record.Country.IsoCode = "FR"
+	record.Continent.Names = map[string]string{"en": "Europe"}
+	record.Continent.Code = "EU"
+	return record, nil
+}
+
+func (f *fakeGeoIPDB) ASN(ip net.IP) (*geoip2.ASN, error) {
+	f.checkOpen()
+	if !ip.Equal(f.ip) {
+		return nil, errGeoIPNotFound
+	}
+	return &geoip2.ASN{AutonomousSystemNumber: 12322, AutonomousSystemOrganization: "Free SAS"}, nil
+}
+
+func (f *fakeGeoIPDB) Close() error {
+	f.checkOpen()
+	f.closed = true
+	return nil
+}
+
+func (f *fakeGeoIPDB) checkOpen() {
+	if f.closed {
+		panic("geoip database used after being closed")
+	}
+}
+
+func TestGeoIPStage_Process(t *testing.T) {
+	t.Parallel()
+
+	source := "ip"
+	tests := map[string]struct {
+		dbType            string
+		extracted         map[string]interface{}
+		expectedExtracted map[string]interface{}
+	}{
+		"city": {
+			dbType:    GeoIPDBTypeCity,
+			extracted: map[string]interface{}{"ip": "82.64.12.34"},
+			expectedExtracted: map[string]interface{}{
+				"ip":                   "82.64.12.34",
+				GeoIPCityName:          "Paris",
+				GeoIPCountryName:       "France",
+				GeoIPCountryCode:       "FR",
+				GeoIPContinentName:     "Europe",
+				GeoIPContinentCode:     "EU",
+				GeoIPSubdivisionName:   "Île-de-France",
+				GeoIPSubdivisionCode:   "IDF",
+				GeoIPPostalCode:        "75001",
+				GeoIPTimezone:          "Europe/Paris",
+				GeoIPLocationLatitude:  48.8582,
+				GeoIPLocationLongitude: 2.3387,
+			},
+		},
+		"country": {
+			dbType:    GeoIPDBTypeCountry,
+			extracted: map[string]interface{}{"ip": "82.64.12.34"},
+			expectedExtracted: map[string]interface{}{
+				"ip":               "82.64.12.34",
+				GeoIPCountryName:   "France",
+				GeoIPCountryCode:   "FR",
+				GeoIPContinentName: "Europe",
+				GeoIPContinentCode: "EU",
+			},
+		},
+		"asn": {
+			dbType:    GeoIPDBTypeASN,
+			extracted: map[string]interface{}{"ip": "82.64.12.34"},
+			expectedExtracted: map[string]interface{}{
+				"ip":                              "82.64.12.34",
+				GeoIPAutonomousSystemNumber:       uint(12322),
+				GeoIPAutonomousSystemOrganization: "Free SAS",
+			},
+		},
+		"unknown address": {
+			dbType:            GeoIPDBTypeCity,
+			extracted:         map[string]interface{}{"ip": "10.0.0.1"},
+			expectedExtracted: map[string]interface{}{"ip": "10.0.0.1"},
+		},
+		"invalid address": {
+			dbType:            GeoIPDBTypeCity,
+			extracted:         map[string]interface{}{"ip": "not an ip"},
+			expectedExtracted: map[string]interface{}{"ip": "not an ip"},
+		},
+		"missing source": {
+			dbType:            GeoIPDBTypeCity,
+			extracted:         map[string]interface{}{},
+			expectedExtracted: map[string]interface{}{},
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			st := &geoIPStage{
+				cfg:    &GeoIPConfig{DB: "test.mmdb", Source: &source, DBType: tt.dbType},
+				db:     &fakeGeoIPDB{ip: net.ParseIP("82.64.12.34")},
+				logger: util.Logger,
+			}
+			ts := time.Now()
+			entry := "line"
+			st.Process(model.LabelSet{}, tt.extracted, &ts, &entry)
+			assert.Equal(t, tt.expectedExtracted, tt.extracted)
+		})
+	}
+}
+
+func TestGeoIPStage_ClosedWithPipeline(t *testing.T) {
+	t.Parallel()
+
+	source := "ip"
+	db := &fakeGeoIPDB{ip: net.ParseIP("82.64.12.34")}
+	st := &geoIPStage{
+		cfg:    &GeoIPConfig{DB: "test.mmdb", Source: &source, DBType: GeoIPDBTypeCity},
+		db:     db,
+		logger: util.Logger,
+	}
+	// the stage is nested in a match stage, it is closed as well.
+	pl := &Pipeline{
+		logger: util.Logger,
+		stages: []Stage{&matcherStage{pipeline: &Pipeline{logger: util.Logger, stages: []Stage{st}}, action: MatchActionKeep}},
+	}
+
+	handler := pl.Wrap(api.EntryHandlerFunc(func(labels model.LabelSet, time time.Time, entry string) error {
+		return nil
+	}))
+	assert.False(t, db.closed)
+	api.StopEntryHandler(handler)
+	assert.True(t, db.closed)
+
+	// the entries still processed once the pipeline is stopped are not looked up.
+	extracted := map[string]interface{}{"ip": "82.64.12.34"}
+	ts := time.Now()
+	entry := "line"
+	st.Process(model.LabelSet{}, extracted, &ts, &entry)
+	assert.Equal(t, map[string]interface{}{"ip": "82.64.12.34"}, extracted)
+	require.NoError(t, st.Close())
+}
+
+func TestGeoIPStage_Validation(t *testing.T) {
+	t.Parallel()
+
+	source := "ip"
+	empty := ""
+
+	tests := map[string]struct {
+		config         *GeoIPConfig
+		expectedDBType string
+		expectedErr    error
+	}{
+		"missing config": {
+			config:      nil,
+			expectedErr: errors.New(ErrEmptyGeoIPStageConfig),
+		},
+		"missing db": {
+			config:      &GeoIPConfig{Source: &source},
+			expectedErr: errors.New(ErrEmptyGeoIPStageDB),
+		},
+		"missing source": {
+			config:      &GeoIPConfig{DB: "test.mmdb"},
+			expectedErr: errors.New(ErrEmptyGeoIPStageSource),
+		},
+		"empty source": {
+			config:      &GeoIPConfig{DB: "test.mmdb", Source: &empty},
+			expectedErr: errors.New(ErrEmptyGeoIPStageSource),
+		},
+		"invalid db type": {
+			config:      &GeoIPConfig{DB: "test.mmdb", Source: &source, DBType: "isp"},
+			expectedErr: errors.New(ErrInvalidGeoIPDBType),
+		},
+		"default db type": {
+			config:         &GeoIPConfig{DB: "test.mmdb", Source: &source},
+			expectedDBType: GeoIPDBTypeCity,
+		},
+		"asn db type": {
+			config:         &GeoIPConfig{DB: "test.mmdb", Source: &source, DBType: GeoIPDBTypeASN},
+			expectedDBType: GeoIPDBTypeASN,
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			err := validateGeoIPConfig(tt.config)
+			if tt.expectedErr != nil {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedDBType, tt.config.DBType)
+		})
+	}
+}
+
+func TestGeoIPStage_MissingDB(t *testing.T) {
+	_, err := New(util.Logger, nil, StageTypeGeoIP, map[string]interface{}{
+		"db":     filepath.Join(t.TempDir(), "missing.mmdb"),
+		"source": "ip",
+	}, nil)
+	require.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), ErrCouldNotOpenGeoIPDB), err.Error())
+}
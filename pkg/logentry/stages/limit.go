@@ -0,0 +1,162 @@
+package stages
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"golang.org/x/time/rate"
+)
+
+// Config Errors
+const (
+	ErrEmptyLimitStageConfig        = "limit stage config cannot be empty"
+	ErrLimitStageInvalidRate        = "limit stage `rate` must be positive"
+	ErrLimitStageInvalidBurst       = "limit stage `burst` must be positive"
+	ErrLimitStageInvalidMaxDistinct = "limit stage `max_distinct_labels` must be positive"
+	defaultLimitStageMaxDistinct    = 10000
+	limitStageDropCounterReason     = "limit_stage"
+)
+
+// LimitConfig contains the configuration for a limitStage
+type LimitConfig struct {
+	Rate              float64 `mapstructure:"rate"`
+	Burst             int     `mapstructure:"burst"`
+	Drop              bool    `mapstructure:"drop"`
+	ByLabelName       string  `mapstructure:"by_label_name"`
+	MaxDistinctLabels int     `mapstructure:"max_distinct_labels"`
+}
+
+// validateLimitConfig validates the LimitConfig for the limitStage
+func validateLimitConfig(cfg *LimitConfig) error {
+	if cfg == nil {
+		return errors.New(ErrEmptyLimitStageConfig)
+	}
+	if cfg.Rate <= 0 {
+		return errors.New(ErrLimitStageInvalidRate)
+	}
+	if cfg.Burst < 0 {
+		return errors.New(ErrLimitStageInvalidBurst)
+	}
+	// The burst defaults to the entries of a second.
+	if cfg.Burst == 0 {
+		cfg.Burst = int(cfg.Rate)
+		if cfg.Burst < 1 {
+			cfg.Burst = 1
+		}
+	}
+	if cfg.MaxDistinctLabels < 0 {
+		return errors.New(ErrLimitStageInvalidMaxDistinct)
+	}
+	if cfg.MaxDistinctLabels == 0 {
+		cfg.MaxDistinctLabels = defaultLimitStageMaxDistinct
+	}
+	return nil
+}
+
+// newLimitStage creates a limitStage from config
+func newLimitStage(logger log.Logger, config interface{}, registerer prometheus.Registerer) (Stage, error) {
+	cfg := &LimitConfig{}
+	err := mapstructure.Decode(config, cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = validateLimitConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	limiters, err := lru.New(cfg.MaxDistinctLabels)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &limitStage{
+		logger:   log.With(logger, "component", "stage", "type", "limit"),
+		cfg:      cfg,
+		limiters: limiters,
+		dropped:  droppedLinesCounter(registerer).WithLabelValues(limitStageDropCounterReason),
+		ctx:      ctx,
+		cancel:   cancel,
+	}, nil
+}
+
+// limitStage rate limits the entries of each stream, or of each value of a label, with a token bucket.
+// The entries over the limit are either dropped or delayed until the bucket is refilled.
+type limitStage struct {
+	logger  log.Logger
+	cfg     *LimitConfig
+	dropped prometheus.Counter
+
+	// ctx is cancelled when the pipeline is closed, the delayed entries are then processed without waiting.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mtx      sync.Mutex
+	limiters *lru.Cache
+}
+
+// Process implements Stage
+func (m *limitStage) Process(labels model.LabelSet, extracted map[string]interface{}, t *time.Time, entry *string) {
+	// The dropped entries don't count towards the limit.
+	if _, ok := labels[dropLabel]; ok {
+		return
+	}
+	limiter := m.limiter(labels)
+	if limiter == nil {
+		return
+	}
+
+	if m.cfg.Drop {
+		if !limiter.Allow() {
+			// Adds the drop label to not be sent by the api.EntryHandler
+			labels[dropLabel] = ""
+			m.dropped.Inc()
+		}
+		return
+	}
+	if err := limiter.Wait(m.ctx); err != nil && m.ctx.Err() == nil {
+		level.Error(m.logger).Log("msg", "failed to wait for the rate limit", "err", err)
+	}
+}
+
+// limiter returns the limiter of the entry, nil if the entry doesn't have the label it is limited by.
+func (m *limitStage) limiter(labels model.LabelSet) *rate.Limiter {
+	var key string
+	if m.cfg.ByLabelName == "" {
+		key = labels.String()
+	} else {
+		value, ok := labels[model.LabelName(m.cfg.ByLabelName)]
+		if !ok {
+			return nil
+		}
+		key = string(value)
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if limiter, ok := m.limiters.Get(key); ok {
+		return limiter.(*rate.Limiter)
+	}
+	limiter := rate.NewLimiter(rate.Limit(m.cfg.Rate), m.cfg.Burst)
+	m.limiters.Add(key, limiter)
+	return limiter
+}
+
+// Close implements ClosableStage, it stops the waits for the rate limit.
+func (m *limitStage) Close() error {
+	m.cancel()
+	return nil
+}
+
+// Name implements Stage
+func (m *limitStage) Name() string {
+	return StageTypeLimit
+}
@@ -0,0 +1,144 @@
+package stages
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testLimitYaml = `
+pipeline_stages:
+- limit:
+    rate: 1
+    burst: 2
+    drop: true
+    by_label_name: pod
+`
+
+func TestLimitPipeline(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	pl, err := NewPipeline(util.Logger, loadConfig(testLimitYaml), nil, registry)
+	require.NoError(t, err)
+	rec := &recordingHandler{}
+	handler := pl.Wrap(rec)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, handler.Handle(model.LabelSet{"pod": "a", "stream": "stdout"}, time.Now(), "a"))
+		require.NoError(t, handler.Handle(model.LabelSet{"pod": "a", "stream": "stderr"}, time.Now(), "a"))
+		require.NoError(t, handler.Handle(model.LabelSet{"pod": "b"}, time.Now(), "b"))
+		require.NoError(t, handler.Handle(model.LabelSet{"app": "c"}, time.Now(), "c"))
+	}
+	// the streams of the same pod share the burst, the entries without the label are not limited.
+	assert.Equal(t, []string{"a", "a", "b", "c", "b", "c", "c", "c", "c"}, rec.lines())
+
+	expected := `
+		# HELP logentry_dropped_lines_total A count of all log lines dropped as a result of a pipeline stage
+		# TYPE logentry_dropped_lines_total counter
+		logentry_dropped_lines_total{reason="limit_stage"} 11
+	`
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "logentry_dropped_lines_total"))
+}
+
+func TestLimitStage_Block(t *testing.T) {
+	st, err := newLimitStage(util.Logger, LimitConfig{Rate: 20, Burst: 1}, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		labels := model.LabelSet{"app": "loki"}
+		ts, entry := time.Now(), "line"
+		st.Process(labels, map[string]interface{}{}, &ts, &entry)
+		assert.NotContains(t, labels, model.LabelName(dropLabel))
+	}
+	// the entries over the limit are delayed rather than dropped.
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+
+	// each stream has its own bucket.
+	start = time.Now()
+	ts, entry := time.Now(), "line"
+	st.Process(model.LabelSet{"app": "promtail"}, map[string]interface{}{}, &ts, &entry)
+	assert.True(t, time.Since(start) < 40*time.Millisecond)
+}
+
+func TestLimitStage_Close(t *testing.T) {
+	st, err := newLimitStage(util.Logger, LimitConfig{Rate: 0.1, Burst: 1}, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	process := func() {
+		ts, entry := time.Now(), "line"
+		st.Process(model.LabelSet{"app": "loki"}, map[string]interface{}{}, &ts, &entry)
+	}
+	process()
+
+	// the second entry waits 10s for the bucket, until the pipeline is closed.
+	done := make(chan struct{})
+	go func() {
+		process()
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, st.(ClosableStage).Close())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the entry is still waiting for the rate limit after the pipeline was closed")
+	}
+
+	// the next entries are not delayed anymore.
+	start := time.Now()
+	process()
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestLimitStage_Validation(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		config        *LimitConfig
+		expectedErr   error
+		expectedBurst int
+	}{
+		"default burst": {
+			config:        &LimitConfig{Rate: 100},
+			expectedBurst: 100,
+		},
+		"minimum burst": {
+			config:        &LimitConfig{Rate: 0.1},
+			expectedBurst: 1,
+		},
+		"missing rate": {
+			config:      &LimitConfig{Burst: 10},
+			expectedErr: errors.New(ErrLimitStageInvalidRate),
+		},
+		"negative burst": {
+			config:      &LimitConfig{Rate: 1, Burst: -1},
+			expectedErr: errors.New(ErrLimitStageInvalidBurst),
+		},
+		"negative max distinct labels": {
+			config:      &LimitConfig{Rate: 1, MaxDistinctLabels: -1},
+			expectedErr: errors.New(ErrLimitStageInvalidMaxDistinct),
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			err := validateLimitConfig(tt.config)
+			if tt.expectedErr != nil {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedBurst, tt.config.Burst)
+			assert.Equal(t, defaultLimitStageMaxDistinct, tt.config.MaxDistinctLabels)
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package stages
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-logfmt/logfmt"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+)
+
+// Config Errors
+const (
+	ErrEmptyLogfmtStageConfig = "empty logfmt stage configuration"
+	ErrEmptyLogfmtStageSource = "empty source"
+	ErrEmptyLogfmtMappingName = "logfmt mapping names cannot be empty"
+)
+
+// LogfmtConfig represents a logfmt Stage configuration
+type LogfmtConfig struct {
+	Mapping map[string]string `mapstructure:"mapping"`
+	Source  *string           `mapstructure:"source"`
+}
+
+// validateLogfmtConfig validates a logfmt config and returns the names of the extracted data keyed by logfmt key.
+// When there is no mapping, nil is returned and all the keys are extracted.
+func validateLogfmtConfig(c *LogfmtConfig) (map[string][]string, error) {
+	if c == nil {
+		return nil, errors.New(ErrEmptyLogfmtStageConfig)
+	}
+
+	if c.Source != nil && *c.Source == "" {
+		return nil, errors.New(ErrEmptyLogfmtStageSource)
+	}
+
+	if len(c.Mapping) == 0 {
+		return nil, nil
+	}
+	keys := map[string][]string{}
+	for n, k := range c.Mapping {
+		if strings.TrimSpace(n) == "" {
+			return nil, errors.New(ErrEmptyLogfmtMappingName)
+		}
+		// If there is no key, use the name as the key.
+		if k == "" {
+			k = n
+		}
+		keys[k] = append(keys[k], n)
+	}
+	return keys, nil
+}
+
+// logfmtStage sets extracted data from the key/value pairs of logfmt lines
+type logfmtStage struct {
+	cfg    *LogfmtConfig
+	keys   map[string][]string
+	logger log.Logger
+}
+
+// newLogfmtStage creates a new logfmt pipeline stage from a config.
+func newLogfmtStage(logger log.Logger, config interface{}) (Stage, error) {
+	cfg := &LogfmtConfig{}
+	err := mapstructure.Decode(config, cfg)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := validateLogfmtConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &logfmtStage{
+		cfg:    cfg,
+		keys:   keys,
+		logger: log.With(logger, "component", "stage", "type", "logfmt"),
+	}, nil
+}
+
+// Process implements Stage
+func (l *logfmtStage) Process(labels model.LabelSet, extracted map[string]interface{}, t *time.Time, entry *string) {
+	// If a source key is provided, the logfmt stage should process it
+	// from the extracted map, otherwise should fallback to the entry
+	input := entry
+
+	if l.cfg.Source != nil {
+		if _, ok := extracted[*l.cfg.Source]; !ok {
+			if Debug {
+				level.Debug(l.logger).Log("msg", "source does not exist in the set of extracted values", "source", *l.cfg.Source)
+			}
+			return
+		}
+
+		value, err := getString(extracted[*l.cfg.Source])
+		if err != nil {
+			if Debug {
+				level.Debug(l.logger).Log("msg", "failed to convert source value to string", "source", *l.cfg.Source, "err", err, "type", reflect.TypeOf(extracted[*l.cfg.Source]))
+			}
+			return
+		}
+
+		input = &value
+	}
+
+	if input == nil {
+		if Debug {
+			level.Debug(l.logger).Log("msg", "cannot parse a nil entry")
+		}
+		return
+	}
+
+	dec := logfmt.NewDecoder(strings.NewReader(*input))
+	for dec.ScanRecord() {
+		for dec.ScanKeyval() {
+			key, value := string(dec.Key()), string(dec.Value())
+			if l.keys == nil {
+				extracted[key] = value
+				continue
+			}
+			for _, n := range l.keys[key] {
+				extracted[n] = value
+			}
+		}
+	}
+	if err := dec.Err(); err != nil {
+		if Debug {
+			level.Debug(l.logger).Log("msg", "failed to decode logfmt", "err", err)
+		}
+	}
+}
+
+// Name implements Stage
+func (l *logfmtStage) Name() string {
+	return StageTypeLogfmt
+}
@@ -0,0 +1,188 @@
+package stages
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testLogfmtYamlSingleStageWithoutSource = `
+pipeline_stages:
+- logfmt:
+    mapping:
+      out: message
+      app:
+      duration:
+      unknown:
+`
+
+var testLogfmtYamlMultiStageWithSource = `
+pipeline_stages:
+- logfmt:
+    mapping:
+      extra:
+- logfmt:
+    mapping:
+      user:
+    source: extra
+`
+
+var testLogfmtYamlAllKeys = `
+pipeline_stages:
+- logfmt: {}
+`
+
+var testLogfmtLogLine = `time=2012-11-01T22:08:41+00:00 app=loki level=WARN duration=125 message="this is a log line" extra="user=foo"`
+
+func TestPipeline_Logfmt(t *testing.T) {
+	tests := map[string]struct {
+		config          string
+		entry           string
+		expectedExtract map[string]interface{}
+	}{
+		"successfully run a pipeline with 1 logfmt stage without source": {
+			testLogfmtYamlSingleStageWithoutSource,
+			testLogfmtLogLine,
+			map[string]interface{}{
+				"out":      "this is a log line",
+				"app":      "loki",
+				"duration": "125",
+			},
+		},
+		"successfully run a pipeline with 2 logfmt stages with source": {
+			testLogfmtYamlMultiStageWithSource,
+			testLogfmtLogLine,
+			map[string]interface{}{
+				"extra": "user=foo",
+				"user":  "foo",
+			},
+		},
+		"successfully run a pipeline extracting all the keys": {
+			testLogfmtYamlAllKeys,
+			`app=loki level=WARN empty=`,
+			map[string]interface{}{
+				"app":   "loki",
+				"level": "WARN",
+				"empty": "",
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		testData := testData
+
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+
+			pl, err := NewPipeline(util.Logger, loadConfig(testData.config), nil, prometheus.DefaultRegisterer)
+			require.NoError(t, err)
+			lbls := model.LabelSet{}
+			ts := time.Now()
+			entry := testData.entry
+			extracted := map[string]interface{}{}
+			pl.Process(lbls, extracted, &ts, &entry)
+			assert.Equal(t, testData.expectedExtract, extracted)
+			assert.Equal(t, testData.entry, entry)
+		})
+	}
+}
+
+func TestLogfmtStage_Validation(t *testing.T) {
+	t.Parallel()
+
+	empty := ""
+
+	tests := map[string]struct {
+		config       *LogfmtConfig
+		expectedKeys map[string][]string
+		expectedErr  error
+	}{
+		"missing config": {
+			config:      nil,
+			expectedErr: errors.New(ErrEmptyLogfmtStageConfig),
+		},
+		"empty source": {
+			config:      &LogfmtConfig{Source: &empty},
+			expectedErr: errors.New(ErrEmptyLogfmtStageSource),
+		},
+		"empty mapping name": {
+			config:      &LogfmtConfig{Mapping: map[string]string{" ": "app"}},
+			expectedErr: errors.New(ErrEmptyLogfmtMappingName),
+		},
+		"no mapping": {
+			config: &LogfmtConfig{},
+		},
+		"valid mapping": {
+			config: &LogfmtConfig{Mapping: map[string]string{"app": "", "out": "message", "msg": "message"}},
+			expectedKeys: map[string][]string{
+				"app":     {"app"},
+				"message": {"msg", "out"},
+			},
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			keys, err := validateLogfmtConfig(tt.config)
+			if tt.expectedErr != nil {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+				return
+			}
+			assert.NoError(t, err)
+			for _, names := range keys {
+				sort.Strings(names)
+			}
+			assert.Equal(t, tt.expectedKeys, keys)
+		})
+	}
+}
+
+func TestLogfmtStage_Process(t *testing.T) {
+	t.Parallel()
+
+	source := "log"
+	tests := map[string]struct {
+		config            *LogfmtConfig
+		extracted         map[string]interface{}
+		entry             string
+		expectedExtracted map[string]interface{}
+	}{
+		"missing source": {
+			config:            &LogfmtConfig{Source: &source},
+			extracted:         map[string]interface{}{},
+			entry:             "app=loki",
+			expectedExtracted: map[string]interface{}{},
+		},
+		"invalid logfmt keeps the parsed keys": {
+			config:            &LogfmtConfig{},
+			extracted:         map[string]interface{}{},
+			entry:             `app=loki msg="unterminated`,
+			expectedExtracted: map[string]interface{}{"app": "loki"},
+		},
+		"non string source": {
+			config:            &LogfmtConfig{Source: &source},
+			extracted:         map[string]interface{}{"log": []string{"app=loki"}},
+			entry:             "",
+			expectedExtracted: map[string]interface{}{"log": []string{"app=loki"}},
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			st, err := newLogfmtStage(util.Logger, tt.config)
+			require.NoError(t, err)
+			ts := time.Now()
+			st.Process(model.LabelSet{}, tt.extracted, &ts, &tt.entry)
+			assert.Equal(t, tt.expectedExtracted, tt.extracted)
+		})
+	}
+}
@@ -111,26 +111,62 @@ func newMatcherStage(logger log.Logger, jobName *string, config interface{}, reg
 type matcherStage struct {
 	matchers []*labels.Matcher
 	filter   logql.LineFilter
-	pipeline Stage
+	pipeline *Pipeline
 	action   string
 }
 
 // Process implements Stage
 func (m *matcherStage) Process(labels model.LabelSet, extracted map[string]interface{}, t *time.Time, entry *string) {
-	for _, filter := range m.matchers {
-		if !filter.Matches(string(labels[model.LabelName(filter.Name)])) {
-			return
-		}
+	if !m.matches(labels, *entry) {
+		return
+	}
+	switch m.action {
+	case MatchActionDrop:
+		// Adds the drop label to not be sent by the api.EntryHandler
+		labels[dropLabel] = ""
+	case MatchActionKeep:
+		m.pipeline.Process(labels, extracted, t, entry)
 	}
-	if m.filter == nil || m.filter.Filter([]byte(*entry)) {
+}
+
+// Handler implements AsyncStage, so that the stages of the match pipeline can hold entries too.
+func (m *matcherStage) Handler(next EntryFunc) (EntryFunc, StopFunc) {
+	var pipeline EntryFunc
+	stop := func() {}
+	if m.pipeline != nil {
+		pipeline, stop = m.pipeline.Handler(next)
+	}
+	return func(entry Entry) error {
+		if !m.matches(entry.Labels, entry.Line) {
+			return next(entry)
+		}
 		switch m.action {
 		case MatchActionDrop:
 			// Adds the drop label to not be sent by the api.EntryHandler
-			labels[dropLabel] = ""
-		case MatchActionKeep:
-			m.pipeline.Process(labels, extracted, t, entry)
+			entry.Labels[dropLabel] = ""
+			return next(entry)
+		default:
+			return pipeline(entry)
+		}
+	}, stop
+}
+
+// Close implements ClosableStage.
+func (m *matcherStage) Close() error {
+	if m.pipeline == nil {
+		return nil
+	}
+	return m.pipeline.Close()
+}
+
+// matches returns whether the labels match the selector and the line its filters.
+func (m *matcherStage) matches(labels model.LabelSet, entry string) bool {
+	for _, filter := range m.matchers {
+		if !filter.Matches(string(labels[model.LabelName(filter.Name)])) {
+			return false
 		}
 	}
+	return m.filter == nil || m.filter.Filter([]byte(entry))
 }
 
 // Name implements Stage
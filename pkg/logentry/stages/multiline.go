@@ -0,0 +1,214 @@
+package stages
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+)
+
+// Config Errors
+const (
+	ErrMultilineStageEmptyConfig        = "multiline stage config must define `firstline` regular expression"
+	ErrMultilineStageInvalidRegex       = "multiline stage first line regex compilation error"
+	ErrMultilineStageInvalidMaxWaitTime = "multiline stage `max_wait_time` parse error"
+	ErrMultilineStageInvalidMaxLines    = "multiline stage `max_lines` must be positive"
+)
+
+const (
+	defaultMultilineMaxWaitTime = 3 * time.Second
+	defaultMultilineMaxLines    = 128
+)
+
+// MultilineConfig contains the configuration for a multilineStage
+type MultilineConfig struct {
+	Expression  *string `mapstructure:"firstline"`
+	MaxWaitTime *string `mapstructure:"max_wait_time"`
+	MaxLines    *int    `mapstructure:"max_lines"`
+}
+
+// validateMultilineConfig validates the MultilineConfig and returns the first line regex, the max wait time
+// and the max number of lines.
+func validateMultilineConfig(cfg *MultilineConfig) (*regexp.Regexp, time.Duration, int, error) {
+	if cfg == nil || cfg.Expression == nil || *cfg.Expression == "" {
+		return nil, 0, 0, errors.New(ErrMultilineStageEmptyConfig)
+	}
+
+	expr, err := regexp.Compile(*cfg.Expression)
+	if err != nil {
+		return nil, 0, 0, errors.Wrap(err, ErrMultilineStageInvalidRegex)
+	}
+
+	maxWait := defaultMultilineMaxWaitTime
+	if cfg.MaxWaitTime != nil {
+		maxWait, err = time.ParseDuration(*cfg.MaxWaitTime)
+		if err != nil {
+			return nil, 0, 0, errors.Wrap(err, ErrMultilineStageInvalidMaxWaitTime)
+		}
+		if maxWait <= 0 {
+			return nil, 0, 0, errors.New(ErrMultilineStageInvalidMaxWaitTime)
+		}
+	}
+
+	maxLines := defaultMultilineMaxLines
+	if cfg.MaxLines != nil {
+		if *cfg.MaxLines <= 0 {
+			return nil, 0, 0, errors.New(ErrMultilineStageInvalidMaxLines)
+		}
+		maxLines = *cfg.MaxLines
+	}
+
+	return expr, maxWait, maxLines, nil
+}
+
+// multilineStage merges the lines of a stream following a line matching the first line regex into a single entry.
+type multilineStage struct {
+	logger   log.Logger
+	cfg      *MultilineConfig
+	regex    *regexp.Regexp
+	maxWait  time.Duration
+	maxLines int
+}
+
+// newMultilineStage creates a new multilineStage
+func newMultilineStage(logger log.Logger, config interface{}) (Stage, error) {
+	cfg := &MultilineConfig{}
+	err := mapstructure.Decode(config, cfg)
+	if err != nil {
+		return nil, err
+	}
+	regex, maxWait, maxLines, err := validateMultilineConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &multilineStage{
+		logger:   log.With(logger, "component", "stage", "type", "multiline"),
+		cfg:      cfg,
+		regex:    regex,
+		maxWait:  maxWait,
+		maxLines: maxLines,
+	}, nil
+}
+
+// Process implements Stage. It leaves the entry unchanged: lines can only be merged by a stage holding them, which
+// is only possible when the pipeline wraps an api.EntryHandler, see Handler.
+func (m *multilineStage) Process(labels model.LabelSet, extracted map[string]interface{}, t *time.Time, entry *string) {
+}
+
+// Handler implements AsyncStage. The lines of each stream are buffered until the next first line, until
+// max_lines lines are buffered or until no line has been received for max_wait_time, then passed to next
+// as a single entry with the labels, extracted values and timestamp of the first one.
+// The buffered lines are passed to next when the handler is stopped.
+func (m *multilineStage) Handler(next EntryFunc) (EntryFunc, StopFunc) {
+	h := &multilineHandler{
+		stage:   m,
+		next:    next,
+		streams: map[string]*multilineBlock{},
+	}
+	return h.handle, h.stop
+}
+
+// Name implements Stage
+func (m *multilineStage) Name() string {
+	return StageTypeMultiline
+}
+
+// multilineBlock is the entry buffered for a stream.
+type multilineBlock struct {
+	entry Entry
+	lines []string
+	timer *time.Timer
+}
+
+type multilineHandler struct {
+	stage *multilineStage
+	next  EntryFunc
+
+	// the entries are passed to next under the lock, so that the order of the entries of each stream is kept.
+	mtx     sync.Mutex
+	streams map[string]*multilineBlock
+	stopped bool
+}
+
+func (h *multilineHandler) handle(entry Entry) error {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if h.stopped {
+		// entries racing with the stop of the target aren't merged anymore, rather than being lost.
+		return h.next(entry)
+	}
+
+	key := entry.Labels.String()
+	block, ok := h.streams[key]
+	if ok && !h.stage.regex.MatchString(entry.Line) {
+		block.lines = append(block.lines, entry.Line)
+		if len(block.lines) >= h.stage.maxLines {
+			return h.flush(key, block)
+		}
+		block.timer.Reset(h.stage.maxWait)
+		return nil
+	}
+
+	var err error
+	if ok {
+		err = h.flush(key, block)
+	}
+	// the labels can be modified by the following stages or reused by the caller while the entry is buffered.
+	entry.Labels = entry.Labels.Clone()
+	block = &multilineBlock{entry: entry, lines: []string{entry.Line}}
+	block.timer = time.AfterFunc(h.stage.maxWait, func() { h.timeout(key, block) })
+	h.streams[key] = block
+	if h.stage.maxLines == 1 {
+		if flushErr := h.flush(key, block); flushErr != nil {
+			err = flushErr
+		}
+	}
+	return err
+}
+
+// stop flushes the blocks of all the streams.
+func (h *multilineHandler) stop() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	h.stopped = true
+	for key, block := range h.streams {
+		if err := h.flush(key, block); err != nil {
+			level.Error(h.stage.logger).Log("msg", "failed to handle multiline entry", "err", err)
+		}
+	}
+}
+
+// timeout flushes the block of the stream if it is still buffered.
+func (h *multilineHandler) timeout(key string, block *multilineBlock) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if h.streams[key] != block {
+		return
+	}
+	if err := h.flush(key, block); err != nil {
+		level.Error(h.stage.logger).Log("msg", "failed to handle multiline entry", "err", err)
+	}
+}
+
+// flush passes the block of the stream to next, it must be called under the lock.
+func (h *multilineHandler) flush(key string, block *multilineBlock) error {
+	block.timer.Stop()
+	delete(h.streams, key)
+
+	entry := block.entry
+	entry.Line = strings.Join(block.lines, "\n")
+	if Debug {
+		level.Debug(h.stage.logger).Log("msg", "flushing multiline entry", "labels", entry.Labels, "lines", len(block.lines))
+	}
+	return h.next(entry)
+}
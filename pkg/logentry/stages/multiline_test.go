@@ -0,0 +1,208 @@
+package stages
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/pkg/promtail/api"
+)
+
+var testMultilineYaml = `
+pipeline_stages:
+- multiline:
+    firstline: "^\\d{4}-\\d{2}-\\d{2}"
+    max_wait_time: 100ms
+    max_lines: 4
+- regex:
+    expression: "^\\S+ (?P<level>\\w+)"
+- labels:
+    level:
+`
+
+var testMultilineMatchYaml = `
+pipeline_stages:
+- match:
+    selector: '{app="java"}'
+    stages:
+    - multiline:
+        firstline: "^\\S"
+        max_wait_time: 100ms
+`
+
+// recordingHandler records the entries it handles.
+type recordingHandler struct {
+	sync.Mutex
+	entries []Entry
+}
+
+func (r *recordingHandler) Handle(labels model.LabelSet, time time.Time, entry string) error {
+	r.Lock()
+	defer r.Unlock()
+	r.entries = append(r.entries, Entry{Labels: labels, Timestamp: time, Line: entry})
+	return nil
+}
+
+func (r *recordingHandler) lines() []string {
+	r.Lock()
+	defer r.Unlock()
+	var lines []string
+	for _, e := range r.entries {
+		lines = append(lines, e.Line)
+	}
+	return lines
+}
+
+func TestMultilineStage_Pipeline(t *testing.T) {
+	pl, err := NewPipeline(util.Logger, loadConfig(testMultilineYaml), nil, prometheus.DefaultRegisterer)
+	require.NoError(t, err)
+	rec := &recordingHandler{}
+	handler := pl.Wrap(rec)
+
+	start := time.Unix(0, 0)
+	for i, line := range []string{
+		"2020-01-01 ERROR Exception in thread \"main\" java.lang.NullPointerException",
+		"\tat com.example.App.process(App.java:42)",
+		"\tat com.example.App.main(App.java:12)",
+		"2020-01-01 INFO done",
+	} {
+		require.NoError(t, handler.Handle(model.LabelSet{"app": "java"}, start.Add(time.Duration(i)*time.Second), line))
+	}
+	// the lines of another stream are buffered separately.
+	require.NoError(t, handler.Handle(model.LabelSet{"app": "python"}, start, "2020-01-01 WARN retrying"))
+
+	// the first entry is passed down the pipeline once the next first line is received.
+	require.Len(t, rec.lines(), 1)
+	rec.Lock()
+	assert.Equal(t, "2020-01-01 ERROR Exception in thread \"main\" java.lang.NullPointerException\n\tat com.example.App.process(App.java:42)\n\tat com.example.App.main(App.java:12)", rec.entries[0].Line)
+	assert.Equal(t, model.LabelSet{"app": "java", "level": "ERROR"}, rec.entries[0].Labels)
+	assert.Equal(t, start, rec.entries[0].Timestamp)
+	rec.Unlock()
+
+	// the other entries are flushed after max_wait_time.
+	require.Eventually(t, func() bool { return len(rec.lines()) == 3 }, 5*time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, []string{"2020-01-01 INFO done", "2020-01-01 WARN retrying"}, rec.lines()[1:])
+}
+
+func TestMultilineStage_MaxLines(t *testing.T) {
+	pl, err := NewPipeline(util.Logger, loadConfig(testMultilineYaml), nil, prometheus.DefaultRegisterer)
+	require.NoError(t, err)
+	rec := &recordingHandler{}
+	handler := pl.Wrap(rec)
+
+	for _, line := range []string{"2020-01-01 ERROR first", "a", "b", "c", "d", "e"} {
+		require.NoError(t, handler.Handle(model.LabelSet{}, time.Now(), line))
+	}
+	require.Equal(t, []string{"2020-01-01 ERROR first\na\nb\nc"}, rec.lines())
+	require.Eventually(t, func() bool { return len(rec.lines()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, "d\ne", rec.lines()[1])
+}
+
+func TestMultilineStage_Match(t *testing.T) {
+	pl, err := NewPipeline(util.Logger, loadConfig(testMultilineMatchYaml), nil, prometheus.DefaultRegisterer)
+	require.NoError(t, err)
+	rec := &recordingHandler{}
+	handler := pl.Wrap(rec)
+
+	for _, line := range []string{"Exception", "  at App.main", "Next"} {
+		require.NoError(t, handler.Handle(model.LabelSet{"app": "java"}, time.Now(), line))
+		require.NoError(t, handler.Handle(model.LabelSet{"app": "go"}, time.Now(), line))
+	}
+	// the entries not matching the selector are not held.
+	require.Equal(t, []string{"Exception", "  at App.main", "Exception\n  at App.main", "Next"}, rec.lines())
+	require.Eventually(t, func() bool { return len(rec.lines()) == 5 }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, "Next", rec.lines()[4])
+}
+
+var testMultilineStopYaml = `
+pipeline_stages:
+- match:
+    selector: '{app="java"}'
+    stages:
+    - multiline:
+        firstline: "^\\S"
+        max_wait_time: 1h
+- regex:
+    expression: "^(?P<level>\\w+)"
+- labels:
+    level:
+`
+
+func TestMultilineStage_Stop(t *testing.T) {
+	pl, err := NewPipeline(util.Logger, loadConfig(testMultilineStopYaml), nil, prometheus.DefaultRegisterer)
+	require.NoError(t, err)
+	rec := &recordingHandler{}
+	handler := pl.Wrap(rec)
+
+	for _, line := range []string{"ERROR Exception", "  at App.main"} {
+		require.NoError(t, handler.Handle(model.LabelSet{"app": "java"}, time.Now(), line))
+	}
+	require.Empty(t, rec.lines())
+
+	// the buffered lines are passed down the following stages once the handler is stopped.
+	api.StopEntryHandler(handler)
+	require.Equal(t, []string{"ERROR Exception\n  at App.main"}, rec.lines())
+	rec.Lock()
+	assert.Equal(t, model.LabelSet{"app": "java", "level": "ERROR"}, rec.entries[0].Labels)
+	rec.Unlock()
+
+	// the entries handled after the stop are not held anymore.
+	require.NoError(t, handler.Handle(model.LabelSet{"app": "java"}, time.Now(), "INFO late"))
+	require.Equal(t, "INFO late", rec.lines()[1])
+}
+
+func TestMultilineStage_Validation(t *testing.T) {
+	t.Parallel()
+
+	firstline := "^\\S"
+	invalid := "("
+	maxWait := "1s"
+	negativeMaxWait := "-1s"
+	zero := 0
+
+	tests := map[string]struct {
+		config      *MultilineConfig
+		expectedErr error
+	}{
+		"valid config": {
+			config: &MultilineConfig{Expression: &firstline, MaxWaitTime: &maxWait},
+		},
+		"missing firstline": {
+			config:      &MultilineConfig{MaxWaitTime: &maxWait},
+			expectedErr: errors.New(ErrMultilineStageEmptyConfig),
+		},
+		"invalid firstline": {
+			config:      &MultilineConfig{Expression: &invalid},
+			expectedErr: errors.Wrap(errors.New("error parsing regexp: missing closing ): `(`"), ErrMultilineStageInvalidRegex),
+		},
+		"negative max wait time": {
+			config:      &MultilineConfig{Expression: &firstline, MaxWaitTime: &negativeMaxWait},
+			expectedErr: errors.New(ErrMultilineStageInvalidMaxWaitTime),
+		},
+		"zero max lines": {
+			config:      &MultilineConfig{Expression: &firstline, MaxLines: &zero},
+			expectedErr: errors.New(ErrMultilineStageInvalidMaxLines),
+		},
+	}
+	for testName, testData := range tests {
+		testData := testData
+
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+
+			_, _, _, err := validateMultilineConfig(testData.config)
+			if testData.expectedErr != nil {
+				assert.EqualError(t, err, testData.expectedErr.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
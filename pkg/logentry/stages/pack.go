@@ -0,0 +1,128 @@
+package stages
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/loki/pkg/logql"
+)
+
+// Config Errors
+const (
+	ErrEmptyPackStageConfig = "pack stage config must contain at least one label"
+	ErrPackStageEmptyLabel  = "pack stage label names cannot be empty strings"
+	ErrPackStageEntryKey    = "pack stage cannot pack a label named " + logql.PackedEntryKey
+)
+
+// PackConfig contains the configuration for a packStage
+type PackConfig struct {
+	Labels          []string `mapstructure:"labels"`
+	IngestTimestamp *bool    `mapstructure:"ingest_timestamp"`
+}
+
+// validatePackConfig validates the PackConfig for the packStage
+func validatePackConfig(cfg *PackConfig) error {
+	if cfg == nil || len(cfg.Labels) == 0 {
+		return errors.New(ErrEmptyPackStageConfig)
+	}
+	for _, name := range cfg.Labels {
+		if strings.TrimSpace(name) == "" {
+			return errors.New(ErrPackStageEmptyLabel)
+		}
+		if name == logql.PackedEntryKey {
+			return errors.New(ErrPackStageEntryKey)
+		}
+	}
+	// The packed entries of several streams end up in the same stream, their timestamps are replaced
+	// by default so that they are not rejected as out of order.
+	if cfg.IngestTimestamp == nil {
+		ingest := true
+		cfg.IngestTimestamp = &ingest
+	}
+	return nil
+}
+
+// newPackStage creates a packStage from config
+func newPackStage(logger log.Logger, config interface{}) (Stage, error) {
+	cfg := &PackConfig{}
+	err := mapstructure.Decode(config, cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = validatePackConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &packStage{
+		logger: log.With(logger, "component", "stage", "type", "pack"),
+		cfg:    cfg,
+	}, nil
+}
+
+// packStage moves labels and extracted values into a JSON object wrapping the log line,
+// which can be unpacked at query time with the LogQL unpack parser.
+type packStage struct {
+	logger log.Logger
+	cfg    *PackConfig
+}
+
+// Process implements Stage
+func (m *packStage) Process(labels model.LabelSet, extracted map[string]interface{}, t *time.Time, entry *string) {
+	if entry == nil {
+		if Debug {
+			level.Debug(m.logger).Log("msg", "cannot pack a nil entry")
+		}
+		return
+	}
+
+	packed := make(map[string]string, len(m.cfg.Labels)+1)
+	for _, name := range m.cfg.Labels {
+		// The labels are removed from the stream, the extracted values are used when there is no such label.
+		if value, ok := labels[model.LabelName(name)]; ok {
+			packed[name] = string(value)
+			delete(labels, model.LabelName(name))
+			continue
+		}
+		value, ok := extracted[name]
+		if !ok {
+			continue
+		}
+		s, err := getString(value)
+		if err != nil {
+			if Debug {
+				level.Debug(m.logger).Log("msg", "failed to convert extracted value to string", "name", name, "err", err, "type", reflect.TypeOf(value))
+			}
+			continue
+		}
+		packed[name] = s
+	}
+	packed[logql.PackedEntryKey] = *entry
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(packed); err != nil {
+		level.Error(m.logger).Log("msg", "failed to pack entry", "err", err)
+		return
+	}
+	*entry = strings.TrimSuffix(buf.String(), "\n")
+
+	if *m.cfg.IngestTimestamp {
+		*t = time.Now()
+	}
+}
+
+// Name implements Stage
+func (m *packStage) Name() string {
+	return StageTypePack
+}
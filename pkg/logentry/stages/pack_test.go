@@ -0,0 +1,101 @@
+package stages
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/pkg/logql"
+)
+
+var testPackYaml = `
+pipeline_stages:
+- regex:
+    expression: "request_id=(?P<request_id>\\S+)"
+- pack:
+    labels:
+    - pod
+    - request_id
+    - missing
+    ingest_timestamp: false
+`
+
+func TestPackPipeline(t *testing.T) {
+	pl, err := NewPipeline(util.Logger, loadConfig(testPackYaml), nil, prometheus.DefaultRegisterer)
+	require.NoError(t, err)
+
+	lbls := model.LabelSet{"app": "loki", "pod": "loki-0"}
+	ts := time.Unix(1, 0)
+	entry := `level=info request_id=42 msg="<hello>"`
+	pl.Process(lbls, map[string]interface{}{}, &ts, &entry)
+
+	assert.Equal(t, model.LabelSet{"app": "loki"}, lbls)
+	assert.Equal(t, time.Unix(1, 0), ts)
+	assert.Equal(t, `{"_entry":"level=info request_id=42 msg=\"<hello>\"","pod":"loki-0","request_id":"42"}`, entry)
+
+	// the LogQL unpack parser restores the packed labels and the original line.
+	expr, err := logql.ParseLogSelector(`{app="loki"} | unpack`)
+	require.NoError(t, err)
+	p, err := expr.Pipeline()
+	require.NoError(t, err)
+	b := labels.NewBuilder(labels.Labels{{Name: "app", Value: "loki"}})
+	line, ok := p.Process([]byte(entry), b)
+	require.True(t, ok)
+	assert.Equal(t, `level=info request_id=42 msg="<hello>"`, string(line))
+	assert.Equal(t, labels.Labels{{Name: "app", Value: "loki"}, {Name: "pod", Value: "loki-0"}, {Name: "request_id", Value: "42"}}, b.Labels())
+}
+
+func TestPackStage_IngestTimestamp(t *testing.T) {
+	st, err := newPackStage(util.Logger, PackConfig{Labels: []string{"pod"}})
+	require.NoError(t, err)
+
+	ts := time.Unix(1, 0)
+	entry := "line"
+	st.Process(model.LabelSet{}, map[string]interface{}{}, &ts, &entry)
+	assert.Equal(t, `{"_entry":"line"}`, entry)
+	assert.True(t, ts.After(time.Unix(1, 0)))
+}
+
+func TestPackStage_Validation(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		config      *PackConfig
+		expectedErr error
+	}{
+		"valid config": {
+			config: &PackConfig{Labels: []string{"pod"}},
+		},
+		"missing labels": {
+			config:      &PackConfig{},
+			expectedErr: errors.New(ErrEmptyPackStageConfig),
+		},
+		"empty label": {
+			config:      &PackConfig{Labels: []string{""}},
+			expectedErr: errors.New(ErrPackStageEmptyLabel),
+		},
+		"entry key": {
+			config:      &PackConfig{Labels: []string{logql.PackedEntryKey}},
+			expectedErr: errors.New(ErrPackStageEntryKey),
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			err := validatePackConfig(tt.config)
+			if tt.expectedErr != nil {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
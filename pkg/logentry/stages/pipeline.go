@@ -10,6 +10,7 @@ import (
 	"github.com/prometheus/common/model"
 
 	"github.com/grafana/loki/pkg/promtail/api"
+	"github.com/grafana/loki/pkg/util"
 )
 
 const dropLabel = "__drop__"
@@ -106,19 +107,111 @@ func (p *Pipeline) Name() string {
 	return StageTypePipeline
 }
 
-// Wrap implements EntryMiddleware
-func (p *Pipeline) Wrap(next api.EntryHandler) api.EntryHandler {
-	return api.EntryHandlerFunc(func(labels model.LabelSet, timestamp time.Time, line string) error {
-		extracted := map[string]interface{}{}
-		p.Process(labels, extracted, &timestamp, &line)
-		// if the labels set contains the __drop__ label we don't send this entry to the next EntryHandler
-		if _, ok := labels[dropLabel]; ok {
+// Handler implements AsyncStage, the entries are passed down the stages of the pipeline, then to next unless
+// they are dropped.
+func (p *Pipeline) Handler(next EntryFunc) (EntryFunc, StopFunc) {
+	// the synchronous stages between asynchronous ones are processed together.
+	handler, end := next, len(p.stages)
+	var stops []StopFunc
+	for i := len(p.stages) - 1; i >= 0; i-- {
+		if async, ok := p.stages[i].(AsyncStage); ok {
+			var stop StopFunc
+			handler, stop = async.Handler(p.processHandler(p.stages[i+1:end], handler))
+			stops = append(stops, stop)
+			end = i
+		}
+	}
+	handler = p.processHandler(p.stages[:end], handler)
+
+	stop := func() {
+		// the first stages are stopped first, so that the entries they held reach the following ones.
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+	}
+	return func(entry Entry) error {
+		// Initialize the extracted map with the initial labels (ie. "filename"),
+		// so that stages can operate on initial labels too
+		for labelName, labelValue := range entry.Labels {
+			entry.Extracted[string(labelName)] = string(labelValue)
+		}
+		return handler(entry)
+	}, stop
+}
+
+// processHandler returns an EntryFunc processing the entries with the synchronous stages, then passing them to next
+// unless they are dropped.
+func (p *Pipeline) processHandler(stages []Stage, next EntryFunc) EntryFunc {
+	return func(entry Entry) error {
+		if len(stages) > 0 {
+			start := time.Now()
+			for _, stage := range stages {
+				if Debug {
+					level.Debug(p.logger).Log("msg", "processing pipeline", "name", stage.Name(), "labels", entry.Labels, "time", entry.Timestamp, "entry", entry.Line)
+				}
+				stage.Process(entry.Labels, entry.Extracted, &entry.Timestamp, &entry.Line)
+			}
+			dur := time.Since(start).Seconds()
+			if Debug {
+				level.Debug(p.logger).Log("msg", "finished processing log line", "labels", entry.Labels, "time", entry.Timestamp, "entry", entry.Line, "duration_s", dur)
+			}
+			if p.jobName != nil {
+				p.plDuration.WithLabelValues(*p.jobName).Observe(dur)
+			}
+		}
+		// if the labels set contains the __drop__ label we don't send this entry to the next stages
+		if _, ok := entry.Labels[dropLabel]; ok {
 			return nil
 		}
-		return next.Handle(labels, timestamp, line)
+		return next(entry)
+	}
+}
+
+// Close implements ClosableStage, it releases the resources held by the stages of the pipeline.
+func (p *Pipeline) Close() error {
+	var errs util.MultiError
+	for _, stage := range p.stages {
+		if closable, ok := stage.(ClosableStage); ok {
+			errs.Add(closable.Close())
+		}
+	}
+	return errs.Err()
+}
+
+// Wrap implements EntryMiddleware. The handler returned must be stopped with api.StopEntryHandler once no more
+// entries are given to it, so that the entries held by the stages are sent. Stopping it also closes the pipeline.
+func (p *Pipeline) Wrap(next api.EntryHandler) api.EntryHandler {
+	handler, stop := p.Handler(func(entry Entry) error {
+		return next.Handle(entry.Labels, entry.Timestamp, entry.Line)
+	})
+	return &pipelineEntryHandler{pipeline: p, handler: handler, stop: stop}
+}
+
+// pipelineEntryHandler is the api.StoppableEntryHandler of a pipeline.
+type pipelineEntryHandler struct {
+	pipeline *Pipeline
+	handler  EntryFunc
+	stop     StopFunc
+}
+
+// Handle implements api.EntryHandler.
+func (h *pipelineEntryHandler) Handle(labels model.LabelSet, timestamp time.Time, line string) error {
+	return h.handler(Entry{
+		Labels:    labels,
+		Extracted: map[string]interface{}{},
+		Timestamp: timestamp,
+		Line:      line,
 	})
 }
 
+// Stop implements api.StoppableEntryHandler.
+func (h *pipelineEntryHandler) Stop() {
+	h.stop()
+	if err := h.pipeline.Close(); err != nil {
+		level.Error(h.pipeline.logger).Log("msg", "failed to close pipeline", "err", err)
+	}
+}
+
 // AddStage adds a stage to the pipeline
 func (p *Pipeline) AddStage(stage Stage) {
 	p.stages = append(p.stages, stage)
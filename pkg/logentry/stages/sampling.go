@@ -0,0 +1,113 @@
+package stages
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// Config Errors
+const (
+	ErrEmptySamplingStageConfig    = "sampling stage config cannot be empty"
+	ErrSamplingStageInvalidRate    = "sampling stage `rate` must be between 0 and 1"
+	ErrSamplingStageEmptySource    = "sampling stage `source` cannot be an empty string"
+	samplingStageDropCounterReason = "sampling_stage"
+)
+
+// SamplingConfig contains the configuration for a samplingStage
+type SamplingConfig struct {
+	Rate   *float64 `mapstructure:"rate"`
+	Source *string  `mapstructure:"source"`
+}
+
+// validateSamplingConfig validates the SamplingConfig for the samplingStage
+func validateSamplingConfig(cfg *SamplingConfig) error {
+	if cfg == nil || cfg.Rate == nil {
+		return errors.New(ErrEmptySamplingStageConfig)
+	}
+	if *cfg.Rate < 0 || *cfg.Rate > 1 {
+		return errors.New(ErrSamplingStageInvalidRate)
+	}
+	if cfg.Source != nil && *cfg.Source == "" {
+		return errors.New(ErrSamplingStageEmptySource)
+	}
+	return nil
+}
+
+// newSamplingStage creates a samplingStage from config
+func newSamplingStage(logger log.Logger, config interface{}, registerer prometheus.Registerer) (Stage, error) {
+	cfg := &SamplingConfig{}
+	err := mapstructure.Decode(config, cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = validateSamplingConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &samplingStage{
+		logger:  log.With(logger, "component", "stage", "type", "sampling"),
+		cfg:     cfg,
+		dropped: droppedLinesCounter(registerer).WithLabelValues(samplingStageDropCounterReason),
+	}, nil
+}
+
+// samplingStage keeps a fraction of the entries, chosen by the hash of the line or of an extracted value,
+// so that the same entries are always kept.
+type samplingStage struct {
+	logger  log.Logger
+	cfg     *SamplingConfig
+	dropped prometheus.Counter
+}
+
+// Process implements Stage
+func (m *samplingStage) Process(labels model.LabelSet, extracted map[string]interface{}, t *time.Time, entry *string) {
+	if _, ok := labels[dropLabel]; ok {
+		return
+	}
+
+	input := *entry
+	if m.cfg.Source != nil {
+		v, ok := extracted[*m.cfg.Source]
+		if !ok {
+			if Debug {
+				level.Debug(m.logger).Log("msg", "source does not exist in the set of extracted values", "source", *m.cfg.Source)
+			}
+			return
+		}
+		value, err := getString(v)
+		if err != nil {
+			if Debug {
+				level.Debug(m.logger).Log("msg", "failed to convert source value to string", "source", *m.cfg.Source, "err", err, "type", reflect.TypeOf(v))
+			}
+			return
+		}
+		input = value
+	}
+
+	if sampled(input, *m.cfg.Rate) {
+		return
+	}
+	// Adds the drop label to not be sent by the api.EntryHandler
+	labels[dropLabel] = ""
+	m.dropped.Inc()
+}
+
+// sampled returns whether the input is part of the fraction of the inputs kept, using the 53 high bits
+// of its hash as a uniformly distributed value between 0 and 1.
+func sampled(input string, rate float64) bool {
+	return float64(xxhash.Sum64String(input)>>11)/(1<<53) < rate
+}
+
+// Name implements Stage
+func (m *samplingStage) Name() string {
+	return StageTypeSampling
+}
@@ -0,0 +1,102 @@
+package stages
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSamplingYaml = `
+pipeline_stages:
+- regex:
+    expression: "trace_id=(?P<trace_id>\\w+)"
+- sampling:
+    rate: 0.25
+    source: trace_id
+`
+
+func TestSamplingPipeline(t *testing.T) {
+	pl, err := NewPipeline(util.Logger, loadConfig(testSamplingYaml), nil, prometheus.NewRegistry())
+	require.NoError(t, err)
+	rec := &recordingHandler{}
+	handler := pl.Wrap(rec)
+
+	for i := 0; i < 10000; i++ {
+		require.NoError(t, handler.Handle(model.LabelSet{}, time.Now(), fmt.Sprintf("trace_id=%d msg=request", i)))
+		require.NoError(t, handler.Handle(model.LabelSet{}, time.Now(), fmt.Sprintf("trace_id=%d msg=response", i)))
+	}
+	// the entries of the same trace are either all kept or all dropped.
+	lines := rec.lines()
+	require.Equal(t, 0, len(lines)%2)
+	for i := 0; i < len(lines); i += 2 {
+		require.Equal(t, lines[i][:len(lines[i])-len("request")], lines[i+1][:len(lines[i+1])-len("response")])
+	}
+	assert.InDelta(t, 5000, len(lines), 300)
+
+	// entries without the source are kept.
+	require.NoError(t, handler.Handle(model.LabelSet{}, time.Now(), "msg=untraced"))
+	assert.Equal(t, "msg=untraced", rec.lines()[len(lines)])
+}
+
+func TestSampled(t *testing.T) {
+	for _, rate := range []float64{0, 0.01, 0.5, 1} {
+		kept := 0
+		for i := 0; i < 100000; i++ {
+			input := fmt.Sprintf("line %d", i)
+			if sampled(input, rate) {
+				kept++
+			}
+			// the sampling is deterministic.
+			require.Equal(t, sampled(input, rate), sampled(input, rate))
+		}
+		assert.InDelta(t, rate*100000, kept, 1000, "rate %f", rate)
+	}
+}
+
+func TestSamplingStage_Validation(t *testing.T) {
+	t.Parallel()
+
+	valid := 0.5
+	invalid := 1.5
+	empty := ""
+
+	tests := map[string]struct {
+		config      *SamplingConfig
+		expectedErr error
+	}{
+		"valid config": {
+			config: &SamplingConfig{Rate: &valid},
+		},
+		"missing rate": {
+			config:      &SamplingConfig{},
+			expectedErr: errors.New(ErrEmptySamplingStageConfig),
+		},
+		"invalid rate": {
+			config:      &SamplingConfig{Rate: &invalid},
+			expectedErr: errors.New(ErrSamplingStageInvalidRate),
+		},
+		"empty source": {
+			config:      &SamplingConfig{Rate: &valid, Source: &empty},
+			expectedErr: errors.New(ErrSamplingStageEmptySource),
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			err := validateSamplingConfig(tt.config)
+			if tt.expectedErr != nil {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
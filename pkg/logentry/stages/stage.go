@@ -23,6 +23,15 @@ const (
 	StageTypeTemplate  = "template"
 	StageTypePipeline  = "pipeline"
 	StageTypeTenant    = "tenant"
+	StageTypeMultiline = "multiline"
+	StageTypeDrop      = "drop"
+	StageTypePack      = "pack"
+	StageTypeLimit     = "limit"
+	StageTypeSampling  = "sampling"
+	StageTypeLogfmt    = "logfmt"
+	StageTypeGeoIP     = "geoip"
+
+	StageTypeStaticLabels = "static_labels"
 )
 
 // Stage takes an existing set of labels, timestamp and log entry and returns either a possibly mutated
@@ -40,6 +49,37 @@ func (s StageFunc) Process(labels model.LabelSet, extracted map[string]interface
 	s(labels, extracted, time, entry)
 }
 
+// Entry is a log entry passed down a pipeline, with the values extracted from it by the previous stages.
+type Entry struct {
+	Labels    model.LabelSet
+	Extracted map[string]interface{}
+	Timestamp time.Time
+	Line      string
+}
+
+// EntryFunc handles an entry passed down a pipeline.
+type EntryFunc func(entry Entry) error
+
+// StopFunc stops the handler of an AsyncStage, the entries it holds are passed down the pipeline.
+type StopFunc func()
+
+// AsyncStage is a Stage which can hold entries and pass them down the pipeline later, possibly from another
+// goroutine, e.g. to merge several entries into one.
+// When a pipeline wraps an api.EntryHandler, the entries are given to the handler of the stage instead of Process,
+// and only the entries the handler passes to next reach the following stages. Handlers must be safe for concurrent use.
+// The handler is stopped once the entries are no longer given to it, e.g. when the target of the pipeline stops.
+type AsyncStage interface {
+	Stage
+	Handler(next EntryFunc) (EntryFunc, StopFunc)
+}
+
+// ClosableStage is a Stage holding resources, e.g. an open file, which are released by Close when its pipeline
+// is torn down.
+type ClosableStage interface {
+	Stage
+	Close() error
+}
+
 // New creates a new stage for the given type and configuration.
 func New(logger log.Logger, jobName *string, stageType string,
 	cfg interface{}, registerer prometheus.Registerer) (Stage, error) {
@@ -106,6 +146,46 @@ func New(logger log.Logger, jobName *string, stageType string,
 		if err != nil {
 			return nil, err
 		}
+	case StageTypeMultiline:
+		s, err = newMultilineStage(logger, cfg)
+		if err != nil {
+			return nil, err
+		}
+	case StageTypeDrop:
+		s, err = newDropStage(logger, cfg, registerer)
+		if err != nil {
+			return nil, err
+		}
+	case StageTypePack:
+		s, err = newPackStage(logger, cfg)
+		if err != nil {
+			return nil, err
+		}
+	case StageTypeLimit:
+		s, err = newLimitStage(logger, cfg, registerer)
+		if err != nil {
+			return nil, err
+		}
+	case StageTypeSampling:
+		s, err = newSamplingStage(logger, cfg, registerer)
+		if err != nil {
+			return nil, err
+		}
+	case StageTypeLogfmt:
+		s, err = newLogfmtStage(logger, cfg)
+		if err != nil {
+			return nil, err
+		}
+	case StageTypeStaticLabels:
+		s, err = newStaticLabelsStage(logger, cfg)
+		if err != nil {
+			return nil, err
+		}
+	case StageTypeGeoIP:
+		s, err = newGeoIPStage(logger, cfg)
+		if err != nil {
+			return nil, err
+		}
 	default:
 		return nil, errors.Errorf("Unknown stage type: %s", stageType)
 	}
@@ -0,0 +1,72 @@
+package stages
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	ErrEmptyStaticLabelStageConfig = "static_labels stage config cannot be empty"
+	ErrInvalidStaticLabelValue     = "invalid value for static label %s"
+)
+
+// StaticLabelsConfig is a set of labels to be added with fixed values
+type StaticLabelsConfig map[string]*string
+
+// validateStaticLabelsConfig validates the static_labels stage configuration
+func validateStaticLabelsConfig(c StaticLabelsConfig) (model.LabelSet, error) {
+	if len(c) == 0 {
+		return nil, errors.New(ErrEmptyStaticLabelStageConfig)
+	}
+	labels := make(model.LabelSet, len(c))
+	for labelName, labelValue := range c {
+		if !model.LabelName(labelName).IsValid() {
+			return nil, fmt.Errorf(ErrInvalidLabelName, labelName)
+		}
+		if labelValue == nil || *labelValue == "" || !model.LabelValue(*labelValue).IsValid() {
+			return nil, fmt.Errorf(ErrInvalidStaticLabelValue, labelName)
+		}
+		labels[model.LabelName(labelName)] = model.LabelValue(*labelValue)
+	}
+	return labels, nil
+}
+
+// newStaticLabelsStage creates a new static_labels stage to set labels with fixed values
+func newStaticLabelsStage(logger log.Logger, configs interface{}) (Stage, error) {
+	cfgs := StaticLabelsConfig{}
+	err := mapstructure.Decode(configs, &cfgs)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := validateStaticLabelsConfig(cfgs)
+	if err != nil {
+		return nil, err
+	}
+	return &staticLabelsStage{
+		labels: labels,
+		logger: logger,
+	}, nil
+}
+
+// staticLabelsStage sets labels with fixed values
+type staticLabelsStage struct {
+	labels model.LabelSet
+	logger log.Logger
+}
+
+// Process implements Stage
+func (s *staticLabelsStage) Process(labels model.LabelSet, extracted map[string]interface{}, t *time.Time, entry *string) {
+	for lName, lValue := range s.labels {
+		labels[lName] = lValue
+	}
+}
+
+// Name implements Stage
+func (s *staticLabelsStage) Name() string {
+	return StageTypeStaticLabels
+}
@@ -0,0 +1,106 @@
+package stages
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testStaticLabelsYaml = `
+pipeline_stages:
+- match:
+    selector: '{app="api"} |= "level=error"'
+    stages:
+    - static_labels:
+        severity: high
+        team: backend
+`
+
+func TestStaticLabelsPipeline(t *testing.T) {
+	pl, err := NewPipeline(util.Logger, loadConfig(testStaticLabelsYaml), nil, prometheus.DefaultRegisterer)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		labels         model.LabelSet
+		entry          string
+		expectedLabels model.LabelSet
+	}{
+		"matching entry": {
+			model.LabelSet{"app": "api"},
+			"level=error msg=failed",
+			model.LabelSet{"app": "api", "severity": "high", "team": "backend"},
+		},
+		"not matching line": {
+			model.LabelSet{"app": "api"},
+			"level=info msg=ok",
+			model.LabelSet{"app": "api"},
+		},
+		"not matching stream": {
+			model.LabelSet{"app": "web"},
+			"level=error msg=failed",
+			model.LabelSet{"app": "web"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ts := time.Now()
+			entry := tt.entry
+			pl.Process(tt.labels, map[string]interface{}{}, &ts, &entry)
+			assert.Equal(t, tt.expectedLabels, tt.labels)
+		})
+	}
+}
+
+func TestStaticLabelsStage_Validation(t *testing.T) {
+	t.Parallel()
+
+	value := "value"
+	empty := ""
+
+	tests := map[string]struct {
+		config         StaticLabelsConfig
+		expectedLabels model.LabelSet
+		expectedErr    error
+	}{
+		"missing config": {
+			config:      nil,
+			expectedErr: errors.New(ErrEmptyStaticLabelStageConfig),
+		},
+		"invalid label name": {
+			config:      StaticLabelsConfig{"#invalid": &value},
+			expectedErr: fmt.Errorf(ErrInvalidLabelName, "#invalid"),
+		},
+		"missing label value": {
+			config:      StaticLabelsConfig{"name": nil},
+			expectedErr: fmt.Errorf(ErrInvalidStaticLabelValue, "name"),
+		},
+		"empty label value": {
+			config:      StaticLabelsConfig{"name": &empty},
+			expectedErr: fmt.Errorf(ErrInvalidStaticLabelValue, "name"),
+		},
+		"valid config": {
+			config:         StaticLabelsConfig{"name": &value},
+			expectedLabels: model.LabelSet{"name": "value"},
+		},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			labels, err := validateStaticLabelsConfig(tt.config)
+			if tt.expectedErr != nil {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedLabels, labels)
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package loghttp
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	errMissingQuery         = errors.New("query must be set")
+	errMissingStart         = errors.New("start must be set")
+	errEndBeforeStartDelete = errors.New("end timestamp must not be before start time")
+)
+
+// DeleteRequest is a request to delete the logs of the streams selected by a query in a time range.
+type DeleteRequest struct {
+	Query string
+	Start time.Time
+	End   time.Time
+}
+
+// ParseDeleteRequest parses a request to delete logs.
+// The query and start are required, the end defaults to now.
+func ParseDeleteRequest(r *http.Request) (*DeleteRequest, error) {
+	req := &DeleteRequest{Query: query(r)}
+	if req.Query == "" {
+		return nil, errMissingQuery
+	}
+
+	if r.Form.Get("start") == "" {
+		return nil, errMissingStart
+	}
+
+	var err error
+	req.Start, req.End, err = bounds(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.End.Before(req.Start) {
+		return nil, errEndBeforeStartDelete
+	}
+	return req, nil
+}
@@ -0,0 +1,49 @@
+package loghttp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDeleteRequest(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		form     url.Values
+		expected *DeleteRequest
+		err      error
+	}{
+		{
+			"valid",
+			url.Values{"query": {`{app="foo"}`}, "start": {"1000"}, "end": {"2000"}},
+			&DeleteRequest{Query: `{app="foo"}`, Start: time.Unix(1000, 0), End: time.Unix(2000, 0)},
+			nil,
+		},
+		{
+			"missing query",
+			url.Values{"start": {"1000"}, "end": {"2000"}},
+			nil,
+			errMissingQuery,
+		},
+		{
+			"missing start",
+			url.Values{"query": {`{app="foo"}`}, "end": {"2000"}},
+			nil,
+			errMissingStart,
+		},
+		{
+			"end before start",
+			url.Values{"query": {`{app="foo"}`}, "start": {"2000"}, "end": {"1000"}},
+			nil,
+			errEndBeforeStartDelete,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			req, err := ParseDeleteRequest(withForm(tc.form))
+			require.Equal(t, tc.err, err)
+			require.Equal(t, tc.expected, req)
+		})
+	}
+}
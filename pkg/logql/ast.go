@@ -3,6 +3,7 @@ package logql
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -69,6 +70,8 @@ type Querier interface {
 // LogSelectorExpr is a LogQL expression filtering and returning logs.
 type LogSelectorExpr interface {
 	Filter() (LineFilter, error)
+	// Pipeline returns the stages to apply to each line after the line filters.
+	Pipeline() (Pipeline, error)
 	Matchers() []*labels.Matcher
 	Expr
 }
@@ -102,6 +105,10 @@ func (e *matchersExpr) Filter() (LineFilter, error) {
 	return nil, nil
 }
 
+func (e *matchersExpr) Pipeline() (Pipeline, error) {
+	return nil, nil
+}
+
 // impl Expr
 func (e *matchersExpr) logQLExpr() {}
 
@@ -142,18 +149,20 @@ func (e *filterExpr) String() string {
 }
 
 func (e *filterExpr) Filter() (LineFilter, error) {
+	// the filter can't be applied on the original line if it was modified by a previous stage.
+	if isLineModified(e.left) {
+		return e.left.Filter()
+	}
 	f, err := newFilter(e.match, e.ty)
 	if err != nil {
 		return nil, err
 	}
-	if nextExpr, ok := e.left.(*filterExpr); ok {
-		nextFilter, err := nextExpr.Filter()
-		if err != nil {
-			return nil, err
-		}
-		if nextFilter != nil {
-			f = newAndFilter(nextFilter, f)
-		}
+	nextFilter, err := e.left.Filter()
+	if err != nil {
+		return nil, err
+	}
+	if nextFilter != nil {
+		f = newAndFilter(nextFilter, f)
 	}
 
 	if f == TrueFilter {
@@ -163,9 +172,253 @@ func (e *filterExpr) Filter() (LineFilter, error) {
 	return f, nil
 }
 
+func (e *filterExpr) Pipeline() (Pipeline, error) {
+	p, err := e.left.Pipeline()
+	if err != nil {
+		return nil, err
+	}
+	if !isLineModified(e.left) {
+		return p, nil
+	}
+	f, err := newFilter(e.match, e.ty)
+	if err != nil {
+		return nil, err
+	}
+	if f == TrueFilter {
+		return p, nil
+	}
+	return append(p, lineFilterStage{f}), nil
+}
+
+// isLineModified returns true if a stage of the expression modifies the log line.
+func isLineModified(expr LogSelectorExpr) bool {
+	switch e := expr.(type) {
+	case *lineFmtExpr:
+		return true
+	case *filterExpr:
+		return isLineModified(e.left)
+	case *parserExpr:
+		return e.op == OpParserTypeUnpack || isLineModified(e.left)
+	case *labelFilterExpr:
+		return isLineModified(e.left)
+	case *labelFmtExpr:
+		return isLineModified(e.left)
+	default:
+		return false
+	}
+}
+
 // impl Expr
 func (e *filterExpr) logQLExpr() {}
 
+type parserExpr struct {
+	left  LogSelectorExpr
+	op    string
+	param string
+}
+
+func mustNewParserExpr(left LogSelectorExpr, op, param string) LogSelectorExpr {
+	e := &parserExpr{
+		left:  left,
+		op:    op,
+		param: param,
+	}
+	// validates the parser parameters early.
+	if _, err := e.stage(); err != nil {
+		panic(newParseError(err.Error(), 0, 0))
+	}
+	return e
+}
+
+func (e *parserExpr) Matchers() []*labels.Matcher {
+	return e.left.Matchers()
+}
+
+// Filter returns the line filters of the left expression,
+// they are applied on the line before it is parsed, even when unpack modifies it.
+func (e *parserExpr) Filter() (LineFilter, error) {
+	return e.left.Filter()
+}
+
+func (e *parserExpr) Pipeline() (Pipeline, error) {
+	p, err := e.left.Pipeline()
+	if err != nil {
+		return nil, err
+	}
+	s, err := e.stage()
+	if err != nil {
+		return nil, err
+	}
+	return append(p, s), nil
+}
+
+func (e *parserExpr) stage() (Stage, error) {
+	switch e.op {
+	case OpParserTypeJSON:
+		return newJSONParser(), nil
+	case OpParserTypeLogfmt:
+		return newLogfmtParser(), nil
+	case OpParserTypeRegexp:
+		return newRegexpParser(e.param)
+	case OpParserTypeUnpack:
+		return newUnpackParser(), nil
+	default:
+		return nil, fmt.Errorf("unknown parser operator: %s", e.op)
+	}
+}
+
+func (e *parserExpr) String() string {
+	var sb strings.Builder
+	sb.WriteString(e.left.String())
+	sb.WriteString(" | ")
+	sb.WriteString(e.op)
+	if e.param != "" {
+		sb.WriteString(" ")
+		sb.WriteString(strconv.Quote(e.param))
+	}
+	return sb.String()
+}
+
+// impl Expr
+func (e *parserExpr) logQLExpr() {}
+
+type labelFilterExpr struct {
+	left   LogSelectorExpr
+	filter LabelFilterer
+}
+
+func newLabelFilterExpr(left LogSelectorExpr, filter LabelFilterer) LogSelectorExpr {
+	return &labelFilterExpr{
+		left:   left,
+		filter: filter,
+	}
+}
+
+func (e *labelFilterExpr) Matchers() []*labels.Matcher {
+	return e.left.Matchers()
+}
+
+// Filter returns the line filters of the left expression, label filters are part of the pipeline.
+func (e *labelFilterExpr) Filter() (LineFilter, error) {
+	return e.left.Filter()
+}
+
+func (e *labelFilterExpr) Pipeline() (Pipeline, error) {
+	p, err := e.left.Pipeline()
+	if err != nil {
+		return nil, err
+	}
+	return append(p, e.filter), nil
+}
+
+func (e *labelFilterExpr) String() string {
+	var sb strings.Builder
+	sb.WriteString(e.left.String())
+	sb.WriteString(" | ")
+	sb.WriteString(e.filter.String())
+	return sb.String()
+}
+
+// impl Expr
+func (e *labelFilterExpr) logQLExpr() {}
+
+type lineFmtExpr struct {
+	left  LogSelectorExpr
+	value string
+}
+
+func mustNewLineFmtExpr(left LogSelectorExpr, value string) LogSelectorExpr {
+	// validates the template early.
+	if _, err := newLineFormatter(value); err != nil {
+		panic(newParseError(err.Error(), 0, 0))
+	}
+	return &lineFmtExpr{
+		left:  left,
+		value: value,
+	}
+}
+
+func (e *lineFmtExpr) Matchers() []*labels.Matcher {
+	return e.left.Matchers()
+}
+
+func (e *lineFmtExpr) Filter() (LineFilter, error) {
+	return e.left.Filter()
+}
+
+func (e *lineFmtExpr) Pipeline() (Pipeline, error) {
+	p, err := e.left.Pipeline()
+	if err != nil {
+		return nil, err
+	}
+	f, err := newLineFormatter(e.value)
+	if err != nil {
+		return nil, err
+	}
+	return append(p, f), nil
+}
+
+func (e *lineFmtExpr) String() string {
+	return fmt.Sprintf("%s | %s %s", e.left.String(), OpFmtLine, strconv.Quote(e.value))
+}
+
+// impl Expr
+func (e *lineFmtExpr) logQLExpr() {}
+
+type labelFmtExpr struct {
+	left    LogSelectorExpr
+	formats []labelFmt
+}
+
+func mustNewLabelFmtExpr(left LogSelectorExpr, fmts []labelFmt) LogSelectorExpr {
+	// validates the formats early.
+	if _, err := newLabelsFormatter(fmts); err != nil {
+		panic(newParseError(err.Error(), 0, 0))
+	}
+	return &labelFmtExpr{
+		left:    left,
+		formats: fmts,
+	}
+}
+
+func (e *labelFmtExpr) Matchers() []*labels.Matcher {
+	return e.left.Matchers()
+}
+
+func (e *labelFmtExpr) Filter() (LineFilter, error) {
+	return e.left.Filter()
+}
+
+func (e *labelFmtExpr) Pipeline() (Pipeline, error) {
+	p, err := e.left.Pipeline()
+	if err != nil {
+		return nil, err
+	}
+	f, err := newLabelsFormatter(e.formats)
+	if err != nil {
+		return nil, err
+	}
+	return append(p, f), nil
+}
+
+func (e *labelFmtExpr) String() string {
+	var sb strings.Builder
+	sb.WriteString(e.left.String())
+	sb.WriteString(" | ")
+	sb.WriteString(OpFmtLabel)
+	sb.WriteString(" ")
+	for i, f := range e.formats {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(f.String())
+	}
+	return sb.String()
+}
+
+// impl Expr
+func (e *labelFmtExpr) logQLExpr() {}
+
 func mustNewMatcher(t labels.MatchType, n, v string) *labels.Matcher {
 	m, err := labels.NewMatcher(t, n, v)
 	if err != nil {
@@ -177,23 +430,72 @@ func mustNewMatcher(t labels.MatchType, n, v string) *labels.Matcher {
 type logRange struct {
 	left     LogSelectorExpr
 	interval time.Duration
+	offset   time.Duration
+
+	unwrap *unwrapExpr
 }
 
 // impls Stringer
 func (r logRange) String() string {
 	var sb strings.Builder
 	sb.WriteString(r.left.String())
+	if r.unwrap != nil {
+		sb.WriteString(r.unwrap.String())
+	}
 	sb.WriteString(fmt.Sprintf("[%v]", model.Duration(r.interval)))
+	if r.offset != 0 {
+		sb.WriteString(fmt.Sprintf(" %s %v", OpOffset, model.Duration(r.offset)))
+	}
 	return sb.String()
 }
 
-func newLogRange(left LogSelectorExpr, interval time.Duration) *logRange {
+func newLogRange(left LogSelectorExpr, interval time.Duration, u *unwrapExpr, o *offsetExpr) *logRange {
+	var offset time.Duration
+	if o != nil {
+		offset = o.offset
+	}
 	return &logRange{
 		left:     left,
 		interval: interval,
+		offset:   offset,
+		unwrap:   u,
 	}
 }
 
+// offsetExpr is the `offset <duration>` modifier shifting the evaluation time of a range back in time.
+type offsetExpr struct {
+	offset time.Duration
+}
+
+func newOffsetExpr(offset time.Duration) *offsetExpr {
+	return &offsetExpr{offset: offset}
+}
+
+// unwrapExpr is the `| unwrap <label>` expression using the value of a label as the sample value.
+// Label filters following it are applied after the conversion, they can be used to filter out conversion errors.
+type unwrapExpr struct {
+	identifier  string
+	postFilters []LabelFilterer
+}
+
+func newUnwrapExpr(id string) *unwrapExpr {
+	return &unwrapExpr{identifier: id}
+}
+
+func (u *unwrapExpr) addPostFilter(f LabelFilterer) *unwrapExpr {
+	u.postFilters = append(u.postFilters, f)
+	return u
+}
+
+func (u *unwrapExpr) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf(" | %s %s", OpUnwrap, u.identifier))
+	for _, f := range u.postFilters {
+		sb.WriteString(fmt.Sprintf(" | %s", f))
+	}
+	return sb.String()
+}
+
 func addFilterToLogRangeExpr(left *logRange, ty labels.MatchType, match string) *logRange {
 	left.left = &filterExpr{
 		left:  left.left,
@@ -220,6 +522,33 @@ const (
 	OpRangeTypeRate      = "rate"
 	OpRangeTypeBytes     = "bytes_over_time"
 	OpRangeTypeBytesRate = "bytes_rate"
+	OpRangeTypeAvg       = "avg_over_time"
+	OpRangeTypeSum       = "sum_over_time"
+	OpRangeTypeMin       = "min_over_time"
+	OpRangeTypeMax       = "max_over_time"
+	OpRangeTypeStdvar    = "stdvar_over_time"
+	OpRangeTypeStddev    = "stddev_over_time"
+	OpRangeTypeQuantile  = "quantile_over_time"
+	OpRangeTypeFirst     = "first_over_time"
+	OpRangeTypeLast      = "last_over_time"
+	OpRangeTypeAbsent    = "absent_over_time"
+
+	// parsers
+	OpParserTypeJSON   = "json"
+	OpParserTypeLogfmt = "logfmt"
+	OpParserTypeRegexp = "regexp"
+	OpParserTypeUnpack = "unpack"
+
+	// formatters
+	OpFmtLine  = "line_format"
+	OpFmtLabel = "label_format"
+
+	OpUnwrap = "unwrap"
+	OpOffset = "offset"
+
+	// label functions
+	OpLabelReplace = "label_replace"
+	OpLabelJoin    = "label_join"
 
 	// binops - logical/set
 	OpTypeOr     = "or"
@@ -275,6 +604,8 @@ type SampleExpr interface {
 type rangeAggregationExpr struct {
 	left      *logRange
 	operation string
+
+	params *float64
 }
 
 func newRangeAggregationExpr(left *logRange, operation string) SampleExpr {
@@ -284,6 +615,54 @@ func newRangeAggregationExpr(left *logRange, operation string) SampleExpr {
 	}
 }
 
+func mustNewRangeAggregationExpr(left *logRange, operation string, params *string) SampleExpr {
+	var p *float64
+	if params != nil {
+		v, err := strconv.ParseFloat(*params, 64)
+		if err != nil {
+			panic(newParseError(fmt.Sprintf("invalid parameter for operation %s: %s", operation, err), 0, 0))
+		}
+		p = &v
+	}
+	e := &rangeAggregationExpr{
+		left:      left,
+		operation: operation,
+		params:    p,
+	}
+	if err := e.validate(); err != nil {
+		panic(newParseError(err.Error(), 0, 0))
+	}
+	return e
+}
+
+func (e *rangeAggregationExpr) validate() error {
+	switch e.operation {
+	case OpRangeTypeQuantile:
+		if e.params == nil {
+			return fmt.Errorf("parameter required for operation %s", e.operation)
+		}
+	default:
+		if e.params != nil {
+			return fmt.Errorf("unsupported parameter for operation %s", e.operation)
+		}
+	}
+	if e.left.unwrap != nil {
+		switch e.operation {
+		case OpRangeTypeAvg, OpRangeTypeSum, OpRangeTypeMax, OpRangeTypeMin, OpRangeTypeStddev, OpRangeTypeStdvar,
+			OpRangeTypeQuantile, OpRangeTypeFirst, OpRangeTypeLast:
+			return nil
+		default:
+			return fmt.Errorf("invalid aggregation %s with unwrap", e.operation)
+		}
+	}
+	switch e.operation {
+	case OpRangeTypeBytes, OpRangeTypeBytesRate, OpRangeTypeCount, OpRangeTypeRate, OpRangeTypeAbsent:
+		return nil
+	default:
+		return fmt.Errorf("invalid aggregation %s without unwrap", e.operation)
+	}
+}
+
 func (e *rangeAggregationExpr) Selector() LogSelectorExpr {
 	return e.left.left
 }
@@ -293,6 +672,9 @@ func (e *rangeAggregationExpr) logQLExpr() {}
 
 // impls Stringer
 func (e *rangeAggregationExpr) String() string {
+	if e.params != nil {
+		return formatOperation(e.operation, nil, strconv.FormatFloat(*e.params, 'f', -1, 64), e.left.String())
+	}
 	return formatOperation(e.operation, nil, e.left.String())
 }
 
@@ -387,7 +769,79 @@ func (e *vectorAggregationExpr) Operations() []string {
 }
 
 type BinOpOptions struct {
-	ReturnBool bool
+	ReturnBool     bool
+	VectorMatching *VectorMatching
+}
+
+// VectorMatchCardinality describes the cardinality relationship
+// of two vectors in a binary operation.
+type VectorMatchCardinality int
+
+const (
+	CardOneToOne VectorMatchCardinality = iota
+	CardManyToOne
+	CardOneToMany
+	CardManyToMany
+)
+
+func (vmc VectorMatchCardinality) String() string {
+	switch vmc {
+	case CardOneToOne:
+		return "one-to-one"
+	case CardManyToOne:
+		return "many-to-one"
+	case CardOneToMany:
+		return "one-to-many"
+	case CardManyToMany:
+		return "many-to-many"
+	}
+	panic("logql.VectorMatchCardinality.String: unknown match cardinality")
+}
+
+// VectorMatching describes how elements from two vectors in a binary
+// operation are supposed to be matched, it follows the Prometheus semantics.
+// A nil VectorMatching matches elements using all their labels.
+type VectorMatching struct {
+	// The cardinality of the two vectors.
+	Card VectorMatchCardinality
+	// MatchingLabels contains the labels which define equality of a pair of
+	// elements from the vectors.
+	MatchingLabels []string
+	// On includes the given label names from matching,
+	// rather than excluding them.
+	On bool
+	// Include contains additional labels that should be included in
+	// the result from the side with the lower cardinality.
+	Include []string
+}
+
+func (m *VectorMatching) String() string {
+	var sb strings.Builder
+	if m.On || len(m.MatchingLabels) > 0 || m.Card == CardManyToOne || m.Card == CardOneToMany {
+		if m.On {
+			sb.WriteString(" on(")
+		} else {
+			sb.WriteString(" ignoring(")
+		}
+		sb.WriteString(strings.Join(m.MatchingLabels, ","))
+		sb.WriteString(")")
+	}
+	switch m.Card {
+	case CardManyToOne:
+		sb.WriteString(" group_left(")
+		sb.WriteString(strings.Join(m.Include, ","))
+		sb.WriteString(")")
+	case CardOneToMany:
+		sb.WriteString(" group_right(")
+		sb.WriteString(strings.Join(m.Include, ","))
+		sb.WriteString(")")
+	}
+	return sb.String()
+}
+
+// isDefault returns true if the vector matching matches samples on all labels.
+func (m *VectorMatching) isDefault() bool {
+	return m == nil || (!m.On && len(m.MatchingLabels) == 0 && (m.Card == CardOneToOne || m.Card == CardManyToMany))
 }
 
 type binOpExpr struct {
@@ -398,10 +852,19 @@ type binOpExpr struct {
 }
 
 func (e *binOpExpr) String() string {
+	var sb strings.Builder
+	sb.WriteString(e.SampleExpr.String())
+	sb.WriteString(" ")
+	sb.WriteString(e.op)
 	if e.opts.ReturnBool {
-		return fmt.Sprintf("%s %s bool %s", e.SampleExpr.String(), e.op, e.RHS.String())
+		sb.WriteString(" bool")
 	}
-	return fmt.Sprintf("%s %s %s", e.SampleExpr.String(), e.op, e.RHS.String())
+	if !e.opts.VectorMatching.isDefault() {
+		sb.WriteString(e.opts.VectorMatching.String())
+	}
+	sb.WriteString(" ")
+	sb.WriteString(e.RHS.String())
+	return sb.String()
 }
 
 // impl SampleExpr
@@ -432,6 +895,12 @@ func mustNewBinOpExpr(op string, opts BinOpOptions, lhs, rhs Expr) SampleExpr {
 	leftLit, lOk := left.(*literalExpr)
 	rightLit, rOk := right.(*literalExpr)
 
+	if opts.VectorMatching != nil {
+		if err := validateVectorMatching(op, opts.VectorMatching, lOk || rOk); err != nil {
+			panic(newParseError(err.Error(), 0, 0))
+		}
+	}
+
 	if IsLogicalBinOp(op) {
 		if lOk {
 			panic(newParseError(fmt.Sprintf(
@@ -463,6 +932,30 @@ func mustNewBinOpExpr(op string, opts BinOpOptions, lhs, rhs Expr) SampleExpr {
 	}
 }
 
+// validateVectorMatching checks the vector matching of a binary operation the same way Prometheus does.
+func validateVectorMatching(op string, m *VectorMatching, hasLiteral bool) error {
+	if hasLiteral && !m.isDefault() {
+		return fmt.Errorf("vector matching only allowed between vectors")
+	}
+	if IsLogicalBinOp(op) {
+		if m.Card == CardOneToMany || m.Card == CardManyToOne {
+			return fmt.Errorf("no grouping allowed for \"%s\" operation", op)
+		}
+		// set operations are always many-to-many.
+		m.Card = CardManyToMany
+	}
+	if m.On && (m.Card == CardOneToMany || m.Card == CardManyToOne) {
+		for _, l1 := range m.MatchingLabels {
+			for _, l2 := range m.Include {
+				if l1 == l2 {
+					return fmt.Errorf("label %q must not occur in ON and GROUP clause at once", l1)
+				}
+			}
+		}
+	}
+	return nil
+}
+
 // Reduces a binary operation expression. A binop is reducible if both of its legs are literal expressions.
 // This is because literals need match all labels, which is currently difficult to encode into StepEvaluators.
 // Therefore, we ensure a binop can be reduced/simplified, maintaining the invariant that it does not have two literal legs.
@@ -477,6 +970,135 @@ func reduceBinOp(op string, left, right *literalExpr) *literalExpr {
 	return &literalExpr{value: merged.V}
 }
 
+type labelReplaceExpr struct {
+	left        SampleExpr
+	dst         string
+	replacement string
+	src         string
+	regex       string
+	re          *regexp.Regexp
+}
+
+func mustNewLabelReplaceExpr(left SampleExpr, dst, replacement, src, regex string) *labelReplaceExpr {
+	re, err := regexp.Compile("^(?:" + regex + ")$")
+	if err != nil {
+		panic(newParseError(fmt.Sprintf("invalid regex in label_replace: %s", err.Error()), 0, 0))
+	}
+	if !model.LabelNameRE.MatchString(dst) {
+		panic(newParseError(fmt.Sprintf("invalid destination label name in label_replace: %s", dst), 0, 0))
+	}
+	return &labelReplaceExpr{
+		left:        left,
+		dst:         dst,
+		replacement: replacement,
+		src:         src,
+		re:          re,
+		regex:       regex,
+	}
+}
+
+func (e *labelReplaceExpr) Selector() LogSelectorExpr {
+	return e.left.Selector()
+}
+
+func (e *labelReplaceExpr) Extractor() (SampleExtractor, error) {
+	return e.left.Extractor()
+}
+
+// impl Expr
+func (e *labelReplaceExpr) logQLExpr() {}
+
+// impl SampleExpr
+func (e *labelReplaceExpr) Operations() []string {
+	return append(e.left.Operations(), OpLabelReplace)
+}
+
+func (e *labelReplaceExpr) String() string {
+	return fmt.Sprintf("%s(%s,%q,%q,%q,%q)", OpLabelReplace, e.left.String(), e.dst, e.replacement, e.src, e.regex)
+}
+
+// replace returns the labels of a sample once the replacement is applied.
+func (e *labelReplaceExpr) replace(lbs labels.Labels) labels.Labels {
+	srcVal := lbs.Get(e.src)
+	indexes := e.re.FindStringSubmatchIndex(srcVal)
+	if indexes == nil {
+		// If there is no match no replacement should take place.
+		return lbs
+	}
+	res := e.re.ExpandString([]byte{}, e.replacement, srcVal, indexes)
+
+	lb := labels.NewBuilder(lbs).Del(e.dst)
+	if len(res) > 0 {
+		lb.Set(e.dst, string(res))
+	}
+	return lb.Labels()
+}
+
+type labelJoinExpr struct {
+	left      SampleExpr
+	dst       string
+	separator string
+	src       []string
+}
+
+func mustNewLabelJoinExpr(left SampleExpr, dst, separator string, src []string) *labelJoinExpr {
+	if !model.LabelNameRE.MatchString(dst) {
+		panic(newParseError(fmt.Sprintf("invalid destination label name in label_join: %s", dst), 0, 0))
+	}
+	for _, l := range src {
+		if !model.LabelName(l).IsValid() {
+			panic(newParseError(fmt.Sprintf("invalid source label name in label_join: %s", l), 0, 0))
+		}
+	}
+	return &labelJoinExpr{
+		left:      left,
+		dst:       dst,
+		separator: separator,
+		src:       src,
+	}
+}
+
+func (e *labelJoinExpr) Selector() LogSelectorExpr {
+	return e.left.Selector()
+}
+
+func (e *labelJoinExpr) Extractor() (SampleExtractor, error) {
+	return e.left.Extractor()
+}
+
+// impl Expr
+func (e *labelJoinExpr) logQLExpr() {}
+
+// impl SampleExpr
+func (e *labelJoinExpr) Operations() []string {
+	return append(e.left.Operations(), OpLabelJoin)
+}
+
+func (e *labelJoinExpr) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s(%s,%q,%q", OpLabelJoin, e.left.String(), e.dst, e.separator))
+	for _, l := range e.src {
+		sb.WriteString(fmt.Sprintf(",%q", l))
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// join returns the labels of a sample once the source labels are joined into the destination label.
+func (e *labelJoinExpr) join(lbs labels.Labels) labels.Labels {
+	values := make([]string, 0, len(e.src))
+	for _, l := range e.src {
+		values = append(values, lbs.Get(l))
+	}
+	res := strings.Join(values, e.separator)
+
+	lb := labels.NewBuilder(lbs).Del(e.dst)
+	if len(res) > 0 {
+		lb.Set(e.dst, res)
+	}
+	return lb.Labels()
+}
+
 type literalExpr struct {
 	value float64
 }
@@ -508,6 +1130,7 @@ func (e *literalExpr) String() string {
 func (e *literalExpr) Selector() LogSelectorExpr           { return e }
 func (e *literalExpr) Operations() []string                { return nil }
 func (e *literalExpr) Filter() (LineFilter, error)         { return nil, nil }
+func (e *literalExpr) Pipeline() (Pipeline, error)         { return nil, nil }
 func (e *literalExpr) Matchers() []*labels.Matcher         { return nil }
 func (e *literalExpr) Extractor() (SampleExtractor, error) { return nil, nil }
 
@@ -69,6 +69,25 @@ func Test_SampleExpr_String(t *testing.T) {
 		/
 			count_over_time({namespace="tns"}[5m])
 		)`,
+		`sum by (status) (count_over_time({job="nginx"} |= "GET" | json [5m]))`,
+		`count_over_time({job="nginx"} | logfmt |= "GET" | regexp "(?P<method>\\w+)" [5m])`,
+		`sum by (app) (count_over_time({job="nginx"} | json | status >= 500 and (latency > 1m30s or size < 1MB) [5m]))`,
+		`rate({job="nginx"} | logfmt | level="error" or level=~"warn.*" and status == 404 [1m])`,
+		`sum by (app) (sum_over_time({job="nginx"} | json | unwrap latency [5m]))`,
+		`sum by (app,status) (rate({job="nginx"} | json [5m])) / ignoring(status) group_left sum by (app) (rate({job="nginx"} [5m]))`,
+		`sum by (app) (rate({job="nginx"} [5m])) * on(app) group_right(team) sum by (app,team) (rate({job="nginx"} [5m]))`,
+		`sum by (app) (rate({job="nginx"} [5m])) > bool on() sum(rate({job="nginx"} [5m]))`,
+		`rate({job="nginx"} [5m]) and ignoring(level) rate({job="nginx"} | logfmt [5m])`,
+		`label_replace(sum by (app) (rate({job="nginx"} [5m])), "svc", "$1", "app", "(.*)-api")`,
+		`label_join(rate({job="nginx"} [5m]), "dst", "-", "app", "env") > 1`,
+		`label_join(rate({job="nginx"} [5m]), "dst", "-")`,
+		`quantile_over_time(0.99,{job="nginx"} | logfmt | status >= 500 | unwrap latency | __error__="" [5m])`,
+		`avg_over_time({job="nginx"} | regexp "(?P<latency>\\d+)ms" | unwrap latency [1m]) > 250`,
+		`count_over_time({job="nginx"} |= "error" [5m] offset 1d)`,
+		`sum by (app) (rate({job="nginx"} [5m])) / sum by (app) (rate({job="nginx"} [5m] offset 1w))`,
+		`sum_over_time({job="nginx"} | json | unwrap latency [5m] offset 1h30m)`,
+		`bytes_over_time({job="nginx"} | json | line_format "{{.method}} {{.path | ToLower}}" |= "GET" | label_format method=verb,app="{{.app}}-{{.env}}" [1m])`,
+		`count_over_time({job="nginx"} | unpack |= "error" | pod="loki-0" [5m])`,
 	} {
 		t.Run(tc, func(t *testing.T) {
 			expr, err := ParseExpr(tc)
@@ -245,3 +264,64 @@ func BenchmarkContainsFilter(b *testing.B) {
 		}
 	}
 }
+
+func Test_LineFilterAfterUnpack(t *testing.T) {
+	expr, err := ParseLogSelector(`{app="foo"} |= "pod" | unpack |= "buzz"`)
+	require.NoError(t, err)
+
+	// only the first filter can be applied on the packed line.
+	f, err := expr.Filter()
+	require.NoError(t, err)
+	require.True(t, f.Filter([]byte(`{"pod":"foo","_entry":"bar"}`)))
+
+	p, err := expr.Pipeline()
+	require.NoError(t, err)
+	require.Len(t, p, 2)
+
+	for _, tc := range []struct {
+		line string
+		want string
+		ok   bool
+	}{
+		{`{"pod":"foo","_entry":"buzz"}`, `buzz`, true},
+		{`{"pod":"buzz","_entry":"foo"}`, ``, false},
+	} {
+		b := labels.NewBuilder(labels.Labels{{Name: "app", Value: "foo"}})
+		line, ok := p.Process([]byte(tc.line), b)
+		require.Equal(t, tc.ok, ok)
+		if ok {
+			require.Equal(t, tc.want, string(line))
+			require.Equal(t, labels.Labels{{Name: "app", Value: "foo"}, {Name: "pod", Value: "foo"}}, b.Labels())
+		}
+	}
+}
+
+func Test_LineFilterAfterLineFormat(t *testing.T) {
+	expr, err := ParseLogSelector(`{app="foo"} |= "bar" | logfmt | line_format "{{.msg}}" |= "buzz"`)
+	require.NoError(t, err)
+
+	// only the first filter can be applied on the original line.
+	f, err := expr.Filter()
+	require.NoError(t, err)
+	require.True(t, f.Filter([]byte(`msg=foo bar`)))
+	require.False(t, f.Filter([]byte(`msg=buzz`)))
+
+	p, err := expr.Pipeline()
+	require.NoError(t, err)
+	require.Len(t, p, 3)
+
+	for _, tc := range []struct {
+		line string
+		want string
+		ok   bool
+	}{
+		{`bar msg=buzz`, `buzz`, true},
+		{`bar buzz msg=foo`, ``, false},
+	} {
+		line, ok := p.Process([]byte(tc.line), labels.NewBuilder(labels.Labels{{Name: "app", Value: "foo"}}))
+		require.Equal(t, tc.ok, ok)
+		if ok {
+			require.Equal(t, tc.want, string(line))
+		}
+	}
+}
@@ -201,7 +201,7 @@ func (q *query) evalSample(ctx context.Context, expr SampleExpr) (parser.Value,
 
 	if GetRangeType(q.params) == InstantType {
 		sort.Slice(vec, func(i, j int) bool { return labels.Compare(vec[i].Metric, vec[j].Metric) < 0 })
-		return vec, nil
+		return vec, stepEvaluator.Error()
 	}
 
 	stepCount := int(math.Ceil(float64(q.params.End().Sub(q.params.Start()).Nanoseconds()) / float64(q.params.Step().Nanoseconds())))
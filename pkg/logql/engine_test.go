@@ -63,6 +63,46 @@ func TestEngine_LogsInstantQuery(t *testing.T) {
 			},
 			Streams([]logproto.Stream{newStream(30, identity, `{app="bar"}`)}),
 		},
+		{
+			`absent_over_time({app="foo",job=~".+",env="dev",env="prod"} [1m])`, time.Unix(60, 0), logproto.BACKWARD, 10,
+			[][]logproto.Series{
+				{},
+			},
+			[]SelectSampleParams{
+				{&logproto.SampleQueryRequest{Start: time.Unix(0, 0), End: time.Unix(60, 0), Selector: `absent_over_time({app="foo",job=~".+",env="dev",env="prod"}[1m])`}},
+			},
+			promql.Vector{promql.Sample{Point: promql.Point{T: 60 * 1000, V: 1}, Metric: labels.Labels{labels.Label{Name: "app", Value: "foo"}}}},
+		},
+		{
+			`label_replace(rate({app="foo"}[1m]), "svc", "$1-svc", "app", "(.*)")`, time.Unix(60, 0), logproto.BACKWARD, 10,
+			[][]logproto.Series{
+				{newSeries(testSize, identity, `{app="foo"}`)},
+			},
+			[]SelectSampleParams{
+				{&logproto.SampleQueryRequest{Start: time.Unix(0, 0), End: time.Unix(60, 0), Selector: `rate({app="foo"}[1m])`}},
+			},
+			promql.Vector{promql.Sample{Point: promql.Point{T: 60 * 1000, V: 1}, Metric: labels.Labels{{Name: "app", Value: "foo"}, {Name: "svc", Value: "foo-svc"}}}},
+		},
+		{
+			`label_join(rate({app="foo",env="dev"}[1m]), "app", "/", "env", "app")`, time.Unix(60, 0), logproto.BACKWARD, 10,
+			[][]logproto.Series{
+				{newSeries(testSize, identity, `{app="foo", env="dev"}`)},
+			},
+			[]SelectSampleParams{
+				{&logproto.SampleQueryRequest{Start: time.Unix(0, 0), End: time.Unix(60, 0), Selector: `rate({app="foo",env="dev"}[1m])`}},
+			},
+			promql.Vector{promql.Sample{Point: promql.Point{T: 60 * 1000, V: 1}, Metric: labels.Labels{{Name: "app", Value: "dev/foo"}, {Name: "env", Value: "dev"}}}},
+		},
+		{
+			`absent_over_time({app="foo"} [1m])`, time.Unix(60, 0), logproto.BACKWARD, 10,
+			[][]logproto.Series{
+				{newSeries(testSize, identity, `{app="foo"}`)},
+			},
+			[]SelectSampleParams{
+				{&logproto.SampleQueryRequest{Start: time.Unix(0, 0), End: time.Unix(60, 0), Selector: `absent_over_time({app="foo"}[1m])`}},
+			},
+			promql.Vector{},
+		},
 		{
 			`rate({app="foo"} |~".+bar" [1m])`, time.Unix(60, 0), logproto.BACKWARD, 10,
 			[][]logproto.Series{
@@ -562,6 +602,21 @@ func TestEngine_RangeQuery(t *testing.T) {
 				},
 			},
 		},
+		{
+			`count_over_time({app="foo"} |~".+bar" [1m] offset 30s)`, time.Unix(90, 0), time.Unix(150, 0), 30 * time.Second, 0, logproto.BACKWARD, 10,
+			[][]logproto.Series{
+				{newSeries(testSize, factor(10, identity), `{app="foo"}`)}, // 10 , 20 , 30 .. 60 = 6 total
+			},
+			[]SelectSampleParams{
+				{&logproto.SampleQueryRequest{Start: time.Unix(0, 0), End: time.Unix(120, 0), Selector: `count_over_time({app="foo"}|~".+bar"[1m] offset 30s)`}},
+			},
+			promql.Matrix{
+				promql.Series{
+					Metric: labels.Labels{{Name: "app", Value: "foo"}},
+					Points: []promql.Point{{T: 90 * 1000, V: 6}, {T: 120 * 1000, V: 6}, {T: 150 * 1000, V: 6}},
+				},
+			},
+		},
 		{
 			`count_over_time(({app="foo"} |~".+bar")[5m])`, time.Unix(5*60, 0), time.Unix(5*120, 0), 30 * time.Second, 0, logproto.BACKWARD, 10,
 			[][]logproto.Series{
@@ -1518,6 +1573,22 @@ func TestStepEvaluator_Error(t *testing.T) {
 	}
 }
 
+func TestEngine_VectorMatchingError(t *testing.T) {
+	eng := NewEngine(EngineOpts{}, NewMockQuerier(0, []logproto.Stream{
+		newStream(testSize, identity, `{app="foo", status="200"}`),
+		newStream(testSize, identity, `{app="foo", status="500"}`),
+	}))
+	for _, params := range []LiteralParams{
+		{start: time.Unix(60, 0), end: time.Unix(60, 0)},
+		{start: time.Unix(0, 0), end: time.Unix(180, 0), step: 30 * time.Second},
+	} {
+		params.qs = `count_over_time({app="foo"}[1m]) / on(app) count_over_time({app="foo"}[1m])`
+		_, err := eng.Query(params).Exec(context.Background())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `found duplicate series for the match group {app="foo"} on the right hand-side of the operation`)
+	}
+}
+
 // go test -mod=vendor ./pkg/logql/ -bench=.  -benchmem -memprofile memprofile.out -cpuprofile cpuprofile.out
 func BenchmarkRangeQuery100000(b *testing.B) {
 	benchmarkRangeQuery(int64(100000), b)
@@ -160,8 +160,8 @@ func (ev *DefaultEvaluator) StepEvaluator(
 	case *rangeAggregationExpr:
 		it, err := ev.querier.SelectSamples(ctx, SelectSampleParams{
 			&logproto.SampleQueryRequest{
-				Start:    q.Start().Add(-e.left.interval),
-				End:      q.End(),
+				Start:    q.Start().Add(-e.left.interval).Add(-e.left.offset),
+				End:      q.End().Add(-e.left.offset),
 				Selector: expr.String(),
 				Shards:   q.Shards(),
 			},
@@ -172,6 +172,10 @@ func (ev *DefaultEvaluator) StepEvaluator(
 		return rangeAggEvaluator(iter.NewPeekingSampleIterator(it), e, q)
 	case *binOpExpr:
 		return binOpStepEvaluator(ctx, nextEv, e, q)
+	case *labelReplaceExpr:
+		return labelsStepEvaluator(ctx, nextEv, e.left, q, e.replace)
+	case *labelJoinExpr:
+		return labelsStepEvaluator(ctx, nextEv, e.left, q, e.join)
 	default:
 		return nil, EvaluatorUnsupportedType(e, ev)
 	}
@@ -383,14 +387,22 @@ func rangeAggEvaluator(
 	if err != nil {
 		return nil, err
 	}
+	iter := newRangeVectorIterator(
+		it,
+		expr.left.interval.Nanoseconds(),
+		q.Step().Nanoseconds(),
+		q.Start().UnixNano(), q.End().UnixNano(),
+		expr.left.offset.Nanoseconds(),
+	)
+	if expr.operation == OpRangeTypeAbsent {
+		return absentRangeVectorEvaluator{
+			iter: iter,
+			lbs:  absentLabels(expr),
+		}, nil
+	}
 	return rangeVectorEvaluator{
-		iter: newRangeVectorIterator(
-			it,
-			expr.left.interval.Nanoseconds(),
-			q.Step().Nanoseconds(),
-			q.Start().UnixNano(), q.End().UnixNano(),
-		),
-		agg: agg,
+		iter: iter,
+		agg:  agg,
 	}, nil
 }
 
@@ -412,6 +424,75 @@ func (r rangeVectorEvaluator) Close() error { return r.iter.Close() }
 
 func (r rangeVectorEvaluator) Error() error { return r.iter.Error() }
 
+// absentRangeVectorEvaluator returns a single sample with the value 1 for each step without any entries,
+// and nothing for steps with entries.
+type absentRangeVectorEvaluator struct {
+	iter RangeVectorIterator
+	lbs  labels.Labels
+}
+
+func (r absentRangeVectorEvaluator) Next() (bool, int64, promql.Vector) {
+	next := r.iter.Next()
+	if !next {
+		return false, 0, promql.Vector{}
+	}
+	ts, vec := r.iter.At(one)
+	if len(vec) > 0 {
+		return next, ts, promql.Vector{}
+	}
+	return next, ts, promql.Vector{
+		promql.Sample{
+			Point: promql.Point{
+				T: ts,
+				V: 1.,
+			},
+			Metric: r.lbs,
+		},
+	}
+}
+
+func (r absentRangeVectorEvaluator) Close() error { return r.iter.Close() }
+
+func (r absentRangeVectorEvaluator) Error() error { return r.iter.Error() }
+
+// labelsStepEvaluator applies a function to the labels of each sample, this is used by label_replace and label_join.
+// Like Prometheus, it fails if the vector contains multiple samples with the same labels afterward.
+func labelsStepEvaluator(
+	ctx context.Context,
+	ev Evaluator,
+	left SampleExpr,
+	q Params,
+	fn func(labels.Labels) labels.Labels,
+) (StepEvaluator, error) {
+	nextEvaluator, err := ev.StepEvaluator(ctx, ev, left, q)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	return newStepEvaluator(func() (bool, int64, promql.Vector) {
+		next, ts, vec := nextEvaluator.Next()
+		if !next {
+			return false, 0, promql.Vector{}
+		}
+		seen := make(map[uint64]struct{}, len(vec))
+		for i := range vec {
+			vec[i].Metric = fn(vec[i].Metric)
+			h := vec[i].Metric.Hash()
+			if _, ok := seen[h]; ok {
+				lastErr = fmt.Errorf("vector cannot contain metrics with the same labelset")
+				return false, 0, promql.Vector{}
+			}
+			seen[h] = struct{}{}
+		}
+		return next, ts, vec
+	}, nextEvaluator.Close, func() error {
+		if lastErr != nil {
+			return lastErr
+		}
+		return nextEvaluator.Error()
+	})
+}
+
 // binOpExpr explicitly does not handle when both legs are literals as
 // it makes the type system simpler and these are reduced in mustNewBinOpExpr
 func binOpStepEvaluator(
@@ -462,11 +543,12 @@ func binOpStepEvaluator(
 		return nil, err
 	}
 
+	var lastErr error
 	return newStepEvaluator(func() (bool, int64, promql.Vector) {
-		pairs := map[uint64][2]*promql.Sample{}
-		var ts int64
-
-		// populate pairs
+		var (
+			ts      int64
+			vectors [2]promql.Vector
+		)
 		for i, eval := range []StepEvaluator{lhs, rhs} {
 			next, timestamp, vec := eval.Next()
 
@@ -476,30 +558,14 @@ func binOpStepEvaluator(
 			if !next {
 				return next, ts, nil
 			}
-
-			for _, sample := range vec {
-				// TODO(owen-d): this seems wildly inefficient: we're calculating
-				// the hash on each sample & step per evaluator.
-				// We seem limited to this approach due to using the StepEvaluator ifc.
-				hash := sample.Metric.Hash()
-				pair := pairs[hash]
-				pair[i] = &promql.Sample{
-					Metric: sample.Metric,
-					Point:  sample.Point,
-				}
-				pairs[hash] = pair
-			}
+			vectors[i] = vec
 		}
 
-		results := make(promql.Vector, 0, len(pairs))
-		for _, pair := range pairs {
-
-			// merge
-			if merged := mergeBinOp(expr.op, pair[0], pair[1], !expr.opts.ReturnBool, IsComparisonOperator(expr.op)); merged != nil {
-				results = append(results, *merged)
-			}
+		results, err := vectorBinop(expr.op, expr.opts, vectors[0], vectors[1])
+		if err != nil {
+			lastErr = err
+			return false, ts, nil
 		}
-
 		return true, ts, results
 	}, func() (lastError error) {
 		for _, ev := range []StepEvaluator{lhs, rhs} {
@@ -510,6 +576,9 @@ func binOpStepEvaluator(
 		return lastError
 	}, func() error {
 		var errs []error
+		if lastErr != nil {
+			errs = append(errs, lastErr)
+		}
 		for _, ev := range []StepEvaluator{lhs, rhs} {
 			if err := ev.Error(); err != nil {
 				errs = append(errs, err)
@@ -526,6 +595,179 @@ func binOpStepEvaluator(
 	})
 }
 
+// vectorBinop applies a binary operation between two vectors, matching samples using the vector matching of the operation.
+// It returns an error if the cardinality of the matched samples doesn't respect the vector matching, like Prometheus.
+func vectorBinop(op string, opts BinOpOptions, lhs, rhs promql.Vector) (promql.Vector, error) {
+	matching := opts.VectorMatching
+	if matching == nil {
+		matching = &VectorMatching{Card: CardOneToOne}
+	}
+	sigf := signatureFunc(matching.On, matching.MatchingLabels...)
+
+	switch op {
+	case OpTypeAnd, OpTypeOr, OpTypeUnless:
+		return vectorSetBinop(op, sigf, lhs, rhs), nil
+	}
+
+	// all samples of the "one" side must be unique, they are always on the right side.
+	if matching.Card == CardOneToMany {
+		lhs, rhs = rhs, lhs
+	}
+	rightSigs := make(map[uint64]*promql.Sample, len(rhs))
+	for i, rs := range rhs {
+		sig := sigf(rs.Metric)
+		if duplicate, found := rightSigs[sig]; found {
+			side := "right"
+			if matching.Card == CardOneToMany {
+				side = "left"
+			}
+			return nil, fmt.Errorf(
+				"found duplicate series for the match group %s on the %s hand-side of the operation: [%s, %s];"+
+					"many-to-many matching not allowed: matching labels must be unique on one side",
+				matchingLabels(matching, rs.Metric), side, rs.Metric.String(), duplicate.Metric.String(),
+			)
+		}
+		rightSigs[sig] = &rhs[i]
+	}
+
+	var (
+		results = make(promql.Vector, 0, len(lhs))
+		// used to detect many-to-one matches which are not explicit (one-to-one).
+		matchedSigs = map[uint64]struct{}{}
+		// used to detect multiple samples producing the same result (many-to-one and one-to-many).
+		resultSigs = map[uint64]struct{}{}
+	)
+	for i := range lhs {
+		ls := &lhs[i]
+		sig := sigf(ls.Metric)
+		rs := rightSigs[sig]
+
+		left, right := ls, rs
+		if matching.Card == CardOneToMany {
+			left, right = right, left
+		}
+		merged := mergeBinOp(op, left, right, !opts.ReturnBool, IsComparisonOperator(op))
+		if merged == nil {
+			continue
+		}
+		if rs != nil && matching.Card == CardOneToOne {
+			if _, found := matchedSigs[sig]; found {
+				return nil, fmt.Errorf("multiple matches for labels: many-to-one matching must be explicit (group_left/group_right)")
+			}
+			matchedSigs[sig] = struct{}{}
+		}
+
+		var rightMetric labels.Labels
+		if rs != nil {
+			rightMetric = rs.Metric
+		}
+		res := *merged
+		res.Metric = resultMetric(ls.Metric, rightMetric, matching)
+		if matching.Card != CardOneToOne {
+			h := res.Metric.Hash()
+			if _, found := resultSigs[h]; found {
+				return nil, fmt.Errorf("multiple matches for labels: grouping labels must ensure unique matches")
+			}
+			resultSigs[h] = struct{}{}
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// vectorSetBinop applies the and, or and unless set operations.
+func vectorSetBinop(op string, sigf func(labels.Labels) uint64, lhs, rhs promql.Vector) promql.Vector {
+	switch op {
+	case OpTypeAnd:
+		rightSigs := make(map[uint64]struct{}, len(rhs))
+		for _, rs := range rhs {
+			rightSigs[sigf(rs.Metric)] = struct{}{}
+		}
+		results := make(promql.Vector, 0, len(lhs))
+		for _, ls := range lhs {
+			if _, ok := rightSigs[sigf(ls.Metric)]; ok {
+				results = append(results, ls)
+			}
+		}
+		return results
+	case OpTypeOr:
+		leftSigs := make(map[uint64]struct{}, len(lhs))
+		results := make(promql.Vector, 0, len(lhs)+len(rhs))
+		for _, ls := range lhs {
+			leftSigs[sigf(ls.Metric)] = struct{}{}
+			results = append(results, ls)
+		}
+		for _, rs := range rhs {
+			if _, ok := leftSigs[sigf(rs.Metric)]; !ok {
+				results = append(results, rs)
+			}
+		}
+		return results
+	case OpTypeUnless:
+		rightSigs := make(map[uint64]struct{}, len(rhs))
+		for _, rs := range rhs {
+			rightSigs[sigf(rs.Metric)] = struct{}{}
+		}
+		results := make(promql.Vector, 0, len(lhs))
+		for _, ls := range lhs {
+			if _, ok := rightSigs[sigf(ls.Metric)]; !ok {
+				results = append(results, ls)
+			}
+		}
+		return results
+	default:
+		panic(errors.Errorf("should never happen: unexpected set operation: (%s)", op))
+	}
+}
+
+// signatureFunc returns a function computing the hash of the labels used to match samples.
+func signatureFunc(on bool, names ...string) func(labels.Labels) uint64 {
+	if on {
+		return func(lset labels.Labels) uint64 { return lset.WithLabels(names...).Hash() }
+	}
+	return func(lset labels.Labels) uint64 { return lset.WithoutLabels(names...).Hash() }
+}
+
+// matchingLabels returns the labels of a sample used for the vector matching.
+func matchingLabels(matching *VectorMatching, lset labels.Labels) labels.Labels {
+	if matching.On {
+		return lset.WithLabels(matching.MatchingLabels...)
+	}
+	return lset.WithoutLabels(matching.MatchingLabels...)
+}
+
+// resultMetric returns the labels of the result of a binary operation between two samples.
+func resultMetric(lhs, rhs labels.Labels, matching *VectorMatching) labels.Labels {
+	if matching.Card == CardOneToOne && len(matching.MatchingLabels) == 0 && !matching.On && len(matching.Include) == 0 {
+		return lhs
+	}
+	b := labels.NewBuilder(lhs)
+	if matching.Card == CardOneToOne {
+		if matching.On {
+		Outer:
+			for _, l := range lhs {
+				for _, n := range matching.MatchingLabels {
+					if l.Name == n {
+						continue Outer
+					}
+				}
+				b.Del(l.Name)
+			}
+		} else {
+			b.Del(matching.MatchingLabels...)
+		}
+	}
+	for _, ln := range matching.Include {
+		// Included labels from the `group_x` modifier are taken from the "one"-side.
+		if v := rhs.Get(ln); v != "" {
+			b.Set(ln, v)
+		} else {
+			b.Del(ln)
+		}
+	}
+	return b.Labels()
+}
+
 func mergeBinOp(op string, left, right *promql.Sample, filter, isVectorComparison bool) *promql.Sample {
 	var merger func(left, right *promql.Sample) *promql.Sample
 
@@ -4,6 +4,7 @@ import (
 	"math"
 	"testing"
 
+	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/promql"
 	"github.com/stretchr/testify/require"
 )
@@ -248,3 +249,106 @@ func Test_MergeBinOpVectors_Filter(t *testing.T) {
 		Point: promql.Point{V: 2},
 	}, res)
 }
+
+func TestEvaluator_vectorBinop(t *testing.T) {
+	var (
+		errorsByStatus = promql.Vector{
+			{Metric: labels.Labels{{Name: "app", Value: "api"}, {Name: "status", Value: "500"}}, Point: promql.Point{V: 2}},
+			{Metric: labels.Labels{{Name: "app", Value: "api"}, {Name: "status", Value: "503"}}, Point: promql.Point{V: 6}},
+			{Metric: labels.Labels{{Name: "app", Value: "web"}, {Name: "status", Value: "500"}}, Point: promql.Point{V: 1}},
+		}
+		totals = promql.Vector{
+			{Metric: labels.Labels{{Name: "app", Value: "api"}, {Name: "team", Value: "a"}}, Point: promql.Point{V: 10}},
+			{Metric: labels.Labels{{Name: "app", Value: "web"}, {Name: "team", Value: "b"}}, Point: promql.Point{V: 4}},
+		}
+	)
+	for _, tc := range []struct {
+		desc     string
+		op       string
+		matching *VectorMatching
+		lhs, rhs promql.Vector
+		expected promql.Vector
+		err      string
+	}{
+		{
+			"group_left",
+			OpTypeDiv,
+			&VectorMatching{Card: CardManyToOne, On: true, MatchingLabels: []string{"app"}, Include: []string{"team"}},
+			errorsByStatus,
+			totals,
+			promql.Vector{
+				{Metric: labels.Labels{{Name: "app", Value: "api"}, {Name: "status", Value: "500"}, {Name: "team", Value: "a"}}, Point: promql.Point{V: 0.2}},
+				{Metric: labels.Labels{{Name: "app", Value: "api"}, {Name: "status", Value: "503"}, {Name: "team", Value: "a"}}, Point: promql.Point{V: 0.6}},
+				{Metric: labels.Labels{{Name: "app", Value: "web"}, {Name: "status", Value: "500"}, {Name: "team", Value: "b"}}, Point: promql.Point{V: 0.25}},
+			},
+			"",
+		},
+		{
+			"group_right",
+			OpTypeMul,
+			&VectorMatching{Card: CardOneToMany, On: true, MatchingLabels: []string{"app"}},
+			totals,
+			errorsByStatus,
+			promql.Vector{
+				{Metric: labels.Labels{{Name: "app", Value: "api"}, {Name: "status", Value: "500"}}, Point: promql.Point{V: 20}},
+				{Metric: labels.Labels{{Name: "app", Value: "api"}, {Name: "status", Value: "503"}}, Point: promql.Point{V: 60}},
+				{Metric: labels.Labels{{Name: "app", Value: "web"}, {Name: "status", Value: "500"}}, Point: promql.Point{V: 4}},
+			},
+			"",
+		},
+		{
+			"one-to-one on",
+			OpTypeSub,
+			&VectorMatching{Card: CardOneToOne, On: true, MatchingLabels: []string{"app"}},
+			totals,
+			promql.Vector{
+				{Metric: labels.Labels{{Name: "app", Value: "api"}}, Point: promql.Point{V: 4}},
+			},
+			promql.Vector{
+				{Metric: labels.Labels{{Name: "app", Value: "api"}}, Point: promql.Point{V: 6}},
+			},
+			"",
+		},
+		{
+			"ignoring",
+			OpTypeAnd,
+			&VectorMatching{Card: CardManyToMany, MatchingLabels: []string{"team"}},
+			totals,
+			promql.Vector{
+				{Metric: labels.Labels{{Name: "app", Value: "web"}}, Point: promql.Point{V: 1}},
+			},
+			promql.Vector{
+				{Metric: labels.Labels{{Name: "app", Value: "web"}, {Name: "team", Value: "b"}}, Point: promql.Point{V: 4}},
+			},
+			"",
+		},
+		{
+			"implicit many-to-one",
+			OpTypeDiv,
+			&VectorMatching{Card: CardOneToOne, On: true, MatchingLabels: []string{"app"}},
+			errorsByStatus,
+			totals,
+			nil,
+			"multiple matches for labels: many-to-one matching must be explicit (group_left/group_right)",
+		},
+		{
+			"many-to-many",
+			OpTypeDiv,
+			&VectorMatching{Card: CardManyToOne, On: true, MatchingLabels: []string{"app"}},
+			totals,
+			errorsByStatus,
+			nil,
+			`found duplicate series for the match group {app="api"} on the right hand-side of the operation: [{app="api", status="503"}, {app="api", status="500"}];many-to-many matching not allowed: matching labels must be unique on one side`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			res, err := vectorBinop(tc.op, BinOpOptions{VectorMatching: tc.matching}, tc.lhs, tc.rhs)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, res)
+		})
+	}
+}
@@ -28,6 +28,16 @@ import (
   duration                time.Duration
   LiteralExpr             *literalExpr
   BinOpModifier           BinOpOptions
+  BoolModifier            BinOpOptions
+  LabelReplaceExpr        SampleExpr
+  Strings                 []string
+  LabelFilter             LabelFilterer
+  LabelFilterType         LabelFilterType
+  LabelFormat             labelFmt
+  LabelsFormat            []labelFmt
+  bytes                   uint64
+  UnwrapExpr              *unwrapExpr
+  OffsetExpr              *offsetExpr
 }
 
 %start root
@@ -49,12 +59,25 @@ import (
 %type <BinOpExpr>             binOpExpr
 %type <LiteralExpr>           literalExpr
 %type <BinOpModifier>         binOpModifier
+%type <BinOpModifier>         onOrIgnoringModifier
+%type <BoolModifier>          boolModifier
+%type <LabelReplaceExpr>      labelReplaceExpr
+%type <Strings>               strings
+%type <LabelFilter>           labelFilter
+%type <LabelFilterType>       labelFilterOp
+%type <LabelFormat>           labelFormat
+%type <LabelsFormat>          labelsFormat
+%type <UnwrapExpr>            unwrapExpr
+%type <OffsetExpr>            offsetExpr
 
 %token <str>      IDENTIFIER STRING NUMBER
-%token <duration> DURATION
+%token <duration> DURATION DURATION_VALUE
+%token <bytes>    BYTES_VALUE
 %token <val>      MATCHERS LABELS EQ RE NRE OPEN_BRACE CLOSE_BRACE OPEN_BRACKET CLOSE_BRACKET COMMA DOT PIPE_MATCH PIPE_EXACT
                   OPEN_PARENTHESIS CLOSE_PARENTHESIS BY WITHOUT COUNT_OVER_TIME RATE SUM AVG MAX MIN COUNT STDDEV STDVAR BOTTOMK TOPK
-                  BYTES_OVER_TIME BYTES_RATE BOOL
+                  BYTES_OVER_TIME BYTES_RATE BOOL PIPE JSON LOGFMT REGEXP LINE_FMT LABEL_FMT UNWRAP AVG_OVER_TIME SUM_OVER_TIME
+                  MIN_OVER_TIME MAX_OVER_TIME STDVAR_OVER_TIME STDDEV_OVER_TIME QUANTILE_OVER_TIME FIRST_OVER_TIME LAST_OVER_TIME ABSENT_OVER_TIME
+                  ON IGNORING GROUP_LEFT GROUP_RIGHT LABEL_REPLACE LABEL_JOIN OFFSET UNPACK
 
 // Operators are listed with increasing precedence.
 %left <binOp> OR
@@ -78,26 +101,63 @@ metricExpr:
     | vectorAggregationExpr                         { $$ = $1 }
     | binOpExpr                                     { $$ = $1 }
     | literalExpr                                   { $$ = $1 }
+    | labelReplaceExpr                              { $$ = $1 }
     | OPEN_PARENTHESIS metricExpr CLOSE_PARENTHESIS { $$ = $2 }
     ;
 
 logExpr:
       selector                                    { $$ = newMatcherExpr($1)}
     | logExpr filter STRING                       { $$ = NewFilterExpr( $1, $2, $3 ) }
+    | logExpr PIPE JSON                           { $$ = mustNewParserExpr( $1, OpParserTypeJSON, "" ) }
+    | logExpr PIPE LOGFMT                         { $$ = mustNewParserExpr( $1, OpParserTypeLogfmt, "" ) }
+    | logExpr PIPE REGEXP STRING                  { $$ = mustNewParserExpr( $1, OpParserTypeRegexp, $4 ) }
+    | logExpr PIPE UNPACK                         { $$ = mustNewParserExpr( $1, OpParserTypeUnpack, "" ) }
+    | logExpr PIPE labelFilter                    { $$ = newLabelFilterExpr( $1, $3 ) }
+    | logExpr PIPE LINE_FMT STRING                { $$ = mustNewLineFmtExpr( $1, $4 ) }
+    | logExpr PIPE LABEL_FMT labelsFormat         { $$ = mustNewLabelFmtExpr( $1, $4 ) }
     | OPEN_PARENTHESIS logExpr CLOSE_PARENTHESIS  { $$ = $2 }
     | logExpr filter error
     | logExpr error
     ;
 
 logRangeExpr:
-      logExpr DURATION { $$ = newLogRange($1, $2) } // <selector> <filters> <range>
+      logExpr DURATION                                 { $$ = newLogRange($1, $2, nil, nil) } // <selector> <filters> <range>
+    | logExpr DURATION offsetExpr                      { $$ = newLogRange($1, $2, nil, $3) } // <selector> <filters> <range> <offset>
+    | logExpr unwrapExpr DURATION                      { $$ = newLogRange($1, $3, $2, nil) } // <selector> <filters> <unwrap> <range>
+    | logExpr unwrapExpr DURATION offsetExpr           { $$ = newLogRange($1, $3, $2, $4) } // <selector> <filters> <unwrap> <range> <offset>
     | logRangeExpr filter STRING                       { $$ = addFilterToLogRangeExpr( $1, $2, $3 ) }
     | OPEN_PARENTHESIS logRangeExpr CLOSE_PARENTHESIS  { $$ = $2 }
     | logRangeExpr filter error
     | logRangeExpr error
     ;
 
-rangeAggregationExpr: rangeOp OPEN_PARENTHESIS logRangeExpr CLOSE_PARENTHESIS { $$ = newRangeAggregationExpr($3,$1) };
+unwrapExpr:
+      PIPE UNWRAP IDENTIFIER                           { $$ = newUnwrapExpr($3) }
+    | unwrapExpr PIPE labelFilter                      { $$ = $1.addPostFilter($3) }
+    ;
+
+offsetExpr:
+      OFFSET DURATION_VALUE                            { $$ = newOffsetExpr($2) }
+    ;
+
+rangeAggregationExpr:
+      rangeOp OPEN_PARENTHESIS logRangeExpr CLOSE_PARENTHESIS                    { $$ = mustNewRangeAggregationExpr($3, $1, nil) }
+    | rangeOp OPEN_PARENTHESIS NUMBER COMMA logRangeExpr CLOSE_PARENTHESIS       { $$ = mustNewRangeAggregationExpr($5, $1, &$3) }
+    ;
+
+labelReplaceExpr:
+      LABEL_REPLACE OPEN_PARENTHESIS metricExpr COMMA STRING COMMA STRING COMMA STRING COMMA STRING CLOSE_PARENTHESIS
+        { $$ = mustNewLabelReplaceExpr($3, $5, $7, $9, $11) }
+    | LABEL_JOIN OPEN_PARENTHESIS metricExpr COMMA STRING COMMA STRING CLOSE_PARENTHESIS
+        { $$ = mustNewLabelJoinExpr($3, $5, $7, nil) }
+    | LABEL_JOIN OPEN_PARENTHESIS metricExpr COMMA STRING COMMA STRING COMMA strings CLOSE_PARENTHESIS
+        { $$ = mustNewLabelJoinExpr($3, $5, $7, $9) }
+    ;
+
+strings:
+      STRING                 { $$ = []string{ $1 } }
+    | strings COMMA STRING   { $$ = append($1, $3) }
+    ;
 
 vectorAggregationExpr:
     // Aggregations with 1 argument.
@@ -116,6 +176,36 @@ filter:
     | NEQ                              { $$ = labels.MatchNotEqual }
     ;
 
+labelFilter:
+      matcher                                          { $$ = newStringLabelFilter($1) }
+    | IDENTIFIER labelFilterOp NUMBER                  { $$ = mustNewNumericLabelFilter($2, $1, $3) }
+    | IDENTIFIER labelFilterOp DURATION_VALUE          { $$ = newDurationLabelFilter($2, $1, $3) }
+    | IDENTIFIER labelFilterOp BYTES_VALUE             { $$ = newBytesLabelFilter($2, $1, $3) }
+    | OPEN_PARENTHESIS labelFilter CLOSE_PARENTHESIS   { $$ = $2 }
+    | labelFilter AND labelFilter                      { $$ = newAndLabelFilter($1, $3) }
+    | labelFilter OR labelFilter                       { $$ = newOrLabelFilter($1, $3) }
+    ;
+
+labelFormat:
+      IDENTIFIER EQ IDENTIFIER                         { $$ = newRenameLabelFmt($1, $3) }
+    | IDENTIFIER EQ STRING                             { $$ = newTemplateLabelFmt($1, $3) }
+    ;
+
+labelsFormat:
+      labelFormat                                      { $$ = []labelFmt{ $1 } }
+    | labelsFormat COMMA labelFormat                   { $$ = append($1, $3) }
+    ;
+
+labelFilterOp:
+      GT     { $$ = LabelFilterGreaterThan }
+    | GTE    { $$ = LabelFilterGreaterThanOrEqual }
+    | LT     { $$ = LabelFilterLesserThan }
+    | LTE    { $$ = LabelFilterLesserThanOrEqual }
+    | NEQ    { $$ = LabelFilterNotEqual }
+    | EQ     { $$ = LabelFilterEqual }
+    | CMP_EQ { $$ = LabelFilterEqual }
+    ;
+
 selector:
       OPEN_BRACE matchers CLOSE_BRACE  { $$ = $2 }
     | OPEN_BRACE matchers error        { $$ = $2 }
@@ -134,7 +224,6 @@ matcher:
     | IDENTIFIER NRE STRING            { $$ = mustNewMatcher(labels.MatchNotRegexp, $1, $3) }
     ;
 
-// TODO(owen-d): add (on,ignoring) clauses to binOpExpr
 // Operator precedence only works if each of these is listed separately.
 binOpExpr:
          expr OR binOpModifier expr          { $$ = mustNewBinOpExpr("or", $3, $1, $4) }
@@ -154,11 +243,29 @@ binOpExpr:
          | expr LTE binOpModifier expr       { $$ = mustNewBinOpExpr("<=", $3, $1, $4) }
          ;
 
-binOpModifier:
+boolModifier:
            { $$ = BinOpOptions{} }
            | BOOL { $$ = BinOpOptions{ ReturnBool: true } }
            ;
 
+onOrIgnoringModifier:
+           boolModifier ON OPEN_PARENTHESIS labels CLOSE_PARENTHESIS        { $$ = $1; $$.VectorMatching = &VectorMatching{ On: true, MatchingLabels: $4 } }
+           | boolModifier ON OPEN_PARENTHESIS CLOSE_PARENTHESIS             { $$ = $1; $$.VectorMatching = &VectorMatching{ On: true } }
+           | boolModifier IGNORING OPEN_PARENTHESIS labels CLOSE_PARENTHESIS  { $$ = $1; $$.VectorMatching = &VectorMatching{ MatchingLabels: $4 } }
+           | boolModifier IGNORING OPEN_PARENTHESIS CLOSE_PARENTHESIS       { $$ = $1; $$.VectorMatching = &VectorMatching{} }
+           ;
+
+binOpModifier:
+           boolModifier                                                             { $$ = $1 }
+           | onOrIgnoringModifier                                                   { $$ = $1 }
+           | onOrIgnoringModifier GROUP_LEFT                                        { $$ = $1; $$.VectorMatching.Card = CardManyToOne }
+           | onOrIgnoringModifier GROUP_LEFT OPEN_PARENTHESIS CLOSE_PARENTHESIS     { $$ = $1; $$.VectorMatching.Card = CardManyToOne }
+           | onOrIgnoringModifier GROUP_LEFT OPEN_PARENTHESIS labels CLOSE_PARENTHESIS   { $$ = $1; $$.VectorMatching.Card = CardManyToOne; $$.VectorMatching.Include = $4 }
+           | onOrIgnoringModifier GROUP_RIGHT                                       { $$ = $1; $$.VectorMatching.Card = CardOneToMany }
+           | onOrIgnoringModifier GROUP_RIGHT OPEN_PARENTHESIS CLOSE_PARENTHESIS    { $$ = $1; $$.VectorMatching.Card = CardOneToMany }
+           | onOrIgnoringModifier GROUP_RIGHT OPEN_PARENTHESIS labels CLOSE_PARENTHESIS  { $$ = $1; $$.VectorMatching.Card = CardOneToMany; $$.VectorMatching.Include = $4 }
+           ;
+
 literalExpr:
            NUMBER         { $$ = mustNewLiteralExpr( $1, false ) }
            | ADD NUMBER   { $$ = mustNewLiteralExpr( $2, false ) }
@@ -178,10 +285,20 @@ vectorOp:
       ;
 
 rangeOp:
-      COUNT_OVER_TIME { $$ = OpRangeTypeCount }
-    | RATE            { $$ = OpRangeTypeRate }
-    | BYTES_OVER_TIME { $$ = OpRangeTypeBytes }
-    | BYTES_RATE      { $$ = OpRangeTypeBytesRate }
+      COUNT_OVER_TIME    { $$ = OpRangeTypeCount }
+    | RATE               { $$ = OpRangeTypeRate }
+    | BYTES_OVER_TIME    { $$ = OpRangeTypeBytes }
+    | BYTES_RATE         { $$ = OpRangeTypeBytesRate }
+    | AVG_OVER_TIME      { $$ = OpRangeTypeAvg }
+    | SUM_OVER_TIME      { $$ = OpRangeTypeSum }
+    | MIN_OVER_TIME      { $$ = OpRangeTypeMin }
+    | MAX_OVER_TIME      { $$ = OpRangeTypeMax }
+    | STDVAR_OVER_TIME   { $$ = OpRangeTypeStdvar }
+    | STDDEV_OVER_TIME   { $$ = OpRangeTypeStddev }
+    | QUANTILE_OVER_TIME { $$ = OpRangeTypeQuantile }
+    | FIRST_OVER_TIME    { $$ = OpRangeTypeFirst }
+    | LAST_OVER_TIME     { $$ = OpRangeTypeLast }
+    | ABSENT_OVER_TIME   { $$ = OpRangeTypeAbsent }
     ;
 
 
@@ -32,58 +32,95 @@ type exprSymType struct {
 	duration              time.Duration
 	LiteralExpr           *literalExpr
 	BinOpModifier         BinOpOptions
+	BoolModifier          BinOpOptions
+	LabelReplaceExpr      SampleExpr
+	Strings               []string
+	LabelFilter           LabelFilterer
+	LabelFilterType       LabelFilterType
+	LabelFormat           labelFmt
+	LabelsFormat          []labelFmt
+	bytes                 uint64
+	UnwrapExpr            *unwrapExpr
+	OffsetExpr            *offsetExpr
 }
 
 const IDENTIFIER = 57346
 const STRING = 57347
 const NUMBER = 57348
 const DURATION = 57349
-const MATCHERS = 57350
-const LABELS = 57351
-const EQ = 57352
-const RE = 57353
-const NRE = 57354
-const OPEN_BRACE = 57355
-const CLOSE_BRACE = 57356
-const OPEN_BRACKET = 57357
-const CLOSE_BRACKET = 57358
-const COMMA = 57359
-const DOT = 57360
-const PIPE_MATCH = 57361
-const PIPE_EXACT = 57362
-const OPEN_PARENTHESIS = 57363
-const CLOSE_PARENTHESIS = 57364
-const BY = 57365
-const WITHOUT = 57366
-const COUNT_OVER_TIME = 57367
-const RATE = 57368
-const SUM = 57369
-const AVG = 57370
-const MAX = 57371
-const MIN = 57372
-const COUNT = 57373
-const STDDEV = 57374
-const STDVAR = 57375
-const BOTTOMK = 57376
-const TOPK = 57377
-const BYTES_OVER_TIME = 57378
-const BYTES_RATE = 57379
-const BOOL = 57380
-const OR = 57381
-const AND = 57382
-const UNLESS = 57383
-const CMP_EQ = 57384
-const NEQ = 57385
-const LT = 57386
-const LTE = 57387
-const GT = 57388
-const GTE = 57389
-const ADD = 57390
-const SUB = 57391
-const MUL = 57392
-const DIV = 57393
-const MOD = 57394
-const POW = 57395
+const DURATION_VALUE = 57350
+const BYTES_VALUE = 57351
+const MATCHERS = 57352
+const LABELS = 57353
+const EQ = 57354
+const RE = 57355
+const NRE = 57356
+const OPEN_BRACE = 57357
+const CLOSE_BRACE = 57358
+const OPEN_BRACKET = 57359
+const CLOSE_BRACKET = 57360
+const COMMA = 57361
+const DOT = 57362
+const PIPE_MATCH = 57363
+const PIPE_EXACT = 57364
+const OPEN_PARENTHESIS = 57365
+const CLOSE_PARENTHESIS = 57366
+const BY = 57367
+const WITHOUT = 57368
+const COUNT_OVER_TIME = 57369
+const RATE = 57370
+const SUM = 57371
+const AVG = 57372
+const MAX = 57373
+const MIN = 57374
+const COUNT = 57375
+const STDDEV = 57376
+const STDVAR = 57377
+const BOTTOMK = 57378
+const TOPK = 57379
+const BYTES_OVER_TIME = 57380
+const BYTES_RATE = 57381
+const BOOL = 57382
+const PIPE = 57383
+const JSON = 57384
+const LOGFMT = 57385
+const REGEXP = 57386
+const LINE_FMT = 57387
+const LABEL_FMT = 57388
+const UNWRAP = 57389
+const AVG_OVER_TIME = 57390
+const SUM_OVER_TIME = 57391
+const MIN_OVER_TIME = 57392
+const MAX_OVER_TIME = 57393
+const STDVAR_OVER_TIME = 57394
+const STDDEV_OVER_TIME = 57395
+const QUANTILE_OVER_TIME = 57396
+const FIRST_OVER_TIME = 57397
+const LAST_OVER_TIME = 57398
+const ABSENT_OVER_TIME = 57399
+const ON = 57400
+const IGNORING = 57401
+const GROUP_LEFT = 57402
+const GROUP_RIGHT = 57403
+const LABEL_REPLACE = 57404
+const LABEL_JOIN = 57405
+const OFFSET = 57406
+const UNPACK = 57407
+const OR = 57408
+const AND = 57409
+const UNLESS = 57410
+const CMP_EQ = 57411
+const NEQ = 57412
+const LT = 57413
+const LTE = 57414
+const GT = 57415
+const GTE = 57416
+const ADD = 57417
+const SUB = 57418
+const MUL = 57419
+const DIV = 57420
+const MOD = 57421
+const POW = 57422
 
 var exprToknames = [...]string{
 	"$end",
@@ -93,6 +130,8 @@ var exprToknames = [...]string{
 	"STRING",
 	"NUMBER",
 	"DURATION",
+	"DURATION_VALUE",
+	"BYTES_VALUE",
 	"MATCHERS",
 	"LABELS",
 	"EQ",
@@ -124,6 +163,31 @@ var exprToknames = [...]string{
 	"BYTES_OVER_TIME",
 	"BYTES_RATE",
 	"BOOL",
+	"PIPE",
+	"JSON",
+	"LOGFMT",
+	"REGEXP",
+	"LINE_FMT",
+	"LABEL_FMT",
+	"UNWRAP",
+	"AVG_OVER_TIME",
+	"SUM_OVER_TIME",
+	"MIN_OVER_TIME",
+	"MAX_OVER_TIME",
+	"STDVAR_OVER_TIME",
+	"STDDEV_OVER_TIME",
+	"QUANTILE_OVER_TIME",
+	"FIRST_OVER_TIME",
+	"LAST_OVER_TIME",
+	"ABSENT_OVER_TIME",
+	"ON",
+	"IGNORING",
+	"GROUP_LEFT",
+	"GROUP_RIGHT",
+	"LABEL_REPLACE",
+	"LABEL_JOIN",
+	"OFFSET",
+	"UNPACK",
 	"OR",
 	"AND",
 	"UNLESS",
@@ -140,6 +204,7 @@ var exprToknames = [...]string{
 	"MOD",
 	"POW",
 }
+
 var exprStatenames = [...]string{}
 
 const exprEofCode = 1
@@ -147,176 +212,236 @@ const exprErrCode = 2
 const exprInitialStackSize = 16
 
 
-var exprExca = [...]int{
+var exprExca = [...]int8{
 	-1, 1,
 	1, -1,
 	-2, 0,
 	-1, 3,
 	1, 2,
-	22, 2,
-	39, 2,
-	40, 2,
-	41, 2,
-	42, 2,
-	44, 2,
-	45, 2,
-	46, 2,
-	47, 2,
-	48, 2,
-	49, 2,
-	50, 2,
-	51, 2,
-	52, 2,
-	53, 2,
+	19, 2,
+	24, 2,
+	66, 2,
+	67, 2,
+	68, 2,
+	69, 2,
+	71, 2,
+	72, 2,
+	73, 2,
+	74, 2,
+	75, 2,
+	76, 2,
+	77, 2,
+	78, 2,
+	79, 2,
+	80, 2,
 	-2, 0,
-	-1, 52,
-	39, 2,
-	40, 2,
-	41, 2,
-	42, 2,
-	44, 2,
-	45, 2,
-	46, 2,
-	47, 2,
-	48, 2,
-	49, 2,
-	50, 2,
-	51, 2,
-	52, 2,
-	53, 2,
+	-1, 66,
+	66, 2,
+	67, 2,
+	68, 2,
+	69, 2,
+	71, 2,
+	72, 2,
+	73, 2,
+	74, 2,
+	75, 2,
+	76, 2,
+	77, 2,
+	78, 2,
+	79, 2,
+	80, 2,
 	-2, 0,
 }
 
 const exprPrivate = 57344
 
-const exprLast = 279
-
-var exprAct = [...]int{
-
-	60, 4, 45, 130, 56, 3, 93, 38, 51, 53,
-	2, 66, 52, 30, 31, 32, 39, 40, 43, 44,
-	41, 42, 33, 34, 35, 36, 37, 38, 14, 33,
-	34, 35, 36, 37, 38, 11, 35, 36, 37, 38,
-	89, 91, 92, 6, 61, 62, 142, 17, 18, 21,
-	22, 24, 25, 23, 26, 27, 28, 29, 19, 20,
-	59, 96, 61, 62, 94, 138, 127, 139, 11, 139,
-	15, 16, 141, 90, 140, 101, 95, 102, 103, 104,
-	105, 106, 107, 108, 109, 110, 111, 112, 113, 114,
-	115, 83, 116, 100, 99, 98, 121, 58, 128, 88,
-	129, 125, 126, 64, 132, 31, 32, 39, 40, 43,
-	44, 41, 42, 33, 34, 35, 36, 37, 38, 134,
-	63, 120, 133, 86, 46, 97, 10, 143, 136, 121,
-	137, 119, 11, 82, 49, 85, 81, 118, 87, 117,
-	6, 47, 48, 144, 17, 18, 21, 22, 24, 25,
-	23, 26, 27, 28, 29, 19, 20, 65, 55, 131,
-	57, 57, 9, 13, 8, 50, 5, 15, 16, 39,
-	40, 43, 44, 41, 42, 33, 34, 35, 36, 37,
-	38, 12, 7, 54, 1, 0, 0, 0, 0, 67,
-	68, 69, 70, 71, 72, 73, 74, 75, 76, 77,
-	78, 79, 80, 46, 0, 0, 0, 122, 124, 0,
-	0, 0, 122, 49, 0, 0, 0, 49, 0, 0,
-	47, 48, 49, 84, 47, 48, 0, 135, 46, 47,
-	48, 0, 123, 124, 0, 0, 0, 46, 49, 0,
-	0, 0, 0, 0, 50, 47, 48, 49, 50, 0,
-	0, 0, 0, 50, 47, 48, 0, 84, 0, 0,
-	0, 0, 0, 0, 0, 0, 0, 0, 0, 50,
-	0, 0, 0, 0, 0, 0, 0, 0, 50,
+const exprLast = 388
+
+var exprAct = [...]int16{
+	74, 105, 58, 205, 184, 156, 108, 4, 121, 67,
+	2, 3, 51, 15, 65, 159, 119, 120, 66, 70,
+	153, 152, 12, 46, 47, 48, 49, 50, 51, 152,
+	6, 117, 119, 120, 20, 21, 34, 35, 37, 38,
+	36, 39, 40, 41, 42, 22, 23, 48, 49, 50,
+	51, 200, 206, 135, 136, 24, 25, 26, 27, 28,
+	29, 30, 31, 32, 33, 84, 133, 134, 256, 18,
+	19, 234, 165, 160, 163, 164, 161, 162, 212, 207,
+	181, 125, 16, 17, 123, 75, 76, 130, 131, 118,
+	185, 132, 111, 153, 152, 137, 138, 139, 140, 141,
+	142, 143, 144, 145, 146, 147, 148, 149, 150, 185,
+	224, 185, 166, 208, 73, 253, 75, 76, 247, 251,
+	252, 213, 167, 246, 172, 213, 241, 213, 245, 222,
+	240, 221, 239, 180, 186, 183, 179, 43, 44, 45,
+	52, 53, 56, 57, 54, 55, 46, 47, 48, 49,
+	50, 51, 192, 191, 193, 194, 44, 45, 52, 53,
+	56, 57, 54, 55, 46, 47, 48, 49, 50, 51,
+	52, 53, 56, 57, 54, 55, 46, 47, 48, 49,
+	50, 51, 210, 172, 203, 190, 213, 123, 185, 189,
+	211, 238, 12, 60, 218, 220, 223, 225, 126, 213,
+	124, 226, 129, 116, 215, 63, 172, 12, 219, 213,
+	233, 232, 61, 62, 214, 6, 128, 109, 127, 20,
+	21, 34, 35, 37, 38, 36, 39, 40, 41, 42,
+	22, 23, 59, 80, 79, 242, 110, 72, 237, 236,
+	24, 25, 26, 27, 28, 29, 30, 31, 32, 33,
+	195, 60, 188, 187, 18, 19, 177, 60, 182, 175,
+	60, 64, 177, 63, 196, 231, 173, 16, 17, 63,
+	61, 62, 63, 112, 78, 173, 61, 62, 63, 61,
+	62, 173, 112, 77, 235, 61, 62, 63, 229, 255,
+	176, 109, 114, 63, 61, 62, 176, 209, 109, 59,
+	61, 62, 254, 174, 122, 197, 113, 198, 199, 115,
+	110, 227, 228, 12, 250, 81, 248, 110, 244, 64,
+	202, 124, 243, 201, 100, 64, 217, 99, 64, 101,
+	102, 103, 106, 107, 64, 216, 101, 102, 103, 106,
+	107, 204, 169, 64, 168, 171, 170, 154, 151, 64,
+	230, 69, 104, 71, 157, 185, 71, 178, 155, 104,
+	85, 86, 87, 88, 89, 90, 91, 92, 93, 94,
+	95, 96, 97, 98, 158, 249, 11, 82, 83, 10,
+	9, 14, 8, 5, 13, 7, 68, 1,
 }
-var exprPact = [...]int{
 
-	22, -1000, -26, 122, -1000, -1000, 22, -1000, -1000, -1000,
-	-1000, 156, 76, 39, -1000, 114, 97, -1000, -1000, -1000,
+var exprPact = [...]int16{
+	7, -1000, 71, 191, -1000, -1000, 7, -1000, -1000, -1000,
+	-1000, -1000, 349, 214, 91, -1000, 277, 268, 211, 210,
+	-1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
 	-1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
-	-27, -27, -27, -27, -27, -27, -27, -27, -27, -27,
-	-27, -27, -27, -27, -27, 131, -1000, -1000, -1000, -1000,
-	-1000, 69, 235, -26, 121, 85, -1000, 30, 55, 119,
-	74, 73, 72, -1000, -1000, 22, -1000, 22, 22, 22,
-	22, 22, 22, 22, 22, 22, 22, 22, 22, 22,
-	22, -1000, -1000, -1000, -1000, -1000, -1000, 157, -1000, 134,
-	132, 126, 116, 210, 226, 55, 44, 81, 22, 155,
-	155, 65, 127, 127, -14, -14, -46, -46, -46, -46,
-	-19, -19, -19, -19, -19, -19, -1000, -1000, -1000, -1000,
-	-1000, 117, -1000, -1000, -1000, 201, 205, 21, 22, 43,
-	52, -1000, 50, -1000, -1000, -1000, -1000, 24, -1000, 123,
-	-1000, -1000, 21, -1000, -1000,
+	-1000, -1000, -1000, 25, 25, 25, 25, 25, 25, 25,
+	25, 25, 25, 25, 25, 25, 25, 25, 322, 287,
+	-1000, -1000, -1000, -1000, -1000, 68, 258, 71, 290, 187,
+	-1000, 19, 298, 192, 195, 193, 179, -1000, -1000, 7,
+	7, 7, 8, -7, -1000, 7, 7, 7, 7, 7,
+	7, 7, 7, 7, 7, 7, 7, 7, 7, -1000,
+	-1000, -1000, -1000, 343, -1000, -46, 342, 350, -1000, 3,
+	213, -1000, -1000, -1000, -1000, 352, -1000, 339, 337, 341,
+	340, 279, 240, 255, 177, 56, 239, 7, 351, 351,
+	234, 233, 89, 166, 162, 130, 129, 101, 101, -30,
+	-30, -68, -68, -68, -68, -52, -52, -52, -52, -52,
+	-52, -1000, 213, 213, -1000, 231, -1000, 252, 299, 339,
+	337, -1000, -1000, -1000, -1000, -1000, 27, -1000, -1000, -1000,
+	-1000, -1000, 318, -1000, -1000, 177, 294, -12, 72, 249,
+	273, 60, 7, 54, 190, -1000, 180, 330, 321, 184,
+	107, 105, 86, -1000, -38, 350, 307, -1000, -1000, -1000,
+	-1000, -1000, -1000, 264, 346, -1000, 257, -12, 213, -1000,
+	-1000, 47, -1000, 280, -1000, -1000, 220, 219, 167, -1000,
+	108, -1000, -1000, 106, -1000, 102, -1000, -1000, -1000, -1000,
+	-1000, -1000, -1000, -46, 60, -1000, 317, 313, -1000, -1000,
+	-1000, -1000, -1000, 109, 99, 311, -1000, 309, 100, 96,
+	-1000, 297, -1000, 284, 44, -1000, -1000,
 }
-var exprPgo = [...]int{
 
-	0, 184, 9, 2, 0, 3, 5, 1, 6, 4,
-	183, 182, 181, 166, 164, 163, 162, 126, 157,
+var exprPgo = [...]int16{
+	0, 387, 9, 2, 0, 4, 11, 7, 8, 6,
+	386, 385, 384, 383, 382, 381, 380, 379, 315, 378,
+	377, 376, 375, 1, 374, 5, 358, 357, 3,
 }
-var exprR1 = [...]int{
 
-	0, 1, 2, 2, 7, 7, 7, 7, 7, 6,
-	6, 6, 6, 6, 8, 8, 8, 8, 8, 11,
-	14, 14, 14, 14, 14, 3, 3, 3, 3, 13,
-	13, 13, 10, 10, 9, 9, 9, 9, 16, 16,
+var exprR1 = [...]int8{
+	0, 1, 2, 2, 7, 7, 7, 7, 7, 7,
+	6, 6, 6, 6, 6, 6, 6, 6, 6, 6,
+	6, 6, 8, 8, 8, 8, 8, 8, 8, 8,
+	27, 27, 28, 11, 11, 21, 21, 21, 22, 22,
+	14, 14, 14, 14, 14, 3, 3, 3, 3, 23,
+	23, 23, 23, 23, 23, 23, 25, 25, 26, 26,
+	24, 24, 24, 24, 24, 24, 24, 13, 13, 13,
+	10, 10, 9, 9, 9, 9, 16, 16, 16, 16,
 	16, 16, 16, 16, 16, 16, 16, 16, 16, 16,
-	16, 16, 16, 18, 18, 17, 17, 17, 15, 15,
+	16, 20, 20, 19, 19, 19, 19, 18, 18, 18,
+	18, 18, 18, 18, 18, 17, 17, 17, 15, 15,
 	15, 15, 15, 15, 15, 15, 15, 12, 12, 12,
+	12, 12, 12, 12, 12, 12, 12, 12, 12, 12,
 	12, 5, 5, 4, 4,
 }
-var exprR2 = [...]int{
 
-	0, 1, 1, 1, 1, 1, 1, 1, 3, 1,
-	3, 3, 3, 2, 2, 3, 3, 3, 2, 4,
-	4, 5, 5, 6, 7, 1, 1, 1, 1, 3,
-	3, 3, 1, 3, 3, 3, 3, 3, 4, 4,
+var exprR2 = [...]int8{
+	0, 1, 1, 1, 1, 1, 1, 1, 1, 3,
+	1, 3, 3, 3, 4, 3, 3, 4, 4, 3,
+	3, 2, 2, 3, 3, 4, 3, 3, 3, 2,
+	3, 3, 2, 4, 6, 12, 8, 10, 1, 3,
+	4, 5, 5, 6, 7, 1, 1, 1, 1, 1,
+	3, 3, 3, 3, 3, 3, 3, 3, 1, 3,
+	1, 1, 1, 1, 1, 1, 1, 3, 3, 3,
+	1, 3, 3, 3, 3, 3, 4, 4, 4, 4,
 	4, 4, 4, 4, 4, 4, 4, 4, 4, 4,
-	4, 4, 4, 0, 1, 1, 2, 2, 1, 1,
+	4, 0, 1, 5, 4, 5, 4, 1, 1, 2,
+	4, 5, 2, 4, 5, 1, 2, 2, 1, 1,
+	1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
 	1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
 	1, 1, 3, 4, 4,
 }
-var exprChk = [...]int{
-
-	-1000, -1, -2, -6, -7, -13, 21, -11, -14, -16,
-	-17, 13, -12, -15, 6, 48, 49, 25, 26, 36,
-	37, 27, 28, 31, 29, 30, 32, 33, 34, 35,
-	39, 40, 41, 48, 49, 50, 51, 52, 53, 42,
-	43, 46, 47, 44, 45, -3, 2, 19, 20, 12,
-	43, -7, -6, -2, -10, 2, -9, 4, 21, 21,
-	-4, 23, 24, 6, 6, -18, 38, -18, -18, -18,
-	-18, -18, -18, -18, -18, -18, -18, -18, -18, -18,
-	-18, 5, 2, 22, 22, 14, 2, 17, 14, 10,
-	43, 11, 12, -8, -6, 21, -7, 6, 21, 21,
-	21, -2, -2, -2, -2, -2, -2, -2, -2, -2,
-	-2, -2, -2, -2, -2, -2, -9, 5, 5, 5,
-	5, -3, 2, 22, 7, -6, -8, 22, 17, -7,
-	-5, 4, -5, 5, 2, 22, -4, -7, 22, 17,
-	22, 22, 22, 4, -4,
+
+var exprChk = [...]int16{
+	-1000, -1, -2, -6, -7, -13, 23, -11, -14, -16,
+	-17, -21, 15, -12, -15, 6, 75, 76, 62, 63,
+	27, 28, 38, 39, 48, 49, 50, 51, 52, 53,
+	54, 55, 56, 57, 29, 30, 33, 31, 32, 34,
+	35, 36, 37, 66, 67, 68, 75, 76, 77, 78,
+	79, 80, 69, 70, 73, 74, 71, 72, -3, 41,
+	2, 21, 22, 14, 70, -7, -6, -2, -10, 2,
+	-9, 4, 23, 23, -4, 25, 26, 6, 6, 23,
+	23, -18, -20, -19, 40, -18, -18, -18, -18, -18,
+	-18, -18, -18, -18, -18, -18, -18, -18, -18, 5,
+	2, 42, 43, 44, 65, -23, 45, 46, -9, 4,
+	23, 24, 24, 16, 2, 19, 16, 12, 70, 13,
+	14, -8, 6, -6, 23, -7, 6, 23, 23, 23,
+	-7, -7, -2, 58, 59, 60, 61, -2, -2, -2,
+	-2, -2, -2, -2, -2, -2, -2, -2, -2, -2,
+	-2, 5, 67, 66, 5, -26, -25, 4, -24, 12,
+	70, 73, 74, 71, 72, 69, -23, -9, 5, 5,
+	5, 5, -3, 2, 24, 19, 41, 7, -27, -6,
+	-8, 24, 19, -7, -5, 4, -5, 19, 19, 23,
+	23, 23, 23, -23, -23, 19, 12, 6, 8, 9,
+	24, 5, 2, -8, 47, -28, 64, 7, 41, 24,
+	-4, -7, 24, 19, 24, 24, 5, 5, -5, 24,
+	-5, 24, 24, -5, 24, -5, -25, 4, 5, 24,
+	4, 8, -28, -23, 24, 4, 19, 19, 24, 24,
+	24, 24, -4, 5, 5, 19, 24, 19, 5, -22,
+	5, 19, 24, 19, 5, 5, 24,
 }
-var exprDef = [...]int{
-
-	0, -2, 1, -2, 3, 9, 0, 4, 5, 6,
-	7, 0, 0, 0, 55, 0, 0, 67, 68, 69,
-	70, 58, 59, 60, 61, 62, 63, 64, 65, 66,
-	53, 53, 53, 53, 53, 53, 53, 53, 53, 53,
-	53, 53, 53, 53, 53, 0, 13, 25, 26, 27,
-	28, 3, -2, 0, 0, 0, 32, 0, 0, 0,
-	0, 0, 0, 56, 57, 0, 54, 0, 0, 0,
-	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 10, 12, 8, 11, 29, 30, 0, 31, 0,
-	0, 0, 0, 0, 0, 0, 3, 55, 0, 0,
-	0, 38, 39, 40, 41, 42, 43, 44, 45, 46,
-	47, 48, 49, 50, 51, 52, 33, 34, 35, 36,
-	37, 0, 18, 19, 14, 0, 0, 20, 0, 3,
-	0, 71, 0, 15, 17, 16, 22, 3, 21, 0,
-	73, 74, 23, 72, 24,
+
+var exprDef = [...]int16{
+	0, -2, 1, -2, 3, 10, 0, 4, 5, 6,
+	7, 8, 0, 0, 0, 105, 0, 0, 0, 0,
+	117, 118, 119, 120, 121, 122, 123, 124, 125, 126,
+	127, 128, 129, 130, 108, 109, 110, 111, 112, 113,
+	114, 115, 116, 91, 91, 91, 91, 91, 91, 91,
+	91, 91, 91, 91, 91, 91, 91, 91, 0, 0,
+	21, 45, 46, 47, 48, 3, -2, 0, 0, 0,
+	70, 0, 0, 0, 0, 0, 0, 106, 107, 0,
+	0, 0, 97, 98, 92, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 11,
+	20, 12, 13, 0, 15, 16, 0, 0, 49, 0,
+	0, 9, 19, 67, 68, 0, 69, 0, 0, 0,
+	0, 0, 0, 0, 0, 3, 105, 0, 0, 0,
+	3, 3, 76, 0, 0, 99, 102, 77, 78, 79,
+	80, 81, 82, 83, 84, 85, 86, 87, 88, 89,
+	90, 14, 0, 0, 17, 18, 58, 0, 0, 65,
+	64, 60, 61, 62, 63, 66, 0, 71, 72, 73,
+	74, 75, 0, 29, 33, 0, 0, 22, 0, 0,
+	0, 40, 0, 3, 0, 131, 0, 0, 0, 0,
+	0, 0, 0, 54, 55, 0, 0, 50, 51, 52,
+	53, 26, 28, 0, 0, 23, 0, 24, 0, 27,
+	42, 3, 41, 0, 133, 134, 0, 0, 0, 94,
+	0, 96, 100, 0, 103, 0, 59, 56, 57, 34,
+	30, 32, 25, 31, 43, 132, 0, 0, 93, 95,
+	101, 104, 44, 0, 0, 0, 36, 0, 0, 0,
+	38, 0, 37, 0, 0, 39, 35,
 }
-var exprTok1 = [...]int{
 
+var exprTok1 = [...]int8{
 	1,
 }
-var exprTok2 = [...]int{
 
+var exprTok2 = [...]int8{
 	2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
 	12, 13, 14, 15, 16, 17, 18, 19, 20, 21,
 	22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
 	32, 33, 34, 35, 36, 37, 38, 39, 40, 41,
 	42, 43, 44, 45, 46, 47, 48, 49, 50, 51,
-	52, 53,
+	52, 53, 54, 55, 56, 57, 58, 59, 60, 61,
+	62, 63, 64, 65, 66, 67, 68, 69, 70, 71,
+	72, 73, 74, 75, 76, 77, 78, 79, 80,
 }
-var exprTok3 = [...]int{
+
+var exprTok3 = [...]int8{
 	0,
 }
 
@@ -397,9 +522,9 @@ func exprErrorMessage(state, lookAhead int) string {
 	expected := make([]int, 0, 4)
 
 	// Look for shiftable tokens.
-	base := exprPact[state]
+	base := int(exprPact[state])
 	for tok := TOKSTART; tok-1 < len(exprToknames); tok++ {
-		if n := base + tok; n >= 0 && n < exprLast && exprChk[exprAct[n]] == tok {
+		if n := base + tok; n >= 0 && n < exprLast && int(exprChk[int(exprAct[n])]) == tok {
 			if len(expected) == cap(expected) {
 				return res
 			}
@@ -409,13 +534,13 @@ func exprErrorMessage(state, lookAhead int) string {
 
 	if exprDef[state] == -2 {
 		i := 0
-		for exprExca[i] != -1 || exprExca[i+1] != state {
+		for exprExca[i] != -1 || int(exprExca[i+1]) != state {
 			i += 2
 		}
 
 		// Look for tokens that we accept or reduce.
 		for i += 2; exprExca[i] >= 0; i += 2 {
-			tok := exprExca[i]
+			tok := int(exprExca[i])
 			if tok < TOKSTART || exprExca[i+1] == 0 {
 				continue
 			}
@@ -446,30 +571,30 @@ func exprlex1(lex exprLexer, lval *exprSymType) (char, token int) {
 	token = 0
 	char = lex.Lex(lval)
 	if char <= 0 {
-		token = exprTok1[0]
+		token = int(exprTok1[0])
 		goto out
 	}
 	if char < len(exprTok1) {
-		token = exprTok1[char]
+		token = int(exprTok1[char])
 		goto out
 	}
 	if char >= exprPrivate {
 		if char < exprPrivate+len(exprTok2) {
-			token = exprTok2[char-exprPrivate]
+			token = int(exprTok2[char-exprPrivate])
 			goto out
 		}
 	}
 	for i := 0; i < len(exprTok3); i += 2 {
-		token = exprTok3[i+0]
+		token = int(exprTok3[i+0])
 		if token == char {
-			token = exprTok3[i+1]
+			token = int(exprTok3[i+1])
 			goto out
 		}
 	}
 
 out:
 	if token == 0 {
-		token = exprTok2[1] /* unknown char */
+		token = int(exprTok2[1]) /* unknown char */
 	}
 	if exprDebug >= 3 {
 		__yyfmt__.Printf("lex %s(%d)\n", exprTokname(token), uint(char))
@@ -524,7 +649,7 @@ exprstack:
 	exprS[exprp].yys = exprstate
 
 exprnewstate:
-	exprn = exprPact[exprstate]
+	exprn = int(exprPact[exprstate])
 	if exprn <= exprFlag {
 		goto exprdefault /* simple state */
 	}
@@ -535,8 +660,8 @@ exprnewstate:
 	if exprn < 0 || exprn >= exprLast {
 		goto exprdefault
 	}
-	exprn = exprAct[exprn]
-	if exprChk[exprn] == exprtoken { /* valid shift */
+	exprn = int(exprAct[exprn])
+	if int(exprChk[exprn]) == exprtoken { /* valid shift */
 		exprrcvr.char = -1
 		exprtoken = -1
 		exprVAL = exprrcvr.lval
@@ -549,7 +674,7 @@ exprnewstate:
 
 exprdefault:
 	/* default state action */
-	exprn = exprDef[exprstate]
+	exprn = int(exprDef[exprstate])
 	if exprn == -2 {
 		if exprrcvr.char < 0 {
 			exprrcvr.char, exprtoken = exprlex1(exprlex, &exprrcvr.lval)
@@ -558,18 +683,18 @@ exprdefault:
 		/* look through exception table */
 		xi := 0
 		for {
-			if exprExca[xi+0] == -1 && exprExca[xi+1] == exprstate {
+			if exprExca[xi+0] == -1 && int(exprExca[xi+1]) == exprstate {
 				break
 			}
 			xi += 2
 		}
 		for xi += 2; ; xi += 2 {
-			exprn = exprExca[xi+0]
+			exprn = int(exprExca[xi+0])
 			if exprn < 0 || exprn == exprtoken {
 				break
 			}
 		}
-		exprn = exprExca[xi+1]
+		exprn = int(exprExca[xi+1])
 		if exprn < 0 {
 			goto ret0
 		}
@@ -591,10 +716,10 @@ exprdefault:
 
 			/* find a state where "error" is a legal shift action */
 			for exprp >= 0 {
-				exprn = exprPact[exprS[exprp].yys] + exprErrCode
+				exprn = int(exprPact[exprS[exprp].yys]) + exprErrCode
 				if exprn >= 0 && exprn < exprLast {
-					exprstate = exprAct[exprn] /* simulate a shift of "error" */
-					if exprChk[exprstate] == exprErrCode {
+					exprstate = int(exprAct[exprn]) /* simulate a shift of "error" */
+					if int(exprChk[exprstate]) == exprErrCode {
 						goto exprstack
 					}
 				}
@@ -630,7 +755,7 @@ exprdefault:
 	exprpt := exprp
 	_ = exprpt // guard against "declared and not used"
 
-	exprp -= exprR2[exprn]
+	exprp -= int(exprR2[exprn])
 	// exprp is now the index of $0. Perform the default action. Iff the
 	// reduced production is ε, $1 is possibly out of range.
 	if exprp+1 >= len(exprS) {
@@ -641,16 +766,16 @@ exprdefault:
 	exprVAL = exprS[exprp+1]
 
 	/* consult goto table to find next state */
-	exprn = exprR1[exprn]
-	exprg := exprPgo[exprn]
+	exprn = int(exprR1[exprn])
+	exprg := int(exprPgo[exprn])
 	exprj := exprg + exprS[exprp].yys + 1
 
 	if exprj >= exprLast {
-		exprstate = exprAct[exprg]
+		exprstate = int(exprAct[exprg])
 	} else {
-		exprstate = exprAct[exprj]
-		if exprChk[exprstate] != -exprn {
-			exprstate = exprAct[exprg]
+		exprstate = int(exprAct[exprj])
+		if int(exprChk[exprstate]) != -exprn {
+			exprstate = int(exprAct[exprg])
 		}
 	}
 	// dummy call; replaced with literal code
@@ -692,315 +817,627 @@ exprdefault:
 			exprVAL.MetricExpr = exprDollar[1].LiteralExpr
 		}
 	case 8:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.MetricExpr = exprDollar[1].LabelReplaceExpr
+		}
+	case 9:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
 		{
 			exprVAL.MetricExpr = exprDollar[2].MetricExpr
 		}
-	case 9:
+	case 10:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.LogExpr = newMatcherExpr(exprDollar[1].Selector)
 		}
-	case 10:
+	case 11:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
 		{
 			exprVAL.LogExpr = NewFilterExpr(exprDollar[1].LogExpr, exprDollar[2].Filter, exprDollar[3].str)
 		}
-	case 11:
+	case 12:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
 		{
-			exprVAL.LogExpr = exprDollar[2].LogExpr
+			exprVAL.LogExpr = mustNewParserExpr(exprDollar[1].LogExpr, OpParserTypeJSON, "")
+		}
+	case 13:
+		exprDollar = exprS[exprpt-3 : exprpt+1]
+		{
+			exprVAL.LogExpr = mustNewParserExpr(exprDollar[1].LogExpr, OpParserTypeLogfmt, "")
 		}
 	case 14:
-		exprDollar = exprS[exprpt-2 : exprpt+1]
+		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
-			exprVAL.LogRangeExpr = newLogRange(exprDollar[1].LogExpr, exprDollar[2].duration)
+			exprVAL.LogExpr = mustNewParserExpr(exprDollar[1].LogExpr, OpParserTypeRegexp, exprDollar[4].str)
 		}
 	case 15:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
 		{
-			exprVAL.LogRangeExpr = addFilterToLogRangeExpr(exprDollar[1].LogRangeExpr, exprDollar[2].Filter, exprDollar[3].str)
+			exprVAL.LogExpr = mustNewParserExpr(exprDollar[1].LogExpr, OpParserTypeUnpack, "")
 		}
 	case 16:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
 		{
-			exprVAL.LogRangeExpr = exprDollar[2].LogRangeExpr
+			exprVAL.LogExpr = newLabelFilterExpr(exprDollar[1].LogExpr, exprDollar[3].LabelFilter)
+		}
+	case 17:
+		exprDollar = exprS[exprpt-4 : exprpt+1]
+		{
+			exprVAL.LogExpr = mustNewLineFmtExpr(exprDollar[1].LogExpr, exprDollar[4].str)
+		}
+	case 18:
+		exprDollar = exprS[exprpt-4 : exprpt+1]
+		{
+			exprVAL.LogExpr = mustNewLabelFmtExpr(exprDollar[1].LogExpr, exprDollar[4].LabelsFormat)
 		}
 	case 19:
+		exprDollar = exprS[exprpt-3 : exprpt+1]
+		{
+			exprVAL.LogExpr = exprDollar[2].LogExpr
+		}
+	case 22:
+		exprDollar = exprS[exprpt-2 : exprpt+1]
+		{
+			exprVAL.LogRangeExpr = newLogRange(exprDollar[1].LogExpr, exprDollar[2].duration, nil, nil)
+		}
+	case 23:
+		exprDollar = exprS[exprpt-3 : exprpt+1]
+		{
+			exprVAL.LogRangeExpr = newLogRange(exprDollar[1].LogExpr, exprDollar[2].duration, nil, exprDollar[3].OffsetExpr)
+		}
+	case 24:
+		exprDollar = exprS[exprpt-3 : exprpt+1]
+		{
+			exprVAL.LogRangeExpr = newLogRange(exprDollar[1].LogExpr, exprDollar[3].duration, exprDollar[2].UnwrapExpr, nil)
+		}
+	case 25:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
-			exprVAL.RangeAggregationExpr = newRangeAggregationExpr(exprDollar[3].LogRangeExpr, exprDollar[1].RangeOp)
+			exprVAL.LogRangeExpr = newLogRange(exprDollar[1].LogExpr, exprDollar[3].duration, exprDollar[2].UnwrapExpr, exprDollar[4].OffsetExpr)
+		}
+	case 26:
+		exprDollar = exprS[exprpt-3 : exprpt+1]
+		{
+			exprVAL.LogRangeExpr = addFilterToLogRangeExpr(exprDollar[1].LogRangeExpr, exprDollar[2].Filter, exprDollar[3].str)
+		}
+	case 27:
+		exprDollar = exprS[exprpt-3 : exprpt+1]
+		{
+			exprVAL.LogRangeExpr = exprDollar[2].LogRangeExpr
+		}
+	case 30:
+		exprDollar = exprS[exprpt-3 : exprpt+1]
+		{
+			exprVAL.UnwrapExpr = newUnwrapExpr(exprDollar[3].str)
+		}
+	case 31:
+		exprDollar = exprS[exprpt-3 : exprpt+1]
+		{
+			exprVAL.UnwrapExpr = exprDollar[1].UnwrapExpr.addPostFilter(exprDollar[3].LabelFilter)
+		}
+	case 32:
+		exprDollar = exprS[exprpt-2 : exprpt+1]
+		{
+			exprVAL.OffsetExpr = newOffsetExpr(exprDollar[2].duration)
+		}
+	case 33:
+		exprDollar = exprS[exprpt-4 : exprpt+1]
+		{
+			exprVAL.RangeAggregationExpr = mustNewRangeAggregationExpr(exprDollar[3].LogRangeExpr, exprDollar[1].RangeOp, nil)
+		}
+	case 34:
+		exprDollar = exprS[exprpt-6 : exprpt+1]
+		{
+			exprVAL.RangeAggregationExpr = mustNewRangeAggregationExpr(exprDollar[5].LogRangeExpr, exprDollar[1].RangeOp, &exprDollar[3].str)
+		}
+	case 35:
+		exprDollar = exprS[exprpt-12 : exprpt+1]
+		{
+			exprVAL.LabelReplaceExpr = mustNewLabelReplaceExpr(exprDollar[3].MetricExpr, exprDollar[5].str, exprDollar[7].str, exprDollar[9].str, exprDollar[11].str)
+		}
+	case 36:
+		exprDollar = exprS[exprpt-8 : exprpt+1]
+		{
+			exprVAL.LabelReplaceExpr = mustNewLabelJoinExpr(exprDollar[3].MetricExpr, exprDollar[5].str, exprDollar[7].str, nil)
+		}
+	case 37:
+		exprDollar = exprS[exprpt-10 : exprpt+1]
+		{
+			exprVAL.LabelReplaceExpr = mustNewLabelJoinExpr(exprDollar[3].MetricExpr, exprDollar[5].str, exprDollar[7].str, exprDollar[9].Strings)
 		}
-	case 20:
+	case 38:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.Strings = []string{exprDollar[1].str}
+		}
+	case 39:
+		exprDollar = exprS[exprpt-3 : exprpt+1]
+		{
+			exprVAL.Strings = append(exprDollar[1].Strings, exprDollar[3].str)
+		}
+	case 40:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
 			exprVAL.VectorAggregationExpr = mustNewVectorAggregationExpr(exprDollar[3].MetricExpr, exprDollar[1].VectorOp, nil, nil)
 		}
-	case 21:
+	case 41:
 		exprDollar = exprS[exprpt-5 : exprpt+1]
 		{
 			exprVAL.VectorAggregationExpr = mustNewVectorAggregationExpr(exprDollar[4].MetricExpr, exprDollar[1].VectorOp, exprDollar[2].Grouping, nil)
 		}
-	case 22:
+	case 42:
 		exprDollar = exprS[exprpt-5 : exprpt+1]
 		{
 			exprVAL.VectorAggregationExpr = mustNewVectorAggregationExpr(exprDollar[3].MetricExpr, exprDollar[1].VectorOp, exprDollar[5].Grouping, nil)
 		}
-	case 23:
+	case 43:
 		exprDollar = exprS[exprpt-6 : exprpt+1]
 		{
 			exprVAL.VectorAggregationExpr = mustNewVectorAggregationExpr(exprDollar[5].MetricExpr, exprDollar[1].VectorOp, nil, &exprDollar[3].str)
 		}
-	case 24:
+	case 44:
 		exprDollar = exprS[exprpt-7 : exprpt+1]
 		{
 			exprVAL.VectorAggregationExpr = mustNewVectorAggregationExpr(exprDollar[5].MetricExpr, exprDollar[1].VectorOp, exprDollar[7].Grouping, &exprDollar[3].str)
 		}
-	case 25:
+	case 45:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.Filter = labels.MatchRegexp
 		}
-	case 26:
+	case 46:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.Filter = labels.MatchEqual
 		}
-	case 27:
+	case 47:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.Filter = labels.MatchNotRegexp
 		}
-	case 28:
+	case 48:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.Filter = labels.MatchNotEqual
 		}
-	case 29:
+	case 49:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.LabelFilter = newStringLabelFilter(exprDollar[1].Matcher)
+		}
+	case 50:
+		exprDollar = exprS[exprpt-3 : exprpt+1]
+		{
+			exprVAL.LabelFilter = mustNewNumericLabelFilter(exprDollar[2].LabelFilterType, exprDollar[1].str, exprDollar[3].str)
+		}
+	case 51:
+		exprDollar = exprS[exprpt-3 : exprpt+1]
+		{
+			exprVAL.LabelFilter = newDurationLabelFilter(exprDollar[2].LabelFilterType, exprDollar[1].str, exprDollar[3].duration)
+		}
+	case 52:
+		exprDollar = exprS[exprpt-3 : exprpt+1]
+		{
+			exprVAL.LabelFilter = newBytesLabelFilter(exprDollar[2].LabelFilterType, exprDollar[1].str, exprDollar[3].bytes)
+		}
+	case 53:
+		exprDollar = exprS[exprpt-3 : exprpt+1]
+		{
+			exprVAL.LabelFilter = exprDollar[2].LabelFilter
+		}
+	case 54:
+		exprDollar = exprS[exprpt-3 : exprpt+1]
+		{
+			exprVAL.LabelFilter = newAndLabelFilter(exprDollar[1].LabelFilter, exprDollar[3].LabelFilter)
+		}
+	case 55:
+		exprDollar = exprS[exprpt-3 : exprpt+1]
+		{
+			exprVAL.LabelFilter = newOrLabelFilter(exprDollar[1].LabelFilter, exprDollar[3].LabelFilter)
+		}
+	case 56:
+		exprDollar = exprS[exprpt-3 : exprpt+1]
+		{
+			exprVAL.LabelFormat = newRenameLabelFmt(exprDollar[1].str, exprDollar[3].str)
+		}
+	case 57:
+		exprDollar = exprS[exprpt-3 : exprpt+1]
+		{
+			exprVAL.LabelFormat = newTemplateLabelFmt(exprDollar[1].str, exprDollar[3].str)
+		}
+	case 58:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.LabelsFormat = []labelFmt{exprDollar[1].LabelFormat}
+		}
+	case 59:
+		exprDollar = exprS[exprpt-3 : exprpt+1]
+		{
+			exprVAL.LabelsFormat = append(exprDollar[1].LabelsFormat, exprDollar[3].LabelFormat)
+		}
+	case 60:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.LabelFilterType = LabelFilterGreaterThan
+		}
+	case 61:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.LabelFilterType = LabelFilterGreaterThanOrEqual
+		}
+	case 62:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.LabelFilterType = LabelFilterLesserThan
+		}
+	case 63:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.LabelFilterType = LabelFilterLesserThanOrEqual
+		}
+	case 64:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.LabelFilterType = LabelFilterNotEqual
+		}
+	case 65:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.LabelFilterType = LabelFilterEqual
+		}
+	case 66:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.LabelFilterType = LabelFilterEqual
+		}
+	case 67:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
 		{
 			exprVAL.Selector = exprDollar[2].Matchers
 		}
-	case 30:
+	case 68:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
 		{
 			exprVAL.Selector = exprDollar[2].Matchers
 		}
-	case 31:
+	case 69:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
 		{
 		}
-	case 32:
+	case 70:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.Matchers = []*labels.Matcher{exprDollar[1].Matcher}
 		}
-	case 33:
+	case 71:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
 		{
 			exprVAL.Matchers = append(exprDollar[1].Matchers, exprDollar[3].Matcher)
 		}
-	case 34:
+	case 72:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
 		{
 			exprVAL.Matcher = mustNewMatcher(labels.MatchEqual, exprDollar[1].str, exprDollar[3].str)
 		}
-	case 35:
+	case 73:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
 		{
 			exprVAL.Matcher = mustNewMatcher(labels.MatchNotEqual, exprDollar[1].str, exprDollar[3].str)
 		}
-	case 36:
+	case 74:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
 		{
 			exprVAL.Matcher = mustNewMatcher(labels.MatchRegexp, exprDollar[1].str, exprDollar[3].str)
 		}
-	case 37:
+	case 75:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
 		{
 			exprVAL.Matcher = mustNewMatcher(labels.MatchNotRegexp, exprDollar[1].str, exprDollar[3].str)
 		}
-	case 38:
+	case 76:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
 			exprVAL.BinOpExpr = mustNewBinOpExpr("or", exprDollar[3].BinOpModifier, exprDollar[1].Expr, exprDollar[4].Expr)
 		}
-	case 39:
+	case 77:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
 			exprVAL.BinOpExpr = mustNewBinOpExpr("and", exprDollar[3].BinOpModifier, exprDollar[1].Expr, exprDollar[4].Expr)
 		}
-	case 40:
+	case 78:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
 			exprVAL.BinOpExpr = mustNewBinOpExpr("unless", exprDollar[3].BinOpModifier, exprDollar[1].Expr, exprDollar[4].Expr)
 		}
-	case 41:
+	case 79:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
 			exprVAL.BinOpExpr = mustNewBinOpExpr("+", exprDollar[3].BinOpModifier, exprDollar[1].Expr, exprDollar[4].Expr)
 		}
-	case 42:
+	case 80:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
 			exprVAL.BinOpExpr = mustNewBinOpExpr("-", exprDollar[3].BinOpModifier, exprDollar[1].Expr, exprDollar[4].Expr)
 		}
-	case 43:
+	case 81:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
 			exprVAL.BinOpExpr = mustNewBinOpExpr("*", exprDollar[3].BinOpModifier, exprDollar[1].Expr, exprDollar[4].Expr)
 		}
-	case 44:
+	case 82:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
 			exprVAL.BinOpExpr = mustNewBinOpExpr("/", exprDollar[3].BinOpModifier, exprDollar[1].Expr, exprDollar[4].Expr)
 		}
-	case 45:
+	case 83:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
 			exprVAL.BinOpExpr = mustNewBinOpExpr("%", exprDollar[3].BinOpModifier, exprDollar[1].Expr, exprDollar[4].Expr)
 		}
-	case 46:
+	case 84:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
 			exprVAL.BinOpExpr = mustNewBinOpExpr("^", exprDollar[3].BinOpModifier, exprDollar[1].Expr, exprDollar[4].Expr)
 		}
-	case 47:
+	case 85:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
 			exprVAL.BinOpExpr = mustNewBinOpExpr("==", exprDollar[3].BinOpModifier, exprDollar[1].Expr, exprDollar[4].Expr)
 		}
-	case 48:
+	case 86:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
 			exprVAL.BinOpExpr = mustNewBinOpExpr("!=", exprDollar[3].BinOpModifier, exprDollar[1].Expr, exprDollar[4].Expr)
 		}
-	case 49:
+	case 87:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
 			exprVAL.BinOpExpr = mustNewBinOpExpr(">", exprDollar[3].BinOpModifier, exprDollar[1].Expr, exprDollar[4].Expr)
 		}
-	case 50:
+	case 88:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
 			exprVAL.BinOpExpr = mustNewBinOpExpr(">=", exprDollar[3].BinOpModifier, exprDollar[1].Expr, exprDollar[4].Expr)
 		}
-	case 51:
+	case 89:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
 			exprVAL.BinOpExpr = mustNewBinOpExpr("<", exprDollar[3].BinOpModifier, exprDollar[1].Expr, exprDollar[4].Expr)
 		}
-	case 52:
+	case 90:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
 			exprVAL.BinOpExpr = mustNewBinOpExpr("<=", exprDollar[3].BinOpModifier, exprDollar[1].Expr, exprDollar[4].Expr)
 		}
-	case 53:
+	case 91:
 		exprDollar = exprS[exprpt-0 : exprpt+1]
 		{
-			exprVAL.BinOpModifier = BinOpOptions{}
+			exprVAL.BoolModifier = BinOpOptions{}
 		}
-	case 54:
+	case 92:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
-			exprVAL.BinOpModifier = BinOpOptions{ReturnBool: true}
+			exprVAL.BoolModifier = BinOpOptions{ReturnBool: true}
 		}
-	case 55:
+	case 93:
+		exprDollar = exprS[exprpt-5 : exprpt+1]
+		{
+			exprVAL.BinOpModifier = exprDollar[1].BoolModifier
+			exprVAL.BinOpModifier.VectorMatching = &VectorMatching{On: true, MatchingLabels: exprDollar[4].Labels}
+		}
+	case 94:
+		exprDollar = exprS[exprpt-4 : exprpt+1]
+		{
+			exprVAL.BinOpModifier = exprDollar[1].BoolModifier
+			exprVAL.BinOpModifier.VectorMatching = &VectorMatching{On: true}
+		}
+	case 95:
+		exprDollar = exprS[exprpt-5 : exprpt+1]
+		{
+			exprVAL.BinOpModifier = exprDollar[1].BoolModifier
+			exprVAL.BinOpModifier.VectorMatching = &VectorMatching{MatchingLabels: exprDollar[4].Labels}
+		}
+	case 96:
+		exprDollar = exprS[exprpt-4 : exprpt+1]
+		{
+			exprVAL.BinOpModifier = exprDollar[1].BoolModifier
+			exprVAL.BinOpModifier.VectorMatching = &VectorMatching{}
+		}
+	case 97:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.BinOpModifier = exprDollar[1].BoolModifier
+		}
+	case 98:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.BinOpModifier = exprDollar[1].BinOpModifier
+		}
+	case 99:
+		exprDollar = exprS[exprpt-2 : exprpt+1]
+		{
+			exprVAL.BinOpModifier = exprDollar[1].BinOpModifier
+			exprVAL.BinOpModifier.VectorMatching.Card = CardManyToOne
+		}
+	case 100:
+		exprDollar = exprS[exprpt-4 : exprpt+1]
+		{
+			exprVAL.BinOpModifier = exprDollar[1].BinOpModifier
+			exprVAL.BinOpModifier.VectorMatching.Card = CardManyToOne
+		}
+	case 101:
+		exprDollar = exprS[exprpt-5 : exprpt+1]
+		{
+			exprVAL.BinOpModifier = exprDollar[1].BinOpModifier
+			exprVAL.BinOpModifier.VectorMatching.Card = CardManyToOne
+			exprVAL.BinOpModifier.VectorMatching.Include = exprDollar[4].Labels
+		}
+	case 102:
+		exprDollar = exprS[exprpt-2 : exprpt+1]
+		{
+			exprVAL.BinOpModifier = exprDollar[1].BinOpModifier
+			exprVAL.BinOpModifier.VectorMatching.Card = CardOneToMany
+		}
+	case 103:
+		exprDollar = exprS[exprpt-4 : exprpt+1]
+		{
+			exprVAL.BinOpModifier = exprDollar[1].BinOpModifier
+			exprVAL.BinOpModifier.VectorMatching.Card = CardOneToMany
+		}
+	case 104:
+		exprDollar = exprS[exprpt-5 : exprpt+1]
+		{
+			exprVAL.BinOpModifier = exprDollar[1].BinOpModifier
+			exprVAL.BinOpModifier.VectorMatching.Card = CardOneToMany
+			exprVAL.BinOpModifier.VectorMatching.Include = exprDollar[4].Labels
+		}
+	case 105:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.LiteralExpr = mustNewLiteralExpr(exprDollar[1].str, false)
 		}
-	case 56:
+	case 106:
 		exprDollar = exprS[exprpt-2 : exprpt+1]
 		{
 			exprVAL.LiteralExpr = mustNewLiteralExpr(exprDollar[2].str, false)
 		}
-	case 57:
+	case 107:
 		exprDollar = exprS[exprpt-2 : exprpt+1]
 		{
 			exprVAL.LiteralExpr = mustNewLiteralExpr(exprDollar[2].str, true)
 		}
-	case 58:
+	case 108:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.VectorOp = OpTypeSum
 		}
-	case 59:
+	case 109:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.VectorOp = OpTypeAvg
 		}
-	case 60:
+	case 110:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.VectorOp = OpTypeCount
 		}
-	case 61:
+	case 111:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.VectorOp = OpTypeMax
 		}
-	case 62:
+	case 112:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.VectorOp = OpTypeMin
 		}
-	case 63:
+	case 113:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.VectorOp = OpTypeStddev
 		}
-	case 64:
+	case 114:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.VectorOp = OpTypeStdvar
 		}
-	case 65:
+	case 115:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.VectorOp = OpTypeBottomK
 		}
-	case 66:
+	case 116:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.VectorOp = OpTypeTopK
 		}
-	case 67:
+	case 117:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.RangeOp = OpRangeTypeCount
 		}
-	case 68:
+	case 118:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.RangeOp = OpRangeTypeRate
 		}
-	case 69:
+	case 119:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.RangeOp = OpRangeTypeBytes
 		}
-	case 70:
+	case 120:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.RangeOp = OpRangeTypeBytesRate
 		}
-	case 71:
+	case 121:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.RangeOp = OpRangeTypeAvg
+		}
+	case 122:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.RangeOp = OpRangeTypeSum
+		}
+	case 123:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.RangeOp = OpRangeTypeMin
+		}
+	case 124:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.RangeOp = OpRangeTypeMax
+		}
+	case 125:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.RangeOp = OpRangeTypeStdvar
+		}
+	case 126:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.RangeOp = OpRangeTypeStddev
+		}
+	case 127:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.RangeOp = OpRangeTypeQuantile
+		}
+	case 128:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.RangeOp = OpRangeTypeFirst
+		}
+	case 129:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.RangeOp = OpRangeTypeLast
+		}
+	case 130:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+		{
+			exprVAL.RangeOp = OpRangeTypeAbsent
+		}
+	case 131:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
 		{
 			exprVAL.Labels = []string{exprDollar[1].str}
 		}
-	case 72:
+	case 132:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
 		{
 			exprVAL.Labels = append(exprDollar[1].Labels, exprDollar[3].str)
 		}
-	case 73:
+	case 133:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
 			exprVAL.Grouping = &grouping{without: false, groups: exprDollar[3].Labels}
 		}
-	case 74:
+	case 134:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
 		{
 			exprVAL.Grouping = &grouping{without: true, groups: exprDollar[3].Labels}
@@ -156,6 +156,21 @@ func newContainsFilter(match []byte, caseInsensitive bool) LineFilter {
 	}
 }
 
+// FilterMayMatch returns false when the filter can't match a line given mayContain, which returns false for
+// the literals the line doesn't contain. Filters it can't tell about, like regexps, may always match.
+func FilterMayMatch(f LineFilter, mayContain func(literal []byte) bool) bool {
+	switch f := f.(type) {
+	case containsFilter:
+		return f.caseInsensitive || mayContain(f.match)
+	case andFilter:
+		return FilterMayMatch(f.left, mayContain) && FilterMayMatch(f.right, mayContain)
+	case orFilter:
+		return FilterMayMatch(f.left, mayContain) || FilterMayMatch(f.right, mayContain)
+	default:
+		return true
+	}
+}
+
 // newFilter creates a new line filter from a match string and type.
 func newFilter(match string, mt labels.MatchType) (LineFilter, error) {
 	switch mt {
@@ -126,6 +126,34 @@ func Test_TrueFilter(t *testing.T) {
 	}
 }
 
+func Test_FilterMayMatch(t *testing.T) {
+	contains := func(literal []byte) bool {
+		return string(literal) == "foo" || string(literal) == "bar"
+	}
+	for _, test := range []struct {
+		filter   string
+		mayMatch bool
+	}{
+		{`|= "foo"`, true},
+		{`|= "buzz"`, false},
+		{`|= "foo" |= "buzz"`, false},
+		{`|= "foo" |= "bar"`, true},
+		{`|~ "foo|buzz"`, true},
+		{`|~ "buzz|fizz"`, false},
+		{`|~ "(?i)buzz"`, true},
+		{`!= "buzz"`, true},
+		{`|~ "bu+zz"`, true},
+	} {
+		t.Run(test.filter, func(t *testing.T) {
+			expr, err := ParseLogSelector(`{app="foo"} ` + test.filter)
+			require.NoError(t, err)
+			f, err := expr.Filter()
+			require.NoError(t, err)
+			require.Equal(t, test.mayMatch, FilterMayMatch(f, contains))
+		})
+	}
+}
+
 func Benchmark_LineFilter(b *testing.B) {
 	b.ReportAllocs()
 	logline := `level=bar ts=2020-02-22T14:57:59.398312973Z caller=logging.go:44 traceID=2107b6b551458908 msg="GET /buzz (200) 4.599635ms`
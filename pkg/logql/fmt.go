@@ -0,0 +1,181 @@
+package logql
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+const errTemplateFormat = "TemplateFormatErr"
+
+// functionMap is the list of functions available in line_format and label_format templates,
+// they are the same as the promtail template stage.
+var functionMap = template.FuncMap{
+	"ToLower":    strings.ToLower,
+	"ToUpper":    strings.ToUpper,
+	"Replace":    strings.Replace,
+	"Trim":       strings.Trim,
+	"TrimLeft":   strings.TrimLeft,
+	"TrimRight":  strings.TrimRight,
+	"TrimPrefix": strings.TrimPrefix,
+	"TrimSuffix": strings.TrimSuffix,
+	"TrimSpace":  strings.TrimSpace,
+}
+
+type lineFormatter struct {
+	*template.Template
+	buf *bytes.Buffer
+}
+
+// newLineFormatter creates a stage replacing the log line with the result of a template executed against the labels.
+func newLineFormatter(tmpl string) (*lineFormatter, error) {
+	t, err := template.New("line").Option("missingkey=zero").Funcs(functionMap).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid line template: %s", err)
+	}
+	return &lineFormatter{
+		Template: t,
+		buf:      bytes.NewBuffer(make([]byte, 0, 4096)),
+	}, nil
+}
+
+func (lf *lineFormatter) Process(line []byte, lbs *labels.Builder) ([]byte, bool) {
+	lf.buf.Reset()
+	if err := lf.Execute(lf.buf, lbs.Labels().Map()); err != nil {
+		lbs.Set(ErrorLabel, errTemplateFormat)
+		return line, true
+	}
+	// the buffer is reused for the next line, the result needs to be copied.
+	res := make([]byte, lf.buf.Len())
+	copy(res, lf.buf.Bytes())
+	return res, true
+}
+
+// labelFmt is a configuration of a label_format stage.
+// The label is either renamed from another label or set to the result of a template.
+type labelFmt struct {
+	name  string
+	value string
+
+	rename bool
+}
+
+func newRenameLabelFmt(dst, src string) labelFmt {
+	return labelFmt{
+		name:   dst,
+		rename: true,
+		value:  src,
+	}
+}
+
+func newTemplateLabelFmt(dst, template string) labelFmt {
+	return labelFmt{
+		name:   dst,
+		rename: false,
+		value:  template,
+	}
+}
+
+func (f labelFmt) String() string {
+	if f.rename {
+		return fmt.Sprintf("%s=%s", f.name, f.value)
+	}
+	return fmt.Sprintf("%s=%q", f.name, f.value)
+}
+
+type labelFormatter struct {
+	labelFmt
+	tmpl *template.Template
+}
+
+type labelsFormatter struct {
+	formats []labelFormatter
+	buf     *bytes.Buffer
+}
+
+// newLabelsFormatter creates a stage renaming labels or setting them using templates.
+// All templates are executed against the labels as they were before the stage.
+// A label can only be the destination of a single format.
+func newLabelsFormatter(fmts []labelFmt) (*labelsFormatter, error) {
+	if err := validateLabelFormats(fmts); err != nil {
+		return nil, err
+	}
+	formats := make([]labelFormatter, 0, len(fmts))
+	for _, fm := range fmts {
+		toAdd := labelFormatter{labelFmt: fm}
+		if !fm.rename {
+			t, err := template.New("label").Option("missingkey=zero").Funcs(functionMap).Parse(fm.value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid template for label '%s': %s", fm.name, err)
+			}
+			toAdd.tmpl = t
+		}
+		formats = append(formats, toAdd)
+	}
+	return &labelsFormatter{
+		formats: formats,
+		buf:     bytes.NewBuffer(make([]byte, 0, 1024)),
+	}, nil
+}
+
+func validateLabelFormats(fmts []labelFmt) error {
+	if len(fmts) == 0 {
+		return fmt.Errorf("at least one label format is required")
+	}
+	names := map[string]struct{}{}
+	for _, f := range fmts {
+		if f.name == ErrorLabel {
+			return fmt.Errorf("%s cannot be formatted", f.name)
+		}
+		if !model.LabelName(f.name).IsValid() {
+			return fmt.Errorf("invalid label name '%s'", f.name)
+		}
+		if _, ok := names[f.name]; ok {
+			return fmt.Errorf("multiple label name '%s' not allowed in a single format operation", f.name)
+		}
+		names[f.name] = struct{}{}
+	}
+	return nil
+}
+
+func (lf *labelsFormatter) Process(line []byte, lbs *labels.Builder) ([]byte, bool) {
+	current := lbs.Labels()
+	var data map[string]string
+	for _, f := range lf.formats {
+		if f.rename {
+			if f.name == f.value {
+				continue
+			}
+			if v := current.Get(f.value); v != "" {
+				lbs.Set(f.name, v)
+				lbs.Del(f.value)
+			}
+			continue
+		}
+		if data == nil {
+			data = current.Map()
+		}
+		lf.buf.Reset()
+		if err := f.tmpl.Execute(lf.buf, data); err != nil {
+			lbs.Set(ErrorLabel, errTemplateFormat)
+			continue
+		}
+		lbs.Set(f.name, lf.buf.String())
+	}
+	return line, true
+}
+
+func (lf *labelsFormatter) String() string {
+	var sb strings.Builder
+	for i, f := range lf.formats {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(f.labelFmt.String())
+	}
+	return sb.String()
+}
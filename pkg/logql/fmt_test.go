@@ -0,0 +1,113 @@
+package logql
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_lineFormatter_Process(t *testing.T) {
+	tests := []struct {
+		name    string
+		fmter   string
+		lbs     labels.Labels
+		want    []byte
+		wantLbs labels.Labels
+	}{
+		{
+			"combining",
+			"foo{{.foo}}buzz{{  .bar  }}",
+			labels.Labels{{Name: "foo", Value: "blip"}, {Name: "bar", Value: "blop"}},
+			[]byte("fooblipbuzzblop"),
+			labels.Labels{{Name: "foo", Value: "blip"}, {Name: "bar", Value: "blop"}},
+		},
+		{
+			"missing",
+			"foo {{.foo}}buzz{{  .bar  }}",
+			labels.Labels{{Name: "bar", Value: "blop"}},
+			[]byte("foo buzzblop"),
+			labels.Labels{{Name: "bar", Value: "blop"}},
+		},
+		{
+			"function",
+			"foo {{.foo | ToUpper }} buzz{{  .bar  }}",
+			labels.Labels{{Name: "foo", Value: "blip"}, {Name: "bar", Value: "blop"}},
+			[]byte("foo BLIP buzzblop"),
+			labels.Labels{{Name: "foo", Value: "blip"}, {Name: "bar", Value: "blop"}},
+		},
+		{
+			"template error",
+			"foo {{.foo | Replace }}",
+			labels.Labels{{Name: "foo", Value: "blip"}},
+			[]byte("line"),
+			labels.Labels{{Name: "foo", Value: "blip"}, {Name: ErrorLabel, Value: errTemplateFormat}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newLineFormatter(tt.fmter)
+			require.NoError(t, err)
+			b := labels.NewBuilder(labels.New(tt.lbs...))
+			line, ok := f.Process([]byte("line"), b)
+			require.True(t, ok)
+			require.Equal(t, tt.want, line)
+			require.Equal(t, labels.New(tt.wantLbs...), b.Labels())
+		})
+	}
+}
+
+func Test_labelsFormatter_Process(t *testing.T) {
+	tests := []struct {
+		name string
+		fmts []labelFmt
+		in   labels.Labels
+		want labels.Labels
+	}{
+		{
+			"combined with template",
+			[]labelFmt{newTemplateLabelFmt("foo", "{{.foo}} and {{.bar}}")},
+			labels.Labels{{Name: "foo", Value: "blip"}, {Name: "bar", Value: "blop"}},
+			labels.Labels{{Name: "foo", Value: "blip and blop"}, {Name: "bar", Value: "blop"}},
+		},
+		{
+			"rename",
+			[]labelFmt{newRenameLabelFmt("baz", "foo")},
+			labels.Labels{{Name: "foo", Value: "blip"}, {Name: "bar", Value: "blop"}},
+			labels.Labels{{Name: "baz", Value: "blip"}, {Name: "bar", Value: "blop"}},
+		},
+		{
+			"rename and overwrite",
+			[]labelFmt{newRenameLabelFmt("bar", "foo")},
+			labels.Labels{{Name: "foo", Value: "blip"}, {Name: "bar", Value: "blop"}},
+			labels.Labels{{Name: "bar", Value: "blip"}},
+		},
+		{
+			"templates use labels before formatting",
+			[]labelFmt{newRenameLabelFmt("baz", "foo"), newTemplateLabelFmt("bar", "{{.foo | ToUpper }}")},
+			labels.Labels{{Name: "foo", Value: "blip"}, {Name: "bar", Value: "blop"}},
+			labels.Labels{{Name: "baz", Value: "blip"}, {Name: "bar", Value: "BLIP"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newLabelsFormatter(tt.fmts)
+			require.NoError(t, err)
+			b := labels.NewBuilder(labels.New(tt.in...))
+			_, ok := f.Process(nil, b)
+			require.True(t, ok)
+			require.Equal(t, labels.New(tt.want...), b.Labels())
+		})
+	}
+}
+
+func Test_validateLabelFormats(t *testing.T) {
+	for _, fmts := range [][]labelFmt{
+		nil,
+		{newRenameLabelFmt("foo", "bar"), newTemplateLabelFmt("foo", "{{.baz}}")},
+		{newRenameLabelFmt(ErrorLabel, "bar")},
+		{newTemplateLabelFmt("foo-bar", "baz")},
+	} {
+		require.Error(t, validateLabelFormats(fmts))
+	}
+}
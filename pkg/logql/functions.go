@@ -2,16 +2,25 @@ package logql
 
 import (
 	"fmt"
+	"math"
+	"sort"
 	"time"
 
+	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/promql"
 )
 
 const unsupportedErr = "unsupported range vector aggregation operation: %s"
 
 func (r rangeAggregationExpr) Extractor() (SampleExtractor, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	if r.left.unwrap != nil {
+		return newLabelSampleExtractor(r.left.unwrap.identifier, r.left.unwrap.postFilters), nil
+	}
 	switch r.operation {
-	case OpRangeTypeRate, OpRangeTypeCount:
+	case OpRangeTypeRate, OpRangeTypeCount, OpRangeTypeAbsent:
 		return ExtractCount, nil
 	case OpRangeTypeBytes, OpRangeTypeBytesRate:
 		return ExtractBytes, nil
@@ -28,8 +37,26 @@ func (r rangeAggregationExpr) aggregator() (RangeVectorAggregator, error) {
 		return countOverTime, nil
 	case OpRangeTypeBytesRate:
 		return rateLogBytes(r.left.interval), nil
-	case OpRangeTypeBytes:
+	case OpRangeTypeBytes, OpRangeTypeSum:
 		return sumOverTime, nil
+	case OpRangeTypeAvg:
+		return avgOverTime, nil
+	case OpRangeTypeMax:
+		return maxOverTime, nil
+	case OpRangeTypeMin:
+		return minOverTime, nil
+	case OpRangeTypeStddev:
+		return stddevOverTime, nil
+	case OpRangeTypeStdvar:
+		return stdvarOverTime, nil
+	case OpRangeTypeQuantile:
+		return quantileOverTime(*r.params), nil
+	case OpRangeTypeFirst:
+		return firstOverTime, nil
+	case OpRangeTypeLast:
+		return lastOverTime, nil
+	case OpRangeTypeAbsent:
+		return one, nil
 	default:
 		return nil, fmt.Errorf(unsupportedErr, r.operation)
 	}
@@ -61,3 +88,125 @@ func sumOverTime(samples []promql.Point) float64 {
 	}
 	return sum
 }
+
+func avgOverTime(samples []promql.Point) float64 {
+	var mean, count float64
+	for _, v := range samples {
+		count++
+		mean += (v.V - mean) / count
+	}
+	return mean
+}
+
+func maxOverTime(samples []promql.Point) float64 {
+	max := samples[0].V
+	for _, v := range samples {
+		if v.V > max || math.IsNaN(max) {
+			max = v.V
+		}
+	}
+	return max
+}
+
+func minOverTime(samples []promql.Point) float64 {
+	min := samples[0].V
+	for _, v := range samples {
+		if v.V < min || math.IsNaN(min) {
+			min = v.V
+		}
+	}
+	return min
+}
+
+func stdvarOverTime(samples []promql.Point) float64 {
+	var aux, count, mean float64
+	for _, v := range samples {
+		count++
+		delta := v.V - mean
+		mean += delta / count
+		aux += delta * (v.V - mean)
+	}
+	return aux / count
+}
+
+func stddevOverTime(samples []promql.Point) float64 {
+	return math.Sqrt(stdvarOverTime(samples))
+}
+
+// quantileOverTime calculates the φ-quantile of the values, using the same method as Prometheus.
+func quantileOverTime(q float64) func(samples []promql.Point) float64 {
+	return func(samples []promql.Point) float64 {
+		values := make([]float64, 0, len(samples))
+		for _, v := range samples {
+			values = append(values, v.V)
+		}
+		return quantile(q, values)
+	}
+}
+
+// quantile calculates the given quantile of a list of values.
+// The values are sorted in place.
+func quantile(q float64, values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	if q < 0 {
+		return math.Inf(-1)
+	}
+	if q > 1 {
+		return math.Inf(+1)
+	}
+	sort.Float64s(values)
+
+	n := float64(len(values))
+	// When the quantile lies between two samples,
+	// we use a weighted average of the two samples.
+	rank := q * (n - 1)
+
+	lowerIndex := math.Max(0, math.Floor(rank))
+	upperIndex := math.Min(n-1, lowerIndex+1)
+
+	weight := rank - math.Floor(rank)
+	return values[int(lowerIndex)]*(1-weight) + values[int(upperIndex)]*weight
+}
+
+func firstOverTime(samples []promql.Point) float64 {
+	return samples[0].V
+}
+
+func lastOverTime(samples []promql.Point) float64 {
+	return samples[len(samples)-1].V
+}
+
+func one(samples []promql.Point) float64 {
+	return 1.0
+}
+
+// absentLabels returns the labels of the series returned by absent_over_time.
+// Like Prometheus absent, only labels from equality matchers are kept,
+// labels with multiple equality matchers are dropped as their value is ambiguous.
+func absentLabels(expr SampleExpr) labels.Labels {
+	m := labels.Labels{}
+
+	lm := expr.Selector().Matchers()
+	if len(lm) == 0 {
+		return m
+	}
+
+	empty := []string{}
+	for _, ma := range lm {
+		if ma.Name == labels.MetricName {
+			continue
+		}
+		if ma.Type == labels.MatchEqual && !m.Has(ma.Name) {
+			m = labels.NewBuilder(m).Set(ma.Name, ma.Value).Labels()
+		} else {
+			empty = append(empty, ma.Name)
+		}
+	}
+
+	for _, v := range empty {
+		m = labels.NewBuilder(m).Del(v).Labels()
+	}
+	return m
+}
@@ -0,0 +1,269 @@
+package logql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+const errLabelFilter = "LabelFilterErr"
+
+// LabelFilterType is the type of comparison done by a label filter.
+type LabelFilterType int
+
+const (
+	LabelFilterEqual LabelFilterType = iota
+	LabelFilterNotEqual
+	LabelFilterGreaterThan
+	LabelFilterGreaterThanOrEqual
+	LabelFilterLesserThan
+	LabelFilterLesserThanOrEqual
+)
+
+func (f LabelFilterType) String() string {
+	switch f {
+	case LabelFilterEqual:
+		return OpTypeCmpEQ
+	case LabelFilterNotEqual:
+		return OpTypeNEQ
+	case LabelFilterGreaterThan:
+		return OpTypeGT
+	case LabelFilterGreaterThanOrEqual:
+		return OpTypeGTE
+	case LabelFilterLesserThan:
+		return OpTypeLT
+	case LabelFilterLesserThanOrEqual:
+		return OpTypeLTE
+	}
+	return ""
+}
+
+// LabelFilterer filters log lines based on their labels.
+// Lines for which the label value can't be converted are kept with the `__error__` label.
+type LabelFilterer interface {
+	Stage
+	fmt.Stringer
+}
+
+type binaryLabelFilter struct {
+	left  LabelFilterer
+	right LabelFilterer
+	and   bool
+}
+
+// newAndLabelFilter creates a new label filter which matches only if left and right matches.
+func newAndLabelFilter(left LabelFilterer, right LabelFilterer) LabelFilterer {
+	return &binaryLabelFilter{
+		left:  left,
+		right: right,
+		and:   true,
+	}
+}
+
+// newOrLabelFilter creates a new label filter which matches if left or right matches.
+func newOrLabelFilter(left LabelFilterer, right LabelFilterer) LabelFilterer {
+	return &binaryLabelFilter{
+		left:  left,
+		right: right,
+	}
+}
+
+func (b *binaryLabelFilter) Process(line []byte, lbs *labels.Builder) ([]byte, bool) {
+	line, lok := b.left.Process(line, lbs)
+	if b.and && !lok {
+		return line, false
+	}
+	if !b.and && lok {
+		return line, true
+	}
+	return b.right.Process(line, lbs)
+}
+
+func (b *binaryLabelFilter) String() string {
+	var sb strings.Builder
+	sb.WriteString("( ")
+	sb.WriteString(b.left.String())
+	if b.and {
+		sb.WriteString(" and ")
+	} else {
+		sb.WriteString(" or ")
+	}
+	sb.WriteString(b.right.String())
+	sb.WriteString(" )")
+	return sb.String()
+}
+
+type bytesLabelFilter struct {
+	name  string
+	value uint64
+	ty    LabelFilterType
+}
+
+// newBytesLabelFilter creates a label filter comparing a label value as an amount of bytes such as `10KB`.
+func newBytesLabelFilter(t LabelFilterType, name string, b uint64) LabelFilterer {
+	return &bytesLabelFilter{
+		name:  name,
+		value: b,
+		ty:    t,
+	}
+}
+
+func (d *bytesLabelFilter) Process(line []byte, lbs *labels.Builder) ([]byte, bool) {
+	if hasError(lbs) {
+		// if there's an error only the string matchers can filter it out.
+		return line, true
+	}
+	value, err := humanize.ParseBytes(lbs.Labels().Get(d.name))
+	if err != nil {
+		lbs.Set(ErrorLabel, errLabelFilter)
+		return line, true
+	}
+	switch d.ty {
+	case LabelFilterEqual:
+		return line, value == d.value
+	case LabelFilterNotEqual:
+		return line, value != d.value
+	case LabelFilterGreaterThan:
+		return line, value > d.value
+	case LabelFilterGreaterThanOrEqual:
+		return line, value >= d.value
+	case LabelFilterLesserThan:
+		return line, value < d.value
+	case LabelFilterLesserThanOrEqual:
+		return line, value <= d.value
+	default:
+		lbs.Set(ErrorLabel, errLabelFilter)
+		return line, true
+	}
+}
+
+func (d *bytesLabelFilter) String() string {
+	return fmt.Sprintf("%s%s%dB", d.name, d.ty, d.value)
+}
+
+type durationLabelFilter struct {
+	name  string
+	value time.Duration
+	ty    LabelFilterType
+}
+
+// newDurationLabelFilter creates a label filter comparing a label value as a duration such as `250ms`.
+func newDurationLabelFilter(t LabelFilterType, name string, d time.Duration) LabelFilterer {
+	return &durationLabelFilter{
+		name:  name,
+		value: d,
+		ty:    t,
+	}
+}
+
+func (d *durationLabelFilter) Process(line []byte, lbs *labels.Builder) ([]byte, bool) {
+	if hasError(lbs) {
+		// if there's an error only the string matchers can filter it out.
+		return line, true
+	}
+	value, err := time.ParseDuration(lbs.Labels().Get(d.name))
+	if err != nil {
+		lbs.Set(ErrorLabel, errLabelFilter)
+		return line, true
+	}
+	switch d.ty {
+	case LabelFilterEqual:
+		return line, value == d.value
+	case LabelFilterNotEqual:
+		return line, value != d.value
+	case LabelFilterGreaterThan:
+		return line, value > d.value
+	case LabelFilterGreaterThanOrEqual:
+		return line, value >= d.value
+	case LabelFilterLesserThan:
+		return line, value < d.value
+	case LabelFilterLesserThanOrEqual:
+		return line, value <= d.value
+	default:
+		lbs.Set(ErrorLabel, errLabelFilter)
+		return line, true
+	}
+}
+
+func (d *durationLabelFilter) String() string {
+	return fmt.Sprintf("%s%s%s", d.name, d.ty, d.value)
+}
+
+type numericLabelFilter struct {
+	name  string
+	value float64
+	ty    LabelFilterType
+}
+
+// newNumericLabelFilter creates a label filter comparing a label value as a float.
+func newNumericLabelFilter(t LabelFilterType, name string, v float64) LabelFilterer {
+	return &numericLabelFilter{
+		name:  name,
+		value: v,
+		ty:    t,
+	}
+}
+
+func (n *numericLabelFilter) Process(line []byte, lbs *labels.Builder) ([]byte, bool) {
+	if hasError(lbs) {
+		// if there's an error only the string matchers can filter it out.
+		return line, true
+	}
+	value, err := strconv.ParseFloat(lbs.Labels().Get(n.name), 64)
+	if err != nil {
+		lbs.Set(ErrorLabel, errLabelFilter)
+		return line, true
+	}
+	switch n.ty {
+	case LabelFilterEqual:
+		return line, value == n.value
+	case LabelFilterNotEqual:
+		return line, value != n.value
+	case LabelFilterGreaterThan:
+		return line, value > n.value
+	case LabelFilterGreaterThanOrEqual:
+		return line, value >= n.value
+	case LabelFilterLesserThan:
+		return line, value < n.value
+	case LabelFilterLesserThanOrEqual:
+		return line, value <= n.value
+	default:
+		lbs.Set(ErrorLabel, errLabelFilter)
+		return line, true
+	}
+}
+
+func (n *numericLabelFilter) String() string {
+	return fmt.Sprintf("%s%s%s", n.name, n.ty, strconv.FormatFloat(n.value, 'f', -1, 64))
+}
+
+func mustNewNumericLabelFilter(t LabelFilterType, name string, s string) LabelFilterer {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		panic(newParseError(fmt.Sprintf("unable to parse label filter value as a float: %s", err.Error()), 0, 0))
+	}
+	return newNumericLabelFilter(t, name, v)
+}
+
+type stringLabelFilter struct {
+	*labels.Matcher
+}
+
+// newStringLabelFilter creates a label filter using a Prometheus label matcher.
+func newStringLabelFilter(m *labels.Matcher) LabelFilterer {
+	return &stringLabelFilter{
+		Matcher: m,
+	}
+}
+
+func (s *stringLabelFilter) Process(line []byte, lbs *labels.Builder) ([]byte, bool) {
+	return line, s.Matches(lbs.Labels().Get(s.Name))
+}
+
+func hasError(lbs *labels.Builder) bool {
+	return lbs.Labels().Has(ErrorLabel)
+}
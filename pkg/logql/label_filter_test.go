@@ -0,0 +1,85 @@
+package logql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinary_Filter(t *testing.T) {
+	tests := []struct {
+		f       LabelFilterer
+		lbs     labels.Labels
+		want    bool
+		wantLbs labels.Labels
+	}{
+		{
+			newAndLabelFilter(newNumericLabelFilter(LabelFilterEqual, "foo", 5), newDurationLabelFilter(LabelFilterEqual, "bar", 1*time.Second)),
+			labels.Labels{{Name: "foo", Value: "5"}, {Name: "bar", Value: "1s"}},
+			true,
+			labels.Labels{{Name: "foo", Value: "5"}, {Name: "bar", Value: "1s"}},
+		},
+		{
+			newAndLabelFilter(newNumericLabelFilter(LabelFilterEqual, "foo", 5), newBytesLabelFilter(LabelFilterEqual, "bar", 42)),
+			labels.Labels{{Name: "foo", Value: "5"}, {Name: "bar", Value: "42B"}},
+			true,
+			labels.Labels{{Name: "foo", Value: "5"}, {Name: "bar", Value: "42B"}},
+		},
+		{
+			newAndLabelFilter(newNumericLabelFilter(LabelFilterEqual, "foo", 5), newDurationLabelFilter(LabelFilterEqual, "bar", 1*time.Second)),
+			labels.Labels{{Name: "foo", Value: "6"}, {Name: "bar", Value: "1s"}},
+			false,
+			labels.Labels{{Name: "foo", Value: "6"}, {Name: "bar", Value: "1s"}},
+		},
+		{
+			newOrLabelFilter(newNumericLabelFilter(LabelFilterEqual, "foo", 5), newDurationLabelFilter(LabelFilterEqual, "bar", 1*time.Second)),
+			labels.Labels{{Name: "foo", Value: "6"}, {Name: "bar", Value: "1s"}},
+			true,
+			labels.Labels{{Name: "foo", Value: "6"}, {Name: "bar", Value: "1s"}},
+		},
+		{
+			newOrLabelFilter(newNumericLabelFilter(LabelFilterGreaterThan, "foo", 5), newBytesLabelFilter(LabelFilterGreaterThanOrEqual, "bar", 2000)),
+			labels.Labels{{Name: "foo", Value: "2"}, {Name: "bar", Value: "1KB"}},
+			false,
+			labels.Labels{{Name: "foo", Value: "2"}, {Name: "bar", Value: "1KB"}},
+		},
+		{
+			newStringLabelFilter(mustNewMatcher(labels.MatchRegexp, "method", "GET|POST")),
+			labels.Labels{{Name: "method", Value: "POST"}},
+			true,
+			labels.Labels{{Name: "method", Value: "POST"}},
+		},
+		{
+			newNumericLabelFilter(LabelFilterLesserThan, "status", 500),
+			labels.Labels{{Name: "status", Value: "not a number"}},
+			true,
+			labels.Labels{{Name: "status", Value: "not a number"}, {Name: ErrorLabel, Value: errLabelFilter}},
+		},
+		{
+			newDurationLabelFilter(LabelFilterLesserThan, "duration", time.Second),
+			labels.Labels{{Name: "status", Value: "200"}},
+			true,
+			labels.Labels{{Name: "status", Value: "200"}, {Name: ErrorLabel, Value: errLabelFilter}},
+		},
+		{
+			// errors are kept until filtered out by a string matcher.
+			newAndLabelFilter(
+				newNumericLabelFilter(LabelFilterLesserThan, "status", 500),
+				newStringLabelFilter(mustNewMatcher(labels.MatchEqual, ErrorLabel, "")),
+			),
+			labels.Labels{{Name: "status", Value: "abc"}},
+			false,
+			labels.Labels{{Name: "status", Value: "abc"}, {Name: ErrorLabel, Value: errLabelFilter}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.f.String(), func(t *testing.T) {
+			b := labels.NewBuilder(labels.New(tt.lbs...))
+			_, got := tt.f.Process(nil, b)
+			require.Equal(t, tt.want, got)
+			require.Equal(t, labels.New(tt.wantLbs...), b.Labels())
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package logql
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-logfmt/logfmt"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+const (
+	jsonSpacer      = "_"
+	duplicateSuffix = "_extracted"
+
+	errJSON   = "JSONParserErr"
+	errLogfmt = "LogfmtParserErr"
+
+	// PackedEntryKey is the key of the original log line in the JSON objects of the lines packed by promtail.
+	PackedEntryKey = "_entry"
+)
+
+var errMissingCapture = errors.New("at least one named capture must be supplied")
+
+// addLabel adds an extracted label to the builder.
+// If the name is already used by the stream labels, the label is suffixed with `_extracted`.
+func addLabel(lbs *labels.Builder, base labels.Labels, name, value string) {
+	name = sanitizeLabelKey(name)
+	if name == "" {
+		return
+	}
+	if base.Has(name) {
+		name = name + duplicateSuffix
+	}
+	lbs.Set(name, value)
+}
+
+// sanitizeLabelKey replaces all characters that are not allowed in label names by an underscore.
+func sanitizeLabelKey(key string) string {
+	if len(key) == 0 {
+		return key
+	}
+	key = strings.TrimSpace(key)
+	if len(key) == 0 {
+		return key
+	}
+	if key[0] >= '0' && key[0] <= '9' {
+		key = "_" + key
+	}
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_' || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+type jsonParser struct{}
+
+// newJSONParser creates a stage extracting all JSON properties of a line as labels.
+// Nested properties are flattened using `_` as separator, arrays are ignored.
+func newJSONParser() jsonParser {
+	return jsonParser{}
+}
+
+func (j jsonParser) Process(line []byte, lbs *labels.Builder) ([]byte, bool) {
+	data := map[string]interface{}{}
+	if err := jsoniter.ConfigFastest.Unmarshal(line, &data); err != nil {
+		lbs.Set(ErrorLabel, errJSON)
+		return line, true
+	}
+	base := lbs.Labels()
+	j.parseMap("", data, lbs, base)
+	return line, true
+}
+
+func (j jsonParser) parseMap(prefix string, data map[string]interface{}, lbs *labels.Builder, base labels.Labels) {
+	for key, val := range data {
+		if prefix != "" {
+			key = prefix + jsonSpacer + key
+		}
+		switch v := val.(type) {
+		case map[string]interface{}:
+			j.parseMap(key, v, lbs, base)
+		case string:
+			addLabel(lbs, base, key, v)
+		case float64:
+			addLabel(lbs, base, key, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			addLabel(lbs, base, key, strconv.FormatBool(v))
+		}
+	}
+}
+
+type logfmtParser struct{}
+
+// newLogfmtParser creates a stage extracting all logfmt key/value pairs of a line as labels.
+func newLogfmtParser() logfmtParser {
+	return logfmtParser{}
+}
+
+func (logfmtParser) Process(line []byte, lbs *labels.Builder) ([]byte, bool) {
+	base := lbs.Labels()
+	dec := logfmt.NewDecoder(bytes.NewReader(line))
+	for dec.ScanRecord() {
+		for dec.ScanKeyval() {
+			addLabel(lbs, base, string(dec.Key()), string(dec.Value()))
+		}
+	}
+	if dec.Err() != nil {
+		lbs.Set(ErrorLabel, errLogfmt)
+	}
+	return line, true
+}
+
+type regexpParser struct {
+	regex     *regexp.Regexp
+	nameIndex map[int]string
+}
+
+// newRegexpParser creates a stage extracting named captures of a regular expression as labels.
+// The regexp must contain at least one named capture, and all capture names must be valid label names.
+func newRegexpParser(re string) (*regexpParser, error) {
+	regex, err := regexp.Compile(re)
+	if err != nil {
+		return nil, err
+	}
+	if regex.NumSubexp() == 0 {
+		return nil, errMissingCapture
+	}
+	nameIndex := map[int]string{}
+	for i, n := range regex.SubexpNames() {
+		if n == "" {
+			continue
+		}
+		if !model.LabelName(n).IsValid() {
+			return nil, fmt.Errorf("invalid extracted label name '%s'", n)
+		}
+		nameIndex[i] = n
+	}
+	if len(nameIndex) == 0 {
+		return nil, errMissingCapture
+	}
+	return &regexpParser{
+		regex:     regex,
+		nameIndex: nameIndex,
+	}, nil
+}
+
+func (r *regexpParser) Process(line []byte, lbs *labels.Builder) ([]byte, bool) {
+	base := lbs.Labels()
+	for i, match := range r.regex.FindSubmatch(line) {
+		if name, ok := r.nameIndex[i]; ok {
+			addLabel(lbs, base, name, string(match))
+		}
+	}
+	return line, true
+}
+
+type unpackParser struct{}
+
+// newUnpackParser creates a stage extracting the labels packed with the line by the promtail pack stage.
+// The packed line is a JSON object of the labels, whose _entry property is the original line which
+// replaces the packed one. The lines which are not JSON get the JSON parser error label.
+func newUnpackParser() unpackParser {
+	return unpackParser{}
+}
+
+func (unpackParser) Process(line []byte, lbs *labels.Builder) ([]byte, bool) {
+	data := map[string]interface{}{}
+	if err := jsoniter.ConfigFastest.Unmarshal(line, &data); err != nil {
+		lbs.Set(ErrorLabel, errJSON)
+		return line, true
+	}
+	base := lbs.Labels()
+	for key, val := range data {
+		v, ok := val.(string)
+		if !ok {
+			continue
+		}
+		if key == PackedEntryKey {
+			line = []byte(v)
+			continue
+		}
+		addLabel(lbs, base, key, v)
+	}
+	return line, true
+}
@@ -0,0 +1,234 @@
+package logql
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_jsonParser_Process(t *testing.T) {
+	tests := []struct {
+		name string
+		line []byte
+		lbs  labels.Labels
+		want labels.Labels
+	}{
+		{
+			"multi depth",
+			[]byte(`{"app":"foo","namespace":"prod","pod":{"uuid":"foo","deployment":{"ref":"foobar"}}}`),
+			labels.Labels{},
+			labels.Labels{
+				{Name: "app", Value: "foo"},
+				{Name: "namespace", Value: "prod"},
+				{Name: "pod_uuid", Value: "foo"},
+				{Name: "pod_deployment_ref", Value: "foobar"},
+			},
+		},
+		{
+			"numeric and bool",
+			[]byte(`{"counter":1, "price": {"_net_":5.56909}, "ok": true}`),
+			labels.Labels{},
+			labels.Labels{
+				{Name: "counter", Value: "1"},
+				{Name: "price__net_", Value: "5.56909"},
+				{Name: "ok", Value: "true"},
+			},
+		},
+		{
+			"skip arrays",
+			[]byte(`{"counter":1, "price": {"net_":["10","20"]}}`),
+			labels.Labels{},
+			labels.Labels{
+				{Name: "counter", Value: "1"},
+			},
+		},
+		{
+			"duplicate with stream labels",
+			[]byte(`{"app":"bar", "some key": "value"}`),
+			labels.Labels{{Name: "app", Value: "foo"}},
+			labels.Labels{
+				{Name: "app", Value: "foo"},
+				{Name: "app_extracted", Value: "bar"},
+				{Name: "some_key", Value: "value"},
+			},
+		},
+		{
+			"bad json",
+			[]byte(`{"app":"foo"`),
+			labels.Labels{{Name: "app", Value: "foo"}},
+			labels.Labels{
+				{Name: "app", Value: "foo"},
+				{Name: ErrorLabel, Value: errJSON},
+			},
+		},
+	}
+	for _, tt := range tests {
+		j := newJSONParser()
+		t.Run(tt.name, func(t *testing.T) {
+			b := labels.NewBuilder(tt.lbs)
+			line, ok := j.Process(tt.line, b)
+			require.True(t, ok)
+			require.Equal(t, tt.line, line)
+			sort.Sort(tt.want)
+			require.Equal(t, tt.want, b.Labels())
+		})
+	}
+}
+
+func Test_logfmtParser_Process(t *testing.T) {
+	tests := []struct {
+		name string
+		line []byte
+		lbs  labels.Labels
+		want labels.Labels
+	}{
+		{
+			"key values",
+			[]byte(`level=info method=GET path=/api/prom/push duration=1.2ms msg="hello world"`),
+			labels.Labels{{Name: "app", Value: "foo"}},
+			labels.Labels{
+				{Name: "app", Value: "foo"},
+				{Name: "level", Value: "info"},
+				{Name: "method", Value: "GET"},
+				{Name: "path", Value: "/api/prom/push"},
+				{Name: "duration", Value: "1.2ms"},
+				{Name: "msg", Value: "hello world"},
+			},
+		},
+		{
+			"duplicate and invalid keys",
+			[]byte(`app=bar foo.bar=buzz`),
+			labels.Labels{{Name: "app", Value: "foo"}},
+			labels.Labels{
+				{Name: "app", Value: "foo"},
+				{Name: "app_extracted", Value: "bar"},
+				{Name: "foo_bar", Value: "buzz"},
+			},
+		},
+		{
+			"bad logfmt",
+			[]byte(`foo="bar`),
+			labels.Labels{{Name: "app", Value: "foo"}},
+			labels.Labels{
+				{Name: "app", Value: "foo"},
+				{Name: ErrorLabel, Value: errLogfmt},
+			},
+		},
+	}
+	for _, tt := range tests {
+		p := newLogfmtParser()
+		t.Run(tt.name, func(t *testing.T) {
+			b := labels.NewBuilder(tt.lbs)
+			_, ok := p.Process(tt.line, b)
+			require.True(t, ok)
+			sort.Sort(tt.want)
+			require.Equal(t, tt.want, b.Labels())
+		})
+	}
+}
+
+func Test_regexpParser_Process(t *testing.T) {
+	tests := []struct {
+		name   string
+		regexp string
+		line   []byte
+		want   labels.Labels
+	}{
+		{
+			"named captures",
+			`^(?P<ip>\S+) \S+ \S+ \[[^\]]+\] "(?P<method>\S+) (?P<path>\S+) [^"]+" (?P<status>\d+)`,
+			[]byte(`127.0.0.1 - - [21/Sep/2020:10:10:10 +0000] "GET /api/v1/query HTTP/1.1" 200 1234`),
+			labels.Labels{
+				{Name: "app", Value: "foo"},
+				{Name: "ip", Value: "127.0.0.1"},
+				{Name: "method", Value: "GET"},
+				{Name: "path", Value: "/api/v1/query"},
+				{Name: "status", Value: "200"},
+			},
+		},
+		{
+			"no match",
+			`^(?P<status>\d+)$`,
+			[]byte(`not a number`),
+			labels.Labels{{Name: "app", Value: "foo"}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newRegexpParser(tt.regexp)
+			require.NoError(t, err)
+			b := labels.NewBuilder(labels.Labels{{Name: "app", Value: "foo"}})
+			_, ok := p.Process(tt.line, b)
+			require.True(t, ok)
+			sort.Sort(tt.want)
+			require.Equal(t, tt.want, b.Labels())
+		})
+	}
+}
+
+func Test_newRegexpParser_Errors(t *testing.T) {
+	for _, re := range []string{`(\d+)`, `(?P<1bad>\d+)`, `(?P<foo>\d+`} {
+		_, err := newRegexpParser(re)
+		require.Error(t, err, re)
+	}
+}
+
+func Test_unpackParser_Process(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     []byte
+		lbs      labels.Labels
+		want     labels.Labels
+		wantLine []byte
+	}{
+		{
+			"packed",
+			[]byte(`{"pod":"loki-0","request_id":"42","_entry":"level=info msg=\"hello\""}`),
+			labels.Labels{{Name: "app", Value: "loki"}},
+			labels.Labels{
+				{Name: "app", Value: "loki"},
+				{Name: "pod", Value: "loki-0"},
+				{Name: "request_id", Value: "42"},
+			},
+			[]byte(`level=info msg="hello"`),
+		},
+		{
+			"duplicate with stream labels and non string values",
+			[]byte(`{"app":"foo","count":1,"_entry":"bar"}`),
+			labels.Labels{{Name: "app", Value: "loki"}},
+			labels.Labels{
+				{Name: "app", Value: "loki"},
+				{Name: "app_extracted", Value: "foo"},
+			},
+			[]byte(`bar`),
+		},
+		{
+			"not packed",
+			[]byte(`{"app":"foo"}`),
+			labels.Labels{},
+			labels.Labels{{Name: "app", Value: "foo"}},
+			[]byte(`{"app":"foo"}`),
+		},
+		{
+			"bad json",
+			[]byte(`level=info`),
+			labels.Labels{},
+			labels.Labels{{Name: ErrorLabel, Value: errJSON}},
+			[]byte(`level=info`),
+		},
+	}
+	for _, tt := range tests {
+		u := newUnpackParser()
+		t.Run(tt.name, func(t *testing.T) {
+			b := labels.NewBuilder(tt.lbs)
+			line, ok := u.Process(tt.line, b)
+			require.True(t, ok)
+			require.Equal(t, tt.wantLine, line)
+			sort.Sort(tt.want)
+			require.Equal(t, tt.want, b.Labels())
+		})
+	}
+}
@@ -2,9 +2,12 @@ package logql
 
 import (
 	"strconv"
+	"strings"
 	"text/scanner"
 	"time"
+	"unicode"
 
+	"github.com/dustin/go-humanize"
 	"github.com/prometheus/common/model"
 )
 
@@ -19,17 +22,32 @@ var tokens = map[string]int{
 	"!~":                 NRE,
 	"|=":                 PIPE_EXACT,
 	"|~":                 PIPE_MATCH,
+	"|":                  PIPE,
 	"(":                  OPEN_PARENTHESIS,
 	")":                  CLOSE_PARENTHESIS,
 	"by":                 BY,
 	"without":            WITHOUT,
 	"bool":               BOOL,
+	"on":                 ON,
+	"ignoring":           IGNORING,
+	"group_left":         GROUP_LEFT,
+	"group_right":        GROUP_RIGHT,
 	"[":                  OPEN_BRACKET,
 	"]":                  CLOSE_BRACKET,
 	OpRangeTypeRate:      RATE,
 	OpRangeTypeCount:     COUNT_OVER_TIME,
 	OpRangeTypeBytesRate: BYTES_RATE,
 	OpRangeTypeBytes:     BYTES_OVER_TIME,
+	OpRangeTypeAvg:       AVG_OVER_TIME,
+	OpRangeTypeSum:       SUM_OVER_TIME,
+	OpRangeTypeMin:       MIN_OVER_TIME,
+	OpRangeTypeMax:       MAX_OVER_TIME,
+	OpRangeTypeStdvar:    STDVAR_OVER_TIME,
+	OpRangeTypeStddev:    STDDEV_OVER_TIME,
+	OpRangeTypeQuantile:  QUANTILE_OVER_TIME,
+	OpRangeTypeFirst:     FIRST_OVER_TIME,
+	OpRangeTypeLast:      LAST_OVER_TIME,
+	OpRangeTypeAbsent:    ABSENT_OVER_TIME,
 	OpTypeSum:            SUM,
 	OpTypeAvg:            AVG,
 	OpTypeMax:            MAX,
@@ -40,6 +58,26 @@ var tokens = map[string]int{
 	OpTypeBottomK:        BOTTOMK,
 	OpTypeTopK:           TOPK,
 
+	// parsers
+	OpParserTypeJSON:   JSON,
+	OpParserTypeLogfmt: LOGFMT,
+	OpParserTypeRegexp: REGEXP,
+	OpParserTypeUnpack: UNPACK,
+
+	// formatters
+	OpFmtLine:  LINE_FMT,
+	OpFmtLabel: LABEL_FMT,
+
+	// unwrap
+	OpUnwrap: UNWRAP,
+
+	// modifiers
+	OpOffset: OFFSET,
+
+	// label functions
+	OpLabelReplace: LABEL_REPLACE,
+	OpLabelJoin:    LABEL_JOIN,
+
 	// binops
 	OpTypeOr:     OR,
 	OpTypeAnd:    AND,
@@ -60,6 +98,8 @@ var tokens = map[string]int{
 
 type lexer struct {
 	scanner.Scanner
+	// input is the source read by the scanner, units following numbers are looked ahead in it.
+	input  string
 	errs   []ParseError
 	expr   Expr
 	parser *exprParserImpl
@@ -72,7 +112,16 @@ func (l *lexer) Lex(lval *exprSymType) int {
 		return 0
 
 	case scanner.Int, scanner.Float:
-		lval.str = l.TokenText()
+		numberText := l.TokenText()
+		if duration, ok := tryScanDuration(numberText, l.input, &l.Scanner); ok {
+			lval.duration = duration
+			return DURATION_VALUE
+		}
+		if bytes, ok := tryScanBytes(numberText, l.input, &l.Scanner); ok {
+			lval.bytes = bytes
+			return BYTES_VALUE
+		}
+		lval.str = numberText
 		return NUMBER
 
 	case scanner.String, scanner.RawString:
@@ -117,6 +166,65 @@ func (l *lexer) Lex(lval *exprSymType) int {
 	return IDENTIFIER
 }
 
+// tryScanDuration attempts to scan a duration unit following a number, e.g. `1m30s`.
+// The scanner is only advanced if a valid duration is found.
+func tryScanDuration(number, input string, l *scanner.Scanner) (time.Duration, bool) {
+	value, consumed := scanUnit(number, input, l)
+	if consumed == 0 {
+		return 0, false
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		// also supports days, weeks and years units.
+		md, err := model.ParseDuration(value)
+		if err != nil {
+			return 0, false
+		}
+		d = time.Duration(md)
+	}
+	advance(l, consumed)
+	return d, true
+}
+
+// tryScanBytes attempts to scan a bytes unit following a number, e.g. `10KB`.
+// The scanner is only advanced if a valid bytes size is found.
+func tryScanBytes(number, input string, l *scanner.Scanner) (uint64, bool) {
+	value, consumed := scanUnit(number, input, l)
+	if consumed == 0 {
+		return 0, false
+	}
+	b, err := humanize.ParseBytes(value)
+	if err != nil {
+		return 0, false
+	}
+	advance(l, consumed)
+	return b, true
+}
+
+// scanUnit returns the number followed by its unit without advancing the scanner,
+// and the amount of runes that were read after the number.
+// The unit is read from the input after the position of the scanner, copying the scanner
+// instead would lose the input it buffers if the copy reads from the shared reader.
+func scanUnit(number, input string, l *scanner.Scanner) (string, int) {
+	var sb strings.Builder
+	sb.WriteString(number)
+	consumed := 0
+	for _, r := range input[l.Pos().Offset:] {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' {
+			break
+		}
+		sb.WriteRune(r)
+		consumed++
+	}
+	return sb.String(), consumed
+}
+
+func advance(l *scanner.Scanner, n int) {
+	for i := 0; i < n; i++ {
+		l.Next()
+	}
+}
+
 func (l *lexer) Error(msg string) {
 	l.errs = append(l.errs, newParseError(msg, l.Line, l.Column))
 }
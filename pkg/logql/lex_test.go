@@ -1,6 +1,7 @@
 package logql
 
 import (
+	"strconv"
 	"strings"
 	"testing"
 	"text/scanner"
@@ -29,6 +30,9 @@ func TestLex(t *testing.T) {
 		{`topk(3,count_over_time({foo="bar"}[5m])) by (foo,bar)`, []int{TOPK, OPEN_PARENTHESIS, NUMBER, COMMA, COUNT_OVER_TIME, OPEN_PARENTHESIS, OPEN_BRACE, IDENTIFIER, EQ, STRING, CLOSE_BRACE, DURATION, CLOSE_PARENTHESIS, CLOSE_PARENTHESIS, BY, OPEN_PARENTHESIS, IDENTIFIER, COMMA, IDENTIFIER, CLOSE_PARENTHESIS}},
 		{`bottomk(10,sum(count_over_time({foo="bar"}[5m])) by (foo,bar))`, []int{BOTTOMK, OPEN_PARENTHESIS, NUMBER, COMMA, SUM, OPEN_PARENTHESIS, COUNT_OVER_TIME, OPEN_PARENTHESIS, OPEN_BRACE, IDENTIFIER, EQ, STRING, CLOSE_BRACE, DURATION, CLOSE_PARENTHESIS, CLOSE_PARENTHESIS, BY, OPEN_PARENTHESIS, IDENTIFIER, COMMA, IDENTIFIER, CLOSE_PARENTHESIS, CLOSE_PARENTHESIS}},
 		{`sum(max(rate({foo="bar"}[5m])) by (foo,bar)) by (foo)`, []int{SUM, OPEN_PARENTHESIS, MAX, OPEN_PARENTHESIS, RATE, OPEN_PARENTHESIS, OPEN_BRACE, IDENTIFIER, EQ, STRING, CLOSE_BRACE, DURATION, CLOSE_PARENTHESIS, CLOSE_PARENTHESIS, BY, OPEN_PARENTHESIS, IDENTIFIER, COMMA, IDENTIFIER, CLOSE_PARENTHESIS, CLOSE_PARENTHESIS, BY, OPEN_PARENTHESIS, IDENTIFIER, CLOSE_PARENTHESIS}},
+		{`{foo="bar"} | json | status>=500`, []int{OPEN_BRACE, IDENTIFIER, EQ, STRING, CLOSE_BRACE, PIPE, JSON, PIPE, IDENTIFIER, GTE, NUMBER}},
+		{`{foo="bar"} | logfmt | latency > 1m30s or size <= 10KB`, []int{OPEN_BRACE, IDENTIFIER, EQ, STRING, CLOSE_BRACE, PIPE, LOGFMT, PIPE, IDENTIFIER, GT, DURATION_VALUE, OR, IDENTIFIER, LTE, BYTES_VALUE}},
+		{`{foo="bar"} | regexp "(?P<foo>.*)" | (foo="bar" and baz=~"b.*")`, []int{OPEN_BRACE, IDENTIFIER, EQ, STRING, CLOSE_BRACE, PIPE, REGEXP, STRING, PIPE, OPEN_PARENTHESIS, IDENTIFIER, EQ, STRING, AND, IDENTIFIER, RE, STRING, CLOSE_PARENTHESIS}},
 	} {
 		t.Run(tc.input, func(t *testing.T) {
 			actual := []int{}
@@ -36,6 +40,7 @@ func TestLex(t *testing.T) {
 				Scanner: scanner.Scanner{
 					Mode: scanner.SkipComments | scanner.ScanStrings,
 				},
+				input: tc.input,
 			}
 			l.Init(strings.NewReader(tc.input))
 			var lval exprSymType
@@ -50,3 +55,29 @@ func TestLex(t *testing.T) {
 		})
 	}
 }
+
+func TestLex_UnitAcrossBufferBoundary(t *testing.T) {
+	// the scanner reads its input by chunks of 1024 bytes, units must be read past them.
+	for pad := 990; pad < 1030; pad++ {
+		input := `{app="` + strings.Repeat("a", pad) + `"} | latency > 250ms and foo="bar"`
+		t.Run(strconv.Itoa(pad), func(t *testing.T) {
+			actual := []int{}
+			l := lexer{
+				Scanner: scanner.Scanner{
+					Mode: scanner.SkipComments | scanner.ScanStrings,
+				},
+				input: input,
+			}
+			l.Init(strings.NewReader(input))
+			var lval exprSymType
+			for {
+				tok := l.Lex(&lval)
+				if tok == 0 {
+					break
+				}
+				actual = append(actual, tok)
+			}
+			require.Equal(t, []int{OPEN_BRACE, IDENTIFIER, EQ, STRING, CLOSE_BRACE, PIPE, IDENTIFIER, GT, DURATION_VALUE, AND, IDENTIFIER, EQ, STRING}, actual)
+		})
+	}
+}
@@ -33,7 +33,8 @@ func NewMatrixStepper(start, end time.Time, step time.Duration, m promql.Matrix)
 
 func (m *MatrixStepper) Next() (bool, int64, promql.Vector) {
 	m.ts = m.ts.Add(m.step)
-	if !m.ts.Before(m.end) {
+	// like the range vector iterator, the end of the query is inclusive.
+	if m.ts.After(m.end) {
 		return false, 0, nil
 	}
 
@@ -43,14 +44,9 @@ func (m *MatrixStepper) Next() (bool, int64, promql.Vector) {
 	for i, series := range m.m {
 		ln := len(series.Points)
 
+		// series without a point for this step are skipped, as a range aggregation would do.
+		// Filling them would break aggregations like absent_over_time or max.
 		if ln == 0 || series.Points[0].T != ts {
-			vec = append(vec, promql.Sample{
-				Point: promql.Point{
-					T: ts,
-					V: 0,
-				},
-				Metric: series.Metric,
-			})
 			continue
 		}
 
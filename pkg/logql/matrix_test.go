@@ -45,20 +45,12 @@ func TestMatrixStepper(t *testing.T) {
 				Point:  promql.Point{T: start.UnixNano() / int64(step), V: 0},
 				Metric: labels.Labels{{Name: "foo", Value: "bar"}},
 			},
-			promql.Sample{
-				Point:  promql.Point{T: start.UnixNano() / int64(step), V: 0},
-				Metric: labels.Labels{{Name: "bazz", Value: "buzz"}},
-			},
 		},
 		{
 			promql.Sample{
 				Point:  promql.Point{T: start.Add(step).UnixNano() / int64(time.Millisecond), V: 1},
 				Metric: labels.Labels{{Name: "foo", Value: "bar"}},
 			},
-			promql.Sample{
-				Point:  promql.Point{T: start.Add(step).UnixNano() / int64(time.Millisecond), V: 0},
-				Metric: labels.Labels{{Name: "bazz", Value: "buzz"}},
-			},
 		},
 		{
 			promql.Sample{
@@ -75,10 +67,6 @@ func TestMatrixStepper(t *testing.T) {
 				Point:  promql.Point{T: start.Add(3*step).UnixNano() / int64(time.Millisecond), V: 3},
 				Metric: labels.Labels{{Name: "foo", Value: "bar"}},
 			},
-			promql.Sample{
-				Point:  promql.Point{T: start.Add(3*step).UnixNano() / int64(time.Millisecond), V: 0},
-				Metric: labels.Labels{{Name: "bazz", Value: "buzz"}},
-			},
 		},
 		{
 			promql.Sample{
@@ -95,14 +83,11 @@ func TestMatrixStepper(t *testing.T) {
 				Point:  promql.Point{T: start.Add(5*step).UnixNano() / int64(time.Millisecond), V: 5},
 				Metric: labels.Labels{{Name: "foo", Value: "bar"}},
 			},
-			promql.Sample{
-				Point:  promql.Point{T: start.Add(5*step).UnixNano() / int64(time.Millisecond), V: 0},
-				Metric: labels.Labels{{Name: "bazz", Value: "buzz"}},
-			},
 		},
+		{},
 	}
 
-	for i := 0; i < int(end.Sub(start)/step); i++ {
+	for i := 0; i <= int(end.Sub(start)/step); i++ {
 		ok, ts, vec := s.Next()
 		require.Equal(t, ok, true)
 		require.Equal(t, start.Add(step*time.Duration(i)).UnixNano()/int64(time.Millisecond), ts)
@@ -32,6 +32,7 @@ func ParseExpr(input string) (expr Expr, err error) {
 		}
 	}()
 	l := lexer{
+		input:  input,
 		parser: exprNewParser().(*exprParserImpl),
 	}
 	l.Init(strings.NewReader(input))
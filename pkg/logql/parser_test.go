@@ -1162,6 +1162,293 @@ func TestParse(t *testing.T) {
 				col:  1,
 			},
 		},
+		{
+			in: `{app="foo"} |= "bar" | json`,
+			exp: &parserExpr{
+				op: OpParserTypeJSON,
+				left: &filterExpr{
+					ty:    labels.MatchEqual,
+					match: "bar",
+					left:  &matchersExpr{matchers: []*labels.Matcher{mustNewMatcher(labels.MatchEqual, "app", "foo")}},
+				},
+			},
+		},
+		{
+			in: `{app="foo"} |= "bar" | unpack`,
+			exp: &parserExpr{
+				op: OpParserTypeUnpack,
+				left: &filterExpr{
+					ty:    labels.MatchEqual,
+					match: "bar",
+					left:  &matchersExpr{matchers: []*labels.Matcher{mustNewMatcher(labels.MatchEqual, "app", "foo")}},
+				},
+			},
+		},
+		{
+			in: `{app="foo"} | logfmt |~ "bar"`,
+			exp: &filterExpr{
+				ty:    labels.MatchRegexp,
+				match: "bar",
+				left: &parserExpr{
+					op:   OpParserTypeLogfmt,
+					left: &matchersExpr{matchers: []*labels.Matcher{mustNewMatcher(labels.MatchEqual, "app", "foo")}},
+				},
+			},
+		},
+		{
+			in: `count_over_time({app="foo"} | regexp "(?P<method>\\w+)" [5m])`,
+			exp: &rangeAggregationExpr{
+				operation: OpRangeTypeCount,
+				left: &logRange{
+					left: &parserExpr{
+						op:    OpParserTypeRegexp,
+						param: "(?P<method>\\w+)",
+						left:  &matchersExpr{matchers: []*labels.Matcher{mustNewMatcher(labels.MatchEqual, "app", "foo")}},
+					},
+					interval: 5 * time.Minute,
+				},
+			},
+		},
+		{
+			in: `{app="foo"} | regexp "(\\w+)"`,
+			err: ParseError{
+				msg: errMissingCapture.Error(),
+			},
+		},
+		{
+			in: `{app="foo"} | json | status>=500 and (duration<1m30s or size==10KB) | level="error"`,
+			exp: &labelFilterExpr{
+				filter: newStringLabelFilter(mustNewMatcher(labels.MatchEqual, "level", "error")),
+				left: &labelFilterExpr{
+					filter: newAndLabelFilter(
+						newNumericLabelFilter(LabelFilterGreaterThanOrEqual, "status", 500),
+						newOrLabelFilter(
+							newDurationLabelFilter(LabelFilterLesserThan, "duration", 90*time.Second),
+							newBytesLabelFilter(LabelFilterEqual, "size", 10000),
+						),
+					),
+					left: &parserExpr{
+						op:   OpParserTypeJSON,
+						left: &matchersExpr{matchers: []*labels.Matcher{mustNewMatcher(labels.MatchEqual, "app", "foo")}},
+					},
+				},
+			},
+		},
+		{
+			in: `{app="foo"} | logfmt | level="error" or level="warn" and status!=200`,
+			exp: &labelFilterExpr{
+				filter: newOrLabelFilter(
+					newStringLabelFilter(mustNewMatcher(labels.MatchEqual, "level", "error")),
+					newAndLabelFilter(
+						newStringLabelFilter(mustNewMatcher(labels.MatchEqual, "level", "warn")),
+						newNumericLabelFilter(LabelFilterNotEqual, "status", 200),
+					),
+				),
+				left: &parserExpr{
+					op:   OpParserTypeLogfmt,
+					left: &matchersExpr{matchers: []*labels.Matcher{mustNewMatcher(labels.MatchEqual, "app", "foo")}},
+				},
+			},
+		},
+		{
+			in: `{app="foo"} |= "bar" | json | line_format "{{.message}}" |= "buzz" | label_format dst=src,foo="{{.bar}}"`,
+			exp: &labelFmtExpr{
+				formats: []labelFmt{newRenameLabelFmt("dst", "src"), newTemplateLabelFmt("foo", "{{.bar}}")},
+				left: &filterExpr{
+					ty:    labels.MatchEqual,
+					match: "buzz",
+					left: &lineFmtExpr{
+						value: "{{.message}}",
+						left: &parserExpr{
+							op: OpParserTypeJSON,
+							left: &filterExpr{
+								ty:    labels.MatchEqual,
+								match: "bar",
+								left:  &matchersExpr{matchers: []*labels.Matcher{mustNewMatcher(labels.MatchEqual, "app", "foo")}},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			in: `{app="foo"} | line_format "{{.foo"`,
+			err: ParseError{
+				msg: `invalid line template: template: line:1: unclosed action`,
+			},
+		},
+		{
+			in: `{app="foo"} | label_format foo=bar,foo="{{.buzz}}"`,
+			err: ParseError{
+				msg: `multiple label name 'foo' not allowed in a single format operation`,
+			},
+		},
+		{
+			in: `quantile_over_time(0.99, {app="foo"} | json | unwrap latency | __error__="" [5m])`,
+			exp: &rangeAggregationExpr{
+				operation: OpRangeTypeQuantile,
+				params:    func() *float64 { v := 0.99; return &v }(),
+				left: &logRange{
+					left: &parserExpr{
+						op:   OpParserTypeJSON,
+						left: &matchersExpr{matchers: []*labels.Matcher{mustNewMatcher(labels.MatchEqual, "app", "foo")}},
+					},
+					interval: 5 * time.Minute,
+					unwrap: &unwrapExpr{
+						identifier:  "latency",
+						postFilters: []LabelFilterer{newStringLabelFilter(mustNewMatcher(labels.MatchEqual, ErrorLabel, ""))},
+					},
+				},
+			},
+		},
+		{
+			in: `count_over_time({app="api"}[5m] offset 1d)`,
+			exp: newRangeAggregationExpr(
+				&logRange{
+					left:     &matchersExpr{matchers: []*labels.Matcher{mustNewMatcher(labels.MatchEqual, "app", "api")}},
+					interval: 5 * time.Minute,
+					offset:   24 * time.Hour,
+				}, OpRangeTypeCount),
+		},
+		{
+			in: `sum_over_time({app="api"} | logfmt | unwrap latency [5m] offset 10m)`,
+			exp: newRangeAggregationExpr(
+				&logRange{
+					left: &parserExpr{
+						op:   OpParserTypeLogfmt,
+						left: &matchersExpr{matchers: []*labels.Matcher{mustNewMatcher(labels.MatchEqual, "app", "api")}},
+					},
+					interval: 5 * time.Minute,
+					offset:   10 * time.Minute,
+					unwrap:   newUnwrapExpr("latency"),
+				}, OpRangeTypeSum),
+		},
+		{
+			in: `count_over_time({app="api"}[5m] offset 1d |= "error")`,
+			exp: newRangeAggregationExpr(
+				&logRange{
+					left: &filterExpr{
+						left:  &matchersExpr{matchers: []*labels.Matcher{mustNewMatcher(labels.MatchEqual, "app", "api")}},
+						ty:    labels.MatchEqual,
+						match: "error",
+					},
+					interval: 5 * time.Minute,
+					offset:   24 * time.Hour,
+				}, OpRangeTypeCount),
+		},
+		{
+			in: `count_over_time({app="api"}[5m] offset)`,
+			err: ParseError{
+				msg:  `syntax error: unexpected ), expecting DURATION_VALUE`,
+				line: 1,
+				col:  39,
+			},
+		},
+		{
+			in: `sum_over_time({app="foo"} | logfmt [5m])`,
+			err: ParseError{
+				msg: `invalid aggregation sum_over_time without unwrap`,
+			},
+		},
+		{
+			in: `count_over_time({app="foo"} | logfmt | unwrap latency [5m])`,
+			err: ParseError{
+				msg: `invalid aggregation count_over_time with unwrap`,
+			},
+		},
+		{
+			in: `quantile_over_time({app="foo"} | unwrap latency [5m])`,
+			err: ParseError{
+				msg: `parameter required for operation quantile_over_time`,
+			},
+		},
+		{
+			in: `sum by (app,status) (count_over_time({app="foo"}[1m])) / ignoring(status) group_left(team) sum by (app,team) (count_over_time({app="foo"}[1m]))`,
+			exp: mustNewBinOpExpr(
+				OpTypeDiv,
+				BinOpOptions{
+					VectorMatching: &VectorMatching{Card: CardManyToOne, MatchingLabels: []string{"status"}, Include: []string{"team"}},
+				},
+				mustNewVectorAggregationExpr(newRangeAggregationExpr(
+					&logRange{
+						left:     &matchersExpr{matchers: []*labels.Matcher{mustNewMatcher(labels.MatchEqual, "app", "foo")}},
+						interval: time.Minute,
+					}, OpRangeTypeCount),
+					OpTypeSum,
+					&grouping{groups: []string{"app", "status"}},
+					nil,
+				),
+				mustNewVectorAggregationExpr(newRangeAggregationExpr(
+					&logRange{
+						left:     &matchersExpr{matchers: []*labels.Matcher{mustNewMatcher(labels.MatchEqual, "app", "foo")}},
+						interval: time.Minute,
+					}, OpRangeTypeCount),
+					OpTypeSum,
+					&grouping{groups: []string{"app", "team"}},
+					nil,
+				),
+			),
+		},
+		{
+			in: `count_over_time({app="foo"}[1m]) and on(app) group_left count_over_time({app="bar"}[1m])`,
+			err: ParseError{
+				msg: `no grouping allowed for "and" operation`,
+			},
+		},
+		{
+			in: `count_over_time({app="foo"}[1m]) + on(app) 1`,
+			err: ParseError{
+				msg: `vector matching only allowed between vectors`,
+			},
+		},
+		{
+			in: `count_over_time({app="foo"}[1m]) / on(app) group_left(app) count_over_time({app="bar"}[1m])`,
+			err: ParseError{
+				msg: `label "app" must not occur in ON and GROUP clause at once`,
+			},
+		},
+		{
+			in: `label_replace(rate({app="foo"}[1m]), "dst", "$1", "src", "(.*)")`,
+			exp: mustNewLabelReplaceExpr(
+				newRangeAggregationExpr(
+					&logRange{
+						left:     &matchersExpr{matchers: []*labels.Matcher{mustNewMatcher(labels.MatchEqual, "app", "foo")}},
+						interval: time.Minute,
+					}, OpRangeTypeRate),
+				"dst", "$1", "src", "(.*)",
+			),
+		},
+		{
+			in: `label_join(rate({app="foo"}[1m]), "dst", ",", "a", "b")`,
+			exp: mustNewLabelJoinExpr(
+				newRangeAggregationExpr(
+					&logRange{
+						left:     &matchersExpr{matchers: []*labels.Matcher{mustNewMatcher(labels.MatchEqual, "app", "foo")}},
+						interval: time.Minute,
+					}, OpRangeTypeRate),
+				"dst", ",", []string{"a", "b"},
+			),
+		},
+		{
+			in: `label_replace(rate({app="foo"}[1m]), "dst", "$1", "src", "(.*")`,
+			err: ParseError{
+				msg: "invalid regex in label_replace: error parsing regexp: missing closing ): `^(?:(.*)$`",
+			},
+		},
+		{
+			in: `label_join(rate({app="foo"}[1m]), "1dst", ",", "a")`,
+			err: ParseError{
+				msg: "invalid destination label name in label_join: 1dst",
+			},
+		},
+		{
+			in: `{app="foo"} | json bar`,
+			err: ParseError{
+				msg:  "syntax error: unexpected IDENTIFIER",
+				line: 1,
+				col:  20,
+			},
+		},
 	} {
 		t.Run(tc.in, func(t *testing.T) {
 			ast, err := ParseExpr(tc.in)
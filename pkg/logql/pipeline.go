@@ -0,0 +1,202 @@
+package logql
+
+import (
+	"github.com/cespare/xxhash/v2"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/grafana/loki/pkg/iter"
+	"github.com/grafana/loki/pkg/logproto"
+)
+
+// ErrorLabel is the label added to entries which could not be processed by a pipeline stage.
+const ErrorLabel = "__error__"
+
+// Stage is a step of a log pipeline applied to each line after the line filters.
+// It can add or remove labels using the builder, rewrite the line
+// or drop the entry entirely by returning false.
+type Stage interface {
+	Process(line []byte, lbs *labels.Builder) ([]byte, bool)
+}
+
+// StageFunc is a syntax sugar for creating a stage from a function.
+type StageFunc func(line []byte, lbs *labels.Builder) ([]byte, bool)
+
+func (f StageFunc) Process(line []byte, lbs *labels.Builder) ([]byte, bool) {
+	return f(line, lbs)
+}
+
+// Pipeline is a list of stages executed in order for each log line.
+type Pipeline []Stage
+
+// Process runs all stages of the pipeline. It stops as soon as a stage drops the line.
+func (p Pipeline) Process(line []byte, lbs *labels.Builder) ([]byte, bool) {
+	var ok bool
+	for _, s := range p {
+		line, ok = s.Process(line, lbs)
+		if !ok {
+			return nil, false
+		}
+	}
+	return line, true
+}
+
+// lineFilterStage applies a line filter as part of a pipeline.
+// This is used for line filters following a stage which modifies the line.
+type lineFilterStage struct {
+	LineFilter
+}
+
+func (s lineFilterStage) Process(line []byte, _ *labels.Builder) ([]byte, bool) {
+	return line, s.Filter(line)
+}
+
+// pipelineProcessor runs a pipeline for entries of any stream and keeps track of the resulting labels.
+type pipelineProcessor struct {
+	pipeline Pipeline
+	builder  *labels.Builder
+
+	// caches parsed streams labels and the string representation of resulting labels.
+	streams map[string]labels.Labels
+	results map[uint64]string
+}
+
+func newPipelineProcessor(p Pipeline) *pipelineProcessor {
+	return &pipelineProcessor{
+		pipeline: p,
+		builder:  labels.NewBuilder(nil),
+		streams:  map[string]labels.Labels{},
+		results:  map[uint64]string{},
+	}
+}
+
+// process returns the processed line and its labels, the last return value is false if the line was dropped.
+func (p *pipelineProcessor) process(line []byte, streamLabels string) ([]byte, string, bool) {
+	line, ok := p.processLine(line, streamLabels)
+	if !ok {
+		return nil, "", false
+	}
+	return line, p.labels(), true
+}
+
+// processLine runs the pipeline for a line, the resulting labels are kept in the builder until the next line.
+func (p *pipelineProcessor) processLine(line []byte, streamLabels string) ([]byte, bool) {
+	base, ok := p.streams[streamLabels]
+	if !ok {
+		var err error
+		base, err = parser.ParseMetric(streamLabels)
+		if err != nil {
+			// this should never happen, streams labels are always valid.
+			base = labels.Labels{}
+		}
+		p.streams[streamLabels] = base
+	}
+	p.builder.Reset(base)
+	return p.pipeline.Process(line, p.builder)
+}
+
+// labels returns the string representation of the labels of the last processed line.
+func (p *pipelineProcessor) labels() string {
+	lbs := p.builder.Labels()
+	h := lbs.Hash()
+	res, ok := p.results[h]
+	if !ok {
+		res = lbs.String()
+		p.results[h] = res
+	}
+	return res
+}
+
+type pipelineEntryIterator struct {
+	iter.EntryIterator
+	processor *pipelineProcessor
+
+	cur       logproto.Entry
+	curLabels string
+}
+
+// NewPipelineEntryIterator returns an iterator applying the pipeline to each entry of the given iterator.
+// Entries dropped by the pipeline are skipped and each distinct resulting label set is returned as its own stream.
+func NewPipelineEntryIterator(it iter.EntryIterator, p Pipeline) iter.EntryIterator {
+	if len(p) == 0 {
+		return it
+	}
+	return &pipelineEntryIterator{
+		EntryIterator: it,
+		processor:     newPipelineProcessor(p),
+	}
+}
+
+func (it *pipelineEntryIterator) Next() bool {
+	for it.EntryIterator.Next() {
+		entry := it.EntryIterator.Entry()
+		line, lbs, ok := it.processor.process([]byte(entry.Line), it.EntryIterator.Labels())
+		if !ok {
+			continue
+		}
+		it.cur = logproto.Entry{
+			Timestamp: entry.Timestamp,
+			Line:      string(line),
+		}
+		it.curLabels = lbs
+		return true
+	}
+	return false
+}
+
+func (it *pipelineEntryIterator) Entry() logproto.Entry { return it.cur }
+
+func (it *pipelineEntryIterator) Labels() string { return it.curLabels }
+
+type pipelineSampleIterator struct {
+	it        iter.EntryIterator
+	processor *pipelineProcessor
+	extractor SampleExtractor
+
+	cur       logproto.Sample
+	curLabels string
+}
+
+// NewPipelineSampleIterator returns a sample iterator extracting samples from entries processed by the pipeline.
+func NewPipelineSampleIterator(it iter.EntryIterator, p Pipeline, extractor SampleExtractor) iter.SampleIterator {
+	return &pipelineSampleIterator{
+		it:        it,
+		processor: newPipelineProcessor(p),
+		extractor: extractor,
+	}
+}
+
+func (it *pipelineSampleIterator) Next() bool {
+	for it.it.Next() {
+		entry := it.it.Entry()
+		line, ok := it.processor.processLine([]byte(entry.Line), it.it.Labels())
+		if !ok {
+			continue
+		}
+		var v float64
+		if e, isLabelsExtractor := it.extractor.(LabelsSampleExtractor); isLabelsExtractor {
+			v, ok = e.ExtractWithLabels(line, it.processor.builder)
+		} else {
+			v, ok = it.extractor.Extract(line)
+		}
+		if !ok {
+			continue
+		}
+		it.cur = logproto.Sample{
+			Timestamp: entry.Timestamp.UnixNano(),
+			Value:     v,
+			Hash:      xxhash.Sum64(line),
+		}
+		it.curLabels = it.processor.labels()
+		return true
+	}
+	return false
+}
+
+func (it *pipelineSampleIterator) Sample() logproto.Sample { return it.cur }
+
+func (it *pipelineSampleIterator) Labels() string { return it.curLabels }
+
+func (it *pipelineSampleIterator) Error() error { return it.it.Error() }
+
+func (it *pipelineSampleIterator) Close() error { return it.it.Close() }
@@ -0,0 +1,127 @@
+package logql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/pkg/iter"
+	"github.com/grafana/loki/pkg/logproto"
+)
+
+func Test_PipelineEntryIterator(t *testing.T) {
+	it := iter.NewStreamIterator(logproto.Stream{
+		Labels: `{app="foo"}`,
+		Entries: []logproto.Entry{
+			{Timestamp: time.Unix(0, 1), Line: `level=info msg=hello`},
+			{Timestamp: time.Unix(0, 2), Line: `level=error msg=world`},
+			{Timestamp: time.Unix(0, 3), Line: `level=info msg=bye`},
+		},
+	})
+	expr, err := ParseLogSelector(`{app="foo"} | logfmt`)
+	require.NoError(t, err)
+	p, err := expr.Pipeline()
+	require.NoError(t, err)
+
+	streams, err := readStreams(NewPipelineEntryIterator(it, p), 10, logproto.FORWARD, 0)
+	require.NoError(t, err)
+	require.Equal(t, Streams{
+		{
+			Labels: `{app="foo", level="error", msg="world"}`,
+			Entries: []logproto.Entry{
+				{Timestamp: time.Unix(0, 2), Line: `level=error msg=world`},
+			},
+		},
+		{
+			Labels: `{app="foo", level="info", msg="bye"}`,
+			Entries: []logproto.Entry{
+				{Timestamp: time.Unix(0, 3), Line: `level=info msg=bye`},
+			},
+		},
+		{
+			Labels: `{app="foo", level="info", msg="hello"}`,
+			Entries: []logproto.Entry{
+				{Timestamp: time.Unix(0, 1), Line: `level=info msg=hello`},
+			},
+		},
+	}, streams)
+}
+
+func Test_PipelineSampleIterator(t *testing.T) {
+	it := iter.NewStreamsIterator(context.Background(), []logproto.Stream{
+		{
+			Labels: `{app="foo"}`,
+			Entries: []logproto.Entry{
+				{Timestamp: time.Unix(0, 1), Line: `{"level":"info"}`},
+				{Timestamp: time.Unix(0, 2), Line: `{"level":"error"}`},
+				{Timestamp: time.Unix(0, 3), Line: `{"level":"info"}`},
+			},
+		},
+	}, logproto.FORWARD)
+	expr, err := ParseLogSelector(`{app="foo"} | json`)
+	require.NoError(t, err)
+	p, err := expr.Pipeline()
+	require.NoError(t, err)
+
+	sit := NewPipelineSampleIterator(it, p, ExtractCount)
+	var got []string
+	for sit.Next() {
+		require.Equal(t, 1., sit.Sample().Value)
+		got = append(got, sit.Labels())
+	}
+	require.NoError(t, sit.Error())
+	require.Equal(t, []string{`{app="foo", level="info"}`, `{app="foo", level="error"}`, `{app="foo", level="info"}`}, got)
+}
+
+func Test_PipelineSampleIterator_Unwrap(t *testing.T) {
+	it := iter.NewStreamsIterator(context.Background(), []logproto.Stream{
+		{
+			Labels: `{app="foo"}`,
+			Entries: []logproto.Entry{
+				{Timestamp: time.Unix(0, 1), Line: `level=info latency=0.5`},
+				{Timestamp: time.Unix(0, 2), Line: `level=info latency=foo`},
+				{Timestamp: time.Unix(0, 3), Line: `level=error latency=1.25`},
+				{Timestamp: time.Unix(0, 4), Line: `level=info`},
+			},
+		},
+	}, logproto.FORWARD)
+	expr, err := ParseSampleExpr(`sum_over_time({app="foo"} | logfmt | unwrap latency | level="info" [1m])`)
+	require.NoError(t, err)
+	p, err := expr.Selector().Pipeline()
+	require.NoError(t, err)
+	extractor, err := expr.Extractor()
+	require.NoError(t, err)
+	require.True(t, NeedsPipeline(p, extractor))
+
+	sit := NewPipelineSampleIterator(it, p, extractor)
+	var (
+		values []float64
+		lbs    []string
+	)
+	for sit.Next() {
+		values = append(values, sit.Sample().Value)
+		lbs = append(lbs, sit.Labels())
+	}
+	require.NoError(t, sit.Error())
+	require.Equal(t, []float64{0.5, 0, 0}, values)
+	require.Equal(t, []string{
+		`{app="foo", level="info"}`,
+		`{__error__="SampleExtractionErr", app="foo", level="info"}`,
+		`{__error__="SampleExtractionErr", app="foo", level="info"}`,
+	}, lbs)
+}
+
+func Test_NeedsPipeline(t *testing.T) {
+	expr, err := ParseSampleExpr(`max_over_time({app="foo"} | unwrap latency [1m])`)
+	require.NoError(t, err)
+	p, err := expr.Selector().Pipeline()
+	require.NoError(t, err)
+	require.Len(t, p, 0)
+	extractor, err := expr.Extractor()
+	require.NoError(t, err)
+	require.True(t, NeedsPipeline(p, extractor))
+
+	require.False(t, NeedsPipeline(nil, ExtractCount))
+}
@@ -27,6 +27,7 @@ type RangeVectorIterator interface {
 type rangeVectorIterator struct {
 	iter                         iter.PeekingSampleIterator
 	selRange, step, end, current int64
+	offset                       int64
 	window                       map[string]*promql.Series
 	metrics                      map[string]labels.Labels
 	at                           []promql.Sample
@@ -34,7 +35,7 @@ type rangeVectorIterator struct {
 
 func newRangeVectorIterator(
 	it iter.PeekingSampleIterator,
-	selRange, step, start, end int64) *rangeVectorIterator {
+	selRange, step, start, end, offset int64) *rangeVectorIterator {
 	// forces at least one step.
 	if step == 0 {
 		step = 1
@@ -44,6 +45,7 @@ func newRangeVectorIterator(
 		step:     step,
 		end:      end,
 		selRange: selRange,
+		offset:   offset,
 		current:  start - step, // first loop iteration will set it to start
 		window:   map[string]*promql.Series{},
 		metrics:  map[string]labels.Labels{},
@@ -56,8 +58,9 @@ func (r *rangeVectorIterator) Next() bool {
 	if r.current > r.end {
 		return false
 	}
-	rangeEnd := r.current
-	rangeStart := r.current - r.selRange
+	// the window is shifted back by the offset, samples are still reported at the current step.
+	rangeEnd := r.current - r.offset
+	rangeStart := rangeEnd - r.selRange
 	// load samples
 	r.popBack(rangeStart)
 	r.load(rangeStart, rangeEnd)
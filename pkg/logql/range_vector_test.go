@@ -3,6 +3,8 @@ package logql
 import (
 	"context"
 	"fmt"
+	"math"
+	"strings"
 	"testing"
 	"time"
 
@@ -149,7 +151,7 @@ func Test_RangeVectorIterator(t *testing.T) {
 			fmt.Sprintf("logs[%s] - step: %s", time.Duration(tt.selRange), time.Duration(tt.step)),
 			func(t *testing.T) {
 				it := newRangeVectorIterator(newfakePeekingSampleIterator(), tt.selRange,
-					tt.step, tt.start.UnixNano(), tt.end.UnixNano())
+					tt.step, tt.start.UnixNano(), tt.end.UnixNano(), 0)
 
 				i := 0
 				for it.Next() {
@@ -163,3 +165,70 @@ func Test_RangeVectorIterator(t *testing.T) {
 			})
 	}
 }
+
+func Test_RangeVectorIteratorOffset(t *testing.T) {
+	it := newRangeVectorIterator(newfakePeekingSampleIterator(),
+		(5 * time.Second).Nanoseconds(),
+		(30 * time.Second).Nanoseconds(),
+		time.Unix(40, 0).UnixNano(), time.Unix(130, 0).UnixNano(),
+		(30 * time.Second).Nanoseconds(),
+	)
+
+	// windows are shifted back by 30s but vectors are still reported at the step timestamp.
+	expected := []promql.Vector{
+		{
+			{Point: newPoint(time.Unix(40, 0), 2), Metric: labelBar},
+			{Point: newPoint(time.Unix(40, 0), 2), Metric: labelFoo},
+		},
+		{
+			{Point: newPoint(time.Unix(70, 0), 2), Metric: labelBar},
+			{Point: newPoint(time.Unix(70, 0), 2), Metric: labelFoo},
+		},
+		{},
+		{
+			{Point: newPoint(time.Unix(130, 0), 1), Metric: labelBar},
+			{Point: newPoint(time.Unix(130, 0), 1), Metric: labelFoo},
+		},
+	}
+	expectedTs := []time.Time{time.Unix(40, 0), time.Unix(70, 0), time.Unix(100, 0), time.Unix(130, 0)}
+
+	i := 0
+	for it.Next() {
+		ts, v := it.At(countOverTime)
+		require.ElementsMatch(t, expected[i], v)
+		require.Equal(t, expectedTs[i].UnixNano()/1e+6, ts)
+		i++
+	}
+	require.Equal(t, len(expectedTs), i)
+}
+
+func Test_RangeAggregations(t *testing.T) {
+	points := []promql.Point{{T: 1, V: 4}, {T: 2, V: 1}, {T: 3, V: 3}, {T: 4, V: 2}}
+	for _, tc := range []struct {
+		op   string
+		want float64
+	}{
+		{`sum_over_time`, 10},
+		{`avg_over_time`, 2.5},
+		{`min_over_time`, 1},
+		{`max_over_time`, 4},
+		{`stdvar_over_time`, 1.25},
+		{`stddev_over_time`, math.Sqrt(1.25)},
+		{`quantile_over_time(0.5,`, 2.5},
+		{`quantile_over_time(0.99,`, 3.97},
+		{`first_over_time`, 4},
+		{`last_over_time`, 2},
+	} {
+		t.Run(tc.op, func(t *testing.T) {
+			query := fmt.Sprintf(`%s({app="foo"} | unwrap latency [1m])`, tc.op)
+			if strings.HasSuffix(tc.op, ",") {
+				query = fmt.Sprintf(`%s {app="foo"} | unwrap latency [1m])`, tc.op)
+			}
+			expr, err := ParseSampleExpr(query)
+			require.NoError(t, err)
+			agg, err := expr.(*rangeAggregationExpr).aggregator()
+			require.NoError(t, err)
+			require.InDelta(t, tc.want, agg(points), 1e-9)
+		})
+	}
+}
@@ -1,16 +1,41 @@
 package logql
 
+import (
+	"strconv"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
 var (
 	ExtractBytes = bytesSampleExtractor{}
 	ExtractCount = countSampleExtractor{}
 )
 
+const errSampleExtraction = "SampleExtractionErr"
+
 // SampleExtractor transforms a log entry into a sample.
 // In case of failure the second return value will be false.
 type SampleExtractor interface {
 	Extract(line []byte) (float64, bool)
 }
 
+// LabelsSampleExtractor transforms a log entry processed by a pipeline into a sample using its labels.
+// The labels builder can be modified, in which case the sample is returned with the modified labels.
+// In case of failure the second return value will be false.
+type LabelsSampleExtractor interface {
+	ExtractWithLabels(line []byte, lbs *labels.Builder) (float64, bool)
+}
+
+// NeedsPipeline returns true if samples must be extracted from entries processed by the pipeline
+// instead of being extracted directly from chunks.
+func NeedsPipeline(p Pipeline, extractor SampleExtractor) bool {
+	if len(p) > 0 {
+		return true
+	}
+	_, ok := extractor.(LabelsSampleExtractor)
+	return ok
+}
+
 type countSampleExtractor struct{}
 
 func (countSampleExtractor) Extract(line []byte) (float64, bool) {
@@ -22,3 +47,41 @@ type bytesSampleExtractor struct{}
 func (bytesSampleExtractor) Extract(line []byte) (float64, bool) {
 	return float64(len(line)), true
 }
+
+type labelSampleExtractor struct {
+	labelName   string
+	postFilters []LabelFilterer
+}
+
+// newLabelSampleExtractor creates an extractor using the value of a label as the sample value.
+// The label is removed from the resulting series and post filters are applied once the value is converted.
+func newLabelSampleExtractor(labelName string, postFilters []LabelFilterer) *labelSampleExtractor {
+	return &labelSampleExtractor{
+		labelName:   labelName,
+		postFilters: postFilters,
+	}
+}
+
+// Extract can't extract a sample without labels, entries must be processed by a pipeline first.
+func (l *labelSampleExtractor) Extract(_ []byte) (float64, bool) {
+	return 0, false
+}
+
+func (l *labelSampleExtractor) ExtractWithLabels(line []byte, lbs *labels.Builder) (float64, bool) {
+	var v float64
+	if !hasError(lbs) {
+		var err error
+		v, err = strconv.ParseFloat(lbs.Labels().Get(l.labelName), 64)
+		if err != nil {
+			v = 0
+			lbs.Set(ErrorLabel, errSampleExtraction)
+		}
+	}
+	for _, f := range l.postFilters {
+		if _, ok := f.Process(line, lbs); !ok {
+			return 0, false
+		}
+	}
+	lbs.Del(l.labelName)
+	return v, true
+}
@@ -44,6 +44,12 @@ func TestMappingEquivalence(t *testing.T) {
 		{`sum(max(rate({a=~".*"}[1s])))`, false},
 		{`max(count(rate({a=~".*"}[1s])))`, false},
 		{`max(sum by (cluster) (rate({a=~".*"}[1s]))) / count(rate({a=~".*"}[1s]))`, false},
+		{`absent_over_time({a="1"}[1s])`, false},
+		{`label_replace(sum by (a) (rate({a=~".*"}[1s])), "b", "$1-b", "a", "(.*)")`, false},
+		{`sum by (dst) (label_join(rate({a=~".*"}[1s]), "dst", "-", "a", "b"))`, false},
+		{`absent_over_time({a="foo"}[1s])`, false},
+		{`sum(absent_over_time({a=~".*"}[1s]))`, false},
+		{`sum by (a) (rate({a=~".*"}[1s] offset 1m))`, false},
 		// topk prefers already-seen values in tiebreakers. Since the test data generates
 		// the same log lines for each series & the resulting promql.Vectors aren't deterministically
 		// sorted by labels, we don't expect this to pass.
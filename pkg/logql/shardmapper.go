@@ -129,12 +129,30 @@ func (m ShardMapper) Map(expr Expr, r *shardRecorder) (Expr, error) {
 	switch e := expr.(type) {
 	case *literalExpr:
 		return e, nil
-	case *matchersExpr, *filterExpr:
+	case *matchersExpr, *filterExpr, *parserExpr, *labelFilterExpr, *lineFmtExpr, *labelFmtExpr:
 		return m.mapLogSelectorExpr(e.(LogSelectorExpr), r), nil
 	case *vectorAggregationExpr:
 		return m.mapVectorAggregationExpr(e, r)
 	case *rangeAggregationExpr:
 		return m.mapRangeAggregationExpr(e, r), nil
+	case *labelReplaceExpr:
+		// label_replace is applied on the merged results, only its argument is sharded.
+		leftMapped, err := m.mapSampleExprArg(e.left, r)
+		if err != nil {
+			return nil, err
+		}
+		mapped := *e
+		mapped.left = leftMapped
+		return &mapped, nil
+	case *labelJoinExpr:
+		// label_join is applied on the merged results, only its argument is sharded.
+		leftMapped, err := m.mapSampleExprArg(e.left, r)
+		if err != nil {
+			return nil, err
+		}
+		mapped := *e
+		mapped.left = leftMapped
+		return &mapped, nil
 	case *binOpExpr:
 		lhsMapped, err := m.Map(e.SampleExpr, r)
 		if err != nil {
@@ -160,6 +178,18 @@ func (m ShardMapper) Map(expr Expr, r *shardRecorder) (Expr, error) {
 	}
 }
 
+func (m ShardMapper) mapSampleExprArg(expr SampleExpr, r *shardRecorder) (SampleExpr, error) {
+	mapped, err := m.Map(expr, r)
+	if err != nil {
+		return nil, err
+	}
+	sampleExpr, ok := mapped.(SampleExpr)
+	if !ok {
+		return nil, badASTMapping("SampleExpr", mapped)
+	}
+	return sampleExpr, nil
+}
+
 func (m ShardMapper) mapLogSelectorExpr(expr LogSelectorExpr, r *shardRecorder) LogSelectorExpr {
 	var head *ConcatLogSelectorExpr
 	for i := m.shards - 1; i >= 0; i-- {
@@ -279,13 +309,16 @@ func (m ShardMapper) mapVectorAggregationExpr(expr *vectorAggregationExpr, r *sh
 
 func (m ShardMapper) mapRangeAggregationExpr(expr *rangeAggregationExpr, r *shardRecorder) SampleExpr {
 	switch expr.operation {
-	case OpRangeTypeCount, OpRangeTypeRate, OpRangeTypeBytesRate, OpRangeTypeBytes:
+	case OpRangeTypeCount, OpRangeTypeRate, OpRangeTypeBytesRate, OpRangeTypeBytes, OpRangeTypeSum:
 		// count_over_time(x) -> count_over_time(x, shard=1) ++ count_over_time(x, shard=2)...
 		// rate(x) -> rate(x, shard=1) ++ rate(x, shard=2)...
-		// same goes for bytes_rate and bytes_over_time
+		// same goes for bytes_rate, bytes_over_time and sum_over_time
 		return m.mapSampleExpr(expr, r)
 	default:
-		return expr
+		// unshardable range aggregations, e.g absent_over_time, are executed downstream on all shards at once.
+		return DownstreamSampleExpr{
+			SampleExpr: expr,
+		}
 	}
 }
 
@@ -328,6 +361,7 @@ var shardableOps = map[string]bool{
 	OpRangeTypeRate:      true,
 	OpRangeTypeBytes:     true,
 	OpRangeTypeBytesRate: true,
+	OpRangeTypeSum:       true,
 
 	// binops - arith
 	OpTypeAdd: true,
@@ -154,6 +154,26 @@ func TestMappingStrings(t *testing.T) {
 			in:  `sum by (cluster) (rate({foo="bar"} |= "id=123" [5m]))`,
 			out: `sum by(cluster)(downstream<sum by(cluster)(rate({foo="bar"}|="id=123"[5m])), shard=0_of_2> ++ downstream<sum by(cluster)(rate({foo="bar"}|="id=123"[5m])), shard=1_of_2>)`,
 		},
+		{
+			in:  `{foo="bar"} | json | status>=500`,
+			out: `downstream<{foo="bar"} | json | status>=500, shard=0_of_2> ++ downstream<{foo="bar"} | json | status>=500, shard=1_of_2>`,
+		},
+		{
+			in:  `sum by (status) (rate({foo="bar"} | logfmt | level="error" [5m]))`,
+			out: `sum by(status)(downstream<sum by(status)(rate({foo="bar"} | logfmt | level="error"[5m])), shard=0_of_2> ++ downstream<sum by(status)(rate({foo="bar"} | logfmt | level="error"[5m])), shard=1_of_2>)`,
+		},
+		{
+			in:  `label_replace(sum by (cluster) (rate({foo="bar"}[5m])), "dst", "$1", "cluster", "(.*)")`,
+			out: `label_replace(sum by(cluster)(downstream<sum by(cluster)(rate({foo="bar"}[5m])), shard=0_of_2> ++ downstream<sum by(cluster)(rate({foo="bar"}[5m])), shard=1_of_2>),"dst","$1","cluster","(.*)")`,
+		},
+		{
+			in:  `sum(label_join(rate({foo="bar"}[5m]), "dst", "-", "a", "b"))`,
+			out: `sum(label_join(downstream<rate({foo="bar"}[5m]), shard=0_of_2> ++ downstream<rate({foo="bar"}[5m]), shard=1_of_2>,"dst","-","a","b"))`,
+		},
+		{
+			in:  `sum(absent_over_time({foo="bar"}[5m]))`,
+			out: `sum(downstream<absent_over_time({foo="bar"}[5m]), shard=<nil>>)`,
+		},
 	} {
 		t.Run(tc.in, func(t *testing.T) {
 			ast, err := ParseExpr(tc.in)
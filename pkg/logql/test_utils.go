@@ -37,6 +37,10 @@ func (q MockQuerier) SelectLogs(ctx context.Context, req SelectLogParams) (iter.
 	if err != nil {
 		return nil, err
 	}
+	pipeline, err := expr.Pipeline()
+	if err != nil {
+		return nil, err
+	}
 
 	matchers := expr.Matchers()
 
@@ -68,33 +72,13 @@ outer:
 		matched = append(matched, stream)
 	}
 
-	// apply the LineFilter
-	filtered := make([]logproto.Stream, 0, len(matched))
-	if filter == nil || filter == TrueFilter {
-		filtered = matched
-	} else {
-		for _, s := range matched {
-			var entries []logproto.Entry
-			for _, entry := range s.Entries {
-				if filter.Filter([]byte(entry.Line)) {
-					entries = append(entries, entry)
-				}
-			}
-
-			if len(entries) > 0 {
-				filtered = append(filtered, logproto.Stream{
-					Labels:  s.Labels,
-					Entries: entries,
-				})
-			}
-		}
-
-	}
-
-	return iter.NewTimeRangedIterator(
-		iter.NewStreamsIterator(ctx, filtered, req.Direction),
-		req.Start,
-		req.End,
+	return NewPipelineEntryIterator(
+		iter.NewTimeRangedIterator(
+			iter.NewStreamsIterator(ctx, applyLineFilter(matched, filter), req.Direction),
+			req.Start,
+			req.End,
+		),
+		pipeline,
 	), nil
 }
 
@@ -107,6 +91,10 @@ func (q MockQuerier) SelectSamples(ctx context.Context, req SelectSampleParams)
 	if err != nil {
 		return nil, err
 	}
+	pipeline, err := selector.Pipeline()
+	if err != nil {
+		return nil, err
+	}
 	expr, err := req.Expr()
 	if err != nil {
 		return nil, err
@@ -147,6 +135,18 @@ outer:
 		matched = append(matched, stream)
 	}
 
+	if NeedsPipeline(pipeline, extractor) {
+		return NewPipelineSampleIterator(
+			iter.NewTimeRangedIterator(
+				iter.NewStreamsIterator(ctx, applyLineFilter(matched, filter), logproto.FORWARD),
+				req.Start,
+				req.End,
+			),
+			pipeline,
+			extractor,
+		), nil
+	}
+
 	// apply the LineFilter
 	filtered := make([]logproto.Series, 0, len(matched))
 	for _, s := range matched {
@@ -180,6 +180,30 @@ outer:
 	), nil
 }
 
+// applyLineFilter returns streams with only the entries matching the LineFilter.
+func applyLineFilter(matched []logproto.Stream, filter LineFilter) []logproto.Stream {
+	if filter == nil || filter == TrueFilter {
+		return matched
+	}
+	filtered := make([]logproto.Stream, 0, len(matched))
+	for _, s := range matched {
+		var entries []logproto.Entry
+		for _, entry := range s.Entries {
+			if filter.Filter([]byte(entry.Line)) {
+				entries = append(entries, entry)
+			}
+		}
+
+		if len(entries) > 0 {
+			filtered = append(filtered, logproto.Stream{
+				Labels:  s.Labels,
+				Entries: entries,
+			})
+		}
+	}
+	return filtered
+}
+
 type MockDownstreamer struct {
 	*Engine
 }
@@ -31,7 +31,9 @@ import (
 	"github.com/grafana/loki/pkg/ingester/client"
 	"github.com/grafana/loki/pkg/querier"
 	"github.com/grafana/loki/pkg/querier/queryrange"
+	"github.com/grafana/loki/pkg/ruler"
 	"github.com/grafana/loki/pkg/storage"
+	"github.com/grafana/loki/pkg/storage/stores/local"
 	"github.com/grafana/loki/pkg/tracing"
 	serverutil "github.com/grafana/loki/pkg/util/server"
 	"github.com/grafana/loki/pkg/util/validation"
@@ -56,7 +58,9 @@ type Config struct {
 	Worker           frontend.WorkerConfig       `yaml:"frontend_worker,omitempty"`
 	Frontend         frontend.Config             `yaml:"frontend,omitempty"`
 	QueryRange       queryrange.Config           `yaml:"query_range,omitempty"`
+	Ruler            ruler.Config                `yaml:"ruler,omitempty"`
 	RuntimeConfig    runtimeconfig.ManagerConfig `yaml:"runtime_config,omitempty"`
+	CompactorConfig  local.CompactorConfig       `yaml:"compactor,omitempty"`
 	MemberlistKV     memberlist.KVConfig         `yaml:"memberlist"`
 	Tracing          tracing.Config              `yaml:"tracing"`
 }
@@ -82,7 +86,9 @@ func (c *Config) RegisterFlags(f *flag.FlagSet) {
 	c.Frontend.RegisterFlags(f)
 	c.Worker.RegisterFlags(f)
 	c.QueryRange.RegisterFlags(f)
+	c.Ruler.RegisterFlags(f)
 	c.RuntimeConfig.RegisterFlags(f)
+	c.CompactorConfig.RegisterFlags(f)
 	c.MemberlistKV.RegisterFlags(f, "")
 	c.Tracing.RegisterFlags(f)
 }
@@ -102,6 +108,9 @@ func (c *Config) Validate(log log.Logger) error {
 	if err := c.TableManager.Validate(); err != nil {
 		return errors.Wrap(err, "invalid tablemanager config")
 	}
+	if err := c.Ingester.Validate(); err != nil {
+		return errors.Wrap(err, "invalid ingester config")
+	}
 	return nil
 }
 
@@ -125,6 +134,8 @@ type Loki struct {
 	stopper       queryrange.Stopper
 	runtimeConfig *runtimeconfig.Manager
 	memberlistKV  *memberlist.KVInitService
+	ruler         *ruler.Ruler
+	compactor     *local.Compactor
 
 	httpAuthMiddleware middleware.Interface
 }
@@ -295,6 +306,8 @@ func (t *Loki) setupModuleManager() error {
 	mm.RegisterModule(Querier, t.initQuerier)
 	mm.RegisterModule(QueryFrontend, t.initQueryFrontend)
 	mm.RegisterModule(TableManager, t.initTableManager)
+	mm.RegisterModule(Ruler, t.initRuler)
+	mm.RegisterModule(Compactor, t.initCompactor)
 	mm.RegisterModule(All, nil)
 
 	// Add dependencies
@@ -307,6 +320,8 @@ func (t *Loki) setupModuleManager() error {
 		Querier:       {Store, Ring, Server},
 		QueryFrontend: {Server, Overrides},
 		TableManager:  {Server},
+		Ruler:         {Ring, Server, Store, Overrides},
+		Compactor:     {Server, Overrides},
 		All:           {Querier, Ingester, Distributor, TableManager},
 	}
 
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/objectclient"
 	"github.com/cortexproject/cortex/pkg/chunk/storage"
 	"github.com/cortexproject/cortex/pkg/cortex"
 	cortex_querier "github.com/cortexproject/cortex/pkg/querier"
@@ -31,15 +32,23 @@ import (
 	"github.com/grafana/loki/pkg/distributor"
 	"github.com/grafana/loki/pkg/ingester"
 	"github.com/grafana/loki/pkg/logproto"
+	"github.com/grafana/loki/pkg/logql"
 	"github.com/grafana/loki/pkg/querier"
 	"github.com/grafana/loki/pkg/querier/queryrange"
+	"github.com/grafana/loki/pkg/ruler"
 	loki_storage "github.com/grafana/loki/pkg/storage"
+	"github.com/grafana/loki/pkg/storage/stores/deletion"
 	"github.com/grafana/loki/pkg/storage/stores/local"
 	serverutil "github.com/grafana/loki/pkg/util/server"
 	"github.com/grafana/loki/pkg/util/validation"
 )
 
-const maxChunkAgeForTableManager = 12 * time.Hour
+const (
+	maxChunkAgeForTableManager = 12 * time.Hour
+
+	// how long queriers keep the delete requests of a tenant before fetching them again.
+	deleteRequestsCacheTTL = time.Minute
+)
 
 // The various modules that make up Loki.
 const (
@@ -54,6 +63,8 @@ const (
 	Store         string = "store"
 	TableManager  string = "table-manager"
 	MemberlistKV  string = "memberlist-kv"
+	Ruler         string = "ruler"
+	Compactor     string = "compactor"
 	All           string = "all"
 )
 
@@ -254,7 +265,21 @@ func (t *Loki) initStore() (_ services.Service, err error) {
 		}
 	}
 
-	t.store, err = loki_storage.NewStore(t.cfg.StorageConfig, t.cfg.ChunkStoreConfig, t.cfg.SchemaConfig, t.overrides, prometheus.DefaultRegisterer)
+	// the logs of delete requests are filtered out of the queries until the compactor deleted them.
+	var deleteRequests deletion.DeleteRequestsGetter
+	if t.cfg.CompactorConfig.DeletionEnabled && activePeriodConfig(t.cfg.SchemaConfig).IndexType == local.BoltDBShipperType {
+		sharedStoreType := t.cfg.CompactorConfig.SharedStoreType
+		if sharedStoreType == "" {
+			sharedStoreType = t.cfg.StorageConfig.BoltDBShipperConfig.SharedStoreType
+		}
+		objectClient, err := loki_storage.NewObjectClient(sharedStoreType, t.cfg.StorageConfig)
+		if err != nil {
+			return nil, err
+		}
+		deleteRequests = deletion.NewCachedGetter(deletion.NewDeleteRequestsStore(objectClient), deleteRequestsCacheTTL)
+	}
+
+	t.store, err = loki_storage.NewStore(t.cfg.StorageConfig, t.cfg.ChunkStoreConfig, t.cfg.SchemaConfig, t.overrides, deleteRequests, prometheus.DefaultRegisterer)
 	if err != nil {
 		return
 	}
@@ -319,6 +344,91 @@ func (t *Loki) initQueryFrontend() (_ services.Service, err error) {
 	}), nil
 }
 
+func (t *Loki) initRuler() (_ services.Service, err error) {
+	q, err := querier.New(t.cfg.Querier, t.cfg.IngesterClient, t.ring, t.store, t.overrides)
+	if err != nil {
+		return nil, err
+	}
+	engine := logql.NewEngine(t.cfg.Querier.Engine, q)
+
+	t.ruler, err = ruler.NewRuler(
+		t.cfg.Ruler,
+		engine,
+		ruler.NewLocalRuleStore(t.cfg.Ruler.RulePath),
+		t.overrides,
+		prometheus.DefaultRegisterer,
+		util.Logger,
+	)
+	if err != nil {
+		return
+	}
+
+	httpMiddleware := middleware.Merge(
+		serverutil.RecoveryHTTPMiddleware,
+		t.httpAuthMiddleware,
+	)
+	t.server.HTTP.Handle("/prometheus/api/v1/rules", httpMiddleware.Wrap(http.HandlerFunc(t.ruler.RulesHandler)))
+	t.server.HTTP.Handle("/prometheus/api/v1/alerts", httpMiddleware.Wrap(http.HandlerFunc(t.ruler.AlertsHandler)))
+	return t.ruler, nil
+}
+
+func (t *Loki) initCompactor() (_ services.Service, err error) {
+	if err := t.cfg.CompactorConfig.Validate(); err != nil {
+		return nil, err
+	}
+
+	objectClient, err := loki_storage.NewObjectClient(t.cfg.CompactorConfig.SharedStoreType, t.cfg.StorageConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// chunks are read, written and deleted in the object store of the schema period they start in.
+	var chunkClients []local.PeriodChunkClient
+	objectTypeClients := map[string]local.ChunkClient{}
+	for _, period := range t.cfg.SchemaConfig.Configs {
+		objectType := period.ObjectType
+		if objectType == "" {
+			objectType = period.IndexType
+		}
+		chunkClient, ok := objectTypeClients[objectType]
+		if !ok {
+			chunkObjectClient, err := loki_storage.NewObjectClient(objectType, t.cfg.StorageConfig)
+			if err != nil {
+				return nil, err
+			}
+			var keyEncoder objectclient.KeyEncoder
+			if objectType == local.FilesystemObjectStoreType {
+				keyEncoder = objectclient.Base64Encoder
+			}
+			chunkClient = local.NewChunkObjectClient(chunkObjectClient, keyEncoder)
+			objectTypeClients[objectType] = chunkClient
+		}
+		chunkClients = append(chunkClients, local.PeriodChunkClient{From: period.From.Time, Client: chunkClient})
+	}
+
+	var deleteRequestsStore deletion.DeleteRequestsStore
+	if t.cfg.CompactorConfig.DeletionEnabled {
+		deleteRequestsStore = deletion.NewDeleteRequestsStore(objectClient)
+		deleteRequestHandler := deletion.NewDeleteRequestHandler(deleteRequestsStore, t.cfg.CompactorConfig.DeleteRequestCancelPeriod)
+
+		httpMiddleware := middleware.Merge(
+			serverutil.RecoveryHTTPMiddleware,
+			t.httpAuthMiddleware,
+			serverutil.NewPrepopulateMiddleware(),
+		)
+		t.server.HTTP.Path("/loki/api/v1/delete").Methods("PUT", "POST").Handler(httpMiddleware.Wrap(http.HandlerFunc(deleteRequestHandler.AddDeleteRequestHandler)))
+		t.server.HTTP.Path("/loki/api/v1/delete").Methods("GET").Handler(httpMiddleware.Wrap(http.HandlerFunc(deleteRequestHandler.GetAllDeleteRequestsHandler)))
+		t.server.HTTP.Path("/loki/api/v1/delete").Methods("DELETE").Handler(httpMiddleware.Wrap(http.HandlerFunc(deleteRequestHandler.CancelDeleteRequestHandler)))
+	}
+
+	t.compactor, err = local.NewCompactor(t.cfg.CompactorConfig, objectClient, t.overrides, local.NewPeriodsChunkClient(chunkClients), deleteRequestsStore, prometheus.DefaultRegisterer)
+	if err != nil {
+		return
+	}
+
+	return t.compactor, nil
+}
+
 func (t *Loki) initMemberlistKV() (services.Service, error) {
 	t.cfg.MemberlistKV.MetricsRegisterer = prometheus.DefaultRegisterer
 	t.cfg.MemberlistKV.Codecs = []codec.Codec{
@@ -11,6 +11,19 @@ type EntryHandler interface {
 	Handle(labels model.LabelSet, time time.Time, entry string) error
 }
 
+// StoppableEntryHandler is an EntryHandler which can hold entries, they are handled once it is stopped.
+type StoppableEntryHandler interface {
+	EntryHandler
+	Stop()
+}
+
+// StopEntryHandler stops the handler if it can hold entries, once no more entries are given to it.
+func StopEntryHandler(handler EntryHandler) {
+	if s, ok := handler.(StoppableEntryHandler); ok {
+		s.Stop()
+	}
+}
+
 // EntryHandlerFunc is modelled on http.HandlerFunc.
 type EntryHandlerFunc func(labels model.LabelSet, time time.Time, entry string) error
 
@@ -347,6 +347,8 @@ func (s *targetSyncer) stop() {
 		target.Stop()
 		delete(s.targets, key)
 	}
+	// the entries held by the pipeline are sent once no more entries are read.
+	api.StopEntryHandler(s.entryHandler)
 }
 
 func hostname() (string, error) {
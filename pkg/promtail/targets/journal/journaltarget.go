@@ -326,7 +326,9 @@ func (t *JournalTarget) Details() interface{} {
 // Stop shuts down the JournalTarget.
 func (t *JournalTarget) Stop() error {
 	t.until <- time.Now()
-	return t.r.Close()
+	err := t.r.Close()
+	api.StopEntryHandler(t.handler)
+	return err
 }
 
 func makeJournalFields(fields map[string]string) map[string]string {
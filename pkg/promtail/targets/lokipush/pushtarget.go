@@ -199,5 +199,6 @@ func (t *PushTarget) Details() interface{} {
 func (t *PushTarget) Stop() error {
 	level.Info(t.logger).Log("msg", "stopping push server", "job", t.jobName)
 	t.server.Shutdown()
+	api.StopEntryHandler(t.handler)
 	return nil
 }
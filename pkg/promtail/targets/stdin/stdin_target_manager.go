@@ -130,6 +130,8 @@ func newReaderTarget(in io.Reader, client api.EntryHandler, cfg scrapeconfig.Con
 
 func (t *readerTarget) read() {
 	defer t.cancel()
+	// the entries held by the pipeline are sent before reading is reported as done.
+	defer api.StopEntryHandler(t.out)
 
 	for {
 		if t.ctx.Err() != nil {
@@ -296,6 +296,7 @@ func (t *SyslogTarget) Stop() error {
 	err := t.listener.Close()
 	t.openConnections.Wait()
 	close(t.messages)
+	api.StopEntryHandler(t.handler)
 	return err
 }
 
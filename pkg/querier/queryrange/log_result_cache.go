@@ -0,0 +1,299 @@
+package queryrange
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/chunk/cache"
+	"github.com/cortexproject/cortex/pkg/querier/queryrange"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/weaveworks/common/httpgrpc"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/loki/pkg/loghttp"
+	"github.com/grafana/loki/pkg/logproto"
+)
+
+// LogResultCacheMetrics is the metrics wrapper used in log result cache.
+type LogResultCacheMetrics struct {
+	CacheHit  prometheus.Counter
+	CacheMiss prometheus.Counter
+}
+
+// NewLogResultCacheMetrics creates metrics to be used in log result cache.
+func NewLogResultCacheMetrics(registerer prometheus.Registerer) *LogResultCacheMetrics {
+	return &LogResultCacheMetrics{
+		CacheHit: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+			Namespace: "loki",
+			Name:      "query_frontend_log_result_cache_hit_total",
+			Help:      "Number of query intervals whose log results were found in the cache.",
+		}),
+		CacheMiss: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+			Namespace: "loki",
+			Name:      "query_frontend_log_result_cache_miss_total",
+			Help:      "Number of cacheable query intervals whose log results were not found in the cache.",
+		}),
+	}
+}
+
+type logResultCache struct {
+	next    queryrange.Handler
+	limits  Limits
+	cache   cache.Cache
+	merger  queryrange.Merger
+	ttl     time.Duration
+	logger  log.Logger
+	metrics *LogResultCacheMetrics
+}
+
+// NewLogResultCache creates a new Middleware caching the results of log queries.
+// The requests are split on the boundaries of the split interval, the results of the intervals older than
+// the max cache freshness are cached, keyed by tenant, query, interval, limit, direction and API version. Consecutive
+// intervals missing from the cache are queried together, the results are merged with the cached ones.
+// The cached results are read for at most ttl, so that logs deleted since are eventually not returned, 0 to read
+// them until they are evicted from the cache.
+func NewLogResultCache(logger log.Logger, limits Limits, cache cache.Cache, merger queryrange.Merger, ttl time.Duration, metrics *LogResultCacheMetrics) queryrange.Middleware {
+	return queryrange.MiddlewareFunc(func(next queryrange.Handler) queryrange.Handler {
+		return &logResultCache{
+			next:    next,
+			limits:  limits,
+			cache:   cache,
+			merger:  merger,
+			ttl:     ttl,
+			logger:  logger,
+			metrics: metrics,
+		}
+	})
+}
+
+// logInterval is a part of a log request, with its cached results if any.
+type logInterval struct {
+	start, end time.Time
+	key        string // empty when the interval is not cacheable.
+	cached     *LokiResponse
+}
+
+func (l *logResultCache) Do(ctx context.Context, r queryrange.Request) (queryrange.Response, error) {
+	req, ok := r.(*LokiRequest)
+	if !ok {
+		return l.next.Do(ctx, r)
+	}
+	userID, err := user.ExtractOrgID(ctx)
+	if err != nil {
+		return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+	}
+
+	split := l.limits.QuerySplitDuration(userID)
+	maxCacheTime := time.Now().Add(-l.limits.MaxCacheFreshness(userID))
+	if split == 0 || !req.StartTs.Before(req.EndTs) || !req.StartTs.Before(maxCacheTime) {
+		return l.next.Do(ctx, r)
+	}
+
+	intervals := l.intervals(userID, req, split, maxCacheTime, time.Now())
+	l.fetch(ctx, intervals)
+	if req.Direction == logproto.BACKWARD {
+		for i, j := 0, len(intervals)-1; i < j; i, j = i+1, j-1 {
+			intervals[i], intervals[j] = intervals[j], intervals[i]
+		}
+	}
+
+	// the responses are ordered in the direction of the query, as expected when merging them.
+	var (
+		responses []queryrange.Response
+		count     int64
+	)
+	for i := 0; i < len(intervals); {
+		// no need to query the next intervals once the limit is reached.
+		if req.Limit > 0 && count >= int64(req.Limit) {
+			break
+		}
+		if intervals[i].cached != nil {
+			responses = append(responses, intervals[i].cached)
+			count += intervals[i].cached.Count()
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(intervals) && intervals[j].cached == nil {
+			j++
+		}
+		misses := intervals[i:j]
+		i = j
+
+		subReq := *req
+		subReq.StartTs, subReq.EndTs = misses[0].start, misses[len(misses)-1].end
+		if req.Direction == logproto.BACKWARD {
+			subReq.StartTs, subReq.EndTs = misses[len(misses)-1].start, misses[0].end
+		}
+		resp, err := l.next.Do(ctx, &subReq)
+		if err != nil {
+			return nil, err
+		}
+		lokiResp, ok := resp.(*LokiResponse)
+		if !ok {
+			return nil, fmt.Errorf("unexpected response type %T", resp)
+		}
+		l.store(ctx, req, misses, lokiResp)
+		responses = append(responses, lokiResp)
+		count += lokiResp.Count()
+	}
+
+	return l.merger.MergeResponse(responses...)
+}
+
+// intervals splits the request on the split interval boundaries, only the intervals fully covered by the request
+// and older than maxCacheTime are cacheable.
+func (l *logResultCache) intervals(userID string, req *LokiRequest, split time.Duration, maxCacheTime, now time.Time) []*logInterval {
+	// the keys change every ttl, the results cached before are not read anymore.
+	var generation int64
+	if l.ttl > 0 {
+		generation = now.UnixNano() / int64(l.ttl)
+	}
+	var intervals []*logInterval
+	for start := req.StartTs; start.Before(req.EndTs); {
+		end := time.Unix(0, (start.UnixNano()/int64(split)+1)*int64(split))
+		if end.After(req.EndTs) {
+			end = req.EndTs
+		}
+		interval := &logInterval{start: start, end: end}
+		if end.Sub(start) == split && !end.After(maxCacheTime) {
+			interval.key = logResultCacheKey(userID, req, start, split, generation)
+		}
+		intervals = append(intervals, interval)
+		start = end
+	}
+	return intervals
+}
+
+// logResultCacheKey includes the API version, the streams of the cached results are encoded according to it.
+func logResultCacheKey(userID string, req *LokiRequest, start time.Time, split time.Duration, generation int64) string {
+	return fmt.Sprintf("log:%s:%s:%d:%d:%d:%s:%d:%d", userID, req.Query, start.UnixNano(), split, req.Limit, req.Direction, loghttp.GetVersion(req.Path), generation)
+}
+
+// fetch sets the cached results of the cacheable intervals.
+func (l *logResultCache) fetch(ctx context.Context, intervals []*logInterval) {
+	byHash := map[string]*logInterval{}
+	var hashes []string
+	for _, interval := range intervals {
+		if interval.key == "" {
+			continue
+		}
+		hash := cache.HashKey(interval.key)
+		byHash[hash] = interval
+		hashes = append(hashes, hash)
+	}
+	if len(hashes) == 0 {
+		return
+	}
+
+	found, bufs, _ := l.cache.Fetch(ctx, hashes)
+	for i, hash := range found {
+		interval := byHash[hash]
+		var cached queryrange.CachedResponse
+		if err := proto.Unmarshal(bufs[i], &cached); err != nil {
+			level.Error(l.logger).Log("msg", "error unmarshalling cached log result", "err", err)
+			continue
+		}
+		if cached.Key != interval.key || len(cached.Extents) != 1 || cached.Extents[0].Response == nil {
+			continue
+		}
+		var resp LokiResponse
+		if err := types.UnmarshalAny(cached.Extents[0].Response, &resp); err != nil {
+			level.Error(l.logger).Log("msg", "error unmarshalling cached log result", "err", err)
+			continue
+		}
+		interval.cached = &resp
+	}
+	l.metrics.CacheHit.Add(float64(len(found)))
+	l.metrics.CacheMiss.Add(float64(len(hashes) - len(found)))
+}
+
+// store caches the results of the cacheable intervals of the response which are complete.
+// When the response reached the limit, only the intervals before its last entry in the direction of the query are.
+func (l *logResultCache) store(ctx context.Context, req *LokiRequest, intervals []*logInterval, resp *LokiResponse) {
+	if resp.Status != loghttp.QueryStatusSuccess {
+		return
+	}
+
+	limited := req.Limit > 0 && resp.Count() >= int64(req.Limit)
+	var last time.Time
+	for _, s := range resp.Data.Result {
+		for _, e := range s.Entries {
+			if last.IsZero() || (req.Direction == logproto.FORWARD && e.Timestamp.After(last)) ||
+				(req.Direction == logproto.BACKWARD && e.Timestamp.Before(last)) {
+				last = e.Timestamp
+			}
+		}
+	}
+
+	var (
+		hashes []string
+		bufs   [][]byte
+	)
+	for _, interval := range intervals {
+		if interval.key == "" {
+			continue
+		}
+		if limited && ((req.Direction == logproto.FORWARD && interval.end.After(last)) ||
+			(req.Direction == logproto.BACKWARD && !interval.start.After(last))) {
+			continue
+		}
+
+		any, err := types.MarshalAny(&LokiResponse{
+			Status:    resp.Status,
+			Direction: resp.Direction,
+			Limit:     resp.Limit,
+			Version:   resp.Version,
+			Data: LokiData{
+				ResultType: resp.Data.ResultType,
+				Result:     extractStreams(interval.start, interval.end, resp.Data.Result),
+			},
+		})
+		if err != nil {
+			level.Error(l.logger).Log("msg", "error marshalling log result", "err", err)
+			continue
+		}
+		buf, err := proto.Marshal(&queryrange.CachedResponse{
+			Key: interval.key,
+			Extents: []queryrange.Extent{{
+				Start:    interval.start.UnixNano() / int64(time.Millisecond),
+				End:      interval.end.UnixNano() / int64(time.Millisecond),
+				Response: any,
+			}},
+		})
+		if err != nil {
+			level.Error(l.logger).Log("msg", "error marshalling log result", "err", err)
+			continue
+		}
+		hashes = append(hashes, cache.HashKey(interval.key))
+		bufs = append(bufs, buf)
+	}
+	if len(hashes) > 0 {
+		l.cache.Store(ctx, hashes, bufs)
+	}
+}
+
+// extractStreams returns the entries of the streams between start and end.
+func extractStreams(start, end time.Time, streams []logproto.Stream) []logproto.Stream {
+	var result []logproto.Stream
+	for _, s := range streams {
+		var entries []logproto.Entry
+		for _, e := range s.Entries {
+			if !e.Timestamp.Before(start) && e.Timestamp.Before(end) {
+				entries = append(entries, e)
+			}
+		}
+		if len(entries) > 0 {
+			result = append(result, logproto.Stream{Labels: s.Labels, Entries: entries})
+		}
+	}
+	return result
+}
@@ -0,0 +1,226 @@
+package queryrange
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/chunk/cache"
+	"github.com/cortexproject/cortex/pkg/querier/queryrange"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/loki/pkg/loghttp"
+	"github.com/grafana/loki/pkg/logproto"
+)
+
+// fakeLogHandler answers log requests with an entry every 10 minutes, and records the requests.
+type fakeLogHandler struct {
+	sync.Mutex
+	requests []*LokiRequest
+}
+
+func (h *fakeLogHandler) Do(_ context.Context, r queryrange.Request) (queryrange.Response, error) {
+	req := r.(*LokiRequest)
+	h.Lock()
+	h.requests = append(h.requests, req)
+	h.Unlock()
+	return logResponse(req), nil
+}
+
+func (h *fakeLogHandler) reset() []*LokiRequest {
+	h.Lock()
+	defer h.Unlock()
+	requests := h.requests
+	h.requests = nil
+	return requests
+}
+
+// logResponse returns the expected response of the request.
+func logResponse(req *LokiRequest) *LokiResponse {
+	var entries []logproto.Entry
+	step := 10 * time.Minute
+	for ts := time.Unix(0, (req.StartTs.UnixNano()+int64(step)-1)/int64(step)*int64(step)); ts.Before(req.EndTs); ts = ts.Add(step) {
+		entries = append(entries, logproto.Entry{Timestamp: ts, Line: fmt.Sprintf("%d", ts.UnixNano())})
+	}
+	if req.Direction == logproto.BACKWARD {
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+	}
+	if req.Limit > 0 && len(entries) > int(req.Limit) {
+		entries = entries[:req.Limit]
+	}
+	resp := &LokiResponse{
+		Status:    loghttp.QueryStatusSuccess,
+		Direction: req.Direction,
+		Limit:     req.Limit,
+		Version:   uint32(loghttp.GetVersion(req.Path)),
+		Data:      LokiData{ResultType: loghttp.ResultTypeStream},
+	}
+	if len(entries) > 0 {
+		resp.Data.Result = []logproto.Stream{{Labels: `{foo="bar"}`, Entries: entries}}
+	}
+	return resp
+}
+
+func logRequest(start, end time.Duration, limit uint32, direction logproto.Direction) *LokiRequest {
+	return &LokiRequest{
+		Query:     `{foo="bar"} |= "1"`,
+		StartTs:   time.Unix(0, int64(start)),
+		EndTs:     time.Unix(0, int64(end)),
+		Limit:     limit,
+		Direction: direction,
+		Path:      "/loki/api/v1/query_range",
+	}
+}
+
+func requestRanges(requests []*LokiRequest) [][2]time.Duration {
+	var ranges [][2]time.Duration
+	for _, r := range requests {
+		ranges = append(ranges, [2]time.Duration{time.Duration(r.StartTs.UnixNano()), time.Duration(r.EndTs.UnixNano())})
+	}
+	return ranges
+}
+
+func newTestLogResultCache(next queryrange.Handler) queryrange.Handler {
+	limits := WithDefaultLimits(fakeLimits{}, queryrange.Config{SplitQueriesByInterval: time.Hour})
+	c := cache.NewFifoCache("test", cache.FifoCacheConfig{MaxSizeItems: 1024, Validity: time.Hour})
+	// no ttl, so that the results cached by the tests are never expired while they run.
+	return NewLogResultCache(util.Logger, limits, c, lokiCodec, 0, NewLogResultCacheMetrics(nil)).Wrap(next)
+}
+
+func TestLogResultCache_TTL(t *testing.T) {
+	l := &logResultCache{ttl: time.Hour}
+	req := logRequest(0, 2*time.Hour, 1000, logproto.FORWARD)
+	keys := func(now time.Time) []string {
+		var keys []string
+		for _, interval := range l.intervals("1", req, time.Hour, time.Unix(0, int64(2*time.Hour)), now) {
+			keys = append(keys, interval.key)
+		}
+		return keys
+	}
+
+	now := time.Unix(0, int64(100*time.Hour))
+	require.Len(t, keys(now), 2)
+	// the keys are the same within the ttl, and change once it elapsed.
+	require.Equal(t, keys(now), keys(now.Add(59*time.Minute)))
+	require.NotEqual(t, keys(now), keys(now.Add(time.Hour)))
+}
+
+func TestLogResultCache(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "1")
+	next := &fakeLogHandler{}
+	h := newTestLogResultCache(next)
+
+	for _, direction := range []logproto.Direction{logproto.FORWARD, logproto.BACKWARD} {
+		t.Run(direction.String(), func(t *testing.T) {
+			req := logRequest(0, 4*time.Hour, 1000, direction)
+			resp, err := h.Do(ctx, req)
+			require.NoError(t, err)
+			require.Equal(t, logResponse(req), resp)
+			require.Equal(t, [][2]time.Duration{{0, 4 * time.Hour}}, requestRanges(next.reset()))
+
+			// the results are now cached.
+			resp, err = h.Do(ctx, req)
+			require.NoError(t, err)
+			require.Equal(t, logResponse(req), resp)
+			require.Empty(t, next.reset())
+
+			// only the partial and missing intervals are queried.
+			req = logRequest(30*time.Minute, 5*time.Hour+30*time.Minute, 1000, direction)
+			resp, err = h.Do(ctx, req)
+			require.NoError(t, err)
+			require.Equal(t, logResponse(req), resp)
+			ranges := requestRanges(next.reset())
+			if direction == logproto.BACKWARD {
+				require.Equal(t, [][2]time.Duration{{4 * time.Hour, 5*time.Hour + 30*time.Minute}, {30 * time.Minute, time.Hour}}, ranges)
+			} else {
+				require.Equal(t, [][2]time.Duration{{30 * time.Minute, time.Hour}, {4 * time.Hour, 5*time.Hour + 30*time.Minute}}, ranges)
+			}
+
+			// the limit is part of the cache key.
+			req = logRequest(0, 4*time.Hour, 100, direction)
+			_, err = h.Do(ctx, req)
+			require.NoError(t, err)
+			require.Len(t, next.reset(), 1)
+
+			// so is the API version.
+			req = logRequest(0, 4*time.Hour, 1000, direction)
+			req.Path = "/api/prom/query"
+			resp, err = h.Do(ctx, req)
+			require.NoError(t, err)
+			require.Equal(t, logResponse(req), resp)
+			require.Len(t, next.reset(), 1)
+		})
+	}
+}
+
+func TestLogResultCache_Limit(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "1")
+	next := &fakeLogHandler{}
+	h := newTestLogResultCache(next)
+
+	// the 10 newest entries are within [2h20m, 4h), only the interval [3h, 4h) is complete.
+	req := logRequest(0, 4*time.Hour, 10, logproto.BACKWARD)
+	resp, err := h.Do(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, logResponse(req), resp)
+	require.Len(t, next.reset(), 1)
+
+	resp, err = h.Do(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, logResponse(req), resp)
+	require.Equal(t, [][2]time.Duration{{0, 3 * time.Hour}}, requestRanges(next.reset()))
+
+	// the intervals are not queried once the limit is reached with the cached ones.
+	for _, r := range []*LokiRequest{logRequest(3*time.Hour, 4*time.Hour, 8, logproto.BACKWARD), logRequest(2*time.Hour, 3*time.Hour, 8, logproto.BACKWARD)} {
+		_, err = h.Do(ctx, r)
+		require.NoError(t, err)
+	}
+	next.reset()
+	req = logRequest(0, 4*time.Hour, 8, logproto.BACKWARD)
+	resp, err = h.Do(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, logResponse(req), resp)
+	require.Empty(t, next.reset())
+}
+
+func TestLogResultCache_UnexpectedResponse(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "1")
+	h := newTestLogResultCache(queryrange.HandlerFunc(func(context.Context, queryrange.Request) (queryrange.Response, error) {
+		return &LokiPromResponse{}, nil
+	}))
+
+	_, err := h.Do(ctx, logRequest(0, 4*time.Hour, 1000, logproto.FORWARD))
+	require.Error(t, err)
+}
+
+func TestLogResultCache_Freshness(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "1")
+	next := &fakeLogHandler{}
+	h := newTestLogResultCache(next)
+
+	// the recent intervals are never cached.
+	now := time.Now().Truncate(time.Hour)
+	req := &LokiRequest{
+		Query:     `{foo="bar"} |= "1"`,
+		StartTs:   now.Add(-2 * time.Hour),
+		EndTs:     now.Add(time.Second),
+		Limit:     1000,
+		Direction: logproto.FORWARD,
+	}
+	for i := 0; i < 2; i++ {
+		resp, err := h.Do(ctx, req)
+		require.NoError(t, err)
+		require.Equal(t, logResponse(req), resp)
+	}
+	requests := next.reset()
+	require.Len(t, requests, 2)
+	require.True(t, requests[1].StartTs.After(req.StartTs))
+	require.False(t, requests[1].StartTs.Before(now.Add(-time.Hour)))
+	require.Equal(t, req.EndTs, requests[1].EndTs)
+}
@@ -24,12 +24,14 @@ import (
 
 // Config is the configuration for the queryrange tripperware
 type Config struct {
-	queryrange.Config `yaml:",inline"`
+	queryrange.Config  `yaml:",inline"`
+	LogResultsCacheTTL time.Duration `yaml:"log_results_cache_ttl"`
 }
 
 // RegisterFlags adds the flags required to configure this flag set.
 func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	cfg.Config.RegisterFlags(f)
+	f.DurationVar(&cfg.LogResultsCacheTTL, "querier.log-results-cache-ttl", time.Hour, "Maximum time the results of log queries are read from the cache, logs deleted since they were cached are returned until then. 0 to read them until they are evicted.")
 }
 
 // Stopper gracefully shutdown resources created
@@ -54,12 +56,14 @@ func NewTripperware(
 	retryMetrics := queryrange.NewRetryMiddlewareMetrics(registerer)
 	shardingMetrics := logql.NewShardingMetrics(registerer)
 	splitByMetrics := NewSplitByMetrics(registerer)
+	logResultCacheMetrics := NewLogResultCacheMetrics(registerer)
 
 	metricsTripperware, cache, err := NewMetricTripperware(cfg, log, limits, schema, minShardingLookback, lokiCodec, PrometheusExtractor{}, instrumentMetrics, retryMetrics, shardingMetrics, splitByMetrics)
 	if err != nil {
 		return nil, nil, err
 	}
-	logFilterTripperware, err := NewLogFilterTripperware(cfg, log, limits, schema, minShardingLookback, lokiCodec, instrumentMetrics, retryMetrics, shardingMetrics, splitByMetrics)
+	// The log results are cached in the same cache as the metric results.
+	logFilterTripperware, err := NewLogFilterTripperware(cfg, log, limits, schema, minShardingLookback, lokiCodec, cache, instrumentMetrics, retryMetrics, shardingMetrics, splitByMetrics, logResultCacheMetrics)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -193,13 +197,19 @@ func NewLogFilterTripperware(
 	schema chunk.SchemaConfig,
 	minShardingLookback time.Duration,
 	codec queryrange.Codec,
+	c cache.Cache,
 	instrumentMetrics *queryrange.InstrumentMiddlewareMetrics,
 	retryMiddlewareMetrics *queryrange.RetryMiddlewareMetrics,
 	shardingMetrics *logql.ShardingMetrics,
 	splitByMetrics *SplitByMetrics,
+	logResultCacheMetrics *LogResultCacheMetrics,
 ) (frontend.Tripperware, error) {
 	queryRangeMiddleware := []queryrange.Middleware{StatsCollectorMiddleware(), queryrange.LimitsMiddleware(limits)}
 	if cfg.SplitQueriesByInterval != 0 {
+		// The results cache relies on the split interval, which is required when caching results.
+		if cfg.CacheResults && c != nil {
+			queryRangeMiddleware = append(queryRangeMiddleware, queryrange.InstrumentMiddleware("log_results_cache", instrumentMetrics), NewLogResultCache(log, limits, c, codec, cfg.LogResultsCacheTTL, logResultCacheMetrics))
+		}
 		queryRangeMiddleware = append(queryRangeMiddleware, queryrange.InstrumentMiddleware("split_by_interval", instrumentMetrics), SplitByIntervalMiddleware(limits, codec, splitByMetrics))
 	}
 
@@ -269,7 +279,7 @@ func NewMetricTripperware(
 	retryMiddlewareMetrics *queryrange.RetryMiddlewareMetrics,
 	shardingMetrics *logql.ShardingMetrics,
 	splitByMetrics *SplitByMetrics,
-) (frontend.Tripperware, Stopper, error) {
+) (frontend.Tripperware, cache.Cache, error) {
 	queryRangeMiddleware := []queryrange.Middleware{StatsCollectorMiddleware(), queryrange.LimitsMiddleware(limits)}
 	if cfg.AlignQueriesWithStep {
 		queryRangeMiddleware = append(
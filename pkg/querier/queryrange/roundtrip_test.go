@@ -32,7 +32,7 @@ import (
 
 var (
 	testTime   = time.Date(2019, 12, 02, 11, 10, 10, 10, time.UTC)
-	testConfig = Config{queryrange.Config{
+	testConfig = Config{Config: queryrange.Config{
 		SplitQueriesByInterval: 4 * time.Hour,
 		AlignQueriesWithStep:   true,
 		MaxRetries:             3,
@@ -210,6 +210,9 @@ func (h *splitByInterval) Do(ctx context.Context, r queryrange.Request) (queryra
 	return h.merger.MergeResponse(resps...)
 }
 
+// splitByTime splits a request into sub-requests of the given interval.
+// Splits are made on the evaluation time, range offsets are applied by the querier
+// when each sub-request is evaluated so they don't need to be taken into account here.
 func splitByTime(req queryrange.Request, interval time.Duration) []queryrange.Request {
 	var reqs []queryrange.Request
 
@@ -72,6 +72,30 @@ func Test_splitQuery(t *testing.T) {
 				},
 			},
 		},
+		{
+			"metric query with offset",
+			&LokiRequest{
+				Query:   `count_over_time({app="api"}[5m] offset 1d)`,
+				Step:    60000,
+				StartTs: time.Date(2019, 12, 9, 12, 0, 0, 0, time.UTC),
+				EndTs:   time.Date(2019, 12, 9, 14, 0, 0, 0, time.UTC),
+			},
+			time.Hour,
+			[]queryrange.Request{
+				&LokiRequest{
+					Query:   `count_over_time({app="api"}[5m] offset 1d)`,
+					Step:    60000,
+					StartTs: time.Date(2019, 12, 9, 12, 0, 0, 0, time.UTC),
+					EndTs:   time.Date(2019, 12, 9, 13, 0, 0, 0, time.UTC),
+				},
+				&LokiRequest{
+					Query:   `count_over_time({app="api"}[5m] offset 1d)`,
+					Step:    60000,
+					StartTs: time.Date(2019, 12, 9, 13, 0, 0, 0, time.UTC),
+					EndTs:   time.Date(2019, 12, 9, 14, 0, 0, 0, time.UTC),
+				},
+			},
+		},
 		{
 			"3 intervals series",
 			&LokiSeriesRequest{
@@ -0,0 +1,187 @@
+package ruler
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/weaveworks/common/user"
+)
+
+// The rules API follows the format of the Prometheus HTTP API so that existing tooling can use it.
+
+type response struct {
+	Status    string      `json:"status"`
+	Data      interface{} `json:"data,omitempty"`
+	ErrorType string      `json:"errorType,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// RuleDiscovery has info for all rules.
+type RuleDiscovery struct {
+	RuleGroups []*RuleGroupState `json:"groups"`
+}
+
+// RuleGroupState has info for rules which are part of a group.
+type RuleGroupState struct {
+	Name     string        `json:"name"`
+	File     string        `json:"file"`
+	Rules    []interface{} `json:"rules"`
+	Interval float64       `json:"interval"`
+}
+
+type alertingRule struct {
+	State          string        `json:"state"`
+	Name           string        `json:"name"`
+	Query          string        `json:"query"`
+	Duration       float64       `json:"duration"`
+	Labels         labels.Labels `json:"labels"`
+	Annotations    labels.Labels `json:"annotations"`
+	Alerts         []*Alert      `json:"alerts"`
+	Health         string        `json:"health"`
+	LastError      string        `json:"lastError,omitempty"`
+	LastEvaluation time.Time     `json:"lastEvaluation"`
+	EvaluationTime float64       `json:"evaluationTime"`
+	Type           string        `json:"type"`
+}
+
+type recordingRule struct {
+	Name           string        `json:"name"`
+	Query          string        `json:"query"`
+	Labels         labels.Labels `json:"labels,omitempty"`
+	Health         string        `json:"health"`
+	LastError      string        `json:"lastError,omitempty"`
+	LastEvaluation time.Time     `json:"lastEvaluation"`
+	EvaluationTime float64       `json:"evaluationTime"`
+	Type           string        `json:"type"`
+}
+
+// AlertDiscovery has info for all active alerts.
+type AlertDiscovery struct {
+	Alerts []*Alert `json:"alerts"`
+}
+
+// Alert has info for an alert.
+type Alert struct {
+	Labels      labels.Labels `json:"labels"`
+	Annotations labels.Labels `json:"annotations"`
+	State       string        `json:"state"`
+	ActiveAt    *time.Time    `json:"activeAt,omitempty"`
+	Value       float64       `json:"value"`
+}
+
+// RulesHandler returns the state of the rule groups of the tenant.
+func (r *Ruler) RulesHandler(w http.ResponseWriter, req *http.Request) {
+	tenant, err := user.ExtractOrgID(req.Context())
+	if err != nil {
+		r.respondError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	groups := r.tenantGroups(tenant)
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].File() != groups[j].File() {
+			return groups[i].File() < groups[j].File()
+		}
+		return groups[i].Name() < groups[j].Name()
+	})
+
+	result := RuleDiscovery{RuleGroups: make([]*RuleGroupState, 0, len(groups))}
+	for _, g := range groups {
+		state := &RuleGroupState{
+			Name:     g.Name(),
+			File:     g.File(),
+			Rules:    make([]interface{}, 0, len(g.Rules())),
+			Interval: g.Interval().Seconds(),
+		}
+		for _, rl := range g.Rules() {
+			var lastError string
+			if rl.LastError() != nil {
+				lastError = rl.LastError().Error()
+			}
+			switch rl := rl.(type) {
+			case *rules.AlertingRule:
+				state.Rules = append(state.Rules, alertingRule{
+					State:          rl.State().String(),
+					Name:           rl.Name(),
+					Query:          rl.Query().String(),
+					Duration:       rl.HoldDuration().Seconds(),
+					Labels:         rl.Labels(),
+					Annotations:    rl.Annotations(),
+					Alerts:         alerts(rl),
+					Health:         string(rl.Health()),
+					LastError:      lastError,
+					LastEvaluation: rl.GetEvaluationTimestamp(),
+					EvaluationTime: rl.GetEvaluationDuration().Seconds(),
+					Type:           "alerting",
+				})
+			case *rules.RecordingRule:
+				state.Rules = append(state.Rules, recordingRule{
+					Name:           rl.Name(),
+					Query:          rl.Query().String(),
+					Labels:         rl.Labels(),
+					Health:         string(rl.Health()),
+					LastError:      lastError,
+					LastEvaluation: rl.GetEvaluationTimestamp(),
+					EvaluationTime: rl.GetEvaluationDuration().Seconds(),
+					Type:           "recording",
+				})
+			}
+		}
+		result.RuleGroups = append(result.RuleGroups, state)
+	}
+	r.respond(w, result)
+}
+
+// AlertsHandler returns the active alerts of the tenant.
+func (r *Ruler) AlertsHandler(w http.ResponseWriter, req *http.Request) {
+	tenant, err := user.ExtractOrgID(req.Context())
+	if err != nil {
+		r.respondError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	result := AlertDiscovery{Alerts: []*Alert{}}
+	for _, g := range r.tenantGroups(tenant) {
+		for _, ar := range g.AlertingRules() {
+			result.Alerts = append(result.Alerts, alerts(ar)...)
+		}
+	}
+	r.respond(w, result)
+}
+
+func alerts(rl *rules.AlertingRule) []*Alert {
+	active := rl.ActiveAlerts()
+	result := make([]*Alert, 0, len(active))
+	for _, a := range active {
+		activeAt := a.ActiveAt
+		result = append(result, &Alert{
+			Labels:      a.Labels,
+			Annotations: a.Annotations,
+			State:       a.State.String(),
+			ActiveAt:    &activeAt,
+			Value:       a.Value,
+		})
+	}
+	return result
+}
+
+func (r *Ruler) respond(w http.ResponseWriter, data interface{}) {
+	r.writeJSON(w, http.StatusOK, response{Status: "success", Data: data})
+}
+
+func (r *Ruler) respondError(w http.ResponseWriter, code int, err error) {
+	r.writeJSON(w, code, response{Status: "error", ErrorType: "server_error", Error: err.Error()})
+}
+
+func (r *Ruler) writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		level.Error(r.logger).Log("msg", "error writing response", "err", err)
+	}
+}
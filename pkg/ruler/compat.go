@@ -0,0 +1,75 @@
+package ruler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/grafana/loki/pkg/logql"
+)
+
+// engineQueryFunc returns a rules.QueryFunc evaluating LogQL metric queries at a single instant.
+// The evaluation time is shifted back by delay to give time to the most recent logs to be ingested.
+func engineQueryFunc(engine *logql.Engine, delay time.Duration) rules.QueryFunc {
+	return func(ctx context.Context, qs string, t time.Time) (promql.Vector, error) {
+		adjusted := t.Add(-delay)
+		params := logql.NewLiteralParams(qs, adjusted, adjusted, 0, 0, logproto.FORWARD, 0, nil)
+		res, err := engine.Query(params).Exec(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		switch v := res.Data.(type) {
+		case promql.Vector:
+			return v, nil
+		case promql.Scalar:
+			return promql.Vector{promql.Sample{
+				Point:  promql.Point(v),
+				Metric: labels.Labels{},
+			}}, nil
+		default:
+			return nil, fmt.Errorf("rule result is not a vector or scalar: %s", res.Data.Type())
+		}
+	}
+}
+
+// exprAdapter allows LogQL expressions to be used by the Prometheus rules package.
+// Rules only use the string representation of their expression to query the QueryFunc,
+// the embedded PromQL expression is never evaluated.
+type exprAdapter struct {
+	parser.Expr
+	query string
+}
+
+func newExprAdapter(expr logql.Expr) exprAdapter {
+	return exprAdapter{
+		Expr:  &parser.StringLiteral{},
+		query: expr.String(),
+	}
+}
+
+func (e exprAdapter) String() string { return e.query }
+
+// appendableFunc is a function implementing storage.Appendable.
+type appendableFunc func() storage.Appender
+
+func (f appendableFunc) Appender() storage.Appender { return f() }
+
+// discardAppendable drops the samples produced by recording rules.
+type discardAppendable struct{}
+
+func (discardAppendable) Appender() storage.Appender { return discardAppender{} }
+
+type discardAppender struct{}
+
+func (discardAppender) Add(_ labels.Labels, _ int64, _ float64) (uint64, error) { return 0, nil }
+func (discardAppender) AddFast(_ uint64, _ int64, _ float64) error              { return nil }
+func (discardAppender) Commit() error                                           { return nil }
+func (discardAppender) Rollback() error                                         { return nil }
@@ -0,0 +1,141 @@
+package ruler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	config_util "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/discovery"
+	sd_config "github.com/prometheus/prometheus/discovery/config"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/util/strutil"
+	"github.com/weaveworks/common/user"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// tenantNotifier sends the alerts of a single tenant to the Alertmanager.
+// It bundles a notifier.Manager with the discovery manager feeding it the Alertmanager targets.
+type tenantNotifier struct {
+	notifier  *notifier.Manager
+	sdCancel  context.CancelFunc
+	sdManager *discovery.Manager
+	wg        sync.WaitGroup
+	logger    log.Logger
+}
+
+func newTenantNotifier(tenant string, o *notifier.Options, logger log.Logger) *tenantNotifier {
+	// The context of the notifier does not hold the tenant, it needs to be injected into each request.
+	o.Do = func(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+		ctx = user.InjectOrgID(ctx, tenant)
+		if err := user.InjectOrgIDIntoHTTPRequest(ctx, req); err != nil {
+			return nil, err
+		}
+		return ctxhttp.Do(ctx, client, req)
+	}
+	sdCtx, sdCancel := context.WithCancel(context.Background())
+	return &tenantNotifier{
+		notifier:  notifier.NewManager(o, logger),
+		sdCancel:  sdCancel,
+		sdManager: discovery.NewManager(sdCtx, logger),
+		logger:    logger,
+	}
+}
+
+func (n *tenantNotifier) run() {
+	n.wg.Add(2)
+	go func() {
+		defer n.wg.Done()
+		if err := n.sdManager.Run(); err != nil {
+			level.Error(n.logger).Log("msg", "error starting notifier discovery manager", "err", err)
+		}
+	}()
+	go func() {
+		defer n.wg.Done()
+		n.notifier.Run(n.sdManager.SyncCh())
+	}()
+}
+
+func (n *tenantNotifier) applyConfig(cfg *config.Config) error {
+	if err := n.notifier.ApplyConfig(cfg); err != nil {
+		return err
+	}
+
+	sdCfgs := make(map[string]sd_config.ServiceDiscoveryConfig)
+	for k, v := range cfg.AlertingConfig.AlertmanagerConfigs.ToMap() {
+		sdCfgs[k] = v.ServiceDiscoveryConfig
+	}
+	return n.sdManager.ApplyConfig(sdCfgs)
+}
+
+func (n *tenantNotifier) stop() {
+	n.sdCancel()
+	n.notifier.Stop()
+	n.wg.Wait()
+}
+
+// buildNotifierConfig builds the Prometheus configuration sending alerts to the configured Alertmanager.
+func buildNotifierConfig(cfg Config) *config.Config {
+	u := cfg.AlertmanagerURL.URL
+	amConfig := &config.AlertmanagerConfig{
+		APIVersion: config.AlertmanagerAPIVersionV1,
+		Scheme:     u.Scheme,
+		PathPrefix: u.Path,
+		Timeout:    model.Duration(cfg.NotificationTimeout),
+		ServiceDiscoveryConfig: sd_config.ServiceDiscoveryConfig{
+			StaticConfigs: []*targetgroup.Group{{
+				Targets: []model.LabelSet{{model.AddressLabel: model.LabelValue(u.Host)}},
+			}},
+		},
+	}
+	if cfg.AlertmanagerEnableV2API {
+		amConfig.APIVersion = config.AlertmanagerAPIVersionV2
+	}
+	if u.User != nil {
+		amConfig.HTTPClientConfig = config_util.HTTPClientConfig{
+			BasicAuth: &config_util.BasicAuth{Username: u.User.Username()},
+		}
+		if password, ok := u.User.Password(); ok {
+			amConfig.HTTPClientConfig.BasicAuth.Password = config_util.Secret(password)
+		}
+	}
+
+	return &config.Config{
+		AlertingConfig: config.AlertingConfig{
+			AlertmanagerConfigs: []*config.AlertmanagerConfig{amConfig},
+		},
+	}
+}
+
+// sendAlerts implements a rules.NotifyFunc forwarding firing and resolved alerts to the notifier.
+func sendAlerts(n *notifier.Manager, externalURL *url.URL) rules.NotifyFunc {
+	return func(_ context.Context, expr string, alerts ...*rules.Alert) {
+		var res []*notifier.Alert
+		for _, alert := range alerts {
+			// Only send actually firing alerts.
+			if alert.State == rules.StatePending {
+				continue
+			}
+			a := &notifier.Alert{
+				StartsAt:     alert.FiredAt,
+				Labels:       alert.Labels,
+				Annotations:  alert.Annotations,
+				GeneratorURL: externalURL.String() + strutil.TableLinkForExpression(expr),
+			}
+			if !alert.ResolvedAt.IsZero() {
+				a.EndsAt = alert.ResolvedAt
+			}
+			res = append(res, a)
+		}
+		if len(res) > 0 {
+			n.Send(res...)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package ruler
+
+import (
+	"flag"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/prometheus/prometheus/tsdb/record"
+	"github.com/prometheus/prometheus/tsdb/wal"
+)
+
+// RemoteWriteConfig configures the remote-write of the samples produced by recording rules.
+type RemoteWriteConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Directory holding the write-ahead log of each tenant.
+	WALDir string `yaml:"wal_dir"`
+	// How frequently the write-ahead logs are truncated.
+	WALTruncateFrequency time.Duration `yaml:"wal_truncate_frequency"`
+	// How long to wait for pending samples to be sent on shutdown.
+	FlushDeadline time.Duration `yaml:"flush_deadline"`
+	// Remote-write endpoint, including its queue and retry settings.
+	Client config.RemoteWriteConfig `yaml:"client"`
+}
+
+// RegisterFlags registers flags.
+func (cfg *RemoteWriteConfig) RegisterFlags(f *flag.FlagSet) {
+	cfg.Client = config.DefaultRemoteWriteConfig
+
+	f.BoolVar(&cfg.Enabled, "ruler.remote-write.enabled", false, "Remote-write the results of recording rules. The endpoint is configured with the client block.")
+	f.StringVar(&cfg.WALDir, "ruler.remote-write.wal-dir", "/loki/ruler-wal", "Directory holding the write-ahead log of each tenant, samples are sent from it to the remote-write endpoint.")
+	f.DurationVar(&cfg.WALTruncateFrequency, "ruler.remote-write.wal-truncate-frequency", time.Hour, "How frequently to truncate the write-ahead logs. Samples older than twice this period may not be sent if the remote-write endpoint is lagging behind.")
+	f.DurationVar(&cfg.FlushDeadline, "ruler.remote-write.flush-deadline", time.Minute, "How long to wait for pending samples to be sent on shutdown.")
+}
+
+// Validate validates the remote-write config.
+func (cfg *RemoteWriteConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.Client.URL == nil {
+		return errors.New("a remote-write client URL is required when remote-write is enabled")
+	}
+	if cfg.WALDir == "" {
+		return errors.New("a remote-write WAL directory is required when remote-write is enabled")
+	}
+	if cfg.WALTruncateFrequency <= 0 {
+		return errors.New("remote-write WAL truncate frequency must be greater than zero")
+	}
+	return nil
+}
+
+// RulesLimits are the per-tenant limits applied by the ruler.
+type RulesLimits interface {
+	// RulerRemoteWriteExternalLabels returns the labels added to the series remote-written for a tenant.
+	RulerRemoteWriteExternalLabels(userID string) map[string]string
+}
+
+// tenantWAL stores the samples produced by the recording rules of a tenant in a write-ahead log.
+// The remote-write queues tail the WAL, which allows them to buffer and retry
+// without holding back the evaluation of rules.
+type tenantWAL struct {
+	wal     *wal.WAL
+	storage *remote.WriteStorage
+	logger  log.Logger
+
+	mtx     sync.Mutex
+	series  map[string]*walSeries // labels string -> series
+	refs    map[uint64]*walSeries
+	nextRef uint64
+}
+
+type walSeries struct {
+	ref      uint64
+	labels   labels.Labels
+	lastSeen int64 // Timestamp of the latest sample in milliseconds.
+}
+
+// newTenantWAL opens the WAL stored in <dir>/wal and starts sending its samples with the remote-write config.
+// Series logged by a previous process are loaded so their references are not reused.
+func newTenantWAL(dir string, cfg *config.Config, flushDeadline time.Duration, reg prometheus.Registerer, logger log.Logger) (*tenantWAL, error) {
+	w, err := wal.New(logger, reg, filepath.Join(dir, "wal"), true)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open WAL")
+	}
+
+	t := &tenantWAL{
+		wal:     w,
+		logger:  logger,
+		series:  map[string]*walSeries{},
+		refs:    map[uint64]*walSeries{},
+		nextRef: 1,
+	}
+	if err := t.replay(); err != nil {
+		w.Close()
+		return nil, errors.Wrap(err, "unable to replay WAL")
+	}
+
+	t.storage = remote.NewWriteStorage(logger, reg, dir, flushDeadline)
+	if err := t.storage.ApplyConfig(cfg); err != nil {
+		t.close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// replay loads the series of the last checkpoint and of the segments following it.
+func (t *tenantWAL) replay() error {
+	from := 0
+	checkpoint, index, err := wal.LastCheckpoint(t.wal.Dir())
+	switch {
+	case err == nil:
+		sr, err := wal.NewSegmentsReader(checkpoint)
+		if err != nil {
+			return err
+		}
+		err = t.loadSeries(sr)
+		sr.Close()
+		if err != nil {
+			return err
+		}
+		from = index + 1
+	case err != record.ErrNotFound:
+		return err
+	}
+
+	sr, err := wal.NewSegmentsRangeReader(wal.SegmentRange{Dir: t.wal.Dir(), First: from, Last: -1})
+	if err != nil {
+		return err
+	}
+	defer sr.Close()
+	return t.loadSeries(sr)
+}
+
+func (t *tenantWAL) loadSeries(r io.Reader) error {
+	var (
+		dec    record.Decoder
+		series []record.RefSeries
+		reader = wal.NewReader(r)
+	)
+	for reader.Next() {
+		rec := reader.Record()
+		if dec.Type(rec) != record.Series {
+			continue
+		}
+		var err error
+		series, err = dec.Series(rec, series[:0])
+		if err != nil {
+			return err
+		}
+		for _, s := range series {
+			t.addSeries(&walSeries{ref: s.Ref, labels: s.Labels})
+			if s.Ref >= t.nextRef {
+				t.nextRef = s.Ref + 1
+			}
+		}
+	}
+	return reader.Err()
+}
+
+func (t *tenantWAL) addSeries(s *walSeries) {
+	t.series[s.labels.String()] = s
+	t.refs[s.ref] = s
+}
+
+func (t *tenantWAL) removeSeries(s *walSeries) {
+	delete(t.series, s.labels.String())
+	delete(t.refs, s.ref)
+}
+
+// applyConfig updates the remote-write config, the queues are only restarted when it changed.
+func (t *tenantWAL) applyConfig(cfg *config.Config) error {
+	return t.storage.ApplyConfig(cfg)
+}
+
+// Appender implements storage.Appendable.
+func (t *tenantWAL) Appender() storage.Appender {
+	return &walAppender{wal: t}
+}
+
+// truncate checkpoints every segment but the last one and removes them from the WAL.
+// Series without samples since mint are not kept in the checkpoint.
+// A new segment is started afterwards, which allows the next truncation to remove the current one.
+func (t *tenantWAL) truncate(mint int64) error {
+	first, last, err := t.wal.Segments()
+	if err != nil {
+		return err
+	}
+
+	if last > first {
+		t.mtx.Lock()
+		for _, s := range t.refs {
+			if s.lastSeen < mint {
+				t.removeSeries(s)
+			}
+		}
+		t.mtx.Unlock()
+
+		keep := func(ref uint64) bool {
+			t.mtx.Lock()
+			defer t.mtx.Unlock()
+			_, ok := t.refs[ref]
+			return ok
+		}
+		if _, err := wal.Checkpoint(t.wal, first, last-1, keep, mint); err != nil {
+			return errors.Wrap(err, "unable to create checkpoint")
+		}
+		if err := t.wal.Truncate(last); err != nil {
+			return errors.Wrap(err, "unable to truncate WAL")
+		}
+		if err := wal.DeleteCheckpoints(t.wal.Dir(), last-1); err != nil {
+			// Leftover old checkpoints are ignored when reading the WAL.
+			level.Warn(t.logger).Log("msg", "unable to delete old WAL checkpoints", "err", err)
+		}
+	}
+	return t.wal.NextSegment()
+}
+
+// close stops the remote-write queues, waiting up to the flush deadline for pending samples to be sent.
+func (t *tenantWAL) close() error {
+	if t.storage != nil {
+		if err := t.storage.Close(); err != nil {
+			level.Warn(t.logger).Log("msg", "unable to stop remote-write", "err", err)
+		}
+	}
+	return t.wal.Close()
+}
+
+// walAppender buffers the samples of a rule group evaluation and logs them to the WAL on commit.
+type walAppender struct {
+	wal     *tenantWAL
+	series  []record.RefSeries
+	samples []record.RefSample
+}
+
+// Add implements storage.Appender.
+func (a *walAppender) Add(l labels.Labels, ts int64, v float64) (uint64, error) {
+	a.wal.mtx.Lock()
+	defer a.wal.mtx.Unlock()
+
+	s, ok := a.wal.series[l.String()]
+	if !ok {
+		s = &walSeries{ref: a.wal.nextRef, labels: l}
+		a.wal.nextRef++
+		a.wal.addSeries(s)
+		a.series = append(a.series, record.RefSeries{Ref: s.ref, Labels: l})
+	}
+	a.samples = append(a.samples, record.RefSample{Ref: s.ref, T: ts, V: v})
+	return s.ref, nil
+}
+
+// AddFast implements storage.Appender.
+func (a *walAppender) AddFast(ref uint64, ts int64, v float64) error {
+	a.wal.mtx.Lock()
+	defer a.wal.mtx.Unlock()
+
+	if _, ok := a.wal.refs[ref]; !ok {
+		return storage.ErrNotFound
+	}
+	a.samples = append(a.samples, record.RefSample{Ref: ref, T: ts, V: v})
+	return nil
+}
+
+// Commit implements storage.Appender.
+func (a *walAppender) Commit() error {
+	var (
+		enc  record.Encoder
+		recs [][]byte
+	)
+	if len(a.series) > 0 {
+		recs = append(recs, enc.Series(a.series, nil))
+	}
+	if len(a.samples) > 0 {
+		recs = append(recs, enc.Samples(a.samples, nil))
+	}
+	if len(recs) == 0 {
+		return nil
+	}
+	if err := a.wal.wal.Log(recs...); err != nil {
+		a.rollbackSeries()
+		return err
+	}
+
+	a.wal.mtx.Lock()
+	for _, sample := range a.samples {
+		if s, ok := a.wal.refs[sample.Ref]; ok && sample.T > s.lastSeen {
+			s.lastSeen = sample.T
+		}
+	}
+	a.wal.mtx.Unlock()
+
+	// Let the remote-write storage know about the appended samples, it uses their rate to scale the queues.
+	app := a.wal.storage.Appender()
+	for _, sample := range a.samples {
+		if _, err := app.Add(nil, sample.T, sample.V); err != nil {
+			return err
+		}
+	}
+	return app.Commit()
+}
+
+// Rollback implements storage.Appender.
+func (a *walAppender) Rollback() error {
+	a.rollbackSeries()
+	a.samples = nil
+	return nil
+}
+
+// rollbackSeries forgets the series created by this appender, they have not been logged.
+func (a *walAppender) rollbackSeries() {
+	a.wal.mtx.Lock()
+	defer a.wal.mtx.Unlock()
+	for _, s := range a.series {
+		if ws, ok := a.wal.refs[s.Ref]; ok {
+			a.wal.removeSeries(ws)
+		}
+	}
+	a.series = nil
+}
+
+// errorAppender fails every append, it is used when the storage of a tenant is unavailable.
+type errorAppender struct {
+	err error
+}
+
+func (a errorAppender) Add(_ labels.Labels, _ int64, _ float64) (uint64, error) { return 0, a.err }
+func (a errorAppender) AddFast(_ uint64, _ int64, _ float64) error              { return a.err }
+func (a errorAppender) Commit() error                                           { return a.err }
+func (a errorAppender) Rollback() error                                         { return nil }
@@ -0,0 +1,183 @@
+package ruler
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/util/services"
+	"github.com/go-kit/kit/log"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	config_util "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/tsdb/wal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/pkg/logql"
+)
+
+// fakeRemoteWrite records the series received through the Prometheus remote-write protocol.
+type fakeRemoteWrite struct {
+	mtx    sync.Mutex
+	series []prompb.TimeSeries
+}
+
+func (rw *fakeRemoteWrite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	compressed, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	buf, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req prompb.WriteRequest
+	if err := proto.Unmarshal(buf, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rw.mtx.Lock()
+	defer rw.mtx.Unlock()
+	rw.series = append(rw.series, req.Timeseries...)
+}
+
+func (rw *fakeRemoteWrite) received() []prompb.TimeSeries {
+	rw.mtx.Lock()
+	defer rw.mtx.Unlock()
+	return rw.series
+}
+
+func newTestRemoteWriteConfig(t *testing.T, dir string, server *httptest.Server) RemoteWriteConfig {
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	client := config.DefaultRemoteWriteConfig
+	client.URL = &config_util.URL{URL: u}
+	client.QueueConfig.BatchSendDeadline = model.Duration(10 * time.Millisecond)
+	return RemoteWriteConfig{
+		Enabled:              true,
+		WALDir:               dir,
+		WALTruncateFrequency: time.Hour,
+		FlushDeadline:        time.Second,
+		Client:               client,
+	}
+}
+
+func Test_RulerRemoteWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	walDir, err := ioutil.TempDir("", "wal")
+	require.NoError(t, err)
+	defer os.RemoveAll(walDir)
+	writeRuleFile(t, dir, "tenant", "api.yaml", testRules)
+
+	rw := &fakeRemoteWrite{}
+	server := httptest.NewServer(rw)
+	defer server.Close()
+
+	cfg := Config{
+		RulePath:           dir,
+		EvaluationInterval: 100 * time.Millisecond,
+		PollInterval:       time.Minute,
+		RemoteWrite:        newTestRemoteWriteConfig(t, walDir, server),
+	}
+	engine := logql.NewEngine(logql.EngineOpts{}, logql.NewMockQuerier(0, newTestStreams()))
+	limits := fakeLimits{"tenant": {"cluster": "eu"}}
+	r, err := NewRuler(cfg, engine, NewLocalRuleStore(dir), limits, prometheus.NewRegistry(), log.NewNopLogger())
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), r))
+	defer func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), r))
+	}()
+
+	// the result of the recording rule is sent with the external labels of the tenant,
+	// like the ALERTS series of the alerting rule.
+	var series prompb.TimeSeries
+	require.Eventually(t, func() bool {
+		for _, s := range rw.received() {
+			if s.Labels[0].Value == "app:errors:count1m" {
+				series = s
+				return true
+			}
+		}
+		return false
+	}, 10*time.Second, 50*time.Millisecond)
+	require.Equal(t, []prompb.Label{
+		{Name: "__name__", Value: "app:errors:count1m"},
+		{Name: "app", Value: "api"},
+		{Name: "cluster", Value: "eu"},
+	}, series.Labels)
+	require.Equal(t, 5., series.Samples[0].Value)
+}
+
+func Test_TenantWAL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	open := func() *tenantWAL {
+		w, err := newTenantWAL(dir, &config.Config{}, time.Second, nil, log.NewNopLogger())
+		require.NoError(t, err)
+		return w
+	}
+
+	w := open()
+	app := w.Appender()
+	ref, err := app.Add(labels.FromStrings("__name__", "foo"), 1000, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), ref)
+	_, err = app.Add(labels.FromStrings("__name__", "bar"), 1000, 1)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+
+	// rolled back series are forgotten.
+	app = w.Appender()
+	_, err = app.Add(labels.FromStrings("__name__", "baz"), 1000, 1)
+	require.NoError(t, err)
+	require.NoError(t, app.Rollback())
+	require.Len(t, w.refs, 2)
+	require.NoError(t, w.close())
+
+	// series are replayed, their references are not reused.
+	w = open()
+	require.Len(t, w.refs, 2)
+	app = w.Appender()
+	ref, err = app.Add(labels.FromStrings("__name__", "foo"), 2000, 2)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), ref)
+	ref, err = app.Add(labels.FromStrings("__name__", "baz"), 2000, 2)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), ref)
+	require.NoError(t, app.Commit())
+
+	// truncation drops the series without recent samples and the old segments.
+	require.NoError(t, w.truncate(1500))
+	require.Len(t, w.refs, 2)
+	require.NotContains(t, w.series, labels.FromStrings("__name__", "bar").String())
+	first, _, err := w.wal.Segments()
+	require.NoError(t, err)
+	require.Greater(t, first, 0)
+	checkpoint, _, err := wal.LastCheckpoint(w.wal.Dir())
+	require.NoError(t, err)
+	require.NotEmpty(t, checkpoint)
+	require.NoError(t, w.close())
+
+	w = open()
+	defer w.close()
+	require.Len(t, w.refs, 2)
+	require.Equal(t, uint64(4), w.nextRef)
+}
@@ -0,0 +1,494 @@
+package ruler
+
+import (
+	"context"
+	"flag"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/services"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/loki/pkg/logql"
+)
+
+// Config for the ruler.
+type Config struct {
+	// Directory holding the rule files of each tenant.
+	RulePath string `yaml:"rule_path"`
+	// How frequently rule groups are evaluated when they don't specify their own interval.
+	EvaluationInterval time.Duration `yaml:"evaluation_interval"`
+	// Delay applied to the evaluation time to give time to the most recent logs to be ingested.
+	EvaluationDelay time.Duration `yaml:"evaluation_delay_duration"`
+	// How frequently rule files are reloaded.
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// URL of the UI used as a source in the alerts sent.
+	ExternalURL flagext.URLValue `yaml:"external_url"`
+
+	// URL of the Alertmanager to send notifications to.
+	AlertmanagerURL         flagext.URLValue `yaml:"alertmanager_url"`
+	AlertmanagerEnableV2API bool             `yaml:"enable_alertmanager_v2"`
+	// Capacity of the queue of notifications waiting to be sent.
+	NotificationQueueCapacity int `yaml:"notification_queue_capacity"`
+	// HTTP timeout when sending notifications to the Alertmanager.
+	NotificationTimeout time.Duration `yaml:"notification_timeout"`
+	// Minimum amount of time to wait before resending an alert to the Alertmanager.
+	ResendDelay time.Duration `yaml:"resend_delay"`
+
+	// Remote-write of the results of recording rules.
+	RemoteWrite RemoteWriteConfig `yaml:"remote_write"`
+}
+
+// RegisterFlags registers flags.
+func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&cfg.RulePath, "ruler.rule-path", "/rules", "Directory holding the rule files of each tenant, as <rule-path>/<tenant>/<namespace>.yaml.")
+	f.DurationVar(&cfg.EvaluationInterval, "ruler.evaluation-interval", time.Minute, "How frequently to evaluate rules.")
+	f.DurationVar(&cfg.EvaluationDelay, "ruler.evaluation-delay-duration", 0, "Duration to delay the evaluation of rules to ensure the underlying logs have been ingested.")
+	f.DurationVar(&cfg.PollInterval, "ruler.poll-interval", time.Minute, "How frequently to poll for rule changes.")
+	f.Var(&cfg.ExternalURL, "ruler.external.url", "URL of alerts return path.")
+	f.Var(&cfg.AlertmanagerURL, "ruler.alertmanager-url", "URL of the Alertmanager to send notifications to.")
+	f.BoolVar(&cfg.AlertmanagerEnableV2API, "ruler.alertmanager-use-v2", false, "If enabled, requests to the Alertmanager will use the V2 API.")
+	f.IntVar(&cfg.NotificationQueueCapacity, "ruler.notification-queue-capacity", 10000, "Capacity of the queue for notifications to be sent to the Alertmanager.")
+	f.DurationVar(&cfg.NotificationTimeout, "ruler.notification-timeout", 10*time.Second, "HTTP timeout duration when sending notifications to the Alertmanager.")
+	f.DurationVar(&cfg.ResendDelay, "ruler.resend-delay", time.Minute, "Minimum amount of time to wait before resending an alert to the Alertmanager.")
+	cfg.RemoteWrite.RegisterFlags(f)
+}
+
+// Validate validates the ruler config.
+func (cfg *Config) Validate() error {
+	if cfg.RulePath == "" {
+		return errors.New("a rule path is required")
+	}
+	if cfg.EvaluationInterval <= 0 {
+		return errors.New("evaluation interval must be greater than zero")
+	}
+	if cfg.PollInterval <= 0 {
+		return errors.New("poll interval must be greater than zero")
+	}
+	return cfg.RemoteWrite.Validate()
+}
+
+// Ruler evaluates the LogQL alerting and recording rules of every tenant.
+type Ruler struct {
+	services.Service
+
+	cfg         Config
+	engine      *logql.Engine
+	store       RuleStore
+	limits      RulesLimits
+	notifierCfg *config.Config
+	logger      log.Logger
+
+	registerer       prometheus.Registerer
+	groupMetrics     *rules.Metrics
+	reloadSuccessful prometheus.Gauge
+
+	mtx    sync.RWMutex
+	groups map[string]map[string]*groupRunner // tenant -> namespace/group name -> running group
+
+	notifiersMtx sync.Mutex
+	notifiers    map[string]*tenantNotifier
+
+	// The WALs are kept until the ruler stops, even when a tenant no longer has rules,
+	// so the samples still in them are sent and their metrics are not registered twice.
+	walsMtx sync.Mutex
+	wals    map[string]*tenantWAL
+}
+
+// NewRuler creates a new ruler evaluating the rules loaded from the store with the given LogQL engine.
+func NewRuler(cfg Config, engine *logql.Engine, store RuleStore, limits RulesLimits, reg prometheus.Registerer, logger log.Logger) (*Ruler, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.ExternalURL.URL == nil {
+		cfg.ExternalURL.URL = &url.URL{}
+	}
+
+	r := &Ruler{
+		cfg:          cfg,
+		engine:       engine,
+		store:        store,
+		limits:       limits,
+		logger:       logger,
+		registerer:   reg,
+		groupMetrics: rules.NewGroupMetrics(prometheus.WrapRegistererWithPrefix("loki_", reg)),
+		reloadSuccessful: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Namespace: "loki",
+			Name:      "ruler_config_last_reload_successful",
+			Help:      "Whether the last rule files reload attempt was successful.",
+		}),
+		groups:    map[string]map[string]*groupRunner{},
+		notifiers: map[string]*tenantNotifier{},
+		wals:      map[string]*tenantWAL{},
+	}
+	if cfg.AlertmanagerURL.URL != nil {
+		r.notifierCfg = buildNotifierConfig(cfg)
+	}
+
+	r.Service = services.NewBasicService(nil, r.running, r.stopping)
+	return r, nil
+}
+
+func (r *Ruler) running(ctx context.Context) error {
+	r.syncRules(ctx)
+
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	// A nil channel never fires, WALs are only truncated when remote-write is enabled.
+	var truncate <-chan time.Time
+	if r.cfg.RemoteWrite.Enabled {
+		truncateTicker := time.NewTicker(r.cfg.RemoteWrite.WALTruncateFrequency)
+		defer truncateTicker.Stop()
+		truncate = truncateTicker.C
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			r.syncRules(ctx)
+		case <-truncate:
+			r.truncateWALs()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (r *Ruler) stopping(_ error) error {
+	r.mtx.Lock()
+	for tenant, groups := range r.groups {
+		for _, g := range groups {
+			g.stop()
+		}
+		delete(r.groups, tenant)
+	}
+	r.mtx.Unlock()
+
+	r.notifiersMtx.Lock()
+	for tenant, n := range r.notifiers {
+		n.stop()
+		delete(r.notifiers, tenant)
+	}
+	r.notifiersMtx.Unlock()
+
+	r.walsMtx.Lock()
+	defer r.walsMtx.Unlock()
+	for tenant, w := range r.wals {
+		if err := w.close(); err != nil {
+			level.Error(r.logger).Log("msg", "unable to close WAL", "tenant", tenant, "err", err)
+		}
+		delete(r.wals, tenant)
+	}
+	return nil
+}
+
+// syncRules reloads the rule groups from the store and starts, updates or stops their evaluation accordingly.
+// On failure the previously loaded rules keep being evaluated.
+func (r *Ruler) syncRules(ctx context.Context) {
+	configs, err := r.store.ListAllRuleGroups(ctx)
+	if err != nil {
+		level.Error(r.logger).Log("msg", "unable to load rules", "err", err)
+		r.reloadSuccessful.Set(0)
+		return
+	}
+
+	groups := make(map[string]map[string]*rules.Group, len(configs))
+	for tenant, rgs := range configs {
+		groups[tenant] = make(map[string]*rules.Group, len(rgs))
+		for _, rg := range rgs {
+			g, err := r.newGroup(tenant, rg)
+			if err != nil {
+				level.Error(r.logger).Log("msg", "unable to create rule group", "tenant", tenant, "namespace", rg.Namespace, "group", rg.Name, "err", err)
+				r.reloadSuccessful.Set(0)
+				return
+			}
+			groups[tenant][groupKey(g)] = g
+		}
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for tenant, tenantGroups := range groups {
+		running, ok := r.groups[tenant]
+		if !ok {
+			running = map[string]*groupRunner{}
+			r.groups[tenant] = running
+		}
+		for key, g := range tenantGroups {
+			old, ok := running[key]
+			if ok && old.group.Equals(g) {
+				continue
+			}
+			if ok {
+				old.stop()
+				g.CopyState(old.group)
+			}
+			running[key] = startGroup(tenant, g)
+		}
+		for key, old := range running {
+			if _, ok := tenantGroups[key]; !ok {
+				old.stop()
+				delete(running, key)
+			}
+		}
+	}
+
+	for tenant, running := range r.groups {
+		if _, ok := groups[tenant]; ok {
+			continue
+		}
+		for _, old := range running {
+			old.stop()
+		}
+		delete(r.groups, tenant)
+		r.removeNotifier(tenant)
+	}
+	r.applyRemoteWriteConfigs()
+	r.reloadSuccessful.Set(1)
+}
+
+// newGroup creates the Prometheus rule group evaluating a rule group of a tenant.
+func (r *Ruler) newGroup(tenant string, rg RuleGroup) (*rules.Group, error) {
+	logger := log.With(r.logger, "tenant", tenant)
+
+	rs := make([]rules.Rule, 0, len(rg.Rules))
+	for _, rl := range rg.Rules {
+		expr, err := logql.ParseSampleExpr(rl.Expr.Value)
+		if err != nil {
+			return nil, err
+		}
+		if rl.Alert.Value != "" {
+			rs = append(rs, rules.NewAlertingRule(
+				rl.Alert.Value,
+				newExprAdapter(expr),
+				time.Duration(rl.For),
+				labels.FromMap(rl.Labels),
+				labels.FromMap(rl.Annotations),
+				nil,
+				true,
+				log.With(logger, "alert", rl.Alert.Value),
+			))
+			continue
+		}
+		rs = append(rs, rules.NewRecordingRule(rl.Record.Value, newExprAdapter(expr), labels.FromMap(rl.Labels)))
+	}
+
+	interval := r.cfg.EvaluationInterval
+	if rg.Interval != 0 {
+		interval = time.Duration(rg.Interval)
+	}
+
+	return rules.NewGroup(rules.GroupOptions{
+		Name:     rg.Name,
+		File:     filepath.Join(tenant, rg.Namespace),
+		Interval: interval,
+		Rules:    rs,
+		Opts: &rules.ManagerOptions{
+			ExternalURL: r.cfg.ExternalURL.URL,
+			QueryFunc:   engineQueryFunc(r.engine, r.cfg.EvaluationDelay),
+			NotifyFunc:  r.notifyFunc(tenant),
+			Context:     user.InjectOrgID(context.Background(), tenant),
+			Appendable:  r.tenantAppendable(tenant),
+			Logger:      logger,
+			Metrics:     r.groupMetrics,
+			ResendDelay: r.cfg.ResendDelay,
+		},
+	}), nil
+}
+
+func groupKey(g *rules.Group) string {
+	return g.File() + ";" + g.Name()
+}
+
+// notifyFunc returns the rules.NotifyFunc sending the alerts of a tenant to the Alertmanager.
+func (r *Ruler) notifyFunc(tenant string) rules.NotifyFunc {
+	if r.notifierCfg == nil {
+		return func(context.Context, string, ...*rules.Alert) {}
+	}
+	return func(ctx context.Context, expr string, alerts ...*rules.Alert) {
+		n, err := r.getOrCreateNotifier(tenant)
+		if err != nil {
+			level.Error(r.logger).Log("msg", "unable to create notifier", "tenant", tenant, "err", err)
+			return
+		}
+		sendAlerts(n, r.cfg.ExternalURL.URL)(ctx, expr, alerts...)
+	}
+}
+
+func (r *Ruler) getOrCreateNotifier(tenant string) (*notifier.Manager, error) {
+	r.notifiersMtx.Lock()
+	defer r.notifiersMtx.Unlock()
+
+	if n, ok := r.notifiers[tenant]; ok {
+		return n.notifier, nil
+	}
+
+	n := newTenantNotifier(tenant, &notifier.Options{
+		QueueCapacity: r.cfg.NotificationQueueCapacity,
+		Registerer:    r.tenantRegisterer(tenant),
+	}, log.With(r.logger, "tenant", tenant))
+	n.run()
+
+	if err := n.applyConfig(r.notifierCfg); err != nil {
+		n.stop()
+		return nil, err
+	}
+	r.notifiers[tenant] = n
+	return n.notifier, nil
+}
+
+func (r *Ruler) removeNotifier(tenant string) {
+	r.notifiersMtx.Lock()
+	defer r.notifiersMtx.Unlock()
+
+	if n, ok := r.notifiers[tenant]; ok {
+		n.stop()
+		delete(r.notifiers, tenant)
+	}
+}
+
+// tenantAppendable returns the storage receiving the samples produced by the recording rules of a tenant.
+func (r *Ruler) tenantAppendable(tenant string) storage.Appendable {
+	if !r.cfg.RemoteWrite.Enabled {
+		return discardAppendable{}
+	}
+	return appendableFunc(func() storage.Appender {
+		w, err := r.getOrCreateWAL(tenant)
+		if err != nil {
+			level.Error(r.logger).Log("msg", "unable to create WAL", "tenant", tenant, "err", err)
+			return errorAppender{err: err}
+		}
+		return w.Appender()
+	})
+}
+
+func (r *Ruler) getOrCreateWAL(tenant string) (*tenantWAL, error) {
+	r.walsMtx.Lock()
+	defer r.walsMtx.Unlock()
+
+	if w, ok := r.wals[tenant]; ok {
+		return w, nil
+	}
+
+	w, err := newTenantWAL(
+		filepath.Join(r.cfg.RemoteWrite.WALDir, tenant),
+		r.remoteWriteConfig(tenant),
+		r.cfg.RemoteWrite.FlushDeadline,
+		r.tenantRegisterer(tenant),
+		log.With(r.logger, "tenant", tenant),
+	)
+	if err != nil {
+		return nil, err
+	}
+	r.wals[tenant] = w
+	return w, nil
+}
+
+// remoteWriteConfig returns the remote-write config of a tenant, which has its own external labels.
+func (r *Ruler) remoteWriteConfig(tenant string) *config.Config {
+	client := r.cfg.RemoteWrite.Client
+	return &config.Config{
+		GlobalConfig: config.GlobalConfig{
+			ExternalLabels: labels.FromMap(r.limits.RulerRemoteWriteExternalLabels(tenant)),
+		},
+		RemoteWriteConfigs: []*config.RemoteWriteConfig{&client},
+	}
+}
+
+// applyRemoteWriteConfigs refreshes the remote-write config of every tenant as their external labels may have changed.
+func (r *Ruler) applyRemoteWriteConfigs() {
+	r.walsMtx.Lock()
+	defer r.walsMtx.Unlock()
+
+	for tenant, w := range r.wals {
+		if err := w.applyConfig(r.remoteWriteConfig(tenant)); err != nil {
+			level.Error(r.logger).Log("msg", "unable to apply remote-write config", "tenant", tenant, "err", err)
+		}
+	}
+}
+
+// truncateWALs removes the samples older than the truncate frequency from the WALs.
+func (r *Ruler) truncateWALs() {
+	r.walsMtx.Lock()
+	defer r.walsMtx.Unlock()
+
+	mint := timestamp.FromTime(time.Now().Add(-r.cfg.RemoteWrite.WALTruncateFrequency))
+	for tenant, w := range r.wals {
+		if err := w.truncate(mint); err != nil {
+			level.Error(r.logger).Log("msg", "unable to truncate WAL", "tenant", tenant, "err", err)
+		}
+	}
+}
+
+// tenantRegisterer returns the registerer of the metrics of the notifier and the remote-write of a tenant.
+func (r *Ruler) tenantRegisterer(tenant string) prometheus.Registerer {
+	reg := prometheus.WrapRegistererWith(prometheus.Labels{"tenant": tenant}, r.registerer)
+	return prometheus.WrapRegistererWithPrefix("loki_", reg)
+}
+
+// tenantGroups returns the rule groups currently evaluated for a tenant.
+func (r *Ruler) tenantGroups(tenant string) []*rules.Group {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	groups := make([]*rules.Group, 0, len(r.groups[tenant]))
+	for _, g := range r.groups[tenant] {
+		groups = append(groups, g.group)
+	}
+	return groups
+}
+
+// groupRunner periodically evaluates a rule group until stopped.
+type groupRunner struct {
+	group  *rules.Group
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func startGroup(tenant string, g *rules.Group) *groupRunner {
+	ctx, cancel := context.WithCancel(user.InjectOrgID(context.Background(), tenant))
+	runner := &groupRunner{
+		group:  g,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(runner.done)
+
+		ticker := time.NewTicker(g.Interval())
+		defer ticker.Stop()
+
+		for {
+			g.Eval(ctx, time.Now())
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return runner
+}
+
+func (g *groupRunner) stop() {
+	g.cancel()
+	<-g.done
+}
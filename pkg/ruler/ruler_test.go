@@ -0,0 +1,239 @@
+package ruler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/services"
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/grafana/loki/pkg/logql"
+)
+
+const testRules = `
+groups:
+  - name: errors
+    rules:
+      - alert: HighErrors
+        expr: sum by (app) (count_over_time({app="api"} |= "error" [1m])) > 2
+        labels:
+          severity: critical
+        annotations:
+          summary: '{{ $labels.app }} logged {{ $value }} errors'
+      - record: app:errors:count1m
+        expr: sum by (app) (count_over_time({app="api"} |= "error" [1m]))
+`
+
+// fakeAlertmanager records the alerts received through the Alertmanager v1 API.
+type fakeAlertmanager struct {
+	mtx    sync.Mutex
+	alerts map[string][]map[string]interface{} // tenant -> alerts
+}
+
+func (am *fakeAlertmanager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/v1/alerts" || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	var alerts []map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	am.mtx.Lock()
+	defer am.mtx.Unlock()
+	tenant := r.Header.Get(user.OrgIDHeaderName)
+	am.alerts[tenant] = append(am.alerts[tenant], alerts...)
+}
+
+func (am *fakeAlertmanager) received(tenant string) []map[string]interface{} {
+	am.mtx.Lock()
+	defer am.mtx.Unlock()
+	return am.alerts[tenant]
+}
+
+func newTestStreams() []logproto.Stream {
+	now := time.Now()
+	stream := logproto.Stream{Labels: `{app="api"}`}
+	for i := 0; i < 10; i++ {
+		line := "info"
+		if i%2 == 0 {
+			line = "error"
+		}
+		stream.Entries = append(stream.Entries, logproto.Entry{
+			Timestamp: now.Add(-time.Duration(10-i) * time.Second),
+			Line:      fmt.Sprintf("level=%s msg=%d", line, i),
+		})
+	}
+	return []logproto.Stream{stream}
+}
+
+type fakeLimits map[string]map[string]string // tenant -> external labels
+
+func (l fakeLimits) RulerRemoteWriteExternalLabels(userID string) map[string]string {
+	return l[userID]
+}
+
+func newTestRuler(t *testing.T, dir string, am *httptest.Server) *Ruler {
+	amURL, err := url.Parse(am.URL)
+	require.NoError(t, err)
+
+	cfg := Config{
+		RulePath:                  dir,
+		EvaluationInterval:        100 * time.Millisecond,
+		PollInterval:              100 * time.Millisecond,
+		AlertmanagerURL:           flagext.URLValue{URL: amURL},
+		NotificationQueueCapacity: 100,
+		NotificationTimeout:       time.Second,
+		ResendDelay:               100 * time.Millisecond,
+	}
+	engine := logql.NewEngine(logql.EngineOpts{}, logql.NewMockQuerier(0, newTestStreams()))
+	r, err := NewRuler(cfg, engine, NewLocalRuleStore(dir), fakeLimits{}, prometheus.NewRegistry(), log.NewNopLogger())
+	require.NoError(t, err)
+	return r
+}
+
+func Test_Ruler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeRuleFile(t, dir, "tenant", "api.yaml", testRules)
+
+	am := &fakeAlertmanager{alerts: map[string][]map[string]interface{}{}}
+	server := httptest.NewServer(am)
+	defer server.Close()
+
+	r := newTestRuler(t, dir, server)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), r))
+	defer func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), r))
+	}()
+
+	// alerts are sent to the Alertmanager on behalf of the tenant,
+	// the discovery of the Alertmanager takes up to 5s.
+	require.Eventually(t, func() bool {
+		return len(am.received("tenant")) > 0
+	}, 15*time.Second, 50*time.Millisecond)
+	alert := am.received("tenant")[0]
+	require.Equal(t, map[string]interface{}{
+		"alertname": "HighErrors",
+		"app":       "api",
+		"severity":  "critical",
+	}, alert["labels"])
+	require.Equal(t, map[string]interface{}{
+		"summary": "api logged 5 errors",
+	}, alert["annotations"])
+
+	// the rules API exposes the state of the rules.
+	req := httptest.NewRequest(http.MethodGet, "/prometheus/api/v1/rules", nil)
+	req = req.WithContext(user.InjectOrgID(req.Context(), "tenant"))
+	rec := httptest.NewRecorder()
+	r.RulesHandler(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var rulesResp struct {
+		Status string `json:"status"`
+		Data   struct {
+			Groups []struct {
+				Name  string `json:"name"`
+				File  string `json:"file"`
+				Rules []struct {
+					Name   string `json:"name"`
+					Query  string `json:"query"`
+					Health string `json:"health"`
+					Type   string `json:"type"`
+					State  string `json:"state"`
+				} `json:"rules"`
+			} `json:"groups"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rulesResp))
+	require.Equal(t, "success", rulesResp.Status)
+	require.Len(t, rulesResp.Data.Groups, 1)
+	group := rulesResp.Data.Groups[0]
+	require.Equal(t, "errors", group.Name)
+	require.Equal(t, filepath.Join("tenant", "api"), group.File)
+	require.Len(t, group.Rules, 2)
+	require.Equal(t, "HighErrors", group.Rules[0].Name)
+	require.Equal(t, "alerting", group.Rules[0].Type)
+	require.Equal(t, "firing", group.Rules[0].State)
+	require.Equal(t, `sum by(app)(count_over_time({app="api"}|="error"[1m])) > 2.000000`, group.Rules[0].Query)
+	require.Equal(t, "app:errors:count1m", group.Rules[1].Name)
+	require.Equal(t, "recording", group.Rules[1].Type)
+	require.Eventually(t, func() bool {
+		for _, g := range r.tenantGroups("tenant") {
+			for _, rl := range g.Rules() {
+				if rl.Health() != "ok" {
+					return false
+				}
+			}
+		}
+		return true
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// the alerts API returns the active alerts.
+	req = httptest.NewRequest(http.MethodGet, "/prometheus/api/v1/alerts", nil)
+	req = req.WithContext(user.InjectOrgID(req.Context(), "tenant"))
+	rec = httptest.NewRecorder()
+	r.AlertsHandler(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var alertsResp struct {
+		Data AlertDiscovery `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &alertsResp))
+	require.Len(t, alertsResp.Data.Alerts, 1)
+	require.Equal(t, "firing", alertsResp.Data.Alerts[0].State)
+	require.Equal(t, 5., alertsResp.Data.Alerts[0].Value)
+
+	// other tenants don't see them.
+	require.Empty(t, r.tenantGroups("other"))
+
+	// rules are unloaded once their file is removed.
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "tenant")))
+	require.Eventually(t, func() bool {
+		return len(r.tenantGroups("tenant")) == 0
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func Test_RulerKeepsRulesOnInvalidReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeRuleFile(t, dir, "tenant", "api.yaml", testRules)
+
+	server := httptest.NewServer(&fakeAlertmanager{alerts: map[string][]map[string]interface{}{}})
+	defer server.Close()
+
+	r := newTestRuler(t, dir, server)
+	r.syncRules(context.Background())
+	defer func() { require.NoError(t, r.stopping(nil)) }()
+	require.Len(t, r.tenantGroups("tenant"), 1)
+
+	writeRuleFile(t, dir, "tenant", "api.yaml", `
+groups:
+  - name: errors
+    rules:
+      - alert: Broken
+        expr: up == 0
+`)
+	r.syncRules(context.Background())
+	groups := r.tenantGroups("tenant")
+	require.Len(t, groups, 1)
+	require.Equal(t, "HighErrors", groups[0].Rules()[0].Name())
+}
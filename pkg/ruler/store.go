@@ -0,0 +1,179 @@
+package ruler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"gopkg.in/yaml.v3"
+
+	"github.com/grafana/loki/pkg/logql"
+)
+
+// RuleGroup is a Prometheus format rule group belonging to a tenant namespace.
+type RuleGroup struct {
+	rulefmt.RuleGroup
+
+	// Namespace is the name of the rule file the group was loaded from.
+	Namespace string
+}
+
+// RuleStore gives access to the rule groups of every tenant.
+type RuleStore interface {
+	// ListAllRuleGroups returns the rule groups of all tenants keyed by tenant ID.
+	ListAllRuleGroups(ctx context.Context) (map[string][]RuleGroup, error)
+}
+
+// LocalRuleStore loads rule groups from the local filesystem.
+// Each tenant has its own directory, every rule file within that directory is a namespace:
+//
+//	<dir>/<tenant>/<namespace>.yaml
+type LocalRuleStore struct {
+	dir string
+}
+
+// NewLocalRuleStore creates a rule store reading rule files from dir.
+func NewLocalRuleStore(dir string) *LocalRuleStore {
+	return &LocalRuleStore{dir: dir}
+}
+
+// ListAllRuleGroups implements RuleStore.
+func (s *LocalRuleStore) ListAllRuleGroups(_ context.Context) (map[string][]RuleGroup, error) {
+	tenants, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read rule directory %s", s.dir)
+	}
+
+	result := map[string][]RuleGroup{}
+	for _, tenant := range tenants {
+		if !tenant.IsDir() {
+			continue
+		}
+		groups, err := s.listTenantRuleGroups(tenant.Name())
+		if err != nil {
+			return nil, err
+		}
+		if len(groups) > 0 {
+			result[tenant.Name()] = groups
+		}
+	}
+	return result, nil
+}
+
+func (s *LocalRuleStore) listTenantRuleGroups(tenant string) ([]RuleGroup, error) {
+	files, err := ioutil.ReadDir(filepath.Join(s.dir, tenant))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read rule directory of tenant %s", tenant)
+	}
+
+	var result []RuleGroup
+	for _, f := range files {
+		if f.IsDir() || !isRuleFile(f) {
+			continue
+		}
+		path := filepath.Join(s.dir, tenant, f.Name())
+		groups, err := parseRuleGroups(path)
+		if err != nil {
+			return nil, err
+		}
+		namespace := strings.TrimSuffix(f.Name(), filepath.Ext(f.Name()))
+		for _, g := range groups {
+			result = append(result, RuleGroup{RuleGroup: g, Namespace: namespace})
+		}
+	}
+	return result, nil
+}
+
+func isRuleFile(f os.FileInfo) bool {
+	switch filepath.Ext(f.Name()) {
+	case ".yaml", ".yml":
+		return true
+	default:
+		return false
+	}
+}
+
+func parseRuleGroups(path string) ([]rulefmt.RuleGroup, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var groups rulefmt.RuleGroups
+	if err := yaml.Unmarshal(content, &groups); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse rule file %s", path)
+	}
+	if err := ValidateRuleGroups(groups.Groups); err != nil {
+		return nil, errors.Wrapf(err, "invalid rule file %s", path)
+	}
+	return groups.Groups, nil
+}
+
+// ValidateRuleGroups validates rule groups the same way Prometheus does except that
+// expressions must be LogQL metric queries.
+func ValidateRuleGroups(groups []rulefmt.RuleGroup) error {
+	names := map[string]struct{}{}
+	for _, g := range groups {
+		if g.Name == "" {
+			return errors.New("rule group name must not be empty")
+		}
+		if _, ok := names[g.Name]; ok {
+			return fmt.Errorf("repeated rule group name %q", g.Name)
+		}
+		names[g.Name] = struct{}{}
+
+		for i, r := range g.Rules {
+			if err := validateRule(r); err != nil {
+				return errors.Wrapf(err, "group %q, rule %d", g.Name, i+1)
+			}
+		}
+	}
+	return nil
+}
+
+func validateRule(r rulefmt.RuleNode) error {
+	switch {
+	case r.Record.Value != "" && r.Alert.Value != "":
+		return errors.New("only one of 'record' and 'alert' must be set")
+	case r.Record.Value == "" && r.Alert.Value == "":
+		return errors.New("one of 'record' or 'alert' must be set")
+	case r.Expr.Value == "":
+		return errors.New("field 'expr' must be set in rule")
+	}
+
+	if _, err := logql.ParseSampleExpr(r.Expr.Value); err != nil {
+		return errors.Wrapf(err, "could not parse expression")
+	}
+
+	if r.Record.Value != "" {
+		if len(r.Annotations) > 0 {
+			return errors.New("invalid field 'annotations' in recording rule")
+		}
+		if r.For != 0 {
+			return errors.New("invalid field 'for' in recording rule")
+		}
+		if !model.IsValidMetricName(model.LabelValue(r.Record.Value)) {
+			return fmt.Errorf("invalid recording rule name: %s", r.Record.Value)
+		}
+	}
+
+	for k, v := range r.Labels {
+		if !model.LabelName(k).IsValid() {
+			return fmt.Errorf("invalid label name: %s", k)
+		}
+		if !model.LabelValue(v).IsValid() {
+			return fmt.Errorf("invalid label value: %s", v)
+		}
+	}
+	for k := range r.Annotations {
+		if !model.LabelName(k).IsValid() {
+			return fmt.Errorf("invalid annotation name: %s", k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package ruler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeRuleFile(t *testing.T, dir, tenant, name, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, tenant), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, tenant, name), []byte(content), 0644))
+}
+
+func Test_LocalRuleStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeRuleFile(t, dir, "tenant-1", "api.yaml", `
+groups:
+  - name: errors
+    interval: 30s
+    rules:
+      - alert: HighErrorRate
+        expr: sum by (app) (count_over_time({app="api"} |= "error" [1m])) > 10
+        for: 5m
+        labels:
+          severity: critical
+      - record: app:errors:rate1m
+        expr: sum by (app) (rate({app="api"} |= "error" [1m]))
+`)
+	writeRuleFile(t, dir, "tenant-1", "README.md", "not a rule file")
+	writeRuleFile(t, dir, "tenant-2", "db.yml", `
+groups:
+  - name: slow
+    rules:
+      - alert: SlowQueries
+        expr: count_over_time({app="db"} |= "slow" [5m]) > 0
+`)
+
+	groups, err := NewLocalRuleStore(dir).ListAllRuleGroups(context.Background())
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+
+	require.Len(t, groups["tenant-1"], 1)
+	g := groups["tenant-1"][0]
+	require.Equal(t, "api", g.Namespace)
+	require.Equal(t, "errors", g.Name)
+	require.Len(t, g.Rules, 2)
+	require.Equal(t, "HighErrorRate", g.Rules[0].Alert.Value)
+	require.Equal(t, "app:errors:rate1m", g.Rules[1].Record.Value)
+
+	require.Len(t, groups["tenant-2"], 1)
+	require.Equal(t, "db", groups["tenant-2"][0].Namespace)
+}
+
+func Test_LocalRuleStoreInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{
+			"promql expression",
+			`
+groups:
+  - name: errors
+    rules:
+      - alert: Up
+        expr: up == 0
+`,
+			"could not parse expression",
+		},
+		{
+			"log query",
+			`
+groups:
+  - name: errors
+    rules:
+      - alert: Errors
+        expr: '{app="api"} |= "error"'
+`,
+			"could not parse expression",
+		},
+		{
+			"record and alert",
+			`
+groups:
+  - name: errors
+    rules:
+      - alert: Errors
+        record: errors
+        expr: count_over_time({app="api"}[1m])
+`,
+			"only one of 'record' and 'alert' must be set",
+		},
+		{
+			"duplicated group",
+			`
+groups:
+  - name: errors
+    rules:
+      - record: errors
+        expr: count_over_time({app="api"}[1m])
+  - name: errors
+    rules:
+      - record: errors
+        expr: count_over_time({app="api"}[1m])
+`,
+			`repeated rule group name "errors"`,
+		},
+		{
+			"invalid record name",
+			`
+groups:
+  - name: errors
+    rules:
+      - record: 1-errors
+        expr: count_over_time({app="api"}[1m])
+`,
+			"invalid recording rule name: 1-errors",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "rules")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			writeRuleFile(t, dir, "tenant", "rules.yaml", tc.content)
+			_, err = NewLocalRuleStore(dir).ListAllRuleGroups(context.Background())
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
@@ -269,18 +269,22 @@ func (l labelCache) computeLabels(c *LazyChunk) string {
 type logBatchIterator struct {
 	*batchChunkIterator
 
-	ctx      context.Context
-	matchers []*labels.Matcher
-	filter   logql.LineFilter
-	labels   labelCache
+	ctx          context.Context
+	matchers     []*labels.Matcher
+	filter       logql.LineFilter
+	bloomFilters *bloomFiltersStore
+	labels       labelCache
 }
 
+// newLogBatchIterator creates an iterator over the entries of the chunks. The chunks skipped by the bloom filters stored
+// next to them, if bloomFilters is not nil, are not fetched.
 func newLogBatchIterator(
 	ctx context.Context,
 	chunks []*LazyChunk,
 	batchSize int,
 	matchers []*labels.Matcher,
 	filter logql.LineFilter,
+	bloomFilters *bloomFiltersStore,
 	direction logproto.Direction,
 	start, end time.Time,
 ) (iter.EntryIterator, error) {
@@ -289,10 +293,11 @@ func newLogBatchIterator(
 	// The same applies to the sharding label which is injected by the cortex storage code.
 	matchers = removeMatchersByName(matchers, labels.MetricName, astmapper.ShardLabel)
 	logbatch := &logBatchIterator{
-		labels:   map[model.Fingerprint]string{},
-		matchers: matchers,
-		filter:   filter,
-		ctx:      ctx,
+		labels:       map[model.Fingerprint]string{},
+		matchers:     matchers,
+		filter:       filter,
+		bloomFilters: bloomFilters,
+		ctx:          ctx,
 	}
 	batch := newBatchChunkIterator(ctx, chunks, batchSize, direction, start, end, logbatch.newChunksIterator)
 	logbatch.batchChunkIterator = batch
@@ -305,6 +310,7 @@ func (it *logBatchIterator) Entry() logproto.Entry {
 
 // newChunksIterator creates an iterator over a set of lazychunks.
 func (it *logBatchIterator) newChunksIterator(chunks []*LazyChunk, from, through time.Time, nextChunk *LazyChunk) (genericIterator, error) {
+	chunks = it.bloomFilters.filter(it.ctx, chunks, it.start, it.end, it.filter)
 	chksBySeries, err := fetchChunkBySeries(it.ctx, chunks, it.matchers)
 	if err != nil {
 		return nil, err
@@ -339,7 +345,7 @@ func (it *logBatchIterator) buildHeapIterator(chks [][]*LazyChunk, from, through
 	for i := range chks {
 		iterators := make([]iter.EntryIterator, 0, len(chks[i]))
 		for j := range chks[i] {
-			if !chks[i][j].IsValid {
+			if !chks[i][j].IsValid || !mayMatch(chks[i][j], from, through, it.filter) {
 				continue
 			}
 			iterator, err := chks[i][j].Iterator(it.ctx, from, through, it.direction, it.filter, nextChunk)
@@ -362,19 +368,23 @@ func (it *logBatchIterator) buildHeapIterator(chks [][]*LazyChunk, from, through
 type sampleBatchIterator struct {
 	*batchChunkIterator
 
-	ctx       context.Context
-	matchers  []*labels.Matcher
-	filter    logql.LineFilter
-	extractor logql.SampleExtractor
-	labels    labelCache
+	ctx          context.Context
+	matchers     []*labels.Matcher
+	filter       logql.LineFilter
+	bloomFilters *bloomFiltersStore
+	extractor    logql.SampleExtractor
+	labels       labelCache
 }
 
+// newSampleBatchIterator creates an iterator over the samples of the chunks. The chunks skipped by the bloom filters
+// stored next to them, if bloomFilters is not nil, are not fetched.
 func newSampleBatchIterator(
 	ctx context.Context,
 	chunks []*LazyChunk,
 	batchSize int,
 	matchers []*labels.Matcher,
 	filter logql.LineFilter,
+	bloomFilters *bloomFiltersStore,
 	extractor logql.SampleExtractor,
 	start, end time.Time,
 ) (iter.SampleIterator, error) {
@@ -384,11 +394,12 @@ func newSampleBatchIterator(
 	matchers = removeMatchersByName(matchers, labels.MetricName, astmapper.ShardLabel)
 
 	samplebatch := &sampleBatchIterator{
-		labels:    map[model.Fingerprint]string{},
-		matchers:  matchers,
-		filter:    filter,
-		extractor: extractor,
-		ctx:       ctx,
+		labels:       map[model.Fingerprint]string{},
+		matchers:     matchers,
+		filter:       filter,
+		bloomFilters: bloomFilters,
+		extractor:    extractor,
+		ctx:          ctx,
 	}
 	batch := newBatchChunkIterator(ctx, chunks, batchSize, logproto.FORWARD, start, end, samplebatch.newChunksIterator)
 	samplebatch.batchChunkIterator = batch
@@ -401,6 +412,7 @@ func (it *sampleBatchIterator) Sample() logproto.Sample {
 
 // newChunksIterator creates an iterator over a set of lazychunks.
 func (it *sampleBatchIterator) newChunksIterator(chunks []*LazyChunk, from, through time.Time, nextChunk *LazyChunk) (genericIterator, error) {
+	chunks = it.bloomFilters.filter(it.ctx, chunks, it.start, it.end, it.filter)
 	chksBySeries, err := fetchChunkBySeries(it.ctx, chunks, it.matchers)
 	if err != nil {
 		return nil, err
@@ -434,7 +446,7 @@ func (it *sampleBatchIterator) buildHeapIterator(chks [][]*LazyChunk, from, thro
 	for i := range chks {
 		iterators := make([]iter.SampleIterator, 0, len(chks[i]))
 		for j := range chks[i] {
-			if !chks[i][j].IsValid {
+			if !chks[i][j].IsValid || !mayMatch(chks[i][j], from, through, it.filter) {
 				continue
 			}
 			iterator, err := chks[i][j].SampleIterator(it.ctx, from, through, it.filter, it.extractor, nextChunk)
@@ -579,6 +591,16 @@ func fetchLazyChunks(ctx context.Context, chunks []*LazyChunk) error {
 	return nil
 }
 
+// mayMatch returns false when the bloom filters of the fetched chunk tell the filter can't match any of its lines,
+// the chunk is then not decoded. It skips the chunks whose bloom filters are not stored next to them.
+func mayMatch(c *LazyChunk, from, through time.Time, filter logql.LineFilter) bool {
+	if chunkenc.MayMatch(c.Chunk.Data, from, through, filter) {
+		return true
+	}
+	bloomFilterSkippedChunks.WithLabelValues("true").Inc()
+	return false
+}
+
 func isInvalidChunkError(err error) bool {
 	err = errors.Cause(err)
 	if err, ok := err.(promql.ErrStorage); ok {
@@ -3,12 +3,15 @@ package storage
 import (
 	"context"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/cespare/xxhash/v2"
 	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/cache"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/promql"
@@ -553,7 +556,7 @@ func Test_newLogBatchChunkIterator(t *testing.T) {
 	for name, tt := range tests {
 		tt := tt
 		t.Run(name, func(t *testing.T) {
-			it, err := newLogBatchIterator(context.Background(), tt.chunks, tt.batchSize, newMatchers(tt.matchers), nil, tt.direction, tt.start, tt.end)
+			it, err := newLogBatchIterator(context.Background(), tt.chunks, tt.batchSize, newMatchers(tt.matchers), nil, nil, tt.direction, tt.start, tt.end)
 			require.NoError(t, err)
 			streams, _, err := iter.ReadBatch(it, 1000)
 			_ = it.Close()
@@ -567,6 +570,119 @@ func Test_newLogBatchChunkIterator(t *testing.T) {
 	}
 }
 
+func Test_newLogBatchChunkIterator_BloomFilters(t *testing.T) {
+	newBloomChunk := func(lines ...string) *LazyChunk {
+		c := newLazyChunk(logproto.Stream{Labels: fooLabelsWithName, Entries: []logproto.Entry{{Timestamp: from, Line: "placeholder"}}})
+		chk := chunkenc.NewMemChunk(chunkenc.EncGZIP, 256*1024, 0)
+		chk.EnableBloomFilters()
+		for i, line := range lines {
+			require.NoError(t, chk.Append(&logproto.Entry{Timestamp: from.Add(time.Duration(i) * time.Millisecond), Line: line}))
+		}
+		require.NoError(t, chk.Close())
+		c.Chunk.Data = chunkenc.NewFacade(chk, 0, 0)
+		c.Chunk.Through = model.TimeFromUnixNano(from.Add(time.Duration(len(lines)-1) * time.Millisecond).UnixNano())
+		return c
+	}
+	chunks := []*LazyChunk{
+		newBloomChunk("traceID=e0cc9e1a8c39e8b1", "traceID=2107b6b551458908"),
+		newBloomChunk("traceID=1111111111111111", "traceID=2222222222222222"),
+	}
+
+	filter, err := logql.ParseLogSelector(`{foo="bar"} |= "2107b6b551458908"`)
+	require.NoError(t, err)
+	f, err := filter.Filter()
+	require.NoError(t, err)
+
+	skipped := testutil.ToFloat64(bloomFilterSkippedChunks.WithLabelValues("true"))
+	it, err := newLogBatchIterator(context.Background(), chunks, 2, newMatchers(fooLabels), f, nil, logproto.FORWARD, from, from.Add(time.Second))
+	require.NoError(t, err)
+	streams, _, err := iter.ReadBatch(it, 1000)
+	require.NoError(t, err)
+	require.NoError(t, it.Close())
+
+	assertStream(t, []logproto.Stream{
+		{Labels: fooLabels, Entries: []logproto.Entry{{Timestamp: from.Add(time.Millisecond), Line: "traceID=2107b6b551458908"}}},
+	}, streams.Streams)
+	require.Equal(t, skipped+1, testutil.ToFloat64(bloomFilterSkippedChunks.WithLabelValues("true")))
+}
+
+// fetchRecordingChunkClient records the keys of the chunks fetched.
+type fetchRecordingChunkClient struct {
+	mockChunkStoreClient
+
+	mtx     sync.Mutex
+	fetched []string
+}
+
+func (c *fetchRecordingChunkClient) GetChunks(ctx context.Context, chunks []chunk.Chunk) ([]chunk.Chunk, error) {
+	c.mtx.Lock()
+	for _, chk := range chunks {
+		c.fetched = append(c.fetched, chk.ExternalKey())
+	}
+	c.mtx.Unlock()
+	return c.mockChunkStoreClient.GetChunks(ctx, chunks)
+}
+
+func Test_newLogBatchChunkIterator_StoredBloomFilters(t *testing.T) {
+	newBloomChunk := func(lines ...string) chunk.Chunk {
+		c := newChunk(logproto.Stream{Labels: fooLabelsWithName, Entries: []logproto.Entry{{Timestamp: from, Line: "placeholder"}}})
+		chk := chunkenc.NewMemChunk(chunkenc.EncGZIP, 256*1024, 0)
+		chk.EnableBloomFilters()
+		for i, line := range lines {
+			require.NoError(t, chk.Append(&logproto.Entry{Timestamp: from.Add(time.Duration(i) * time.Millisecond), Line: line}))
+		}
+		require.NoError(t, chk.Close())
+		c.Data = chunkenc.NewFacade(chk, 0, 0)
+		c.Through = model.TimeFromUnixNano(from.Add(time.Duration(len(lines)-1) * time.Millisecond).UnixNano())
+		require.NoError(t, c.Encode())
+		return c
+	}
+	matching := newBloomChunk("traceID=e0cc9e1a8c39e8b1", "traceID=2107b6b551458908")
+	other := newBloomChunk("traceID=1111111111111111", "traceID=2222222222222222")
+	withoutFilters := newChunk(logproto.Stream{Labels: fooLabelsWithName, Entries: []logproto.Entry{
+		{Timestamp: from.Add(time.Second), Line: "traceID=2107b6b551458908"},
+		{Timestamp: from.Add(time.Second + time.Millisecond), Line: "traceID=3333333333333333"},
+	}})
+
+	ctx := context.Background()
+	bloomFilters, err := newBloomFiltersStore(Config{}, chunk.SchemaConfig{Configs: []chunk.PeriodConfig{{ObjectType: "inmemory"}}})
+	require.NoError(t, err)
+	require.NoError(t, bloomFilters.put(ctx, []chunk.Chunk{matching, other, withoutFilters}))
+
+	client := &fetchRecordingChunkClient{mockChunkStoreClient: mockChunkStoreClient{chunks: []chunk.Chunk{matching, other, withoutFilters}}}
+	fetcher, err := chunk.NewChunkFetcher(cache.NewNoopCache(), false, client)
+	require.NoError(t, err)
+	defer fetcher.Stop()
+	var chunks []*LazyChunk
+	for _, c := range []chunk.Chunk{matching, other, withoutFilters} {
+		ref, err := chunk.ParseExternalKey(c.UserID, c.ExternalKey())
+		require.NoError(t, err)
+		chunks = append(chunks, &LazyChunk{Chunk: ref, Fetcher: fetcher})
+	}
+
+	filter, err := logql.ParseLogSelector(`{foo="bar"} |= "2107b6b551458908"`)
+	require.NoError(t, err)
+	f, err := filter.Filter()
+	require.NoError(t, err)
+
+	skipped := testutil.ToFloat64(bloomFilterSkippedChunks.WithLabelValues("false"))
+	it, err := newLogBatchIterator(ctx, chunks, 2, newMatchers(fooLabels), f, bloomFilters, logproto.FORWARD, from, from.Add(2*time.Second))
+	require.NoError(t, err)
+	streams, _, err := iter.ReadBatch(it, 1000)
+	require.NoError(t, err)
+	require.NoError(t, it.Close())
+
+	assertStream(t, []logproto.Stream{
+		{Labels: fooLabels, Entries: []logproto.Entry{
+			{Timestamp: from.Add(time.Millisecond), Line: "traceID=2107b6b551458908"},
+			{Timestamp: from.Add(time.Second), Line: "traceID=2107b6b551458908"},
+		}},
+	}, streams.Streams)
+	// the chunk the filter can't match is never fetched, the chunk without bloom filters is.
+	require.ElementsMatch(t, []string{matching.ExternalKey(), withoutFilters.ExternalKey()}, client.fetched)
+	require.Equal(t, skipped+1, testutil.ToFloat64(bloomFilterSkippedChunks.WithLabelValues("false")))
+}
+
 func Test_newSampleBatchChunkIterator(t *testing.T) {
 
 	tests := map[string]struct {
@@ -838,7 +954,7 @@ func Test_newSampleBatchChunkIterator(t *testing.T) {
 	for name, tt := range tests {
 		tt := tt
 		t.Run(name, func(t *testing.T) {
-			it, err := newSampleBatchIterator(context.Background(), tt.chunks, tt.batchSize, newMatchers(tt.matchers), nil, logql.ExtractCount, tt.start, tt.end)
+			it, err := newSampleBatchIterator(context.Background(), tt.chunks, tt.batchSize, newMatchers(tt.matchers), nil, nil, logql.ExtractCount, tt.start, tt.end)
 			require.NoError(t, err)
 			series, _, err := iter.ReadSampleBatch(it, 1000)
 			_ = it.Close()
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/loki/pkg/chunkenc"
+	"github.com/grafana/loki/pkg/logql"
+	"github.com/grafana/loki/pkg/storage/stores/local"
+	storage_util "github.com/grafana/loki/pkg/storage/stores/util"
+)
+
+var bloomFilterSkippedChunks = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "loki",
+	Name:      "store_bloom_filter_skipped_chunks_total",
+	Help:      "Total number of chunks skipped by queries because their bloom filters tell the line filter can't match, by whether they were fetched.",
+}, []string{"fetched"})
+
+// bloomFiltersStore stores the bloom filters of the chunks next to them, in the object store of their schema period.
+// Queries read them before fetching the chunks, to skip the chunks their line filters can't match.
+type bloomFiltersStore struct {
+	periods []bloomFiltersPeriod
+}
+
+type bloomFiltersPeriod struct {
+	from model.Time
+	// client is nil when the chunks of the period are not stored in an object store.
+	client chunk.ObjectClient
+}
+
+func newBloomFiltersStore(cfg Config, schemaCfg chunk.SchemaConfig) (*bloomFiltersStore, error) {
+	s := &bloomFiltersStore{}
+	for _, period := range schemaCfg.Configs {
+		objectType := period.ObjectType
+		if objectType == "" {
+			objectType = period.IndexType
+		}
+
+		var client chunk.ObjectClient
+		switch objectType {
+		case "aws", "s3", "gcs", "azure", "swift", "inmemory", local.FilesystemObjectStoreType:
+			var err error
+			client, err = NewObjectClient(objectType, cfg)
+			if err != nil {
+				return nil, err
+			}
+		}
+		s.periods = append(s.periods, bloomFiltersPeriod{from: period.From.Time, client: client})
+	}
+	return s, nil
+}
+
+// client returns the object client of the period of a chunk starting at from, nil if there is none.
+func (s *bloomFiltersStore) client(from model.Time) chunk.ObjectClient {
+	i := sort.Search(len(s.periods), func(i int) bool { return s.periods[i].from > from })
+	if i == 0 {
+		return nil
+	}
+	return s.periods[i-1].client
+}
+
+// put stores the bloom filters of the chunks which have some.
+func (s *bloomFiltersStore) put(ctx context.Context, chunks []chunk.Chunk) error {
+	if s == nil {
+		return nil
+	}
+	for _, c := range chunks {
+		client := s.client(c.From)
+		if client == nil {
+			continue
+		}
+		filters := chunkenc.NewBloomFilters(c.Data)
+		if filters == nil {
+			continue
+		}
+		if err := client.PutObject(ctx, storage_util.BloomFiltersKey(c.UserID, c.ExternalKey()), bytes.NewReader(filters.Bytes())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filter returns the chunks the filter may match between from and through, the bounds of the query, the bloom filters
+// of the chunks not fetched yet are read to skip the others. Chunks without bloom filters are kept.
+func (s *bloomFiltersStore) filter(ctx context.Context, chunks []*LazyChunk, from, through time.Time, filter logql.LineFilter) []*LazyChunk {
+	if s == nil || filter == nil {
+		return chunks
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range chunks {
+		if c.Chunk.Data != nil || c.bloomFiltersChecked {
+			continue
+		}
+		client := s.client(c.Chunk.From)
+		if client == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(c *LazyChunk) {
+			defer wg.Done()
+			c.bloomFiltersChecked = true
+			filters, err := s.get(ctx, client, c.Chunk)
+			if err != nil {
+				if err != chunk.ErrStorageObjectNotFound && !os.IsNotExist(err) {
+					level.Warn(util.WithContext(ctx, util.Logger)).Log("msg", "failed to read the bloom filters of a chunk", "chunk", c.Chunk.ExternalKey(), "err", err)
+				}
+				return
+			}
+			if !filters.MayMatch(from, through, filter) {
+				c.bloomFiltersSkipped = true
+				bloomFilterSkippedChunks.WithLabelValues("false").Inc()
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	result := chunks[:0:0]
+	for _, c := range chunks {
+		if !c.bloomFiltersSkipped {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+func (s *bloomFiltersStore) get(ctx context.Context, client chunk.ObjectClient, c chunk.Chunk) (*chunkenc.BloomFilters, error) {
+	r, err := client.GetObject(ctx, storage_util.BloomFiltersKey(c.UserID, c.ExternalKey()))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return chunkenc.DecodeBloomFilters(b)
+}
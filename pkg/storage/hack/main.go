@@ -65,6 +65,7 @@ func getStore() (lstore.Store, error) {
 			},
 		},
 		&validation.Overrides{},
+		nil,
 		prometheus.DefaultRegisterer,
 	)
 	if err != nil {
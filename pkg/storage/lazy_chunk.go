@@ -19,6 +19,11 @@ type LazyChunk struct {
 	IsValid bool
 	Fetcher *chunk.Fetcher
 
+	// Whether the bloom filters stored next to the chunk were read, and tell the line filter of the query can't
+	// match it. The chunk is then not fetched.
+	bloomFiltersChecked bool
+	bloomFiltersSkipped bool
+
 	// cache of overlapping block.
 	// We use the offset of the block as key since it's unique per chunk.
 	overlappingBlocks       map[int]*cachedIterator
@@ -58,7 +63,8 @@ func (c *LazyChunk) Iterator(
 		}
 		// if the block is overlapping cache it with the next chunk boundaries.
 		if nextChunk != nil && IsBlockOverlapping(b, nextChunk, direction) {
-			it := newCachedIterator(b.Iterator(ctx, filter), b.Entries())
+			// the cached block is reused by the next batches, which have other bounds.
+			it := newCachedIterator(b.Iterator(ctx, blockFrom(b), blockThrough(b), filter), b.Entries())
 			its = append(its, it)
 			if c.overlappingBlocks == nil {
 				c.overlappingBlocks = make(map[int]*cachedIterator)
@@ -70,15 +76,18 @@ func (c *LazyChunk) Iterator(
 			delete(c.overlappingBlocks, b.Offset())
 		}
 		// non-overlapping block with the next chunk are not cached.
-		its = append(its, b.Iterator(ctx, filter))
+		its = append(its, b.Iterator(ctx, from, through, filter))
 	}
 
 	// build the final iterator bound to the requested time range.
-	iterForward := iter.NewTimeRangedIterator(
-		iter.NewNonOverlappingIterator(its, ""),
-		from,
-		through,
-	)
+	// Blocks of chunks built from out of order entries may overlap and need to be merged.
+	var it iter.EntryIterator
+	if blocksOverlapping(blocks) {
+		it = iter.NewHeapIterator(ctx, its, logproto.FORWARD)
+	} else {
+		it = iter.NewNonOverlappingIterator(its, "")
+	}
+	iterForward := iter.NewTimeRangedIterator(it, from, through)
 
 	if direction == logproto.FORWARD {
 		return iterForward, nil
@@ -120,7 +129,8 @@ func (c *LazyChunk) SampleIterator(
 		}
 		// if the block is overlapping cache it with the next chunk boundaries.
 		if nextChunk != nil && IsBlockOverlapping(b, nextChunk, logproto.FORWARD) {
-			it := newCachedSampleIterator(b.SampleIterator(ctx, filter, extractor), b.Entries())
+			// the cached block is reused by the next batches, which have other bounds.
+			it := newCachedSampleIterator(b.SampleIterator(ctx, blockFrom(b), blockThrough(b), filter, extractor), b.Entries())
 			its = append(its, it)
 			if c.overlappingSampleBlocks == nil {
 				c.overlappingSampleBlocks = make(map[int]*cachedSampleIterator)
@@ -132,15 +142,36 @@ func (c *LazyChunk) SampleIterator(
 			delete(c.overlappingBlocks, b.Offset())
 		}
 		// non-overlapping block with the next chunk are not cached.
-		its = append(its, b.SampleIterator(ctx, filter, extractor))
+		its = append(its, b.SampleIterator(ctx, from, through, filter, extractor))
 	}
 
 	// build the final iterator bound to the requested time range.
-	return iter.NewTimeRangedSampleIterator(
-		iter.NewNonOverlappingSampleIterator(its, ""),
-		from.UnixNano(),
-		through.UnixNano(),
-	), nil
+	var it iter.SampleIterator
+	if blocksOverlapping(blocks) {
+		it = iter.NewHeapSampleIterator(ctx, its)
+	} else {
+		it = iter.NewNonOverlappingSampleIterator(its, "")
+	}
+	return iter.NewTimeRangedSampleIterator(it, from.UnixNano(), through.UnixNano()), nil
+}
+
+// blockFrom and blockThrough return the bounds of a block, including all its entries.
+func blockFrom(b chunkenc.Block) time.Time {
+	return time.Unix(0, b.MinTime())
+}
+
+func blockThrough(b chunkenc.Block) time.Time {
+	return time.Unix(0, b.MaxTime())
+}
+
+// blocksOverlapping returns whether a block starts before the end of the previous one.
+func blocksOverlapping(blocks []chunkenc.Block) bool {
+	for i := 1; i < len(blocks); i++ {
+		if blocks[i].MinTime() < blocks[i-1].MaxTime() {
+			return true
+		}
+	}
+	return false
 }
 
 func IsBlockOverlapping(b chunkenc.Block, with *LazyChunk, direction logproto.Direction) bool {
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -99,12 +100,14 @@ type fakeBlock struct {
 	mint, maxt int64
 }
 
-func (fakeBlock) Entries() int                                                  { return 0 }
-func (fakeBlock) Offset() int                                                   { return 0 }
-func (f fakeBlock) MinTime() int64                                              { return f.mint }
-func (f fakeBlock) MaxTime() int64                                              { return f.maxt }
-func (fakeBlock) Iterator(context.Context, logql.LineFilter) iter.EntryIterator { return nil }
-func (fakeBlock) SampleIterator(context.Context, logql.LineFilter, logql.SampleExtractor) iter.SampleIterator {
+func (fakeBlock) Entries() int     { return 0 }
+func (fakeBlock) Offset() int      { return 0 }
+func (f fakeBlock) MinTime() int64 { return f.mint }
+func (f fakeBlock) MaxTime() int64 { return f.maxt }
+func (fakeBlock) Iterator(context.Context, time.Time, time.Time, logql.LineFilter) iter.EntryIterator {
+	return nil
+}
+func (fakeBlock) SampleIterator(context.Context, time.Time, time.Time, logql.LineFilter, logql.SampleExtractor) iter.SampleIterator {
 	return nil
 }
 
@@ -114,3 +117,68 @@ func blockWithBounds(mint, maxt int64) chunkenc.Block {
 		mint: mint,
 	}
 }
+
+// boundsRecordingChunk records the bounds its blocks are iterated with.
+type boundsRecordingChunk struct {
+	chunkenc.Chunk
+	bounds [][2]time.Time
+}
+
+func (c *boundsRecordingChunk) Blocks(from, through time.Time) []chunkenc.Block {
+	var blocks []chunkenc.Block
+	for _, b := range c.Chunk.Blocks(from, through) {
+		blocks = append(blocks, boundsRecordingBlock{Block: b, chunk: c})
+	}
+	return blocks
+}
+
+type boundsRecordingBlock struct {
+	chunkenc.Block
+	chunk *boundsRecordingChunk
+}
+
+func (b boundsRecordingBlock) Iterator(ctx context.Context, from, through time.Time, filter logql.LineFilter) iter.EntryIterator {
+	b.chunk.bounds = append(b.chunk.bounds, [2]time.Time{from, through})
+	return b.Block.Iterator(ctx, from, through, filter)
+}
+
+func (b boundsRecordingBlock) SampleIterator(ctx context.Context, from, through time.Time, filter logql.LineFilter, extractor logql.SampleExtractor) iter.SampleIterator {
+	b.chunk.bounds = append(b.chunk.bounds, [2]time.Time{from, through})
+	return b.Block.SampleIterator(ctx, from, through, filter, extractor)
+}
+
+func TestLazyChunkIterator_BlockBounds(t *testing.T) {
+	stream := logproto.Stream{Labels: fooLabelsWithName}
+	for i := 0; i < 20000; i++ {
+		stream.Entries = append(stream.Entries, logproto.Entry{
+			Timestamp: from.Add(time.Duration(i) * time.Millisecond),
+			Line:      fmt.Sprintf("line %d with some padding to fill the block", i),
+		})
+	}
+	c := newLazyChunk(stream)
+	chk := &boundsRecordingChunk{Chunk: c.Chunk.Data.(*chunkenc.Facade).LokiChunk()}
+	c.Chunk.Data = chunkenc.NewFacade(chk, 0, 0)
+	start, end := from.Add(15000*time.Millisecond), from.Add(15010*time.Millisecond)
+
+	// the blocks are iterated within the bounds of the query, so they are entered at the closest point of their index
+	// before its start.
+	it, err := c.Iterator(context.Background(), start, end, logproto.FORWARD, nil, nil)
+	require.NoError(t, err)
+	lines := 0
+	for it.Next() {
+		lines++
+	}
+	require.NoError(t, it.Close())
+	require.Equal(t, 10, lines)
+
+	sampleIt, err := c.SampleIterator(context.Background(), start, end, nil, logql.ExtractCount, nil)
+	require.NoError(t, err)
+	samples := 0
+	for sampleIt.Next() {
+		samples++
+	}
+	require.NoError(t, sampleIt.Close())
+	require.Equal(t, 10, samples)
+
+	require.Equal(t, [][2]time.Time{{start, end}, {start, end}}, chk.bounds)
+}
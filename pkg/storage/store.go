@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"sort"
 
@@ -18,6 +19,7 @@ import (
 	"github.com/grafana/loki/pkg/logproto"
 	"github.com/grafana/loki/pkg/logql"
 	"github.com/grafana/loki/pkg/logql/stats"
+	"github.com/grafana/loki/pkg/storage/stores/deletion"
 	"github.com/grafana/loki/pkg/storage/stores/local"
 	"github.com/grafana/loki/pkg/util"
 )
@@ -27,6 +29,7 @@ type Config struct {
 	storage.Config      `yaml:",inline"`
 	MaxChunkBatchSize   int                 `yaml:"max_chunk_batch_size"`
 	BoltDBShipperConfig local.ShipperConfig `yaml:"boltdb_shipper"`
+	BloomFilters        bool                `yaml:"bloom_filters"`
 }
 
 // RegisterFlags adds the flags required to configure this flag set.
@@ -34,6 +37,18 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	cfg.Config.RegisterFlags(f)
 	cfg.BoltDBShipperConfig.RegisterFlags(f)
 	f.IntVar(&cfg.MaxChunkBatchSize, "max-chunk-batch-size", 50, "The maximum number of chunks to fetch per batch.")
+	f.BoolVar(&cfg.BloomFilters, "store.bloom-filters", false, "Store the bloom filters of the chunks next to them in the object store, so that queries with line filters skip the chunks they can't match without fetching them.")
+}
+
+// Validate config and returns error on failure
+func (cfg *Config) Validate() error {
+	if err := cfg.Config.Validate(); err != nil {
+		return err
+	}
+	if cfg.BoltDBShipperConfig.SharedStoreType == local.FilesystemObjectStoreType && cfg.FSConfig.Directory == "" {
+		return errors.New("filesystem directory must be set when it is the shared store of boltdb-shipper")
+	}
+	return nil
 }
 
 // Store is the Loki chunk store to retrieve and save chunks.
@@ -46,21 +61,43 @@ type Store interface {
 
 type store struct {
 	chunk.Store
-	cfg Config
+	cfg            Config
+	deleteRequests deletion.DeleteRequestsGetter
+	// bloomFilters is nil unless the bloom filters of the chunks are stored next to them.
+	bloomFilters *bloomFiltersStore
 }
 
 // NewStore creates a new Loki Store using configuration supplied.
-func NewStore(cfg Config, storeCfg chunk.StoreConfig, schemaCfg chunk.SchemaConfig, limits storage.StoreLimits, registerer prometheus.Registerer) (Store, error) {
+// The logs of the delete requests returned by deleteRequests, which can be nil, are filtered out of the queries until
+// they are deleted from the store.
+func NewStore(cfg Config, storeCfg chunk.StoreConfig, schemaCfg chunk.SchemaConfig, limits storage.StoreLimits, deleteRequests deletion.DeleteRequestsGetter, registerer prometheus.Registerer) (Store, error) {
 	s, err := storage.NewStore(cfg.Config, storeCfg, schemaCfg, limits, registerer, nil)
 	if err != nil {
 		return nil, err
 	}
+	var bloomFilters *bloomFiltersStore
+	if cfg.BloomFilters {
+		bloomFilters, err = newBloomFiltersStore(cfg, schemaCfg)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return &store{
-		Store: s,
-		cfg:   cfg,
+		Store:          s,
+		cfg:            cfg,
+		deleteRequests: deleteRequests,
+		bloomFilters:   bloomFilters,
 	}, nil
 }
 
+// Put implements chunk.Store, the bloom filters of the chunks are stored next to them if enabled.
+func (s *store) Put(ctx context.Context, chunks []chunk.Chunk) error {
+	if err := s.Store.Put(ctx, chunks); err != nil {
+		return err
+	}
+	return s.bloomFilters.put(ctx, chunks)
+}
+
 // NewTableClient creates a TableClient for managing tables for index/chunk store.
 // ToDo: Add support in Cortex for registering custom table client like index client.
 func NewTableClient(name string, cfg Config) (chunk.TableClient, error) {
@@ -71,6 +108,16 @@ func NewTableClient(name string, cfg Config) (chunk.TableClient, error) {
 	return storage.NewTableClient(name, cfg.Config)
 }
 
+// NewObjectClient makes a new ObjectClient of the given type.
+// The filesystem object client writes objects atomically so that files being uploaded can be read concurrently,
+// which boltdb-shipper relies on when its shared store is the filesystem.
+func NewObjectClient(name string, cfg Config) (chunk.ObjectClient, error) {
+	if name == local.FilesystemObjectStoreType {
+		return local.NewFSObjectClient(cfg.FSConfig)
+	}
+	return storage.NewObjectClient(name, cfg.Config)
+}
+
 // decodeReq sanitizes an incoming request, rounds bounds, appends the __name__ matcher,
 // and adds the "__cortex_shard__" label if this is a sharded query.
 func decodeReq(req logql.QueryParams) ([]*labels.Matcher, logql.LineFilter, model.Time, model.Time, error) {
@@ -236,6 +283,16 @@ func (s *store) SelectLogs(ctx context.Context, req logql.SelectLogParams) (iter
 		return nil, err
 	}
 
+	expr, err := req.LogSelector()
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline, err := expr.Pipeline()
+	if err != nil {
+		return nil, err
+	}
+
 	lazyChunks, err := s.lazyChunks(ctx, matchers, from, through)
 	if err != nil {
 		return nil, err
@@ -245,7 +302,16 @@ func (s *store) SelectLogs(ctx context.Context, req logql.SelectLogParams) (iter
 		return iter.NoopIterator, nil
 	}
 
-	return newLogBatchIterator(ctx, lazyChunks, s.cfg.MaxChunkBatchSize, matchers, filter, req.Direction, req.Start, req.End)
+	deleteRequests, err := s.pendingDeleteRequests(ctx, from, through)
+	if err != nil {
+		return nil, err
+	}
+
+	it, err := newLogBatchIterator(ctx, lazyChunks, s.cfg.MaxChunkBatchSize, matchers, filter, s.bloomFilters, req.Direction, req.Start, req.End)
+	if err != nil {
+		return nil, err
+	}
+	return logql.NewPipelineEntryIterator(deletion.NewDeletedEntriesFilterIterator(it, deleteRequests), pipeline), nil
 
 }
 
@@ -265,6 +331,11 @@ func (s *store) SelectSamples(ctx context.Context, req logql.SelectSampleParams)
 		return nil, err
 	}
 
+	pipeline, err := expr.Selector().Pipeline()
+	if err != nil {
+		return nil, err
+	}
+
 	lazyChunks, err := s.lazyChunks(ctx, matchers, from, through)
 	if err != nil {
 		return nil, err
@@ -273,7 +344,48 @@ func (s *store) SelectSamples(ctx context.Context, req logql.SelectSampleParams)
 	if len(lazyChunks) == 0 {
 		return iter.NoopIterator, nil
 	}
-	return newSampleBatchIterator(ctx, lazyChunks, s.cfg.MaxChunkBatchSize, matchers, filter, extractor, req.Start, req.End)
+
+	deleteRequests, err := s.pendingDeleteRequests(ctx, from, through)
+	if err != nil {
+		return nil, err
+	}
+
+	// samples of a pipeline are extracted from processed entries as labels can change for each line,
+	// and deleted entries can only be filtered out before extracting samples.
+	if logql.NeedsPipeline(pipeline, extractor) || len(deleteRequests) > 0 {
+		it, err := newLogBatchIterator(ctx, lazyChunks, s.cfg.MaxChunkBatchSize, matchers, filter, s.bloomFilters, logproto.FORWARD, req.Start, req.End)
+		if err != nil {
+			return nil, err
+		}
+		return logql.NewPipelineSampleIterator(deletion.NewDeletedEntriesFilterIterator(it, deleteRequests), pipeline, extractor), nil
+	}
+	return newSampleBatchIterator(ctx, lazyChunks, s.cfg.MaxChunkBatchSize, matchers, filter, s.bloomFilters, extractor, req.Start, req.End)
+}
+
+// pendingDeleteRequests returns the delete requests of the tenant which can delete logs between from and through.
+// Processed requests are still applied as queriers can use an index downloaded before the chunks were deleted.
+func (s *store) pendingDeleteRequests(ctx context.Context, from, through model.Time) ([]deletion.DeleteRequest, error) {
+	if s.deleteRequests == nil {
+		return nil, nil
+	}
+
+	userID, err := user.ExtractOrgID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	requests, err := s.deleteRequests.GetAllDeleteRequestsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []deletion.DeleteRequest
+	for _, req := range requests {
+		if req.Status != deletion.StatusCancelled && req.Overlaps(from, through) {
+			pending = append(pending, req)
+		}
+	}
+	return pending, nil
 }
 
 func filterChunksByTime(from, through model.Time, chunks []chunk.Chunk) []chunk.Chunk {
@@ -298,7 +410,7 @@ func RegisterCustomIndexClients(cfg Config, registerer prometheus.Registerer) {
 			return boltDBIndexClientWithShipper, nil
 		}
 
-		objectClient, err := storage.NewObjectClient(cfg.BoltDBShipperConfig.SharedStoreType, cfg.Config)
+		objectClient, err := NewObjectClient(cfg.BoltDBShipperConfig.SharedStoreType, cfg)
 		if err != nil {
 			return nil, err
 		}
@@ -309,7 +421,7 @@ func RegisterCustomIndexClients(cfg Config, registerer prometheus.Registerer) {
 
 		return boltDBIndexClientWithShipper, err
 	}, func() (client chunk.TableClient, e error) {
-		objectClient, err := storage.NewObjectClient(cfg.BoltDBShipperConfig.SharedStoreType, cfg.Config)
+		objectClient, err := NewObjectClient(cfg.BoltDBShipperConfig.SharedStoreType, cfg)
 		if err != nil {
 			return nil, err
 		}
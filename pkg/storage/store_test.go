@@ -28,6 +28,7 @@ import (
 	"github.com/grafana/loki/pkg/logproto"
 	"github.com/grafana/loki/pkg/logql"
 	"github.com/grafana/loki/pkg/logql/marshal"
+	"github.com/grafana/loki/pkg/storage/stores/deletion"
 	"github.com/grafana/loki/pkg/storage/stores/local"
 	"github.com/grafana/loki/pkg/util/validation"
 )
@@ -205,7 +206,7 @@ func getLocalStore() Store {
 				},
 			},
 		},
-	}, limits, nil)
+	}, limits, nil, nil)
 	if err != nil {
 		panic(err)
 	}
@@ -608,6 +609,58 @@ func Test_store_SelectSample(t *testing.T) {
 	}
 }
 
+func Test_store_DeleteRequests(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "delete-requests")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	objectClient, err := cortex_local.NewFSObjectClient(cortex_local.FSConfig{Directory: tempDir})
+	require.NoError(t, err)
+	deleteRequests := deletion.NewDeleteRequestsStore(objectClient)
+
+	ctx := user.InjectOrgID(context.Background(), "test-user")
+	fromTime := model.TimeFromUnixNano(from.UnixNano())
+	_, err = deleteRequests.AddDeleteRequest(ctx, "test-user", `{foo="bar"} |= "2"`, fromTime, fromTime.Add(time.Hour))
+	require.NoError(t, err)
+	_, err = deleteRequests.AddDeleteRequest(ctx, "test-user", `{foo="bazz"}`, fromTime.Add(3*time.Millisecond), fromTime.Add(4*time.Millisecond))
+	require.NoError(t, err)
+	cancelled, err := deleteRequests.AddDeleteRequest(ctx, "test-user", `{foo="bar"}`, fromTime, fromTime.Add(time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, deleteRequests.UpdateStatus(ctx, "test-user", cancelled.RequestID, deletion.StatusReceived, deletion.StatusCancelled))
+	// requests of other tenants are ignored.
+	_, err = deleteRequests.AddDeleteRequest(ctx, "other-user", `{foo="bar"}`, fromTime, fromTime.Add(time.Hour))
+	require.NoError(t, err)
+
+	s := &store{
+		Store: storeFixture,
+		cfg: Config{
+			MaxChunkBatchSize: 10,
+		},
+		deleteRequests: deleteRequests,
+	}
+
+	it, err := s.SelectLogs(ctx, logql.SelectLogParams{QueryRequest: newQuery(`{foo=~"ba.*"}`, from, from.Add(6*time.Millisecond), nil)})
+	require.NoError(t, err)
+	lines := map[string][]string{}
+	for it.Next() {
+		lines[it.Labels()] = append(lines[it.Labels()], it.Entry().Line)
+	}
+	require.NoError(t, it.Close())
+	require.Equal(t, map[string][]string{
+		`{foo="bar"}`:  {"1", "3", "4", "5", "6"},
+		`{foo="bazz"}`: {"1", "2", "3", "6"},
+	}, lines)
+
+	sampleIt, err := s.SelectSamples(ctx, logql.SelectSampleParams{SampleQueryRequest: newSampleQuery(`count_over_time({foo=~"ba.*"}[5m])`, from, from.Add(6*time.Millisecond))})
+	require.NoError(t, err)
+	samples := 0
+	for sampleIt.Next() {
+		samples++
+	}
+	require.NoError(t, sampleIt.Close())
+	require.Equal(t, 9, samples)
+}
+
 func Test_store_GetSeries(t *testing.T) {
 
 	tests := []struct {
@@ -774,7 +827,7 @@ func TestStore_MultipleBoltDBShippersInConfig(t *testing.T) {
 				RowShards: 2,
 			},
 		},
-	}, limits, nil)
+	}, limits, nil, nil)
 	require.NoError(t, err)
 
 	// time ranges adding a chunk for each store and a chunk which overlaps both the stores
@@ -0,0 +1,50 @@
+package deletion
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type cachedRequests struct {
+	requests  []DeleteRequest
+	fetchedAt time.Time
+}
+
+// cachedGetter keeps the delete requests of each tenant for a while so queries do not fetch them from the store each time.
+type cachedGetter struct {
+	getter DeleteRequestsGetter
+	ttl    time.Duration
+
+	mtx   sync.Mutex
+	cache map[string]cachedRequests
+}
+
+// NewCachedGetter returns a DeleteRequestsGetter caching the requests returned by getter for ttl.
+// New requests are only applied at query time once the cache expired.
+func NewCachedGetter(getter DeleteRequestsGetter, ttl time.Duration) DeleteRequestsGetter {
+	return &cachedGetter{
+		getter: getter,
+		ttl:    ttl,
+		cache:  map[string]cachedRequests{},
+	}
+}
+
+func (c *cachedGetter) GetAllDeleteRequestsForUser(ctx context.Context, userID string) ([]DeleteRequest, error) {
+	c.mtx.Lock()
+	cached, ok := c.cache[userID]
+	c.mtx.Unlock()
+	if ok && time.Since(cached.fetchedAt) < c.ttl {
+		return cached.requests, nil
+	}
+
+	requests, err := c.getter.GetAllDeleteRequestsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mtx.Lock()
+	c.cache[userID] = cachedRequests{requests: requests, fetchedAt: time.Now()}
+	c.mtx.Unlock()
+	return requests, nil
+}
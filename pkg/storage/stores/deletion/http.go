@@ -0,0 +1,140 @@
+package deletion
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/common/model"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/loki/pkg/loghttp"
+)
+
+// DeleteRequestHandler serves the API to add, list and cancel the delete requests of a tenant.
+type DeleteRequestHandler struct {
+	store        DeleteRequestsStore
+	cancelPeriod time.Duration
+}
+
+// NewDeleteRequestHandler creates a handler of the delete requests API.
+// Requests can be cancelled during cancelPeriod after being added, they are processed after it.
+func NewDeleteRequestHandler(store DeleteRequestsStore, cancelPeriod time.Duration) *DeleteRequestHandler {
+	return &DeleteRequestHandler{store: store, cancelPeriod: cancelPeriod}
+}
+
+// AddDeleteRequestHandler records a request to delete the logs selected by the query parameter between start and end.
+func (h *DeleteRequestHandler) AddDeleteRequestHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := user.ExtractOrgID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params, err := loghttp.ParseDeleteRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, _, err := ParseQuery(params.Query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req, err := h.store.AddDeleteRequest(r.Context(), userID, params.Query, model.TimeFromUnixNano(params.Start.UnixNano()), model.TimeFromUnixNano(params.End.UnixNano()))
+	if err != nil {
+		level.Error(util.Logger).Log("msg", "error adding delete request", "user", userID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	level.Info(util.Logger).Log("msg", "delete request added", "user", userID, "request_id", req.RequestID, "query", req.Query)
+	writeJSON(w, http.StatusAccepted, req)
+}
+
+// GetAllDeleteRequestsHandler returns all the delete requests of the tenant with their status.
+// The request_id parameter can be set to only get a single request.
+func (h *DeleteRequestHandler) GetAllDeleteRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := user.ExtractOrgID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if requestID := r.FormValue("request_id"); requestID != "" {
+		req, err := h.store.GetDeleteRequest(r.Context(), userID, requestID)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, req)
+		return
+	}
+
+	requests, err := h.store.GetAllDeleteRequestsForUser(r.Context(), userID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, requests)
+}
+
+// CancelDeleteRequestHandler cancels the delete request given by the request_id parameter, unless it is already processed
+// or its cancel period elapsed.
+func (h *DeleteRequestHandler) CancelDeleteRequestHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := user.ExtractOrgID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	requestID := r.FormValue("request_id")
+	req, err := h.store.GetDeleteRequest(r.Context(), userID, requestID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	if req.Status != StatusReceived {
+		http.Error(w, fmt.Sprintf("delete request is %s", req.Status), http.StatusBadRequest)
+		return
+	}
+	if !model.Now().Before(req.CreatedAt.Add(h.cancelPeriod)) {
+		http.Error(w, "the cancel period of the delete request elapsed", http.StatusBadRequest)
+		return
+	}
+
+	// the status can change concurrently, the compactor re-checks it before applying the request to each table and
+	// before marking it as processed.
+	if err := h.store.UpdateStatus(r.Context(), userID, requestID, StatusReceived, StatusCancelled); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	level.Info(util.Logger).Log("msg", "delete request cancelled", "user", userID, "request_id", requestID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	if err == ErrDeleteRequestNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err == ErrDeleteRequestStatusChanged {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		level.Error(util.Logger).Log("msg", "error writing response", "err", err)
+	}
+}
@@ -0,0 +1,72 @@
+package deletion
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+)
+
+func TestDeleteRequestHandler(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	do := func(handler http.HandlerFunc, method string, params url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/loki/api/v1/delete?"+params.Encode(), nil)
+		req = req.WithContext(user.InjectOrgID(req.Context(), "1"))
+		require.NoError(t, req.ParseForm())
+
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	add := func(h *DeleteRequestHandler, query string) *httptest.ResponseRecorder {
+		return do(h.AddDeleteRequestHandler, http.MethodPost, url.Values{"query": {query}, "start": {"1"}, "end": {"2"}})
+	}
+
+	h := NewDeleteRequestHandler(store, time.Hour)
+	require.Equal(t, http.StatusBadRequest, add(h, `{app="foo"} | logfmt`).Code)
+	require.Equal(t, http.StatusBadRequest, do(h.AddDeleteRequestHandler, http.MethodPost, url.Values{"query": {`{app="foo"}`}}).Code)
+
+	w := add(h, `{app="foo"}`)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var added DeleteRequest
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &added))
+	require.Equal(t, StatusReceived, added.Status)
+
+	w = do(h.GetAllDeleteRequestsHandler, http.MethodGet, url.Values{})
+	require.Equal(t, http.StatusOK, w.Code)
+	var requests []DeleteRequest
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &requests))
+	require.Len(t, requests, 1)
+	require.Equal(t, added.RequestID, requests[0].RequestID)
+
+	w = do(h.CancelDeleteRequestHandler, http.MethodDelete, url.Values{"request_id": {added.RequestID}})
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	w = do(h.GetAllDeleteRequestsHandler, http.MethodGet, url.Values{"request_id": {added.RequestID}})
+	require.Equal(t, http.StatusOK, w.Code)
+	var cancelled DeleteRequest
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &cancelled))
+	require.Equal(t, StatusCancelled, cancelled.Status)
+
+	// requests can't be cancelled twice or once their cancel period elapsed.
+	w = do(h.CancelDeleteRequestHandler, http.MethodDelete, url.Values{"request_id": {added.RequestID}})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	h = NewDeleteRequestHandler(store, 0)
+	w = add(h, `{app="bar"}`)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &added))
+	w = do(h.CancelDeleteRequestHandler, http.MethodDelete, url.Values{"request_id": {added.RequestID}})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do(h.CancelDeleteRequestHandler, http.MethodDelete, url.Values{"request_id": {"unknown"}})
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
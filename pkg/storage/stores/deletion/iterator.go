@@ -0,0 +1,60 @@
+package deletion
+
+import (
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/grafana/loki/pkg/iter"
+)
+
+type deletedEntriesFilterIterator struct {
+	iter.EntryIterator
+	requests []DeleteRequest
+
+	// requests matching each stream, by labels.
+	streamRequests map[string][]*DeleteRequest
+}
+
+// NewDeletedEntriesFilterIterator returns an iterator skipping the entries of it deleted by requests.
+// The requests must have been returned by a DeleteRequestsGetter.
+func NewDeletedEntriesFilterIterator(it iter.EntryIterator, requests []DeleteRequest) iter.EntryIterator {
+	if len(requests) == 0 {
+		return it
+	}
+	return &deletedEntriesFilterIterator{
+		EntryIterator:  it,
+		requests:       requests,
+		streamRequests: map[string][]*DeleteRequest{},
+	}
+}
+
+func (it *deletedEntriesFilterIterator) Next() bool {
+outer:
+	for it.EntryIterator.Next() {
+		entry := it.EntryIterator.Entry()
+		for _, req := range it.requestsForStream(it.EntryIterator.Labels()) {
+			if req.IsDeleted(entry.Timestamp, []byte(entry.Line)) {
+				continue outer
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (it *deletedEntriesFilterIterator) requestsForStream(lbls string) []*DeleteRequest {
+	if requests, ok := it.streamRequests[lbls]; ok {
+		return requests
+	}
+
+	var requests []*DeleteRequest
+	metric, err := parser.ParseMetric(lbls)
+	if err == nil {
+		for i := range it.requests {
+			if it.requests[i].MatchesSeries(metric) {
+				requests = append(requests, &it.requests[i])
+			}
+		}
+	}
+	it.streamRequests[lbls] = requests
+	return requests
+}
@@ -0,0 +1,51 @@
+package deletion
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/loki/pkg/iter"
+	"github.com/grafana/loki/pkg/logproto"
+)
+
+func TestDeletedEntriesFilterIterator(t *testing.T) {
+	streams := []logproto.Stream{
+		{
+			Labels: `{app="foo"}`,
+			Entries: []logproto.Entry{
+				{Timestamp: time.Unix(1, 0), Line: "a"},
+				{Timestamp: time.Unix(2, 0), Line: "secret"},
+				{Timestamp: time.Unix(3, 0), Line: "b"},
+			},
+		},
+		{
+			Labels: `{app="bar"}`,
+			Entries: []logproto.Entry{
+				{Timestamp: time.Unix(1, 0), Line: "c"},
+				{Timestamp: time.Unix(2, 0), Line: "d"},
+				{Timestamp: time.Unix(3, 0), Line: "e"},
+			},
+		},
+	}
+
+	requests := []DeleteRequest{
+		{Query: `{app="foo"} |= "secret"`, StartTime: 0, EndTime: 10000},
+		{Query: `{app="bar"}`, StartTime: 2000, EndTime: 2000},
+	}
+	for i := range requests {
+		require.NoError(t, requests[i].parse())
+	}
+
+	it := NewDeletedEntriesFilterIterator(iter.NewStreamsIterator(context.Background(), streams, logproto.FORWARD), requests)
+	defer it.Close()
+
+	var lines []string
+	for it.Next() {
+		lines = append(lines, it.Entry().Line)
+	}
+	require.NoError(t, it.Error())
+	require.Equal(t, []string{"c", "a", "e", "b"}, lines)
+}
@@ -0,0 +1,108 @@
+package deletion
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/grafana/loki/pkg/logql"
+)
+
+// Status is the processing status of a delete request.
+type Status string
+
+const (
+	// StatusReceived is the status of requests not processed yet, they can be cancelled until the cancel period elapsed.
+	StatusReceived Status = "received"
+	// StatusProcessed is the status of requests whose logs were deleted from the store.
+	StatusProcessed Status = "processed"
+	// StatusCancelled is the status of requests cancelled by the tenant.
+	StatusCancelled Status = "cancelled"
+)
+
+var errUnsupportedPipeline = errors.New("delete queries only support label matchers and line filters")
+
+// DeleteRequest is a request of a tenant to delete the logs of the streams matching a query in a time range.
+type DeleteRequest struct {
+	RequestID string     `json:"request_id"`
+	UserID    string     `json:"user_id"`
+	Query     string     `json:"query"`
+	StartTime model.Time `json:"start_time"`
+	EndTime   model.Time `json:"end_time"`
+	CreatedAt model.Time `json:"created_at"`
+	Status    Status     `json:"status"`
+
+	matchers []*labels.Matcher
+	filter   logql.LineFilter
+}
+
+// ParseQuery parses the query of a delete request, only label matchers and line filters are supported.
+func ParseQuery(query string) ([]*labels.Matcher, logql.LineFilter, error) {
+	expr, err := logql.ParseLogSelector(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pipeline, err := expr.Pipeline()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(pipeline) > 0 {
+		return nil, nil, errUnsupportedPipeline
+	}
+
+	filter, err := expr.Filter()
+	if err != nil {
+		return nil, nil, err
+	}
+	return expr.Matchers(), filter, nil
+}
+
+func (r *DeleteRequest) parse() error {
+	if r.matchers != nil {
+		return nil
+	}
+
+	matchers, filter, err := ParseQuery(r.Query)
+	if err != nil {
+		return err
+	}
+	r.matchers, r.filter = matchers, filter
+	return nil
+}
+
+// HasLineFilter returns whether only some lines of the selected streams are deleted.
+func (r *DeleteRequest) HasLineFilter() bool {
+	return r.filter != nil
+}
+
+// Overlaps returns whether the request deletes logs between from and through.
+func (r *DeleteRequest) Overlaps(from, through model.Time) bool {
+	return r.StartTime <= through && from <= r.EndTime
+}
+
+// Covers returns whether the request deletes all the logs of the selected streams between from and through.
+func (r *DeleteRequest) Covers(from, through model.Time) bool {
+	return r.filter == nil && r.StartTime <= from && through <= r.EndTime
+}
+
+// MatchesSeries returns whether the request deletes logs of the series with the given labels.
+func (r *DeleteRequest) MatchesSeries(lbls labels.Labels) bool {
+	for _, m := range r.matchers {
+		if !m.Matches(lbls.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsDeleted returns whether a line of a series matched by the request logged at ts is deleted.
+func (r *DeleteRequest) IsDeleted(ts time.Time, line []byte) bool {
+	t := model.TimeFromUnixNano(ts.UnixNano())
+	if t < r.StartTime || t > r.EndTime {
+		return false
+	}
+	return r.filter == nil || r.filter.Filter(line)
+}
@@ -0,0 +1,201 @@
+package deletion
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/common/model"
+
+	storage_util "github.com/grafana/loki/pkg/storage/stores/util"
+)
+
+// storageKeyPrefix is the prefix of the keys of the delete requests in the object store.
+const storageKeyPrefix = "delete_requests/"
+
+// ErrDeleteRequestNotFound is returned when a delete request does not exist.
+var ErrDeleteRequestNotFound = errors.New("delete request not found")
+
+// ErrDeleteRequestStatusChanged is returned when the status of a delete request to update is not the expected one.
+var ErrDeleteRequestStatusChanged = errors.New("delete request status changed")
+
+// DeleteRequestsGetter returns the delete requests of a tenant.
+type DeleteRequestsGetter interface {
+	GetAllDeleteRequestsForUser(ctx context.Context, userID string) ([]DeleteRequest, error)
+}
+
+// DeleteRequestsStore stores the delete requests of all the tenants.
+type DeleteRequestsStore interface {
+	DeleteRequestsGetter
+	AddDeleteRequest(ctx context.Context, userID, query string, startTime, endTime model.Time) (*DeleteRequest, error)
+	GetDeleteRequest(ctx context.Context, userID, requestID string) (*DeleteRequest, error)
+	GetDeleteRequestsByStatus(ctx context.Context, status Status) ([]DeleteRequest, error)
+	// UpdateStatus sets the status of the request to status if it is from, ErrDeleteRequestStatusChanged is returned
+	// otherwise.
+	UpdateStatus(ctx context.Context, userID, requestID string, from, status Status) error
+}
+
+// deleteRequestsStore keeps each delete request in a JSON object named <user>/<request id>.
+type deleteRequestsStore struct {
+	objectClient chunk.ObjectClient
+}
+
+// NewDeleteRequestsStore creates a store keeping the delete requests in objectClient.
+func NewDeleteRequestsStore(objectClient chunk.ObjectClient) DeleteRequestsStore {
+	return &deleteRequestsStore{objectClient: storage_util.NewPrefixedObjectClient(objectClient, storageKeyPrefix)}
+}
+
+func (s *deleteRequestsStore) AddDeleteRequest(ctx context.Context, userID, query string, startTime, endTime model.Time) (*DeleteRequest, error) {
+	requestID, err := generateRequestID()
+	if err != nil {
+		return nil, err
+	}
+
+	req := &DeleteRequest{
+		RequestID: requestID,
+		UserID:    userID,
+		Query:     query,
+		StartTime: startTime,
+		EndTime:   endTime,
+		CreatedAt: model.Now(),
+		Status:    StatusReceived,
+	}
+	if err := req.parse(); err != nil {
+		return nil, err
+	}
+	if err := s.put(ctx, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (s *deleteRequestsStore) GetAllDeleteRequestsForUser(ctx context.Context, userID string) ([]DeleteRequest, error) {
+	objects, _, err := s.objectClient.List(ctx, userID+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	requests := make([]DeleteRequest, 0, len(objects))
+	for _, object := range objects {
+		req, err := s.get(ctx, object.Key)
+		if err != nil {
+			if err == ErrDeleteRequestNotFound {
+				continue
+			}
+			return nil, err
+		}
+
+		if err := req.parse(); err != nil {
+			level.Warn(util.Logger).Log("msg", "skipping delete request with invalid query", "user", userID, "request_id", req.RequestID, "err", err)
+			continue
+		}
+		requests = append(requests, *req)
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].CreatedAt < requests[j].CreatedAt
+	})
+	return requests, nil
+}
+
+func (s *deleteRequestsStore) GetDeleteRequest(ctx context.Context, userID, requestID string) (*DeleteRequest, error) {
+	// the id is given by the tenant, it must not be able to reach the requests of other tenants.
+	if _, err := hex.DecodeString(requestID); err != nil || requestID == "" {
+		return nil, ErrDeleteRequestNotFound
+	}
+
+	req, err := s.get(ctx, path.Join(userID, requestID))
+	if err != nil {
+		return nil, err
+	}
+	if req.UserID != userID {
+		return nil, ErrDeleteRequestNotFound
+	}
+	return req, req.parse()
+}
+
+func (s *deleteRequestsStore) GetDeleteRequestsByStatus(ctx context.Context, status Status) ([]DeleteRequest, error) {
+	_, users, err := s.objectClient.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var requests []DeleteRequest
+	for _, user := range users {
+		userRequests, err := s.GetAllDeleteRequestsForUser(ctx, strings.TrimSuffix(string(user), "/"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, req := range userRequests {
+			if req.Status == status {
+				requests = append(requests, req)
+			}
+		}
+	}
+	return requests, nil
+}
+
+// UpdateStatus checks the status right before writing the new one, object stores don't support conditional writes.
+// The status can still be changed concurrently in between, callers re-check it before acting on it.
+func (s *deleteRequestsStore) UpdateStatus(ctx context.Context, userID, requestID string, from, status Status) error {
+	req, err := s.GetDeleteRequest(ctx, userID, requestID)
+	if err != nil {
+		return err
+	}
+	if req.Status != from {
+		return ErrDeleteRequestStatusChanged
+	}
+
+	req.Status = status
+	return s.put(ctx, req)
+}
+
+func (s *deleteRequestsStore) get(ctx context.Context, key string) (*DeleteRequest, error) {
+	readCloser, err := s.objectClient.GetObject(ctx, key)
+	if err != nil {
+		if err == chunk.ErrStorageObjectNotFound || os.IsNotExist(err) {
+			return nil, ErrDeleteRequestNotFound
+		}
+		return nil, err
+	}
+	defer readCloser.Close()
+
+	buf, err := ioutil.ReadAll(readCloser)
+	if err != nil {
+		return nil, err
+	}
+
+	var req DeleteRequest
+	if err := json.Unmarshal(buf, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (s *deleteRequestsStore) put(ctx context.Context, req *DeleteRequest) error {
+	buf, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return s.objectClient.PutObject(ctx, path.Join(req.UserID, req.RequestID), bytes.NewReader(buf))
+}
+
+func generateRequestID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,92 @@
+package deletion
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/chunk/local"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStore(t *testing.T) (DeleteRequestsStore, func()) {
+	tempDir, err := ioutil.TempDir("", "delete-requests")
+	require.NoError(t, err)
+
+	objectClient, err := local.NewFSObjectClient(local.FSConfig{Directory: tempDir})
+	require.NoError(t, err)
+
+	return NewDeleteRequestsStore(objectClient), func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}
+}
+
+func TestDeleteRequestsStore(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	_, err := store.AddDeleteRequest(ctx, "1", `{app="foo"} | json`, 0, 10)
+	require.Equal(t, errUnsupportedPipeline, err)
+
+	foo, err := store.AddDeleteRequest(ctx, "1", `{app="foo"}`, 0, 10)
+	require.NoError(t, err)
+	bar, err := store.AddDeleteRequest(ctx, "1", `{app="bar"} |= "secret"`, 5, 20)
+	require.NoError(t, err)
+	other, err := store.AddDeleteRequest(ctx, "2", `{app="foo"}`, 0, 10)
+	require.NoError(t, err)
+
+	requests, err := store.GetAllDeleteRequestsForUser(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, requests, 2)
+	ids := []string{requests[0].RequestID, requests[1].RequestID}
+	require.ElementsMatch(t, []string{foo.RequestID, bar.RequestID}, ids)
+
+	// tenants only see their own requests.
+	_, err = store.GetDeleteRequest(ctx, "1", other.RequestID)
+	require.Equal(t, ErrDeleteRequestNotFound, err)
+	_, err = store.GetDeleteRequest(ctx, "1", "../2/"+other.RequestID)
+	require.Equal(t, ErrDeleteRequestNotFound, err)
+
+	req, err := store.GetDeleteRequest(ctx, "1", bar.RequestID)
+	require.NoError(t, err)
+	require.Equal(t, StatusReceived, req.Status)
+	require.True(t, req.HasLineFilter())
+
+	require.NoError(t, store.UpdateStatus(ctx, "1", bar.RequestID, StatusReceived, StatusProcessed))
+	// the status is only updated from the expected one.
+	require.Equal(t, ErrDeleteRequestStatusChanged, store.UpdateStatus(ctx, "1", bar.RequestID, StatusReceived, StatusCancelled))
+	processed, err := store.GetDeleteRequestsByStatus(ctx, StatusProcessed)
+	require.NoError(t, err)
+	require.Len(t, processed, 1)
+	require.Equal(t, bar.RequestID, processed[0].RequestID)
+
+	received, err := store.GetDeleteRequestsByStatus(ctx, StatusReceived)
+	require.NoError(t, err)
+	require.Len(t, received, 2)
+}
+
+func TestCachedGetter(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	getter := NewCachedGetter(store, time.Hour)
+	requests, err := getter.GetAllDeleteRequestsForUser(ctx, "1")
+	require.NoError(t, err)
+	require.Empty(t, requests)
+
+	_, err = store.AddDeleteRequest(ctx, "1", `{app="foo"}`, 0, 10)
+	require.NoError(t, err)
+
+	// the new request is only returned once the cache expired.
+	requests, err = getter.GetAllDeleteRequestsForUser(ctx, "1")
+	require.NoError(t, err)
+	require.Empty(t, requests)
+
+	requests, err = NewCachedGetter(store, 0).GetAllDeleteRequestsForUser(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+}
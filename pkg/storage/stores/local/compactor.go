@@ -0,0 +1,232 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	chunk_util "github.com/cortexproject/cortex/pkg/chunk/util"
+	pkg_util "github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/services"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/loki/pkg/storage/stores/deletion"
+	"github.com/grafana/loki/pkg/storage/stores/util"
+)
+
+type CompactorConfig struct {
+	WorkingDirectory          string        `yaml:"working_directory"`
+	SharedStoreType           string        `yaml:"shared_store"`
+	CompactionInterval        time.Duration `yaml:"compaction_interval"`
+	RetentionEnabled          bool          `yaml:"retention_enabled"`
+	RetentionDeleteDelay      time.Duration `yaml:"retention_delete_delay"`
+	RetentionDryRun           bool          `yaml:"retention_dry_run"`
+	DeletionEnabled           bool          `yaml:"deletion_enabled"`
+	DeleteRequestCancelPeriod time.Duration `yaml:"delete_request_cancel_period"`
+}
+
+// RegisterFlags registers flags.
+func (cfg *CompactorConfig) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&cfg.WorkingDirectory, "boltdb.shipper.compactor.working-directory", "", "Directory where files can be downloaded for compaction.")
+	f.StringVar(&cfg.SharedStoreType, "boltdb.shipper.compactor.shared-store", "", "Shared store used for storing boltdb files. Supported types: gcs, s3, azure, swift, filesystem")
+	f.DurationVar(&cfg.CompactionInterval, "boltdb.shipper.compactor.compaction-interval", 2*time.Hour, "Interval at which to re-run the compaction operation.")
+	f.BoolVar(&cfg.RetentionEnabled, "boltdb.shipper.compactor.retention-enabled", false, "Delete the chunks older than the retention period of their tenant or stream while compacting.")
+	f.DurationVar(&cfg.RetentionDeleteDelay, "boltdb.shipper.compactor.retention-delete-delay", 2*time.Hour, "Delay after which chunks removed from the index by the retention or delete requests are deleted from the store.")
+	f.BoolVar(&cfg.RetentionDryRun, "boltdb.shipper.compactor.retention-dry-run", false, "Only log and count the chunks the retention would delete.")
+	f.BoolVar(&cfg.DeletionEnabled, "boltdb.shipper.compactor.deletion-enabled", false, "Serve the delete requests API and delete the logs of the requests while compacting.")
+	f.DurationVar(&cfg.DeleteRequestCancelPeriod, "boltdb.shipper.compactor.delete-request-cancel-period", 24*time.Hour, "Period during which a delete request can be cancelled, it is processed after it.")
+}
+
+// Validate verifies the config does not contain inappropriate values
+func (cfg *CompactorConfig) Validate() error {
+	if cfg.WorkingDirectory == "" {
+		return errors.New("working directory of the compactor must be set")
+	}
+	if cfg.SharedStoreType == "" {
+		return errors.New("shared store of the compactor must be set")
+	}
+	if cfg.CompactionInterval <= 0 {
+		return errors.New("compaction interval of the compactor must be greater than 0")
+	}
+	if (cfg.RetentionEnabled || cfg.DeletionEnabled) && cfg.RetentionDeleteDelay < cfg.CompactionInterval {
+		return errors.New("retention delete delay of the compactor must be greater than the compaction interval")
+	}
+	if cfg.DeleteRequestCancelPeriod < 0 {
+		return errors.New("delete request cancel period of the compactor must not be negative")
+	}
+	return nil
+}
+
+type compactorMetrics struct {
+	compactTablesOperationTotal           *prometheus.CounterVec
+	compactTablesOperationDurationSeconds prometheus.Gauge
+	compactTablesOperationLastSuccess     prometheus.Gauge
+}
+
+func newCompactorMetrics(r prometheus.Registerer) *compactorMetrics {
+	return &compactorMetrics{
+		compactTablesOperationTotal: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "loki_boltdb_shipper",
+			Name:      "compact_tables_operation_total",
+			Help:      "Total number of tables compaction done by status",
+		}, []string{"status"}),
+		compactTablesOperationDurationSeconds: promauto.With(r).NewGauge(prometheus.GaugeOpts{
+			Namespace: "loki_boltdb_shipper",
+			Name:      "compact_tables_operation_duration_seconds",
+			Help:      "Time (in seconds) spent in compacting all the tables",
+		}),
+		compactTablesOperationLastSuccess: promauto.With(r).NewGauge(prometheus.GaugeOpts{
+			Namespace: "loki_boltdb_shipper",
+			Name:      "compact_tables_operation_last_successful_run_timestamp_seconds",
+			Help:      "Unix timestamp of the last successful compaction run",
+		}),
+	}
+}
+
+// Compactor periodically merges the boltdb files uploaded by all the ingesters for a table into a single file,
+// which reduces the number of files queriers have to download and the size of the index.
+type Compactor struct {
+	services.Service
+
+	cfg            CompactorConfig
+	objectClient   chunk.ObjectClient
+	sweeper        *chunkSweeper
+	retention      *retention
+	deleteRequests *deleteRequestsProcessor
+	metrics        *compactorMetrics
+}
+
+// NewCompactor creates a compactor for the boltdb files stored in objectClient.
+// limits is only used when the retention is enabled, deleteRequestsStore when the deletion is, and chunkClient by both.
+func NewCompactor(cfg CompactorConfig, objectClient chunk.ObjectClient, limits RetentionLimits, chunkClient ChunkClient, deleteRequestsStore deletion.DeleteRequestsStore, r prometheus.Registerer) (*Compactor, error) {
+	if err := chunk_util.EnsureDirectory(cfg.WorkingDirectory); err != nil {
+		return nil, err
+	}
+
+	c := &Compactor{
+		cfg:          cfg,
+		objectClient: util.NewPrefixedObjectClient(objectClient, storageKeyPrefix),
+		metrics:      newCompactorMetrics(r),
+	}
+
+	if cfg.RetentionEnabled || cfg.DeletionEnabled {
+		var err error
+		c.sweeper, err = newChunkSweeper(cfg, chunkClient, r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.RetentionEnabled {
+		c.retention = newRetention(cfg, limits, c.sweeper, r)
+	}
+	if cfg.DeletionEnabled {
+		c.deleteRequests = newDeleteRequestsProcessor(cfg, deleteRequestsStore, chunkClient, c.sweeper, r)
+	}
+
+	c.Service = services.NewBasicService(nil, c.running, nil)
+	return c, nil
+}
+
+func (c *Compactor) running(ctx context.Context) error {
+	c.runCompactions(ctx)
+
+	ticker := time.NewTicker(c.cfg.CompactionInterval)
+	defer ticker.Stop()
+
+	// the sweep ticker is left nil when no chunks are deleted so it never fires.
+	var sweepC <-chan time.Time
+	if c.sweeper != nil {
+		sweepTicker := time.NewTicker(sweepInterval)
+		defer sweepTicker.Stop()
+		sweepC = sweepTicker.C
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			c.runCompactions(ctx)
+		case <-sweepC:
+			if err := c.sweeper.sweep(ctx); err != nil {
+				level.Error(pkg_util.Logger).Log("msg", "failed to delete chunks", "err", err)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (c *Compactor) runCompactions(ctx context.Context) {
+	status := statusSuccess
+	err := c.RunCompaction(ctx)
+	if err != nil {
+		status = statusFailure
+		level.Error(pkg_util.Logger).Log("msg", "failed to compact tables", "err", err)
+	}
+
+	c.metrics.compactTablesOperationTotal.WithLabelValues(status).Inc()
+	if status == statusSuccess {
+		c.metrics.compactTablesOperationLastSuccess.SetToCurrentTime()
+	}
+}
+
+// RunCompaction compacts all the tables found in the store once.
+// A failure to compact a table does not prevent the others from being compacted.
+// Delete requests are only marked as processed once all the tables were compacted.
+func (c *Compactor) RunCompaction(ctx context.Context) error {
+	start := time.Now()
+	defer func() {
+		c.metrics.compactTablesOperationDurationSeconds.Set(time.Since(start).Seconds())
+	}()
+
+	var processors []indexProcessor
+	if c.retention != nil {
+		processors = append(processors, c.retention)
+	}
+	applyDeleteRequests := false
+	if c.deleteRequests != nil {
+		var err error
+		applyDeleteRequests, err = c.deleteRequests.loadRequests(ctx)
+		if err != nil {
+			return err
+		}
+		if applyDeleteRequests {
+			processors = append(processors, c.deleteRequests)
+		}
+	}
+
+	_, dirs, err := c.objectClient.List(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, dir := range dirs {
+		tableName := strings.TrimSuffix(string(dir), "/")
+
+		table := newCompactorTable(ctx, tableName, c.cfg.WorkingDirectory, c.objectClient, processors)
+		if err := table.compact(); err != nil {
+			level.Error(pkg_util.Logger).Log("msg", "failed to compact table", "table", tableName, "err", err)
+			failed = append(failed, tableName)
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to compact tables %s", strings.Join(failed, ", "))
+	}
+
+	if applyDeleteRequests {
+		return c.deleteRequests.markRequestsProcessed(ctx)
+	}
+	return nil
+}
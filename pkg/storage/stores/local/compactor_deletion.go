@@ -0,0 +1,300 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"go.etcd.io/bbolt"
+
+	"github.com/grafana/loki/pkg/chunkenc"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/grafana/loki/pkg/storage/stores/deletion"
+	loki_util "github.com/grafana/loki/pkg/util"
+)
+
+// size of the blocks of the chunks rewritten without the deleted lines, the default of the ingesters.
+const rewrittenChunkBlockSize = 256 * 1024
+
+type deleteRequestsMetrics struct {
+	processedRequestsTotal prometheus.Counter
+	chunksTotal            *prometheus.CounterVec
+}
+
+func newDeleteRequestsMetrics(r prometheus.Registerer) *deleteRequestsMetrics {
+	return &deleteRequestsMetrics{
+		processedRequestsTotal: promauto.With(r).NewCounter(prometheus.CounterOpts{
+			Namespace: "loki_boltdb_shipper",
+			Name:      "delete_requests_processed_total",
+			Help:      "Total number of delete requests processed by the compactor",
+		}),
+		chunksTotal: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "loki_boltdb_shipper",
+			Name:      "delete_requests_chunks_total",
+			Help:      "Total number of chunks removed or rewritten without the deleted lines by operation",
+		}, []string{"operation"}),
+	}
+}
+
+// deleteRequestsProcessor applies the delete requests whose cancel period elapsed to the compacted index of the tables.
+// The chunks with deleted lines are rewritten without them, or removed when no line is left, and the original chunks
+// are deleted by the sweeper once the requests were applied to all the tables, as chunks may span several of them.
+type deleteRequestsProcessor struct {
+	store        deletion.DeleteRequestsStore
+	chunkClient  ChunkClient
+	sweeper      *chunkSweeper
+	cancelPeriod time.Duration
+	metrics      *deleteRequestsMetrics
+
+	// requests applied during the current compaction run.
+	requests []deletion.DeleteRequest
+	// ids of the chunks rewritten during the current compaction run by the id of the original chunk, empty when
+	// all the lines were deleted. Chunks spanning several tables are only rewritten once.
+	rewritten map[string]string
+	// ids of the original chunks removed from the index of the tables, they are marked for deletion once all the
+	// tables were compacted. They are kept after a failed compaction run, the tables still referencing them are
+	// rewritten by the next one.
+	toMark map[string]struct{}
+}
+
+func newDeleteRequestsProcessor(cfg CompactorConfig, store deletion.DeleteRequestsStore, chunkClient ChunkClient, sweeper *chunkSweeper, r prometheus.Registerer) *deleteRequestsProcessor {
+	return &deleteRequestsProcessor{
+		store:        store,
+		chunkClient:  chunkClient,
+		sweeper:      sweeper,
+		cancelPeriod: cfg.DeleteRequestCancelPeriod,
+		metrics:      newDeleteRequestsMetrics(r),
+		toMark:       map[string]struct{}{},
+	}
+}
+
+// loadRequests fetches the requests to apply during a compaction run and returns whether there are any.
+func (p *deleteRequestsProcessor) loadRequests(ctx context.Context) (bool, error) {
+	requests, err := p.store.GetDeleteRequestsByStatus(ctx, deletion.StatusReceived)
+	if err != nil {
+		return false, err
+	}
+
+	p.requests = p.requests[:0]
+	p.rewritten = map[string]string{}
+	for _, req := range requests {
+		if !model.Now().Before(req.CreatedAt.Add(p.cancelPeriod)) {
+			p.requests = append(p.requests, req)
+		}
+	}
+	return len(p.requests) > 0, nil
+}
+
+// checkRequests drops the requests cancelled since they were loaded. A request can only be cancelled before its cancel
+// period elapses, so this only happens when the cancellation races with the load of the requests.
+func (p *deleteRequestsProcessor) checkRequests(ctx context.Context) error {
+	requests := p.requests[:0]
+	for _, req := range p.requests {
+		current, err := p.store.GetDeleteRequest(ctx, req.UserID, req.RequestID)
+		if err != nil {
+			return err
+		}
+		if current.Status != deletion.StatusReceived {
+			level.Warn(util.Logger).Log("msg", "delete request cancelled while being applied, it is only applied to the tables already compacted", "user", req.UserID, "request_id", req.RequestID, "status", current.Status)
+			continue
+		}
+		requests = append(requests, req)
+	}
+	p.requests = requests
+	return nil
+}
+
+// markRequestsProcessed is called once the requests were applied to all the tables.
+func (p *deleteRequestsProcessor) markRequestsProcessed(ctx context.Context) error {
+	if len(p.toMark) > 0 {
+		chunkIDs := make([]string, 0, len(p.toMark))
+		for chunkID := range p.toMark {
+			chunkIDs = append(chunkIDs, chunkID)
+		}
+		if err := p.sweeper.markChunks(chunkIDs); err != nil {
+			return err
+		}
+		p.toMark = map[string]struct{}{}
+	}
+
+	for _, req := range p.requests {
+		err := p.store.UpdateStatus(ctx, req.UserID, req.RequestID, deletion.StatusReceived, deletion.StatusProcessed)
+		if err == deletion.ErrDeleteRequestStatusChanged {
+			level.Warn(util.Logger).Log("msg", "delete request cancelled while being applied, it is not marked as processed", "user", req.UserID, "request_id", req.RequestID)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		level.Info(util.Logger).Log("msg", "delete request processed", "user", req.UserID, "request_id", req.RequestID)
+		p.metrics.processedRequestsTotal.Inc()
+	}
+	p.requests = p.requests[:0]
+	return nil
+}
+
+func (p *deleteRequestsProcessor) process(ctx context.Context, tableName string, db *bbolt.DB) (bool, error) {
+	if err := p.checkRequests(ctx); err != nil {
+		return false, err
+	}
+	if len(p.requests) == 0 {
+		return false, nil
+	}
+
+	entries, err := readIndexEntries(db)
+	if err != nil {
+		return false, err
+	}
+
+	var removed []chunkEntry
+	replacements := map[string][]byte{}
+	for _, c := range entries.chunks {
+		seriesID, _ := splitSeries(c.series)
+		requests := p.requestsForChunk(c, entries.seriesLabels[seriesID])
+		if len(requests) == 0 {
+			continue
+		}
+
+		newChunkID, ok := p.rewritten[c.chunkID]
+		if !ok {
+			newChunkID, err = p.rewriteChunk(ctx, c, requests)
+			if err != nil {
+				return false, err
+			}
+			p.rewritten[c.chunkID] = newChunkID
+			if newChunkID != c.chunkID {
+				p.toMark[c.chunkID] = struct{}{}
+			}
+		}
+
+		switch newChunkID {
+		case c.chunkID:
+		case "":
+			removed = append(removed, c)
+		default:
+			replacements[string(c.key)] = replaceChunkID(c.key, newChunkID)
+		}
+	}
+
+	if len(removed) == 0 && len(replacements) == 0 {
+		return false, nil
+	}
+
+	deadSeries, err := removeChunks(db, entries, removed, replacements)
+	if err != nil {
+		return false, err
+	}
+
+	level.Info(util.Logger).Log("msg", "applied delete requests to the index", "table", tableName, "removed_chunks", len(removed), "rewritten_chunks", len(replacements), "series", deadSeries)
+	return true, nil
+}
+
+func (p *deleteRequestsProcessor) requestsForChunk(c chunkEntry, lbls labels.Labels) []*deletion.DeleteRequest {
+	from, through := model.TimeFromUnixNano(c.from.UnixNano()), model.TimeFromUnixNano(c.through.UnixNano())
+
+	var requests []*deletion.DeleteRequest
+	for i := range p.requests {
+		req := &p.requests[i]
+		if req.UserID == c.userID && req.Overlaps(from, through) && req.MatchesSeries(lbls) {
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
+
+// rewriteChunk writes a new chunk without the lines deleted by requests and returns its id.
+// The id of the chunk is returned when no line is deleted and an empty id when all of them are.
+func (p *deleteRequestsProcessor) rewriteChunk(ctx context.Context, c chunkEntry, requests []*deletion.DeleteRequest) (string, error) {
+	for _, req := range requests {
+		if req.Covers(model.TimeFromUnixNano(c.from.UnixNano()), model.TimeFromUnixNano(c.through.UnixNano())) {
+			p.metrics.chunksTotal.WithLabelValues("removed").Inc()
+			return "", nil
+		}
+	}
+
+	ref, err := parseChunkID(c.chunkID)
+	if err != nil {
+		return "", err
+	}
+	chunks, err := p.chunkClient.GetChunks(ctx, []chunk.Chunk{ref})
+	if err != nil {
+		return "", err
+	}
+	if len(chunks) != 1 {
+		return "", fmt.Errorf("chunk %s not found", c.chunkID)
+	}
+	original := chunks[0]
+
+	facade, ok := original.Data.(*chunkenc.Facade)
+	if !ok {
+		return "", fmt.Errorf("unexpected encoding of chunk %s", c.chunkID)
+	}
+	lokiChunk := facade.LokiChunk()
+
+	enc := chunkenc.EncGZIP
+	if memChunk, ok := lokiChunk.(*chunkenc.MemChunk); ok {
+		enc = memChunk.Encoding()
+	}
+	rewritten := chunkenc.NewMemChunk(enc, rewrittenChunkBlockSize, 0)
+
+	from, through := lokiChunk.Bounds()
+	it, err := lokiChunk.Iterator(ctx, from, through.Add(time.Nanosecond), logproto.FORWARD, nil)
+	if err != nil {
+		return "", err
+	}
+	defer it.Close()
+
+	total, kept := 0, 0
+outer:
+	for it.Next() {
+		total++
+		entry := it.Entry()
+		for _, req := range requests {
+			if req.IsDeleted(entry.Timestamp, []byte(entry.Line)) {
+				continue outer
+			}
+		}
+		if err := rewritten.Append(&entry); err != nil {
+			return "", err
+		}
+		kept++
+	}
+	if err := it.Error(); err != nil {
+		return "", err
+	}
+
+	switch kept {
+	case total:
+		return c.chunkID, nil
+	case 0:
+		p.metrics.chunksTotal.WithLabelValues("removed").Inc()
+		return "", nil
+	}
+
+	if err := rewritten.Close(); err != nil {
+		return "", err
+	}
+	firstTime, lastTime := loki_util.RoundToMilliseconds(rewritten.Bounds())
+	newChunk := chunk.NewChunk(
+		original.UserID, original.Fingerprint, original.Metric,
+		chunkenc.NewFacade(rewritten, rewrittenChunkBlockSize, 0),
+		firstTime,
+		lastTime,
+	)
+	if err := newChunk.Encode(); err != nil {
+		return "", err
+	}
+	if err := p.chunkClient.PutChunks(ctx, []chunk.Chunk{newChunk}); err != nil {
+		return "", err
+	}
+
+	p.metrics.chunksTotal.WithLabelValues("rewritten").Inc()
+	return newChunk.ExternalKey(), nil
+}
@@ -0,0 +1,271 @@
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/local"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+
+	"github.com/grafana/loki/pkg/chunkenc"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/grafana/loki/pkg/storage/stores/deletion"
+)
+
+// newTestChunk creates a chunk with a line for each given one, logged every second until through.
+func newTestChunk(t *testing.T, c testChunk, lines ...string) chunk.Chunk {
+	lbls, err := parser.ParseMetric(c.labels)
+	require.NoError(t, err)
+	lbls = append(lbls, labels.Label{Name: labels.MetricName, Value: "logs"})
+
+	memChunk := chunkenc.NewMemChunk(chunkenc.EncGZIP, 256*1024, 0)
+	for i, line := range lines {
+		ts := c.through.Add(time.Duration(i-len(lines)+1) * time.Second)
+		require.NoError(t, memChunk.Append(&logproto.Entry{Timestamp: ts, Line: line}))
+	}
+	require.NoError(t, memChunk.Close())
+
+	from, through := memChunk.Bounds()
+	result := chunk.NewChunk(c.userID, model.Fingerprint(lbls.Hash()), lbls, chunkenc.NewFacade(memChunk, 256*1024, 0),
+		model.TimeFromUnixNano(from.UnixNano()), model.TimeFromUnixNano(through.UnixNano()))
+	require.NoError(t, result.Encode())
+	return result
+}
+
+func readChunkLines(t *testing.T, c chunk.Chunk) []string {
+	lokiChunk := c.Data.(*chunkenc.Facade).LokiChunk()
+	from, through := lokiChunk.Bounds()
+	it, err := lokiChunk.Iterator(context.Background(), from, through.Add(time.Nanosecond), logproto.FORWARD, nil)
+	require.NoError(t, err)
+	defer it.Close()
+
+	var lines []string
+	for it.Next() {
+		lines = append(lines, it.Entry().Line)
+	}
+	require.NoError(t, it.Error())
+	return lines
+}
+
+func TestDeleteRequestsProcessor(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "deletion-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	objectClient, err := local.NewFSObjectClient(local.FSConfig{Directory: filepath.Join(tempDir, "store")})
+	require.NoError(t, err)
+	store := deletion.NewDeleteRequestsStore(objectClient)
+
+	old := time.Now().Add(-48 * time.Hour).Truncate(24 * time.Hour).Add(12 * time.Hour)
+	foo := testChunk{userID: "1", labels: `{app="foo"}`, through: old}
+	bar := testChunk{userID: "1", labels: `{app="bar"}`, through: old}
+	baz := testChunk{userID: "1", labels: `{app="baz"}`, through: old}
+	barOtherTenant := testChunk{userID: "2", labels: `{app="bar"}`, through: old}
+	chunks := []testChunk{foo, bar, baz, barOtherTenant}
+
+	chunkClient := &fakeChunkClient{chunks: map[string]chunk.Chunk{}}
+	for _, c := range chunks {
+		chunkClient.chunks[c.id()] = newTestChunk(t, c, "first", "secret", "last")
+	}
+
+	start, end := model.TimeFromUnixNano(old.Add(-time.Hour).UnixNano()), model.TimeFromUnixNano(old.UnixNano())
+	_, err = store.AddDeleteRequest(context.Background(), "1", `{app="foo"}`, start, end)
+	require.NoError(t, err)
+	_, err = store.AddDeleteRequest(context.Background(), "1", `{app="bar"} |= "secret"`, start, end)
+	require.NoError(t, err)
+	// lines logged after the end of the request are kept.
+	_, err = store.AddDeleteRequest(context.Background(), "1", `{app="baz"}`, start, end.Add(-time.Second))
+	require.NoError(t, err)
+	cancelled, err := store.AddDeleteRequest(context.Background(), "1", `{app="baz"}`, start, end)
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateStatus(context.Background(), "1", cancelled.RequestID, deletion.StatusReceived, deletion.StatusCancelled))
+
+	db, err := local.OpenBoltdbFile(filepath.Join(tempDir, "index"))
+	require.NoError(t, err)
+	defer db.Close()
+	writeTestIndex(t, db, chunks)
+
+	cfg := CompactorConfig{WorkingDirectory: tempDir}
+	sweeper, err := newChunkSweeper(cfg, chunkClient, prometheus.NewRegistry())
+	require.NoError(t, err)
+	p := newDeleteRequestsProcessor(cfg, store, chunkClient, sweeper, prometheus.NewRegistry())
+
+	pending, err := p.loadRequests(context.Background())
+	require.NoError(t, err)
+	require.True(t, pending)
+
+	modified, err := p.process(context.Background(), "table", db)
+	require.NoError(t, err)
+	require.True(t, modified)
+	require.NoError(t, p.markRequestsProcessed(context.Background()))
+
+	entries, err := readIndexEntries(db)
+	require.NoError(t, err)
+	remaining := map[string]string{}
+	for _, c := range entries.chunks {
+		remaining[c.chunkID] = c.userID
+	}
+	require.Len(t, remaining, 3)
+	require.Contains(t, remaining, barOtherTenant.id())
+	require.NotContains(t, remaining, foo.id())
+	require.NotContains(t, remaining, bar.id())
+	require.NotContains(t, remaining, baz.id())
+
+	for chunkID := range remaining {
+		c, ok := chunkClient.chunks[chunkID]
+		require.True(t, ok)
+		switch app := c.Metric.Get("app"); {
+		case chunkID == barOtherTenant.id():
+			require.Equal(t, []string{"first", "secret", "last"}, readChunkLines(t, c))
+		case app == "bar":
+			require.Equal(t, []string{"first", "last"}, readChunkLines(t, c))
+		case app == "baz":
+			require.Equal(t, []string{"last"}, readChunkLines(t, c))
+		default:
+			t.Fatalf("unexpected chunk %s", chunkID)
+		}
+	}
+
+	// the original chunks are deleted by the sweeper.
+	require.NoError(t, sweeper.sweep(context.Background()))
+	require.ElementsMatch(t, []string{foo.id(), bar.id(), baz.id()}, chunkClient.deleted)
+
+	requests, err := store.GetAllDeleteRequestsForUser(context.Background(), "1")
+	require.NoError(t, err)
+	for _, req := range requests {
+		if req.RequestID == cancelled.RequestID {
+			require.Equal(t, deletion.StatusCancelled, req.Status)
+			continue
+		}
+		require.Equal(t, deletion.StatusProcessed, req.Status)
+	}
+
+	pending, err = p.loadRequests(context.Background())
+	require.NoError(t, err)
+	require.False(t, pending)
+}
+
+func TestDeleteRequestsProcessor_FailedTable(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "deletion-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	objectClient, err := local.NewFSObjectClient(local.FSConfig{Directory: filepath.Join(tempDir, "store")})
+	require.NoError(t, err)
+	store := deletion.NewDeleteRequestsStore(objectClient)
+
+	// the chunk is indexed in both tables.
+	old := time.Now().Add(-48 * time.Hour).Truncate(24 * time.Hour).Add(12 * time.Hour)
+	foo := testChunk{userID: "1", labels: `{app="foo"}`, through: old}
+	chunkClient := &fakeChunkClient{chunks: map[string]chunk.Chunk{foo.id(): newTestChunk(t, foo, "first", "secret", "last")}}
+
+	start, end := model.TimeFromUnixNano(old.Add(-time.Hour).UnixNano()), model.TimeFromUnixNano(old.UnixNano())
+	_, err = store.AddDeleteRequest(context.Background(), "1", `{app="foo"} |= "secret"`, start, end)
+	require.NoError(t, err)
+
+	var dbs []*bbolt.DB
+	for _, name := range []string{"index-1", "index-2"} {
+		db, err := local.OpenBoltdbFile(filepath.Join(tempDir, name))
+		require.NoError(t, err)
+		defer db.Close()
+		writeTestIndex(t, db, []testChunk{foo})
+		dbs = append(dbs, db)
+	}
+
+	cfg := CompactorConfig{WorkingDirectory: tempDir}
+	sweeper, err := newChunkSweeper(cfg, chunkClient, prometheus.NewRegistry())
+	require.NoError(t, err)
+	p := newDeleteRequestsProcessor(cfg, store, chunkClient, sweeper, prometheus.NewRegistry())
+
+	// the compaction of the second table fails after the first one was rewritten.
+	pending, err := p.loadRequests(context.Background())
+	require.NoError(t, err)
+	require.True(t, pending)
+	modified, err := p.process(context.Background(), "table-1", dbs[0])
+	require.NoError(t, err)
+	require.True(t, modified)
+
+	// the original chunk is still referenced by the second table, it is not deleted.
+	require.NoError(t, sweeper.sweep(context.Background()))
+	require.Empty(t, chunkClient.deleted)
+
+	// the next run rewrites the second table from the original chunk.
+	pending, err = p.loadRequests(context.Background())
+	require.NoError(t, err)
+	require.True(t, pending)
+	for i, db := range dbs {
+		modified, err := p.process(context.Background(), "table", db)
+		require.NoError(t, err)
+		require.Equal(t, i == 1, modified)
+	}
+	require.NoError(t, p.markRequestsProcessed(context.Background()))
+
+	for _, db := range dbs {
+		entries, err := readIndexEntries(db)
+		require.NoError(t, err)
+		require.Len(t, entries.chunks, 1)
+		c, ok := chunkClient.chunks[entries.chunks[0].chunkID]
+		require.True(t, ok)
+		require.Equal(t, []string{"first", "last"}, readChunkLines(t, c))
+	}
+
+	require.NoError(t, sweeper.sweep(context.Background()))
+	require.Equal(t, []string{foo.id()}, chunkClient.deleted)
+}
+
+func TestDeleteRequestsProcessor_CancelledAfterLoad(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "deletion-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	objectClient, err := local.NewFSObjectClient(local.FSConfig{Directory: filepath.Join(tempDir, "store")})
+	require.NoError(t, err)
+	store := deletion.NewDeleteRequestsStore(objectClient)
+
+	old := time.Now().Add(-48 * time.Hour).Truncate(24 * time.Hour).Add(12 * time.Hour)
+	foo := testChunk{userID: "1", labels: `{app="foo"}`, through: old}
+	chunkClient := &fakeChunkClient{chunks: map[string]chunk.Chunk{foo.id(): newTestChunk(t, foo, "first", "last")}}
+
+	start, end := model.TimeFromUnixNano(old.Add(-time.Hour).UnixNano()), model.TimeFromUnixNano(old.UnixNano())
+	req, err := store.AddDeleteRequest(context.Background(), "1", `{app="foo"}`, start, end)
+	require.NoError(t, err)
+
+	db, err := local.OpenBoltdbFile(filepath.Join(tempDir, "index"))
+	require.NoError(t, err)
+	defer db.Close()
+	writeTestIndex(t, db, []testChunk{foo})
+
+	cfg := CompactorConfig{WorkingDirectory: tempDir}
+	sweeper, err := newChunkSweeper(cfg, chunkClient, prometheus.NewRegistry())
+	require.NoError(t, err)
+	p := newDeleteRequestsProcessor(cfg, store, chunkClient, sweeper, prometheus.NewRegistry())
+
+	pending, err := p.loadRequests(context.Background())
+	require.NoError(t, err)
+	require.True(t, pending)
+
+	// the request is cancelled between the load of the requests and their application.
+	require.NoError(t, store.UpdateStatus(context.Background(), "1", req.RequestID, deletion.StatusReceived, deletion.StatusCancelled))
+
+	modified, err := p.process(context.Background(), "table", db)
+	require.NoError(t, err)
+	require.False(t, modified)
+	require.NoError(t, p.markRequestsProcessed(context.Background()))
+
+	entries, err := readIndexEntries(db)
+	require.NoError(t, err)
+	require.Len(t, entries.chunks, 1)
+	current, err := store.GetDeleteRequest(context.Background(), "1", req.RequestID)
+	require.NoError(t, err)
+	require.Equal(t, deletion.StatusCancelled, current.Status)
+}
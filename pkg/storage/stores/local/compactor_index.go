@@ -0,0 +1,266 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// range key types of the v9+ schemas, see the chunk package of cortex.
+	chunkTimeRangeKeyV3   = '3'
+	seriesRangeKeyV1      = '7'
+	labelSeriesRangeKeyV1 = '8'
+	labelNamesRangeKeyV1  = '9'
+)
+
+// indexBucketName is the bucket in which cortex writes the index entries of a boltdb file.
+var indexBucketName = []byte("index")
+
+// indexProcessor removes or rewrites the entries of chunks in the compacted index of a table.
+// Only the entries written by the v9+ schemas are supported.
+type indexProcessor interface {
+	// process updates the index entries in db and returns whether it was modified.
+	process(ctx context.Context, tableName string, db *bbolt.DB) (bool, error)
+}
+
+type chunkEntry struct {
+	key    []byte
+	userID string
+	// series is the hash value of the entry, <user>:d<day>:<series ID>, which identifies the series of a tenant in a bucket.
+	series  string
+	chunkID string
+	from    time.Time
+	through time.Time
+}
+
+// splitSeries returns the series ID and the hash key of the bucket of a chunk entry hash value.
+func splitSeries(series string) (seriesID, bucketHashKey string) {
+	i := strings.LastIndexByte(series, ':')
+	if i < 0 {
+		return series, ""
+	}
+	return series[i+1:], series[:i]
+}
+
+// inBucket returns whether hashValue, which can be prefixed by a shard number, belongs to the bucket with the given hash key.
+func inBucket(hashValue []byte, bucketHashKey string) bool {
+	prefix := []byte(bucketHashKey + ":")
+	return bytes.HasPrefix(hashValue, prefix) || (len(hashValue) > 3 && hashValue[2] == ':' && bytes.HasPrefix(hashValue[3:], prefix))
+}
+
+// indexEntries holds the entries of a boltdb file relevant to remove chunks.
+type indexEntries struct {
+	chunks []chunkEntry
+	// keys of the series and label entries by series ID, for all the tenants and buckets.
+	seriesKeys map[string][][]byte
+	// keys of the label names entries by series ID, they are shared by all the tenants and buckets.
+	labelNamesKeys map[string][]byte
+	// labels of the series by series ID, the ID is a hash of the labels so it is the same for all tenants.
+	seriesLabels map[string]labels.Labels
+}
+
+func readIndexEntries(db *bbolt.DB) (*indexEntries, error) {
+	entries := &indexEntries{
+		seriesKeys:     map[string][][]byte{},
+		labelNamesKeys: map[string][]byte{},
+		seriesLabels:   map[string]labels.Labels{},
+	}
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(indexBucketName)
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			sep := bytes.IndexByte(k, 0)
+			if sep < 0 {
+				return nil
+			}
+			hashValue, rangeValue := string(k[:sep]), k[sep+1:]
+			components := decodeRangeKey(rangeValue)
+			if len(components) < 4 || len(components[3]) != 1 {
+				return nil
+			}
+
+			switch components[3][0] {
+			case chunkTimeRangeKeyV3:
+				chunkID := string(components[2])
+				c, err := parseChunkID(chunkID)
+				if err != nil {
+					level.Warn(util.Logger).Log("msg", "skipping chunk with invalid id", "chunk", chunkID, "err", err)
+					return nil
+				}
+				entries.chunks = append(entries.chunks, chunkEntry{
+					key:     append([]byte{}, k...),
+					userID:  c.UserID,
+					series:  hashValue,
+					chunkID: chunkID,
+					from:    c.From.Time(),
+					through: c.Through.Time(),
+				})
+			case seriesRangeKeyV1:
+				seriesID := string(components[0])
+				entries.seriesKeys[seriesID] = append(entries.seriesKeys[seriesID], append([]byte{}, k...))
+			case labelSeriesRangeKeyV1:
+				seriesID := string(components[1])
+				entries.seriesKeys[seriesID] = append(entries.seriesKeys[seriesID], append([]byte{}, k...))
+				entries.seriesLabels[seriesID] = append(entries.seriesLabels[seriesID], labels.Label{
+					Name:  hashValue[strings.LastIndexByte(hashValue, ':')+1:],
+					Value: string(v),
+				})
+			case labelNamesRangeKeyV1:
+				entries.labelNamesKeys[hashValue] = append([]byte{}, k...)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, lbls := range entries.seriesLabels {
+		sort.Sort(lbls)
+	}
+	return entries, nil
+}
+
+// parseChunkID parses the id of a chunk, the tenant is part of it since the v9 schema.
+func parseChunkID(chunkID string) (chunk.Chunk, error) {
+	i := strings.IndexByte(chunkID, '/')
+	if i < 0 {
+		return chunk.Chunk{}, fmt.Errorf("chunk id %s does not contain the tenant", chunkID)
+	}
+	return chunk.ParseExternalKey(chunkID[:i], chunkID)
+}
+
+// decodeRangeKey splits a range value in its components, which are separated by a 0 byte.
+func decodeRangeKey(value []byte) [][]byte {
+	components := make([][]byte, 0, 5)
+	i, j := 0, 0
+	for j < len(value) {
+		if value[j] != 0 {
+			j++
+			continue
+		}
+		components = append(components, value[i:j])
+		j++
+		i = j
+	}
+	return components
+}
+
+// encodeRangeKey is the reverse of decodeRangeKey.
+func encodeRangeKey(components ...[]byte) []byte {
+	length := 0
+	for _, c := range components {
+		length += len(c) + 1
+	}
+
+	value := make([]byte, 0, length)
+	for _, c := range components {
+		value = append(value, c...)
+		value = append(value, 0)
+	}
+	return value
+}
+
+// replaceChunkID returns the key of the entry of a chunk for the chunk with the given id.
+func replaceChunkID(key []byte, chunkID string) []byte {
+	sep := bytes.IndexByte(key, 0)
+	components := decodeRangeKey(key[sep+1:])
+	components[2] = []byte(chunkID)
+	return append(append([]byte{}, key[:sep+1]...), encodeRangeKey(components...)...)
+}
+
+// removeChunks deletes the entries of the removed chunks from db, and the entries of the series left without chunks.
+// The entries of chunks in replacements, by key, are replaced by the entries with the new keys.
+// It returns the number of series removed from a bucket.
+func removeChunks(db *bbolt.DB, entries *indexEntries, removed []chunkEntry, replacements map[string][]byte) (int, error) {
+	removedKeys := make(map[string]struct{}, len(removed))
+	for _, c := range removed {
+		removedKeys[string(c.key)] = struct{}{}
+	}
+
+	liveSeries, liveSeriesIDs := map[string]struct{}{}, map[string]struct{}{}
+	for _, c := range entries.chunks {
+		if _, ok := removedKeys[string(c.key)]; ok {
+			continue
+		}
+		seriesID, _ := splitSeries(c.series)
+		liveSeries[c.series] = struct{}{}
+		liveSeriesIDs[seriesID] = struct{}{}
+	}
+
+	toDelete := make([][]byte, 0, len(removed)+len(replacements))
+	deadSeries := map[string]struct{}{}
+	for _, c := range removed {
+		toDelete = append(toDelete, c.key)
+		if _, ok := liveSeries[c.series]; !ok {
+			deadSeries[c.series] = struct{}{}
+		}
+	}
+	for series := range deadSeries {
+		seriesID, bucketHashKey := splitSeries(series)
+		for _, k := range entries.seriesKeys[seriesID] {
+			// the same series can exist for other tenants or days.
+			if inBucket(k, bucketHashKey) {
+				toDelete = append(toDelete, k)
+			}
+		}
+		if k, ok := entries.labelNamesKeys[seriesID]; ok {
+			if _, live := liveSeriesIDs[seriesID]; !live {
+				toDelete = append(toDelete, k)
+				delete(entries.labelNamesKeys, seriesID)
+			}
+		}
+	}
+
+	toPut := make([][]byte, 0, len(replacements))
+	for oldKey, newKey := range replacements {
+		toDelete = append(toDelete, []byte(oldKey))
+		toPut = append(toPut, newKey)
+	}
+
+	for len(toDelete) > 0 || len(toPut) > 0 {
+		n, m := mergeBatchSize, mergeBatchSize
+		if n > len(toDelete) {
+			n = len(toDelete)
+		}
+		if m > len(toPut) {
+			m = len(toPut)
+		}
+
+		err := db.Update(func(tx *bbolt.Tx) error {
+			b := tx.Bucket(indexBucketName)
+			for _, k := range toDelete[:n] {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			// the entries of chunks have no value.
+			for _, k := range toPut[:m] {
+				if err := b.Put(k, []byte{}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		toDelete, toPut = toDelete[n:], toPut[m:]
+	}
+
+	return len(deadSeries), nil
+}
@@ -0,0 +1,118 @@
+package local
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"go.etcd.io/bbolt"
+
+	"github.com/grafana/loki/pkg/util/validation"
+)
+
+// RetentionLimits provides the retention of each tenant.
+type RetentionLimits interface {
+	RetentionPeriod(userID string) time.Duration
+	StreamRetention(userID string) []validation.StreamRetention
+}
+
+// retention removes the index entries of expired chunks from compacted files, the chunks are deleted by the sweeper.
+type retention struct {
+	limits             RetentionLimits
+	sweeper            *chunkSweeper
+	dryRun             bool
+	expiredChunksTotal *prometheus.CounterVec
+}
+
+func newRetention(cfg CompactorConfig, limits RetentionLimits, sweeper *chunkSweeper, r prometheus.Registerer) *retention {
+	return &retention{
+		limits:  limits,
+		sweeper: sweeper,
+		dryRun:  cfg.RetentionDryRun,
+		expiredChunksTotal: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "loki_boltdb_shipper",
+			Name:      "retention_expired_chunks_total",
+			Help:      "Total number of chunks found expired by the retention, including the ones of dry runs",
+		}, []string{"dry_run"}),
+	}
+}
+
+// retentionPeriod returns how long the chunks of a stream are kept, 0 means forever.
+// The matching stream rule with the highest priority wins, then the one with the longest period.
+func retentionPeriod(limits RetentionLimits, userID string, lbls labels.Labels) time.Duration {
+	rules := limits.StreamRetention(userID)
+
+	var matched *validation.StreamRetention
+	for i := range rules {
+		rule := &rules[i]
+		if !matchesAll(rule.Matchers, lbls) {
+			continue
+		}
+		if matched == nil || rule.Priority > matched.Priority || (rule.Priority == matched.Priority && rule.Period > matched.Period) {
+			matched = rule
+		}
+	}
+
+	if matched == nil {
+		return limits.RetentionPeriod(userID)
+	}
+	return matched.Period
+}
+
+func matchesAll(matchers []*labels.Matcher, lbls labels.Labels) bool {
+	for _, m := range matchers {
+		if !m.Matches(lbls.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// process removes the index entries of the expired chunks from db, and the entries of the series left without chunks.
+func (r *retention) process(_ context.Context, tableName string, db *bbolt.DB) (bool, error) {
+	entries, err := readIndexEntries(db)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	var expired []chunkEntry
+	for _, c := range entries.chunks {
+		seriesID, _ := splitSeries(c.series)
+		period := retentionPeriod(r.limits, c.userID, entries.seriesLabels[seriesID])
+		if period > 0 && c.through.Before(now.Add(-period)) {
+			expired = append(expired, c)
+		}
+	}
+
+	if len(expired) == 0 {
+		return false, nil
+	}
+
+	r.expiredChunksTotal.WithLabelValues(strconv.FormatBool(r.dryRun)).Add(float64(len(expired)))
+	if r.dryRun {
+		level.Info(util.Logger).Log("msg", "dry run: not deleting expired chunks", "table", tableName, "chunks", len(expired))
+		return false, nil
+	}
+
+	chunkIDs := make([]string, 0, len(expired))
+	for _, c := range expired {
+		chunkIDs = append(chunkIDs, c.chunkID)
+	}
+	if err := r.sweeper.markChunks(chunkIDs); err != nil {
+		return false, err
+	}
+
+	deadSeries, err := removeChunks(db, entries, expired, nil)
+	if err != nil {
+		return false, err
+	}
+
+	level.Info(util.Logger).Log("msg", "removed expired chunks from the index", "table", tableName, "chunks", len(expired), "series", deadSeries)
+	return true, nil
+}
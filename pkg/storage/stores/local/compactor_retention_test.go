@@ -0,0 +1,237 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/local"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+
+	"github.com/grafana/loki/pkg/logql"
+	"github.com/grafana/loki/pkg/util/validation"
+)
+
+type fakeRetentionLimits struct {
+	periods map[string]time.Duration
+	streams map[string][]validation.StreamRetention
+}
+
+func (f fakeRetentionLimits) RetentionPeriod(userID string) time.Duration {
+	return f.periods[userID]
+}
+
+func (f fakeRetentionLimits) StreamRetention(userID string) []validation.StreamRetention {
+	return f.streams[userID]
+}
+
+type fakeChunkClient struct {
+	chunks  map[string]chunk.Chunk
+	deleted []string
+}
+
+func (f *fakeChunkClient) GetChunks(_ context.Context, chunks []chunk.Chunk) ([]chunk.Chunk, error) {
+	result := make([]chunk.Chunk, 0, len(chunks))
+	for _, c := range chunks {
+		if found, ok := f.chunks[c.ExternalKey()]; ok {
+			result = append(result, found)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeChunkClient) PutChunks(_ context.Context, chunks []chunk.Chunk) error {
+	if f.chunks == nil {
+		f.chunks = map[string]chunk.Chunk{}
+	}
+	for _, c := range chunks {
+		f.chunks[c.ExternalKey()] = c
+	}
+	return nil
+}
+
+func (f *fakeChunkClient) DeleteChunk(_ context.Context, _, chunkID string) error {
+	f.deleted = append(f.deleted, chunkID)
+	return nil
+}
+
+type testChunk struct {
+	userID  string
+	labels  string
+	through time.Time
+}
+
+func (c testChunk) id() string {
+	lbls, _ := parser.ParseMetric(c.labels)
+	return fmt.Sprintf("%s/%x:%x:%x:%x", c.userID, lbls.Hash(), int64(model.TimeFromUnixNano(c.through.Add(-time.Hour).UnixNano())), int64(model.TimeFromUnixNano(c.through.UnixNano())), 0)
+}
+
+// writeTestIndex writes the index entries of the v11 schema for chunks to db.
+func writeTestIndex(t *testing.T, db *bbolt.DB, chunks []testChunk) {
+	schema, err := chunk.PeriodConfig{
+		Schema:      "v11",
+		IndexTables: chunk.PeriodicTableConfig{Prefix: "index_", Period: 24 * time.Hour},
+		RowShards:   16,
+	}.CreateSchema()
+	require.NoError(t, err)
+	seriesSchema := schema.(chunk.SeriesStoreSchema)
+
+	var entries []chunk.IndexEntry
+	for _, c := range chunks {
+		lbls, err := parser.ParseMetric(c.labels)
+		require.NoError(t, err)
+		lbls = append(lbls, labels.Label{Name: labels.MetricName, Value: "logs"})
+		sort.Sort(lbls)
+
+		from, through := model.TimeFromUnixNano(c.through.Add(-time.Hour).UnixNano()), model.TimeFromUnixNano(c.through.UnixNano())
+		_, labelEntries, err := seriesSchema.GetCacheKeysAndLabelWriteEntries(from, through, c.userID, "logs", lbls, c.id())
+		require.NoError(t, err)
+		for _, e := range labelEntries {
+			entries = append(entries, e...)
+		}
+		chunkEntries, err := seriesSchema.GetChunkWriteEntries(from, through, c.userID, "logs", lbls, c.id())
+		require.NoError(t, err)
+		entries = append(entries, chunkEntries...)
+	}
+
+	require.NoError(t, db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(indexBucketName)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := b.Put([]byte(e.HashValue+"\x00"+string(e.RangeValue)), e.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func TestRetention(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-10 * 24 * time.Hour).Truncate(24 * time.Hour).Add(12 * time.Hour)
+	recent := now.Add(-time.Hour)
+
+	oldFoo := testChunk{userID: "1", labels: `{app="foo"}`, through: old}
+	recentFoo := testChunk{userID: "1", labels: `{app="foo"}`, through: recent}
+	oldBar := testChunk{userID: "1", labels: `{app="bar"}`, through: old}
+	oldBarOtherTenant := testChunk{userID: "2", labels: `{app="bar"}`, through: old}
+	chunks := []testChunk{oldFoo, recentFoo, oldBar, oldBarOtherTenant}
+
+	matchers, err := logql.ParseMatchers(`{app="foo"}`)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name     string
+		limits   fakeRetentionLimits
+		dryRun   bool
+		expected []testChunk
+	}{
+		{
+			name:     "no retention",
+			limits:   fakeRetentionLimits{},
+			expected: chunks,
+		},
+		{
+			name:     "tenant retention",
+			limits:   fakeRetentionLimits{periods: map[string]time.Duration{"1": 7 * 24 * time.Hour}},
+			expected: []testChunk{recentFoo, oldBarOtherTenant},
+		},
+		{
+			name: "stream retention",
+			limits: fakeRetentionLimits{
+				periods: map[string]time.Duration{"1": 7 * 24 * time.Hour},
+				streams: map[string][]validation.StreamRetention{"1": {{Period: 30 * 24 * time.Hour, Selector: `{app="foo"}`, Matchers: matchers}}},
+			},
+			expected: []testChunk{oldFoo, recentFoo, oldBarOtherTenant},
+		},
+		{
+			name:     "dry run",
+			limits:   fakeRetentionLimits{periods: map[string]time.Duration{"1": 7 * 24 * time.Hour}},
+			dryRun:   true,
+			expected: chunks,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir, err := ioutil.TempDir("", "retention-test")
+			require.NoError(t, err)
+			defer os.RemoveAll(tempDir)
+
+			db, err := local.OpenBoltdbFile(filepath.Join(tempDir, "index"))
+			require.NoError(t, err)
+			defer db.Close()
+			writeTestIndex(t, db, chunks)
+
+			chunkClient := &fakeChunkClient{}
+			cfg := CompactorConfig{WorkingDirectory: tempDir, RetentionDryRun: tc.dryRun}
+			sweeper, err := newChunkSweeper(cfg, chunkClient, prometheus.NewRegistry())
+			require.NoError(t, err)
+			r := newRetention(cfg, tc.limits, sweeper, prometheus.NewRegistry())
+
+			modified, err := r.process(context.Background(), "table", db)
+			require.NoError(t, err)
+			require.Equal(t, len(tc.expected) != len(chunks), modified)
+
+			entries, err := readIndexEntries(db)
+			require.NoError(t, err)
+			var remaining, expectedIDs []string
+			for _, c := range entries.chunks {
+				remaining = append(remaining, c.chunkID)
+			}
+			for _, c := range tc.expected {
+				expectedIDs = append(expectedIDs, c.id())
+			}
+			require.ElementsMatch(t, expectedIDs, remaining)
+
+			// the series left without chunks are removed, even if other tenants have the same series.
+			var barSeriesID string
+			for _, c := range entries.chunks {
+				if c.userID == "2" {
+					barSeriesID, _ = splitSeries(c.series)
+				}
+			}
+			barSeriesEntries := len(entries.seriesKeys[barSeriesID])
+			if len(tc.expected) == len(chunks) {
+				require.Equal(t, 4, barSeriesEntries)
+			} else {
+				require.Equal(t, 2, barSeriesEntries)
+			}
+			require.Contains(t, entries.labelNamesKeys, barSeriesID)
+
+			// the chunks get deleted once the delay elapsed.
+			require.NoError(t, sweeper.sweep(context.Background()))
+			var expectedDeleted []string
+			for _, c := range chunks {
+				if !containsChunk(tc.expected, c) {
+					expectedDeleted = append(expectedDeleted, c.id())
+				}
+			}
+			require.ElementsMatch(t, expectedDeleted, chunkClient.deleted)
+
+			files, err := ioutil.ReadDir(sweeper.markersDir)
+			require.NoError(t, err)
+			require.Empty(t, files)
+		})
+	}
+}
+
+func containsChunk(chunks []testChunk, c testChunk) bool {
+	for _, other := range chunks {
+		if other == c {
+			return true
+		}
+	}
+	return false
+}
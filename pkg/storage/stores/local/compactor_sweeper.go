@@ -0,0 +1,250 @@
+package local
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/objectclient"
+	chunk_util "github.com/cortexproject/cortex/pkg/chunk/util"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+
+	storage_util "github.com/grafana/loki/pkg/storage/stores/util"
+)
+
+// interval at which the chunks marked for deletion are checked.
+const sweepInterval = time.Minute
+
+// ChunkClient reads, writes and deletes the chunks removed from the index by the compactor.
+type ChunkClient interface {
+	GetChunks(ctx context.Context, chunks []chunk.Chunk) ([]chunk.Chunk, error)
+	PutChunks(ctx context.Context, chunks []chunk.Chunk) error
+	DeleteChunk(ctx context.Context, userID, chunkID string) error
+}
+
+type chunkObjectClient struct {
+	*objectclient.Client
+	objectClient chunk.ObjectClient
+	keyEncoder   objectclient.KeyEncoder
+}
+
+// NewChunkObjectClient returns a ChunkClient for chunks stored in an object store with keys encoded by keyEncoder, which can be nil.
+func NewChunkObjectClient(objectClient chunk.ObjectClient, keyEncoder objectclient.KeyEncoder) ChunkClient {
+	return &chunkObjectClient{
+		Client:       objectclient.NewClient(objectClient, keyEncoder),
+		objectClient: objectClient,
+		keyEncoder:   keyEncoder,
+	}
+}
+
+// DeleteChunk deletes a chunk and the bloom filters stored next to it, chunks which do not exist anymore are not
+// considered as failures.
+func (c *chunkObjectClient) DeleteChunk(ctx context.Context, userID, chunkID string) error {
+	key := chunkID
+	if c.keyEncoder != nil {
+		key = c.keyEncoder(key)
+	}
+
+	if err := c.deleteObject(ctx, key); err != nil {
+		return err
+	}
+	return c.deleteObject(ctx, storage_util.BloomFiltersKey(userID, chunkID))
+}
+
+func (c *chunkObjectClient) deleteObject(ctx context.Context, key string) error {
+	err := c.objectClient.DeleteObject(ctx, key)
+	if err == chunk.ErrStorageObjectNotFound || os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// PeriodChunkClient is the ChunkClient of the chunks of a schema period, starting at From.
+type PeriodChunkClient struct {
+	From   model.Time
+	Client ChunkClient
+}
+
+type periodsChunkClient []PeriodChunkClient
+
+// NewPeriodsChunkClient returns a ChunkClient sending every chunk to the client of the schema period it starts in,
+// periods must be sorted by From.
+func NewPeriodsChunkClient(periods []PeriodChunkClient) ChunkClient {
+	return periodsChunkClient(periods)
+}
+
+func (p periodsChunkClient) client(from model.Time) (ChunkClient, error) {
+	i := sort.Search(len(p), func(i int) bool { return p[i].From > from })
+	if i == 0 {
+		return nil, fmt.Errorf("no schema period for chunks starting at %s", from.Time())
+	}
+	return p[i-1].Client, nil
+}
+
+func (p periodsChunkClient) GetChunks(ctx context.Context, chunks []chunk.Chunk) ([]chunk.Chunk, error) {
+	var result []chunk.Chunk
+	for _, c := range chunks {
+		client, err := p.client(c.From)
+		if err != nil {
+			return nil, err
+		}
+		found, err := client.GetChunks(ctx, []chunk.Chunk{c})
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, found...)
+	}
+	return result, nil
+}
+
+func (p periodsChunkClient) PutChunks(ctx context.Context, chunks []chunk.Chunk) error {
+	for _, c := range chunks {
+		client, err := p.client(c.From)
+		if err != nil {
+			return err
+		}
+		if err := client.PutChunks(ctx, []chunk.Chunk{c}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p periodsChunkClient) DeleteChunk(ctx context.Context, userID, chunkID string) error {
+	c, err := parseChunkID(chunkID)
+	if err != nil {
+		return err
+	}
+	client, err := p.client(c.From)
+	if err != nil {
+		return err
+	}
+	return client.DeleteChunk(ctx, userID, chunkID)
+}
+
+// chunkSweeper deletes the chunks removed from the index after a delay, so queriers which did not download the new index
+// yet can still read them.
+// The chunks are written to marker files before the index gets uploaded, so they are not lost on a crash.
+type chunkSweeper struct {
+	chunkClient        ChunkClient
+	deleteDelay        time.Duration
+	markersDir         string
+	deletedChunksTotal *prometheus.CounterVec
+}
+
+func newChunkSweeper(cfg CompactorConfig, chunkClient ChunkClient, r prometheus.Registerer) (*chunkSweeper, error) {
+	markersDir := path.Join(cfg.WorkingDirectory, "markers")
+	if err := chunk_util.EnsureDirectory(markersDir); err != nil {
+		return nil, err
+	}
+
+	return &chunkSweeper{
+		chunkClient: chunkClient,
+		deleteDelay: cfg.RetentionDeleteDelay,
+		markersDir:  markersDir,
+		deletedChunksTotal: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "loki_boltdb_shipper",
+			Name:      "compactor_deleted_chunks_total",
+			Help:      "Total number of chunk deletions done by status",
+		}, []string{"status"}),
+	}, nil
+}
+
+// markChunks writes the ids of chunks to delete to a new marker file named after the current time.
+// The chunks must be marked before their index entries are removed, they would never be deleted otherwise.
+func (s *chunkSweeper) markChunks(chunkIDs []string) error {
+	name := path.Join(s.markersDir, strconv.FormatInt(time.Now().UnixNano(), 10))
+	if err := writeMarkerFile(name+".tmp", chunkIDs); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+func writeMarkerFile(name string, chunkIDs []string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, id := range chunkIDs {
+		if _, err := fmt.Fprintln(w, id); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// sweep deletes the chunks of the marker files older than the delete delay.
+// Chunks failing to be deleted are kept in the marker file to be retried on the next sweep.
+func (s *chunkSweeper) sweep(ctx context.Context) error {
+	files, err := ioutil.ReadDir(s.markersDir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		ts, err := strconv.ParseInt(file.Name(), 10, 64)
+		if err != nil || time.Unix(0, ts).Add(s.deleteDelay).After(time.Now()) {
+			continue
+		}
+
+		if err := s.sweepMarkerFile(ctx, path.Join(s.markersDir, file.Name())); err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (s *chunkSweeper) sweepMarkerFile(ctx context.Context, name string) error {
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, chunkID := range strings.Fields(string(content)) {
+		c, err := parseChunkID(chunkID)
+		if err != nil {
+			level.Warn(util.Logger).Log("msg", "dropping marked chunk with invalid id", "chunk", chunkID, "err", err)
+			continue
+		}
+
+		if err := s.chunkClient.DeleteChunk(ctx, c.UserID, chunkID); err != nil {
+			level.Error(util.Logger).Log("msg", "failed to delete chunk", "chunk", chunkID, "err", err)
+			s.deletedChunksTotal.WithLabelValues(statusFailure).Inc()
+			failed = append(failed, chunkID)
+			continue
+		}
+		s.deletedChunksTotal.WithLabelValues(statusSuccess).Inc()
+	}
+
+	if len(failed) == 0 {
+		return os.Remove(name)
+	}
+
+	if err := writeMarkerFile(name+".tmp", failed); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
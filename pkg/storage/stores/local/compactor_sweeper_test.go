@@ -0,0 +1,47 @@
+package local
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeriodsChunkClient(t *testing.T) {
+	now := time.Now().Truncate(24 * time.Hour)
+	old := testChunk{userID: "1", labels: `{app="foo"}`, through: now.Add(-36 * time.Hour)}
+	recent := testChunk{userID: "1", labels: `{app="foo"}`, through: now.Add(-6 * time.Hour)}
+
+	oldClient, recentClient := &fakeChunkClient{}, &fakeChunkClient{}
+	client := NewPeriodsChunkClient([]PeriodChunkClient{
+		{From: model.TimeFromUnixNano(now.Add(-72 * time.Hour).UnixNano()), Client: oldClient},
+		{From: model.TimeFromUnixNano(now.Add(-24 * time.Hour).UnixNano()), Client: recentClient},
+	})
+
+	var refs []chunk.Chunk
+	for _, c := range []testChunk{old, recent} {
+		ref, err := parseChunkID(c.id())
+		require.NoError(t, err)
+		refs = append(refs, ref)
+	}
+	require.NoError(t, client.PutChunks(context.Background(), refs))
+	require.Contains(t, oldClient.chunks, old.id())
+	require.Contains(t, recentClient.chunks, recent.id())
+
+	found, err := client.GetChunks(context.Background(), refs)
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+
+	for _, c := range []testChunk{old, recent} {
+		require.NoError(t, client.DeleteChunk(context.Background(), c.userID, c.id()))
+	}
+	require.Equal(t, []string{old.id()}, oldClient.deleted)
+	require.Equal(t, []string{recent.id()}, recentClient.deleted)
+
+	// chunks older than the first period have no object store.
+	tooOld := testChunk{userID: "1", labels: `{app="foo"}`, through: now.Add(-96 * time.Hour)}
+	require.Error(t, client.DeleteChunk(context.Background(), tooOld.userID, tooOld.id()))
+}
@@ -0,0 +1,287 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/local"
+	chunk_util "github.com/cortexproject/cortex/pkg/chunk/util"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/go-kit/kit/log/level"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// compactedFilePrefix is the prefix of the name of files uploaded by the compactor.
+	// The name ends with the latest modification time in nanoseconds of the files merged into it.
+	compactedFilePrefix = "compacted_"
+
+	// number of keys written to the compacted file per transaction.
+	mergeBatchSize = 10000
+)
+
+func compactedFileName(sourcesModifiedAt time.Time) string {
+	return fmt.Sprintf("%s%d", compactedFilePrefix, sourcesModifiedAt.UnixNano())
+}
+
+// parseCompactedFileName returns the latest modification time of the files merged into a compacted file,
+// and false if the name is not the one of a compacted file.
+func parseCompactedFileName(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, compactedFilePrefix) {
+		return time.Time{}, false
+	}
+
+	ts, err := strconv.ParseInt(strings.TrimPrefix(name, compactedFilePrefix), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, ts), true
+}
+
+// filterCompactedObjects removes the files which were merged into the latest compacted file of a table and older compacted files.
+// The compactor deletes them once the compacted file is uploaded but they could still be listed in the meantime.
+func filterCompactedObjects(objects []chunk.StorageObject) []chunk.StorageObject {
+	latest := ""
+	var latestModifiedAt time.Time
+	for _, object := range objects {
+		uploader := getUploaderFromObjectKey(object.Key)
+		if ts, ok := parseCompactedFileName(uploader); ok && (latest == "" || ts.After(latestModifiedAt)) {
+			latest = object.Key
+			latestModifiedAt = ts
+		}
+	}
+
+	if latest == "" {
+		return objects
+	}
+
+	filtered := make([]chunk.StorageObject, 0, len(objects))
+	for _, object := range objects {
+		if _, ok := parseCompactedFileName(getUploaderFromObjectKey(object.Key)); ok {
+			if object.Key == latest {
+				filtered = append(filtered, object)
+			}
+			continue
+		}
+
+		// files updated after the compaction have entries which are not in the compacted file.
+		if object.ModifiedAt.After(latestModifiedAt) {
+			filtered = append(filtered, object)
+		}
+	}
+
+	return filtered
+}
+
+// compactorTable merges all the files of a table into a single one.
+type compactorTable struct {
+	ctx              context.Context
+	name             string
+	workingDirectory string
+	storageClient    chunk.ObjectClient
+	processors       []indexProcessor
+}
+
+func newCompactorTable(ctx context.Context, name, workingDirectory string, storageClient chunk.ObjectClient, processors []indexProcessor) *compactorTable {
+	return &compactorTable{
+		ctx:              ctx,
+		name:             name,
+		workingDirectory: path.Join(workingDirectory, name),
+		storageClient:    storageClient,
+		processors:       processors,
+	}
+}
+
+// compact downloads all the files of the table, merges them into a new file which gets uploaded and then removes the merged files from the store.
+// Files modified while being compacted are not removed, they would be compacted in the next run.
+// When the retention or deletion is enabled, tables with a single file are also processed to remove chunks.
+func (t *compactorTable) compact() error {
+	objects, _, err := t.storageClient.List(t.ctx, t.name+"/")
+	if err != nil {
+		return err
+	}
+
+	if len(objects) == 0 || (len(objects) == 1 && len(t.processors) == 0) {
+		level.Debug(util.Logger).Log("msg", "not compacting table with less than 2 files", "table", t.name)
+		return nil
+	}
+
+	level.Info(util.Logger).Log("msg", "compacting table", "table", t.name, "files", len(objects))
+	startTime := time.Now()
+
+	if err := os.RemoveAll(t.workingDirectory); err != nil {
+		return err
+	}
+	if err := chunk_util.EnsureDirectory(t.workingDirectory); err != nil {
+		return err
+	}
+	defer func() {
+		if err := os.RemoveAll(t.workingDirectory); err != nil {
+			level.Error(util.Logger).Log("msg", "failed to cleanup working directory", "path", t.workingDirectory, "err", err)
+		}
+	}()
+
+	compactedFilePath := path.Join(t.workingDirectory, "compacted")
+	compactedDB, err := local.OpenBoltdbFile(compactedFilePath)
+	if err != nil {
+		return err
+	}
+
+	var sourcesModifiedAt time.Time
+	for i, object := range objects {
+		if object.ModifiedAt.After(sourcesModifiedAt) {
+			sourcesModifiedAt = object.ModifiedAt
+		}
+
+		if err := t.mergeObject(compactedDB, object, path.Join(t.workingDirectory, fmt.Sprintf("source-%d", i))); err != nil {
+			compactedDB.Close()
+			return err
+		}
+	}
+
+	modified := len(objects) > 1
+	for _, p := range t.processors {
+		processed, err := p.process(t.ctx, t.name, compactedDB)
+		if err != nil {
+			compactedDB.Close()
+			return err
+		}
+		modified = modified || processed
+	}
+
+	if err := compactedDB.Close(); err != nil {
+		return err
+	}
+
+	if !modified {
+		return nil
+	}
+
+	compactedKey := path.Join(t.name, compactedFileName(sourcesModifiedAt))
+	if err := t.upload(compactedKey, compactedFilePath); err != nil {
+		return err
+	}
+
+	if err := t.removeSources(objects, compactedKey); err != nil {
+		return err
+	}
+
+	level.Info(util.Logger).Log("msg", "finished compacting table", "table", t.name, "duration", time.Since(startTime))
+	return nil
+}
+
+func (t *compactorTable) mergeObject(compactedDB *bbolt.DB, object chunk.StorageObject, filePath string) error {
+	if err := getFileFromStorage(t.ctx, t.storageClient, object.Key, filePath); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := os.Remove(filePath); err != nil {
+			level.Error(util.Logger).Log("msg", "failed to remove downloaded file", "path", filePath, "err", err)
+		}
+	}()
+
+	db, err := local.OpenBoltdbFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			level.Error(util.Logger).Log("msg", "failed to close downloaded file", "path", filePath, "err", err)
+		}
+	}()
+
+	return mergeBoltdbFile(compactedDB, db)
+}
+
+// mergeBoltdbFile writes all the key/value pairs of the buckets of src to the buckets with the same name in dst.
+// Entries written by several ingesters have the same key and value, so they are deduped.
+func mergeBoltdbFile(dst, src *bbolt.DB) error {
+	return src.View(func(srcTx *bbolt.Tx) error {
+		return srcTx.ForEach(func(name []byte, srcBucket *bbolt.Bucket) error {
+			c := srcBucket.Cursor()
+			k, v := c.First()
+
+			for k != nil {
+				err := dst.Update(func(dstTx *bbolt.Tx) error {
+					b, err := dstTx.CreateBucketIfNotExists(name)
+					if err != nil {
+						return err
+					}
+
+					for n := 0; k != nil && n < mergeBatchSize; k, v = c.Next() {
+						// nested buckets are not used by the index.
+						if v == nil {
+							continue
+						}
+
+						if err := b.Put(k, v); err != nil {
+							return err
+						}
+						n++
+					}
+
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	})
+}
+
+func (t *compactorTable) upload(objectKey, filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := f.Close(); err != nil {
+			level.Error(util.Logger).Log("msg", "failed to close compacted file", "path", filePath, "err", err)
+		}
+	}()
+
+	return t.storageClient.PutObject(t.ctx, objectKey, f)
+}
+
+// removeSources deletes the files merged into the compacted file unless they were modified after being listed.
+func (t *compactorTable) removeSources(sources []chunk.StorageObject, compactedKey string) error {
+	objects, _, err := t.storageClient.List(t.ctx, t.name+"/")
+	if err != nil {
+		return err
+	}
+
+	modifiedAt := make(map[string]time.Time, len(objects))
+	for _, object := range objects {
+		modifiedAt[object.Key] = object.ModifiedAt
+	}
+
+	for _, source := range sources {
+		if source.Key == compactedKey {
+			continue
+		}
+
+		mtime, ok := modifiedAt[source.Key]
+		if !ok || !mtime.Equal(source.ModifiedAt) {
+			continue
+		}
+
+		if err := t.storageClient.DeleteObject(t.ctx, source.Key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/local"
+	"github.com/cortexproject/cortex/pkg/chunk/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactor_RunCompaction(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "compactor-test")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempDir))
+	}()
+
+	localStoreLocation := filepath.Join(tempDir, "local-store")
+	objectClient, err := local.NewFSObjectClient(local.FSConfig{Directory: localStoreLocation})
+	require.NoError(t, err)
+
+	// create boltdb files with overlapping records for table1 and a single file for table2.
+	createFile := func(table, uploader string, numRecords, start int) {
+		tableDir := filepath.Join(localStoreLocation, storageKeyPrefix, table)
+		require.NoError(t, util.EnsureDirectory(tableDir))
+
+		db, err := local.OpenBoltdbFile(filepath.Join(tableDir, uploader))
+		require.NoError(t, err)
+		addTestRecordsToBoltDBFile(t, db, numRecords, start)
+		require.NoError(t, db.Close())
+	}
+	createFile("table1", "ingester-1", 10, 0)
+	createFile("table1", "ingester-2", 10, 5)
+	createFile("table1", "ingester-3", 5, 15)
+	createFile("table2", "ingester-1", 10, 0)
+
+	compactor, err := NewCompactor(CompactorConfig{
+		WorkingDirectory:   filepath.Join(tempDir, "working-dir"),
+		SharedStoreType:    "filesystem",
+		CompactionInterval: time.Hour,
+	}, objectClient, nil, nil, nil, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	listFiles := func(table string) []string {
+		objects, _, err := compactor.objectClient.List(context.Background(), table+"/")
+		require.NoError(t, err)
+
+		var files []string
+		for _, object := range objects {
+			files = append(files, getUploaderFromObjectKey(object.Key))
+		}
+		return files
+	}
+
+	require.NoError(t, compactor.RunCompaction(context.Background()))
+
+	files := listFiles("table1")
+	require.Len(t, files, 1)
+	_, ok := parseCompactedFileName(files[0])
+	require.True(t, ok)
+	checkExpectedKVsInBoltdbResp(t, readAllKVsFromBoltdbFileAtPath(t, filepath.Join(localStoreLocation, storageKeyPrefix, "table1", files[0])), 20, 0)
+
+	// tables with a single file are left untouched.
+	require.Equal(t, []string{"ingester-1"}, listFiles("table2"))
+
+	// a new file uploaded after the compaction gets merged with the compacted one.
+	createFile("table1", "ingester-4", 5, 20)
+	require.NoError(t, compactor.RunCompaction(context.Background()))
+
+	newFiles := listFiles("table1")
+	require.Len(t, newFiles, 1)
+	require.NotEqual(t, files[0], newFiles[0])
+	checkExpectedKVsInBoltdbResp(t, readAllKVsFromBoltdbFileAtPath(t, filepath.Join(localStoreLocation, storageKeyPrefix, "table1", newFiles[0])), 25, 0)
+}
+
+func TestFilterCompactedObjects(t *testing.T) {
+	compactedAt := time.Unix(100, 0)
+	compacted := compactedFileName(compactedAt)
+
+	for _, tc := range []struct {
+		name     string
+		objects  []chunk.StorageObject
+		expected []string
+	}{
+		{
+			name: "no compacted file",
+			objects: []chunk.StorageObject{
+				{Key: "table/ingester-1", ModifiedAt: time.Unix(10, 0)},
+				{Key: "table/ingester-2", ModifiedAt: time.Unix(20, 0)},
+			},
+			expected: []string{"table/ingester-1", "table/ingester-2"},
+		},
+		{
+			name: "files merged into the compacted file are dropped",
+			objects: []chunk.StorageObject{
+				{Key: "table/ingester-1", ModifiedAt: time.Unix(10, 0)},
+				{Key: "table/ingester-2", ModifiedAt: compactedAt},
+				{Key: "table/ingester-3", ModifiedAt: time.Unix(200, 0)},
+				{Key: "table/" + compacted, ModifiedAt: time.Unix(150, 0)},
+			},
+			expected: []string{"table/ingester-3", "table/" + compacted},
+		},
+		{
+			name: "only the latest compacted file is kept",
+			objects: []chunk.StorageObject{
+				{Key: "table/" + compactedFileName(time.Unix(50, 0)), ModifiedAt: time.Unix(60, 0)},
+				{Key: "table/" + compacted, ModifiedAt: time.Unix(150, 0)},
+			},
+			expected: []string{"table/" + compacted},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var keys []string
+			for _, object := range filterCompactedObjects(tc.objects) {
+				keys = append(keys, object.Key)
+			}
+			require.Equal(t, tc.expected, keys)
+		})
+	}
+}
@@ -25,11 +25,12 @@ func (fc *FilesCollection) checkStorageForUpdates(ctx context.Context) (toDownlo
 		return
 	}
 
+	objects = filterCompactedObjects(objects)
 	listedUploaders := make(map[string]struct{}, len(objects))
 
 	fc.mtx.RLock()
 	for _, object := range objects {
-		uploader := strings.Split(object.Key, "/")[1]
+		uploader := getUploaderFromObjectKey(object.Key)
 		listedUploaders[uploader] = struct{}{}
 
 		// Checking whether file was updated in the store after we downloaded it, if not, no need to include it in updates
@@ -88,7 +89,7 @@ func (fc *FilesCollection) downloadFile(ctx context.Context, storageObject chunk
 	// download the file temporarily with some other name to allow boltdb client to close the existing file first if it exists
 	tempFilePath := path.Join(folderPath, fmt.Sprintf("%s.%s", uploader, "temp"))
 
-	err := fc.getFileFromStorage(ctx, storageObject.Key, tempFilePath)
+	err := getFileFromStorage(ctx, fc.storageClient, storageObject.Key, tempFilePath)
 	if err != nil {
 		return err
 	}
@@ -123,8 +124,8 @@ func (fc *FilesCollection) downloadFile(ctx context.Context, storageObject chunk
 }
 
 // getFileFromStorage downloads a file from storage to given location.
-func (fc *FilesCollection) getFileFromStorage(ctx context.Context, objectKey, destination string) error {
-	readCloser, err := fc.storageClient.GetObject(ctx, objectKey)
+func getFileFromStorage(ctx context.Context, storageClient chunk.ObjectClient, objectKey, destination string) error {
+	readCloser, err := storageClient.GetObject(ctx, objectKey)
 	if err != nil {
 		return err
 	}
@@ -140,6 +141,12 @@ func (fc *FilesCollection) getFileFromStorage(ctx context.Context, objectKey, de
 		return err
 	}
 
+	defer func() {
+		if err := f.Close(); err != nil {
+			level.Warn(util.Logger).Log("msg", "failed to close file", "file", destination)
+		}
+	}()
+
 	_, err = io.Copy(f, readCloser)
 	if err != nil {
 		return err
@@ -177,6 +184,8 @@ func (fc *FilesCollection) downloadAllFilesForPeriod(ctx context.Context) (err e
 		return
 	}
 
+	objects = filterCompactedObjects(objects)
+
 	level.Debug(util.Logger).Log("msg", fmt.Sprintf("list of files to download for period %s: %s", fc.period, objects))
 
 	folderPath, err := fc.getFolderPathForPeriod(true)
@@ -190,7 +199,7 @@ func (fc *FilesCollection) downloadAllFilesForPeriod(ctx context.Context) (err e
 		filePath := path.Join(folderPath, uploader)
 		df := downloadedFile{}
 
-		err = fc.getFileFromStorage(ctx, object.Key, filePath)
+		err = getFileFromStorage(ctx, fc.storageClient, object.Key, filePath)
 		if err != nil {
 			return
 		}
@@ -0,0 +1,117 @@
+package local
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/local"
+	chunk_util "github.com/cortexproject/cortex/pkg/chunk/util"
+)
+
+// tempFilePrefix is the prefix of the files objects are written to before being renamed to their key.
+const tempFilePrefix = ".tmp-"
+
+// FSObjectClient is a filesystem object store meant to be used as the shared store of boltdb-shipper.
+// Objects are written to a temporary file which is synced and then renamed to the object key so that concurrent
+// readers, like queriers downloading index files while an ingester uploads them, never see a partially written object.
+type FSObjectClient struct {
+	*local.FSObjectClient
+	directory string
+}
+
+// NewFSObjectClient makes a chunk.ObjectClient storing objects as files in the configured directory.
+func NewFSObjectClient(cfg local.FSConfig) (*FSObjectClient, error) {
+	client, err := local.NewFSObjectClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FSObjectClient{
+		FSObjectClient: client,
+		directory:      filepath.Clean(cfg.Directory),
+	}, nil
+}
+
+// PutObject atomically writes the object to the store.
+func (f *FSObjectClient) PutObject(ctx context.Context, objectKey string, object io.ReadSeeker) error {
+	fullPath := filepath.Join(f.directory, objectKey)
+	dir := filepath.Dir(fullPath)
+	if err := chunk_util.EnsureDirectory(dir); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, tempFilePrefix+filepath.Base(fullPath))
+	if err != nil {
+		return err
+	}
+
+	if err := writeAndSync(tmp, object); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), fullPath); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	// sync the directory to persist the rename.
+	return syncDir(dir)
+}
+
+// List objects and common-prefixes i.e directories from the store non-recursively, ignoring objects being written.
+func (f *FSObjectClient) List(ctx context.Context, prefix string) ([]chunk.StorageObject, []chunk.StorageCommonPrefix, error) {
+	objects, commonPrefixes, err := f.FSObjectClient.List(ctx, prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filtered := objects[:0]
+	for _, object := range objects {
+		if strings.HasPrefix(filepath.Base(object.Key), tempFilePrefix) {
+			continue
+		}
+		filtered = append(filtered, object)
+	}
+
+	return filtered, commonPrefixes, nil
+}
+
+func writeAndSync(f *os.File, r io.Reader) error {
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	// ioutil.TempFile creates files readable only by their owner.
+	if err := f.Chmod(0644); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	if err := d.Sync(); err != nil {
+		_ = d.Close()
+		return err
+	}
+
+	return d.Close()
+}
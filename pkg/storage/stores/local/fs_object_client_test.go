@@ -0,0 +1,82 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/cortexproject/cortex/pkg/chunk/local"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFSObjectClient(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "fs-object-client")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	client, err := NewFSObjectClient(local.FSConfig{Directory: tempDir})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, client.PutObject(ctx, "index/table/file", bytes.NewReader([]byte("first"))))
+	require.NoError(t, client.PutObject(ctx, "index/table/file", bytes.NewReader([]byte("second"))))
+
+	// temporary files are not listed.
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, "index", "table", tempFilePrefix+"other"), []byte("partial"), 0644))
+	objects, _, err := client.List(ctx, "index/table")
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	require.Equal(t, "index/table/file", objects[0].Key)
+
+	readCloser, err := client.GetObject(ctx, "index/table/file")
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(readCloser)
+	require.NoError(t, err)
+	require.NoError(t, readCloser.Close())
+	require.Equal(t, "second", string(b))
+
+	fi, err := os.Stat(filepath.Join(tempDir, "index", "table", "file"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0644), fi.Mode().Perm())
+}
+
+func TestFSObjectClient_ConcurrentReads(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "fs-object-client")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	client, err := NewFSObjectClient(local.FSConfig{Directory: tempDir})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	objects := [][]byte{bytes.Repeat([]byte("a"), 1<<20), bytes.Repeat([]byte("b"), 1<<20)}
+	require.NoError(t, client.PutObject(ctx, "file", bytes.NewReader(objects[0])))
+
+	var (
+		wg     sync.WaitGroup
+		putErr error
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20 && putErr == nil; i++ {
+			putErr = client.PutObject(ctx, "file", bytes.NewReader(objects[i%2]))
+		}
+	}()
+
+	// readers always see a complete object.
+	for i := 0; i < 20; i++ {
+		readCloser, err := client.GetObject(ctx, "file")
+		require.NoError(t, err)
+		b, err := ioutil.ReadAll(readCloser)
+		require.NoError(t, err)
+		require.NoError(t, readCloser.Close())
+		require.True(t, bytes.Equal(objects[0], b) || bytes.Equal(objects[1], b))
+	}
+	wg.Wait()
+	require.NoError(t, putErr)
+}
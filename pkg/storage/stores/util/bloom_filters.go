@@ -0,0 +1,11 @@
+package util
+
+import (
+	"encoding/base64"
+)
+
+// BloomFiltersKey returns the object key of the bloom filters stored next to the chunk with the given external key.
+// The external key is encoded as it holds characters some object stores don't allow.
+func BloomFiltersKey(userID, chunkKey string) string {
+	return "blooms/" + userID + "/" + base64.RawURLEncoding.EncodeToString([]byte(chunkKey))
+}
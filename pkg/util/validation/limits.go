@@ -2,8 +2,12 @@ package validation
 
 import (
 	"flag"
+	"fmt"
 	"time"
 
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/grafana/loki/pkg/logql"
 	"github.com/grafana/loki/pkg/util/flagext"
 )
 
@@ -37,6 +41,8 @@ type Limits struct {
 	MaxLocalStreamsPerUser  int `yaml:"max_streams_per_user"`
 	MaxGlobalStreamsPerUser int `yaml:"max_global_streams_per_user"`
 
+	OutOfOrderWindow time.Duration `yaml:"out_of_order_window"`
+
 	// Querier enforced limits.
 	MaxChunksPerQuery          int           `yaml:"max_chunks_per_query"`
 	MaxQueryLength             time.Duration `yaml:"max_query_length"`
@@ -50,6 +56,13 @@ type Limits struct {
 	// Query frontend enforced limits. The default is actually parameterized by the queryrange config.
 	QuerySplitDuration time.Duration `yaml:"split_queries_by_interval"`
 
+	// Ruler enforced limits.
+	RulerRemoteWriteExternalLabels map[string]string `yaml:"ruler_remote_write_external_labels"`
+
+	// Compactor enforced limits.
+	RetentionPeriod time.Duration     `yaml:"retention_period"`
+	StreamRetention []StreamRetention `yaml:"retention_stream"`
+
 	// Config for overrides, convenient if it goes here.
 	PerTenantOverrideConfig string        `yaml:"per_tenant_override_config"`
 	PerTenantOverridePeriod time.Duration `yaml:"per_tenant_override_period"`
@@ -72,6 +85,7 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 
 	f.IntVar(&l.MaxLocalStreamsPerUser, "ingester.max-streams-per-user", 10e3, "Maximum number of active streams per user, per ingester. 0 to disable.")
 	f.IntVar(&l.MaxGlobalStreamsPerUser, "ingester.max-global-streams-per-user", 0, "Maximum number of active streams per user, across the cluster. 0 to disable.")
+	f.DurationVar(&l.OutOfOrderWindow, "ingester.out-of-order-window", 0, "How far behind the newest entry of a stream an entry can be and still be accepted. 0 to reject out of order entries.")
 
 	f.IntVar(&l.MaxChunksPerQuery, "store.query-chunk-limit", 2e6, "Maximum number of chunks that can be fetched in a single query.")
 	f.DurationVar(&l.MaxQueryLength, "store.max-query-length", 0, "Limit to length of chunk store queries, 0 to disable.")
@@ -81,6 +95,8 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&l.MaxConcurrentTailRequests, "querier.max-concurrent-tail-requests", 10, "Limit the number of concurrent tail requests")
 	f.DurationVar(&l.MaxCacheFreshness, "frontend.max-cache-freshness", 1*time.Minute, "Most recent allowed cacheable result per-tenant, to prevent caching very recent results that might still be in flux.")
 
+	f.DurationVar(&l.RetentionPeriod, "store.retention", 0, "How long chunks are kept before being deleted by the compactor. 0 to disable.")
+
 	f.StringVar(&l.PerTenantOverrideConfig, "limits.per-user-override-config", "", "File name of per-user overrides.")
 	f.DurationVar(&l.PerTenantOverridePeriod, "limits.per-user-override-period", 10*time.Second, "Period with this to reload the overrides.")
 }
@@ -96,7 +112,39 @@ func (l *Limits) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		*l = *defaultLimits
 	}
 	type plain Limits
-	return unmarshal((*plain)(l))
+	if err := unmarshal((*plain)(l)); err != nil {
+		return err
+	}
+
+	for i := range l.StreamRetention {
+		if err := l.StreamRetention[i].parse(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StreamRetention is the retention of the streams matching a selector.
+// It takes precedence over the retention period of the tenant.
+type StreamRetention struct {
+	Period   time.Duration `yaml:"period"`
+	Priority int           `yaml:"priority"`
+	Selector string        `yaml:"selector"`
+
+	Matchers []*labels.Matcher `yaml:"-"`
+}
+
+func (r *StreamRetention) parse() error {
+	if r.Period <= 0 {
+		return fmt.Errorf("retention period of streams matching %s must be greater than 0", r.Selector)
+	}
+
+	matchers, err := logql.ParseMatchers(r.Selector)
+	if err != nil {
+		return fmt.Errorf("invalid retention stream selector %s: %w", r.Selector, err)
+	}
+	r.Matchers = matchers
+	return nil
 }
 
 // When we load YAML from disk, we want the various per-customer limits
@@ -194,6 +242,11 @@ func (o *Overrides) MaxGlobalStreamsPerUser(userID string) int {
 	return o.getOverridesForUser(userID).MaxGlobalStreamsPerUser
 }
 
+// OutOfOrderWindow returns how far behind the newest entry of a stream an entry is accepted.
+func (o *Overrides) OutOfOrderWindow(userID string) time.Duration {
+	return o.getOverridesForUser(userID).OutOfOrderWindow
+}
+
 // MaxChunksPerQuery returns the maximum number of chunks allowed per query.
 func (o *Overrides) MaxChunksPerQuery(userID string) int {
 	return o.getOverridesForUser(userID).MaxChunksPerQuery
@@ -249,6 +302,21 @@ func (o *Overrides) MaxCacheFreshness(userID string) time.Duration {
 	return o.getOverridesForUser(userID).MaxCacheFreshness
 }
 
+// RulerRemoteWriteExternalLabels returns the labels added to the series remote-written by the ruler.
+func (o *Overrides) RulerRemoteWriteExternalLabels(userID string) map[string]string {
+	return o.getOverridesForUser(userID).RulerRemoteWriteExternalLabels
+}
+
+// RetentionPeriod returns how long the chunks of a tenant are kept, 0 means forever.
+func (o *Overrides) RetentionPeriod(userID string) time.Duration {
+	return o.getOverridesForUser(userID).RetentionPeriod
+}
+
+// StreamRetention returns the retention of the streams of a tenant matching a selector.
+func (o *Overrides) StreamRetention(userID string) []StreamRetention {
+	return o.getOverridesForUser(userID).StreamRetention
+}
+
 func (o *Overrides) getOverridesForUser(userID string) *Limits {
 	if o.tenantLimits != nil {
 		l := o.tenantLimits(userID)